@@ -0,0 +1,165 @@
+package recordio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// NewAppendWriter creates a Writer that appends chunks to the existing
+// recordio file f, whose arguments are those of NewWriter.  It checks
+// that the file ends with a complete chunk, or with a footer index,
+// which is then truncated, if f has a Truncate method like *os.File,
+// or overwritten by the new chunks, and written again, with the new
+// chunks added, on Close.  Files with a truncated chunk or trailing
+// garbage are rejected.  The dictionary of WithDictionary must be that
+// of the file, if any, and is otherwise taken from the file.  As the
+// file header is already written, the metadata of WithMetadata is
+// stored in the footer index, which the file must have, and the schema
+// of WithSchema must be that of the file.  The keys of a file with a
+// KeyIndex keep being indexed; WithKeyIndex on a file without one
+// indexes the keys of the file, reading all its records.  Records
+// appended to a file written with WithSortedKeys must follow its keys
+// in order, and those appended to a file with Bloom filters get
+// filters too.  The FileStats of WithStats cover the whole file.
+func NewAppendWriter(f io.ReadWriteSeeker, maxChunkSize, compressor int, opts ...Option) (*Writer, error) {
+	idx, end, e := readFooter(f)
+	footer := e == nil
+	if e == ErrNoFooter {
+		if _, e = f.Seek(0, io.SeekStart); e != nil {
+			return nil, e
+		}
+		if idx, e = LoadIndex(f); e != nil {
+			return nil, e
+		}
+		if end, e = f.Seek(0, io.SeekEnd); e != nil {
+			return nil, e
+		}
+	}
+	if e != nil {
+		return nil, e
+	}
+
+	if _, e = f.Seek(0, io.SeekStart); e != nil {
+		return nil, e
+	}
+	fh, e := readFileHeader(f)
+	if e != nil {
+		return nil, e
+	}
+
+	// Check that the last chunk ends where the new data goes.
+	last, e := f.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return nil, e
+	}
+	if n := idx.NumChunks(); n > 0 {
+		if _, e = f.Seek(idx.ChunkOffsets[n-1], io.SeekStart); e != nil {
+			return nil, e
+		}
+
+		hdr, e := parseHeader(f)
+		if e != nil {
+			return nil, fmt.Errorf("Failed to parse the last chunk header: %v", e)
+		}
+		last = idx.ChunkOffsets[n-1] + hdr.size() + int64(hdr.compressedSize)
+	}
+
+	if last != end {
+		return nil, fmt.Errorf("Cannot append to a file whose last chunk ends at %d but data ends at %d", last, end)
+	}
+
+	if _, e = f.Seek(end, io.SeekStart); e != nil {
+		return nil, e
+	}
+
+	if wrapped := fh.get(wrappedKeyKey); wrapped != nil {
+		opts = append(opts[:len(opts):len(opts)], withWrappedKey(wrapped))
+	}
+	w := NewWriter(f, maxChunkSize, compressor, opts...)
+	if end > 0 {
+		if w.kms != nil && fh.get(wrappedKeyKey) == nil {
+			return nil, fmt.Errorf("Cannot append with a KMS to a file without a wrapped data key")
+		}
+
+		if fh == nil && w.dict != nil {
+			return nil, fmt.Errorf("Cannot add a dictionary to a file without one")
+		}
+
+		if d := fh.get(dictionaryKey); d != nil && w.compressor == Zstd {
+			if w.dict != nil && !bytes.Equal(w.dict, d) {
+				return nil, fmt.Errorf("Cannot append with a dictionary other than that of the file")
+			}
+			w.dict = d
+		}
+		if w.schema != nil {
+			if e := fh.checkSchema(w.schema); e != nil {
+				return nil, e
+			}
+		}
+		w.header, w.headerDone = fh, true
+	}
+	w.offset = end
+	w.footerIndex = (w.footerIndex || footer) && !w.paddle
+	if end > 0 {
+		// The file header is written; WithMetadata goes to the footer.
+		for k, v := range w.metadata {
+			if !w.footerIndex {
+				return nil, fmt.Errorf("Cannot add metadata to a file without a footer index")
+			}
+			idx.setMetadata(k, v)
+		}
+	}
+	if w.keyIndex && idx.keys == nil && idx.NumRecords > 0 {
+		if idx.keys, e = BuildKeyIndex(f, idx); e != nil {
+			return nil, e
+		}
+		if _, e = f.Seek(end, io.SeekStart); e != nil {
+			return nil, e
+		}
+	}
+	if idx.keys != nil && !w.paddle {
+		// Keep indexing keys, lest the footer lose the KeyIndex.
+		w.keyIndex, w.keys = true, append([]keyEntry(nil), idx.keys.entries...)
+	}
+	if idx.keyRanges != nil && !w.paddle {
+		// Keep the records sorted, lest the footer lose the key
+		// ranges.
+		w.sortedKeys, w.ranges = true, append([]keyRange(nil), idx.keyRanges...)
+	} else if w.sortedKeys && idx.NumRecords > 0 {
+		return nil, fmt.Errorf("Cannot append sorted records to a file not sorted by key")
+	}
+	if idx.blooms != nil && !w.paddle {
+		if w.bloomBitsPerKey <= 0 {
+			WithBloomFilter(defaultBloomBitsPerKey, idx.blooms[len(idx.blooms)-1].hashes)(w)
+		}
+		w.blooms = append([]bloomFilter(nil), idx.blooms...)
+	} else if w.bloomBitsPerKey > 0 && idx.NumChunks() > 0 {
+		return nil, fmt.Errorf("Cannot add Bloom filters to a file without them")
+	}
+	if w.collectStats && idx.stats == nil && idx.NumChunks() > 0 {
+		if idx.stats, e = computeStats(f, idx); e != nil {
+			return nil, e
+		}
+		if _, e = f.Seek(end, io.SeekStart); e != nil {
+			return nil, e
+		}
+	}
+	if idx.stats != nil && !w.paddle {
+		w.collectStats, w.stats = true, idx.stats.clone()
+	}
+
+	if footer {
+		// Drop the old footer, lest it stay after the new chunks of
+		// a Writer without a footer, or of a crash before Close.
+		if t, ok := f.(interface{ Truncate(int64) error }); ok {
+			if e = t.Truncate(end); e != nil {
+				return nil, fmt.Errorf("Failed to truncate the footer: %v", e)
+			}
+		} else if !w.footerIndex {
+			return nil, fmt.Errorf("Cannot append without a footer index to a file with one")
+		}
+	}
+	w.index = idx
+	return w, nil
+}
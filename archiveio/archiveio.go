@@ -0,0 +1,177 @@
+// Package archiveio packs the records of recordio files as the entries
+// of tar and zip archives, one file per record, and builds recordio
+// files from archives, so that datasets are unpacked and repacked with
+// standard tools:
+//
+//	n, err := archiveio.WriteTar(w, s, nil)
+//	...
+//	$ tar xf dataset.tar
+//	$ ls
+//	000000000 000000001 000000002 ...
+package archiveio
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+// A NameFunc names the entry of the record of the given index in the
+// scan.  Names are slash-separated paths, valid by fs.ValidPath, like
+// "images/cat.jpg"; they must be unique within an archive.
+type NameFunc func(index int, record []byte) string
+
+// IndexName names entries by the index of their records, zero padded to
+// nine digits, so that they sort in the order of the records.  It is
+// the NameFunc of nil.
+func IndexName(index int, record []byte) string {
+	return fmt.Sprintf("%09d", index)
+}
+
+// WriteTar writes the records of s into w as a tar archive of regular
+// files named by name, returning their number.
+func WriteTar(w io.Writer, s recordio.RecordScanner, name NameFunc) (int, error) {
+	tw := tar.NewWriter(w)
+	now := time.Now().Truncate(time.Second)
+	n, e := writeEntries(s, name, func(name string, record []byte) error {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(record)),
+			ModTime:  now,
+		}
+		if e := tw.WriteHeader(hdr); e != nil {
+			return e
+		}
+		_, e := tw.Write(record)
+		return e
+	})
+	if e != nil {
+		return n, e
+	}
+	if e = tw.Close(); e != nil {
+		return n, fmt.Errorf("Failed to write tar: %v", e)
+	}
+	return n, nil
+}
+
+// WriteZip writes the records of s into w as a zip archive of files
+// named by name and compressed by method, like zip.Store for records
+// already compressed or zip.Deflate, returning their number.
+func WriteZip(w io.Writer, s recordio.RecordScanner, name NameFunc, method uint16) (int, error) {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	n, e := writeEntries(s, name, func(name string, record []byte) error {
+		fw, e := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: now})
+		if e != nil {
+			return e
+		}
+		_, e = fw.Write(record)
+		return e
+	})
+	if e != nil {
+		return n, e
+	}
+	if e = zw.Close(); e != nil {
+		return n, fmt.Errorf("Failed to write zip: %v", e)
+	}
+	return n, nil
+}
+
+func writeEntries(s recordio.RecordScanner, name NameFunc, write func(name string, record []byte) error) (int, error) {
+	if name == nil {
+		name = IndexName
+	}
+
+	names := make(map[string]bool)
+	n := 0
+	for s.Scan() {
+		record := s.Record()
+		entry := name(n, record)
+		if !fs.ValidPath(entry) || entry == "." {
+			return n, fmt.Errorf("Invalid entry name of record %d: %q", n, entry)
+		}
+		if names[entry] {
+			return n, fmt.Errorf("Duplicate entry name of record %d: %q", n, entry)
+		}
+		names[entry] = true
+
+		if e := write(entry, record); e != nil {
+			return n, fmt.Errorf("Failed to write entry %q: %v", entry, e)
+		}
+		n++
+	}
+	return n, s.Err()
+}
+
+// ReadTar writes the regular files of the tar archive r into w as
+// records, in the order of the archive, returning their number.  Other
+// entries, like directories, are skipped.  w is not closed.
+func ReadTar(w *recordio.Writer, r io.Reader) (int, error) {
+	tr := tar.NewReader(r)
+	n := 0
+	for {
+		hdr, e := tr.Next()
+		if e == io.EOF {
+			return n, nil
+		}
+		if e != nil {
+			return n, fmt.Errorf("Failed to read tar: %v", e)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		record, e := io.ReadAll(tr)
+		if e != nil {
+			return n, fmt.Errorf("Failed to read entry %q: %v", hdr.Name, e)
+		}
+		if _, e = w.Write(record); e != nil {
+			return n, e
+		}
+		n++
+	}
+}
+
+// ReadZip writes the files of the zip archive r of the given size into
+// w as records, in the order of the archive, returning their number.
+// Directories are skipped.  w is not closed.
+func ReadZip(w *recordio.Writer, r io.ReaderAt, size int64) (int, error) {
+	zr, e := zip.NewReader(r, size)
+	if e != nil {
+		return 0, fmt.Errorf("Failed to read zip: %v", e)
+	}
+
+	n := 0
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+
+		record, e := readZipFile(f)
+		if e != nil {
+			return n, fmt.Errorf("Failed to read entry %q: %v", f.Name, e)
+		}
+		if _, e = w.Write(record); e != nil {
+			return n, e
+		}
+		n++
+	}
+	return n, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, e := f.Open()
+	if e != nil {
+		return nil, e
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,110 @@
+package archiveio_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/archiveio"
+)
+
+func dataset(n int) []byte {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(10))
+	for i := 0; i < n; i++ {
+		w.Write([]byte(fmt.Sprintf("label%d:record %d", i%3, i)))
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func scanner(data []byte) recordio.RecordScanner {
+	return recordio.NewStreamScanner(bytes.NewReader(data))
+}
+
+func records(t *testing.T, data []byte) []string {
+	var records []string
+	s := scanner(data)
+	for s.Scan() {
+		records = append(records, string(s.Record()))
+	}
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+	return records
+}
+
+func TestTar(t *testing.T) {
+	data := dataset(25)
+
+	var archive bytes.Buffer
+	if n, err := archiveio.WriteTar(&archive, scanner(data), nil); err != nil || n != 25 {
+		t.Fatal("unexpected tar:", n, err)
+	}
+
+	tr := tar.NewReader(bytes.NewReader(archive.Bytes()))
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		b, _ := io.ReadAll(tr)
+		if err != nil || hdr.Name != fmt.Sprintf("%09d", i) || string(b) != fmt.Sprintf("label%d:record %d", i%3, i) {
+			t.Fatal("unexpected entry:", i, hdr.Name, err)
+		}
+	}
+
+	var out bytes.Buffer
+	w := recordio.NewWriter(&out, -1, recordio.NoCompression)
+	if n, err := archiveio.ReadTar(w, bytes.NewReader(archive.Bytes())); err != nil || n != 25 {
+		t.Fatal("unexpected records:", n, err)
+	}
+	w.Close()
+	if fmt.Sprint(records(t, out.Bytes())) != fmt.Sprint(records(t, data)) {
+		t.Fatal("expected the records back")
+	}
+}
+
+func TestZip(t *testing.T) {
+	data := dataset(25)
+	byLabel := func(index int, record []byte) string {
+		label, _, _ := bytes.Cut(record, []byte(":"))
+		return fmt.Sprintf("%s/%d.txt", label, index)
+	}
+
+	var archive bytes.Buffer
+	if n, err := archiveio.WriteZip(&archive, scanner(data), byLabel, zip.Deflate); err != nil || n != 25 {
+		t.Fatal("unexpected zip:", n, err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil || len(zr.File) != 25 || zr.File[4].Name != "label1/4.txt" || zr.File[4].Method != zip.Deflate {
+		t.Fatal("unexpected archive:", err)
+	}
+
+	var out bytes.Buffer
+	w := recordio.NewWriter(&out, -1, recordio.NoCompression)
+	if n, err := archiveio.ReadZip(w, bytes.NewReader(archive.Bytes()), int64(archive.Len())); err != nil || n != 25 {
+		t.Fatal("unexpected records:", n, err)
+	}
+	w.Close()
+	if fmt.Sprint(records(t, out.Bytes())) != fmt.Sprint(records(t, data)) {
+		t.Fatal("expected the records back")
+	}
+
+	byLabelOnly := func(index int, record []byte) string {
+		label, _, _ := bytes.Cut(record, []byte(":"))
+		return string(label)
+	}
+	if _, err := archiveio.WriteZip(io.Discard, scanner(data), byLabelOnly, zip.Store); err == nil {
+		t.Fatal("expected an error of duplicate names")
+	}
+	escaping := func(index int, record []byte) string { return "../x" }
+	if _, err := archiveio.WriteTar(io.Discard, scanner(data), escaping); err == nil {
+		t.Fatal("expected an error of an invalid name")
+	}
+}
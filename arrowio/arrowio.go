@@ -0,0 +1,158 @@
+// Package arrowio exports the records of recordio files as Apache Arrow
+// IPC streams, so that Arrow-based engines take them over without
+// parsing: records are batched into RecordBatches of a binary column
+// "record", optionally with an int64 column "index" of their index in
+// the scan and a binary column "key".
+package arrowio
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+const defaultBatchSize = 1024
+
+// Column names.
+const (
+	RecordColumn = "record"
+	IndexColumn  = "index"
+	KeyColumn    = "key"
+)
+
+type options struct {
+	batchSize int
+	index     bool
+	key       func(record []byte) []byte
+}
+
+// An Option configures Export.
+type Option func(*options)
+
+// WithBatchSize sets the number of rows of RecordBatches; <= 0 means
+// the default of 1024.
+func WithBatchSize(n int) Option {
+	return func(o *options) {
+		o.batchSize = n
+	}
+}
+
+// WithIndex adds the index column.
+func WithIndex() Option {
+	return func(o *options) {
+		o.index = true
+	}
+}
+
+// WithKey adds the key column, whose values key extracts from records;
+// a nil key is a null.
+func WithKey(key func(record []byte) []byte) Option {
+	return func(o *options) {
+		o.key = key
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.batchSize <= 0 {
+		o.batchSize = defaultBatchSize
+	}
+	return o
+}
+
+// Schema returns the schema of the streams written by Export with opts.
+func Schema(opts ...Option) *arrow.Schema {
+	return newOptions(opts).schema()
+}
+
+func (o *options) schema() *arrow.Schema {
+	var fields []arrow.Field
+	if o.index {
+		fields = append(fields, arrow.Field{Name: IndexColumn, Type: arrow.PrimitiveTypes.Int64})
+	}
+	if o.key != nil {
+		fields = append(fields, arrow.Field{Name: KeyColumn, Type: arrow.BinaryTypes.Binary, Nullable: true})
+	}
+	fields = append(fields, arrow.Field{Name: RecordColumn, Type: arrow.BinaryTypes.Binary})
+	return arrow.NewSchema(fields, nil)
+}
+
+// Export writes the records of s into w as an Arrow IPC stream,
+// returning their number.
+func Export(w io.Writer, s recordio.RecordScanner, opts ...Option) (int, error) {
+	o := newOptions(opts)
+	schema := o.schema()
+
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	iw := ipc.NewWriter(w, ipc.WithSchema(schema))
+
+	var index *array.Int64Builder
+	var key *array.BinaryBuilder
+	field := 0
+	if o.index {
+		index = b.Field(field).(*array.Int64Builder)
+		field++
+	}
+	if o.key != nil {
+		key = b.Field(field).(*array.BinaryBuilder)
+		field++
+	}
+	records := b.Field(field).(*array.BinaryBuilder)
+
+	rows := 0
+	flush := func() error {
+		batch := b.NewRecordBatch()
+		defer batch.Release()
+		if e := iw.Write(batch); e != nil {
+			return fmt.Errorf("Failed to write record batch: %v", e)
+		}
+		rows = 0
+		return nil
+	}
+
+	n := 0
+	for s.Scan() {
+		record := s.Record()
+		if index != nil {
+			index.Append(int64(n))
+		}
+		if key != nil {
+			if k := o.key(record); k != nil {
+				key.Append(k)
+			} else {
+				key.AppendNull()
+			}
+		}
+		records.Append(record)
+		n++
+
+		if rows++; rows == o.batchSize {
+			if e := flush(); e != nil {
+				return n, e
+			}
+		}
+	}
+	if e := s.Err(); e != nil {
+		return n, e
+	}
+
+	if rows > 0 {
+		if e := flush(); e != nil {
+			return n, e
+		}
+	}
+	if e := iw.Close(); e != nil {
+		return n, fmt.Errorf("Failed to close Arrow stream: %v", e)
+	}
+	return n, nil
+}
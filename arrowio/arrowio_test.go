@@ -0,0 +1,77 @@
+package arrowio_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/arrowio"
+)
+
+func TestExport(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(100))
+	for i := 0; i < 2500; i++ {
+		w.Write([]byte(fmt.Sprintf("user%d:record %d", i%10, i)))
+	}
+	w.Close()
+
+	key := func(record []byte) []byte {
+		if k, _, ok := bytes.Cut(record, []byte(":")); ok && !bytes.Equal(k, []byte("user0")) {
+			return k
+		}
+		return nil
+	}
+
+	var out bytes.Buffer
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), w.Index(), 0, -1)
+	n, err := arrowio.Export(&out, s, arrowio.WithBatchSize(1000), arrowio.WithIndex(), arrowio.WithKey(key))
+	if err != nil || n != 2500 {
+		t.Fatal("unexpected export:", n, err)
+	}
+
+	r, err := ipc.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Release()
+	if !r.Schema().Equal(arrowio.Schema(arrowio.WithIndex(), arrowio.WithKey(key))) {
+		t.Fatal("unexpected schema:", r.Schema())
+	}
+
+	rows, batches := 0, 0
+	for r.Next() {
+		batch := r.RecordBatch()
+		index := batch.Column(0).(*array.Int64)
+		keys := batch.Column(1).(*array.Binary)
+		records := batch.Column(2).(*array.Binary)
+		for i := 0; i < int(batch.NumRows()); i++ {
+			if index.Value(i) != int64(rows) ||
+				string(records.Value(i)) != fmt.Sprintf("user%d:record %d", rows%10, rows) ||
+				keys.IsNull(i) != (rows%10 == 0) {
+				t.Fatal("unexpected row:", rows)
+			}
+			rows++
+		}
+		batches++
+	}
+	if r.Err() != nil || rows != 2500 || batches != 3 {
+		t.Fatal("unexpected stream:", r.Err(), rows, batches)
+	}
+
+	// Records alone.
+	out.Reset()
+	s = recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), w.Index(), 0, 10)
+	if _, err := arrowio.Export(&out, s); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = ipc.NewReader(bytes.NewReader(out.Bytes()))
+	if !r.Next() || r.RecordBatch().NumCols() != 1 || r.RecordBatch().NumRows() != 10 {
+		t.Fatal("unexpected stream of records alone")
+	}
+	r.Release()
+}
@@ -0,0 +1,81 @@
+package recordio
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// errAborted is passed to the onClose callback of a Writer by Abort.
+var errAborted = errors.New("recordio: writer aborted")
+
+// CreateAtomic creates a Writer of the recordio file path, so that the
+// file either appears complete or not at all.  Records are written to
+// a temporary file in the same directory, hidden from globs like
+// path*, which Close syncs and renames to path, syncing the directory
+// too.  The file has the permissions of os.Create.  If Close fails, or
+// Abort is called, the temporary file is removed instead.  The chunk
+// size and compressor default to those of NewWriter(f, -1, -1).
+func CreateAtomic(path string, opts ...Option) (*Writer, error) {
+	dir := filepath.Dir(path)
+	f, e := createTemp(dir, filepath.Base(path))
+	if e != nil {
+		return nil, fmt.Errorf("Failed to create temporary file: %v", e)
+	}
+
+	w := NewWriter(f, -1, -1, opts...)
+	w.onClose = func(e error) error {
+		if e == nil {
+			e = f.Sync()
+		}
+		if ce := f.Close(); e == nil {
+			e = ce
+		}
+		if e == nil {
+			e = os.Rename(f.Name(), path)
+		}
+		if e == nil {
+			return syncDir(dir)
+		}
+
+		os.Remove(f.Name())
+		if e == errAborted {
+			return nil
+		}
+		return e
+	}
+	return w, nil
+}
+
+// createTemp creates a new temporary file for the file name in dir,
+// like os.CreateTemp, but with the permissions of os.Create, 0666
+// before the umask, rather than 0600, as it is renamed to name.
+func createTemp(dir, name string) (*os.File, error) {
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, "."+name+".tmp"+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, e := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(e) && i < 10000 {
+			continue
+		}
+		return f, e
+	}
+}
+
+// syncDir syncs the directory dir, so that a rename in it is durable.
+func syncDir(dir string) error {
+	d, e := os.Open(dir)
+	if e != nil {
+		return fmt.Errorf("Failed to sync directory: %v", e)
+	}
+	e = d.Sync()
+	if ce := d.Close(); e == nil {
+		e = ce
+	}
+	if e != nil {
+		return fmt.Errorf("Failed to sync directory: %v", e)
+	}
+	return nil
+}
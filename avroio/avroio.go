@@ -0,0 +1,495 @@
+// Package avroio reads and writes Avro Object Container Files, so that
+// Avro datasets are scanned like recordio files, and converts them from
+// and to recordio files.
+//
+// Records are Avro datums in binary encoding, as they are in the blocks
+// of a container file.  The schema of the file tells where each datum
+// ends: this package parses it for that purpose only, and does not
+// decode datums into Go values.
+package avroio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+const (
+	syncSize = 16
+
+	// DefaultBlockSize is the size of the datums buffered by a Writer
+	// before writing a block.
+	DefaultBlockSize = 64 * 1024
+
+	schemaKey = "avro.schema"
+	codecKey  = "avro.codec"
+)
+
+var magic = []byte("Obj\x01")
+
+var errTruncated = errors.New("avroio: truncated datum")
+
+// Codecs of the blocks of container files.
+const (
+	Null      = "null"
+	Deflate   = "deflate"
+	Snappy    = "snappy"
+	Zstandard = "zstandard"
+)
+
+// Reader scans the datums of an Avro Object Container File.  It
+// implements recordio.RecordScanner.
+type Reader struct {
+	r      *bufio.Reader
+	schema *schema
+	meta   map[string][]byte
+	sync   [syncSize]byte
+
+	block  []byte // the datums of the current block not yet scanned.
+	left   int64  // the datums left in block.
+	blocks int    // read so far.
+	record []byte
+	err    error
+}
+
+// NewReader creates a Reader of the container file r, reading its
+// header.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	var m [4]byte
+	if _, e := io.ReadFull(br, m[:]); e != nil || !bytes.Equal(m[:], magic) {
+		return nil, fmt.Errorf("Failed to parse Avro magic number")
+	}
+
+	meta, e := readMetadata(br)
+	if e != nil {
+		return nil, fmt.Errorf("Failed to read Avro header: %v", e)
+	}
+	sc, e := parseSchema(string(meta[schemaKey]))
+	if e != nil {
+		return nil, e
+	}
+	if _, e = newCodec(string(meta[codecKey])); e != nil {
+		return nil, e
+	}
+
+	rd := &Reader{r: br, schema: sc, meta: meta}
+	if _, e = io.ReadFull(br, rd.sync[:]); e != nil {
+		return nil, fmt.Errorf("Failed to read Avro header: %v", e)
+	}
+	return rd, nil
+}
+
+// Schema returns the schema of the file, in JSON.
+func (r *Reader) Schema() string {
+	return string(r.meta[schemaKey])
+}
+
+// Codec returns the codec of the blocks of the file.
+func (r *Reader) Codec() string {
+	if c := r.meta[codecKey]; len(c) > 0 {
+		return string(c)
+	}
+	return Null
+}
+
+// Metadata returns the value of key in the metadata of the file header.
+func (r *Reader) Metadata(key string) []byte {
+	return r.meta[key]
+}
+
+// Scan reads the next datum, returning false at the end of the file or
+// on error.
+func (r *Reader) Scan() bool {
+	if r.err != nil {
+		return false
+	}
+
+	for r.left == 0 {
+		if r.err = r.readBlock(); r.err != nil {
+			return false
+		}
+	}
+
+	n, e := r.schema.skip(r.block)
+	if e != nil {
+		r.err = fmt.Errorf("Failed to parse datum of block %d: %v", r.blocks-1, e)
+		return false
+	}
+	r.record, r.block = r.block[:n], r.block[n:]
+	r.left--
+	return true
+}
+
+// Record returns the datum read by the last Scan.
+func (r *Reader) Record() []byte {
+	return r.record
+}
+
+// Block returns the index of the block of the datum read by the last
+// Scan.
+func (r *Reader) Block() int {
+	return r.blocks - 1
+}
+
+// Err returns the first error of Scan other than the end of the file.
+func (r *Reader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+func (r *Reader) readBlock() error {
+	if len(r.block) > 0 {
+		return fmt.Errorf("Block %d has %d bytes after its datums", r.blocks-1, len(r.block))
+	}
+
+	count, e := binary.ReadVarint(r.r)
+	if e == io.EOF {
+		return io.EOF
+	}
+	if e != nil {
+		return fmt.Errorf("Failed to read block: %v", e)
+	}
+	size, e := binary.ReadVarint(r.r)
+	if e != nil {
+		return fmt.Errorf("Failed to read block: %v", noEOF(e))
+	}
+	if count < 0 || size < 0 || size > 1<<31 {
+		return fmt.Errorf("Invalid block of %d datums and %d bytes", count, size)
+	}
+
+	data := make([]byte, size+syncSize)
+	if _, e = io.ReadFull(r.r, data); e != nil {
+		return fmt.Errorf("Failed to read block: %v", noEOF(e))
+	}
+	if !bytes.Equal(data[size:], r.sync[:]) {
+		return fmt.Errorf("Block %d lacks the sync marker", r.blocks)
+	}
+
+	c, _ := newCodec(r.Codec())
+	if r.block, e = c.decode(data[:size]); e != nil {
+		return fmt.Errorf("Failed to decompress block %d: %v", r.blocks, e)
+	}
+	r.left = count
+	r.blocks++
+	return nil
+}
+
+// Writer writes datums into an Avro Object Container File.
+type Writer struct {
+	w         io.Writer
+	schema    *schema
+	codec     codec
+	sync      [syncSize]byte
+	blockSize int
+
+	block bytes.Buffer // the datums of the current block.
+	count int64        // in block.
+}
+
+// NewWriter creates a Writer of a container file of the given schema,
+// in JSON, and codec, "" meaning Null, writing its header into w.  Blocks are written
+// once they hold blockSize bytes of datums; <= 0 means
+// DefaultBlockSize.
+func NewWriter(w io.Writer, schema, codec string, blockSize int) (*Writer, error) {
+	sc, e := parseSchema(schema)
+	if e != nil {
+		return nil, e
+	}
+	c, e := newCodec(codec)
+	if e != nil {
+		return nil, e
+	}
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	if codec == "" {
+		codec = Null
+	}
+
+	wr := &Writer{w: w, schema: sc, codec: c, blockSize: blockSize}
+	if _, e = rand.Read(wr.sync[:]); e != nil {
+		return nil, e
+	}
+
+	hdr := append([]byte(nil), magic...)
+	hdr = binary.AppendVarint(hdr, 2)
+	for _, kv := range [][2]string{{schemaKey, schema}, {codecKey, codec}} {
+		hdr = appendBytes(hdr, []byte(kv[0]))
+		hdr = appendBytes(hdr, []byte(kv[1]))
+	}
+	hdr = binary.AppendVarint(hdr, 0)
+	hdr = append(hdr, wr.sync[:]...)
+
+	if _, e = w.Write(hdr); e != nil {
+		return nil, fmt.Errorf("Failed to write Avro header: %v", e)
+	}
+	return wr, nil
+}
+
+// Write writes a datum in the binary encoding of the schema, which is
+// checked to hold exactly one datum.
+func (w *Writer) Write(datum []byte) (int, error) {
+	n, e := w.schema.skip(datum)
+	if e == nil && n != len(datum) {
+		e = fmt.Errorf("%d bytes after the datum", len(datum)-n)
+	}
+	if e != nil {
+		return 0, fmt.Errorf("Invalid datum: %v", e)
+	}
+
+	w.block.Write(datum)
+	w.count++
+	if w.block.Len() >= w.blockSize {
+		if e := w.Flush(); e != nil {
+			return 0, e
+		}
+	}
+	return len(datum), nil
+}
+
+// Flush writes the datums written so far as a block.
+func (w *Writer) Flush() error {
+	if w.count == 0 {
+		return nil
+	}
+
+	data, e := w.codec.encode(w.block.Bytes())
+	if e != nil {
+		return fmt.Errorf("Failed to compress block: %v", e)
+	}
+
+	hdr := binary.AppendVarint(nil, w.count)
+	hdr = binary.AppendVarint(hdr, int64(len(data)))
+	for _, b := range [][]byte{hdr, data, w.sync[:]} {
+		if _, e = w.w.Write(b); e != nil {
+			return fmt.Errorf("Failed to write block: %v", e)
+		}
+	}
+
+	w.block.Reset()
+	w.count = 0
+	return nil
+}
+
+// Close writes the last block.  It does not close the underlying
+// io.Writer.
+func (w *Writer) Close() error {
+	return w.Flush()
+}
+
+// ToRecordIO writes the datums of the container file r into w, each
+// block of r as a chunk, returning their number.  The schema is not
+// kept; FromRecordIO needs it again.  w is not closed.
+func ToRecordIO(w *recordio.Writer, r io.Reader) (int, error) {
+	rd, e := NewReader(r)
+	if e != nil {
+		return 0, e
+	}
+
+	n := 0
+	for rd.Scan() {
+		if _, e = w.Write(rd.Record()); e != nil {
+			return n, e
+		}
+		n++
+		if rd.left == 0 {
+			if e = w.Flush(); e != nil {
+				return n, e
+			}
+		}
+	}
+	return n, rd.Err()
+}
+
+// FromRecordIO writes the records of s, datums of schema, into w as a
+// container file with the given codec, each chunk as a block, returning
+// their number.
+func FromRecordIO(w io.Writer, schema, codec string, s *recordio.RangeScanner) (int, error) {
+	aw, e := NewWriter(w, schema, codec, 1<<31-1)
+	if e != nil {
+		return 0, e
+	}
+
+	n, chunk := 0, -1
+	for s.Scan() {
+		if c := s.Position().Chunk; c != chunk {
+			if e = aw.Flush(); e != nil {
+				return n, e
+			}
+			chunk = c
+		}
+		if _, e = aw.Write(s.Record()); e != nil {
+			return n, fmt.Errorf("Failed to write record %d: %v", n, e)
+		}
+		n++
+	}
+	if e = s.Err(); e != nil {
+		return n, e
+	}
+	return n, aw.Close()
+}
+
+// readMetadata reads the metadata map of the file header.
+func readMetadata(r *bufio.Reader) (map[string][]byte, error) {
+	meta := map[string][]byte{}
+	for {
+		count, e := binary.ReadVarint(r)
+		if e != nil {
+			return nil, noEOF(e)
+		}
+		if count == 0 {
+			return meta, nil
+		}
+		if count < 0 {
+			count = -count
+			if _, e = binary.ReadVarint(r); e != nil {
+				return nil, noEOF(e)
+			}
+		}
+
+		for i := int64(0); i < count; i++ {
+			k, e := readBytes(r)
+			if e != nil {
+				return nil, e
+			}
+			v, e := readBytes(r)
+			if e != nil {
+				return nil, e
+			}
+			meta[string(k)] = v
+		}
+	}
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	l, e := binary.ReadVarint(r)
+	if e != nil {
+		return nil, noEOF(e)
+	}
+	if l < 0 || l > 1<<26 {
+		return nil, fmt.Errorf("invalid length %d", l)
+	}
+	b := make([]byte, l)
+	if _, e = io.ReadFull(r, b); e != nil {
+		return nil, noEOF(e)
+	}
+	return b, nil
+}
+
+func appendBytes(buf, b []byte) []byte {
+	return append(binary.AppendVarint(buf, int64(len(b))), b...)
+}
+
+// readLong reads a long in zigzag varint encoding from buf, returning
+// its length.
+func readLong(buf []byte) (int64, int, error) {
+	v, n := binary.Varint(buf)
+	if n <= 0 {
+		return 0, 0, errTruncated
+	}
+	return v, n, nil
+}
+
+func noEOF(e error) error {
+	if e == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return e
+}
+
+// A codec compresses the blocks of container files.
+type codec interface {
+	encode(data []byte) ([]byte, error)
+	decode(data []byte) ([]byte, error)
+}
+
+func newCodec(name string) (codec, error) {
+	switch name {
+	case "", Null:
+		return nullCodec{}, nil
+	case Deflate:
+		return deflateCodec{}, nil
+	case Snappy:
+		return snappyCodec{}, nil
+	case Zstandard:
+		return zstdCodec{}, nil
+	}
+	return nil, fmt.Errorf("Unsupported Avro codec: %s", name)
+}
+
+type nullCodec struct{}
+
+func (nullCodec) encode(data []byte) ([]byte, error) { return data, nil }
+func (nullCodec) decode(data []byte) ([]byte, error) { return data, nil }
+
+// deflateCodec is raw deflate, without zlib framing.
+type deflateCodec struct{}
+
+func (deflateCodec) encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fw, e := flate.NewWriter(&buf, flate.DefaultCompression)
+	if e != nil {
+		return nil, e
+	}
+	fw.Write(data)
+	if e = fw.Close(); e != nil {
+		return nil, e
+	}
+	return buf.Bytes(), nil
+}
+
+func (deflateCodec) decode(data []byte) ([]byte, error) {
+	return io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+}
+
+// snappyCodec is snappy blocks followed by the big-endian CRC32 of the
+// uncompressed data.
+type snappyCodec struct{}
+
+func (snappyCodec) encode(data []byte) ([]byte, error) {
+	return binary.BigEndian.AppendUint32(snappy.Encode(nil, data), crc32.ChecksumIEEE(data)), nil
+}
+
+func (snappyCodec) decode(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errTruncated
+	}
+	out, e := snappy.Decode(nil, data[:len(data)-4])
+	if e != nil {
+		return nil, e
+	}
+	if binary.BigEndian.Uint32(data[len(data)-4:]) != crc32.ChecksumIEEE(out) {
+		return nil, fmt.Errorf("Checksum checking failed.")
+	}
+	return out, nil
+}
+
+type zstdCodec struct{}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func (zstdCodec) encode(data []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
+
+func (zstdCodec) decode(data []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(data, nil)
+}
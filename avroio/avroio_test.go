@@ -0,0 +1,145 @@
+package avroio_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/avroio"
+)
+
+const schema = `{"type":"record","name":"User","fields":[{"name":"id","type":"long"},{"name":"name","type":"string"},{"name":"tags","type":{"type":"array","items":"string"}},{"name":"score","type":["null","double"]}]}`
+
+// user encodes the User of testdata/users.avro, with a score for odd
+// ids.
+func user(id int) []byte {
+	d := binary.AppendVarint(nil, int64(id))
+	d = binary.AppendVarint(d, 5)
+	d = append(d, "user"...)
+	d = append(d, byte('0'+id))
+	// A block of one tag, prefixed by its size, then the end.
+	d = append(d, 1, 4, 2, 't', 0)
+	if id%2 == 0 {
+		return append(d, 0)
+	}
+	return binary.LittleEndian.AppendUint64(append(d, 2), math.Float64bits(float64(id)/2))
+}
+
+func TestReader(t *testing.T) {
+	// Written by another Avro implementation, in blocks of 4 datums.
+	f, err := os.Open("testdata/users.avro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := avroio.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains([]byte(r.Schema()), []byte(`"name":"User"`)) || r.Codec() != avroio.Deflate {
+		t.Fatal("unexpected header:", r.Schema(), r.Codec())
+	}
+
+	n := 0
+	for r.Scan() {
+		if !bytes.Equal(r.Record(), user(n)) || r.Block() != n/4 {
+			t.Fatalf("unexpected datum %d in block %d: %q", n, r.Block(), r.Record())
+		}
+		n++
+	}
+	if r.Err() != nil || n != 10 {
+		t.Fatal("unexpected scan:", r.Err(), n)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	for _, codec := range []string{avroio.Null, avroio.Deflate, avroio.Snappy, avroio.Zstandard} {
+		var buf bytes.Buffer
+		w, err := avroio.NewWriter(&buf, schema, codec, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, err := w.Write(user(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := w.Write(append(user(0), 0)); err == nil {
+			t.Fatal("expected an error of trailing bytes")
+		}
+		if _, err := w.Write(user(1)[:5]); err == nil {
+			t.Fatal("expected an error of a truncated datum")
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := avroio.NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for r.Scan() {
+			if !bytes.Equal(r.Record(), user(n)) {
+				t.Fatal("unexpected datum:", codec, n)
+			}
+			n++
+		}
+		if r.Err() != nil || n != 10 || r.Block() < 2 {
+			t.Fatal("unexpected scan:", codec, r.Err(), n, r.Block())
+		}
+
+		// A corrupted sync marker is caught.
+		data := buf.Bytes()
+		data[len(data)-1] ^= 0xff
+		r, _ = avroio.NewReader(bytes.NewReader(data))
+		for r.Scan() {
+		}
+		if r.Err() == nil {
+			t.Fatal("expected an error of a corrupted block")
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	f, err := os.Open("testdata/users.avro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var rio bytes.Buffer
+	w := recordio.NewWriter(&rio, -1, recordio.Snappy)
+	if n, err := avroio.ToRecordIO(w, f); err != nil || n != 10 {
+		t.Fatal("unexpected conversion:", n, err)
+	}
+	w.Close()
+	if idx := w.Index(); idx.NumChunks() != 3 || idx.ChunkRecords[0] != 4 {
+		t.Fatal("expected a chunk per block:", idx.ChunkRecords)
+	}
+
+	var out bytes.Buffer
+	s := recordio.NewRangeScanner(bytes.NewReader(rio.Bytes()), w.Index(), 0, -1)
+	if n, err := avroio.FromRecordIO(&out, schema, avroio.Snappy, s); err != nil || n != 10 {
+		t.Fatal("unexpected conversion:", n, err)
+	}
+
+	r, err := avroio.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for r.Scan() {
+		if !bytes.Equal(r.Record(), user(n)) || r.Block() != n/4 {
+			t.Fatalf("unexpected datum %d in block %d: %q", n, r.Block(), r.Record())
+		}
+		n++
+	}
+	if r.Err() != nil || n != 10 {
+		t.Fatal("unexpected scan:", r.Err(), n)
+	}
+}
@@ -0,0 +1,261 @@
+package avroio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// A schema is the part of an Avro schema needed to find the end of a
+// datum in binary encoding.
+type schema struct {
+	kind     string    // a primitive type, "record", "enum", "array", "map", "fixed" or "union".
+	children []*schema // the fields of a record, or the branches of a union.
+	items    *schema   // of an array, or the values of a map.
+	size     int       // of a fixed.
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// parseSchema parses an Avro schema in JSON.
+func parseSchema(s string) (*schema, error) {
+	var v interface{}
+	if e := json.Unmarshal([]byte(s), &v); e != nil {
+		return nil, fmt.Errorf("Failed to parse schema: %v", e)
+	}
+
+	p := &schemaParser{named: map[string]*schema{}}
+	sc, e := p.parse(v, "")
+	if e != nil {
+		return nil, fmt.Errorf("Failed to parse schema: %v", e)
+	}
+	return sc, nil
+}
+
+// schemaParser holds the named types parsed so far, which later types
+// may refer to.
+type schemaParser struct {
+	named map[string]*schema
+}
+
+func (p *schemaParser) parse(v interface{}, namespace string) (*schema, error) {
+	switch v := v.(type) {
+	case string:
+		if primitives[v] {
+			return &schema{kind: v}, nil
+		}
+		if sc, ok := p.named[fullName(v, namespace)]; ok {
+			return sc, nil
+		}
+		if sc, ok := p.named[v]; ok {
+			return sc, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+
+	case []interface{}:
+		sc := &schema{kind: "union"}
+		for _, branch := range v {
+			b, e := p.parse(branch, namespace)
+			if e != nil {
+				return nil, e
+			}
+			sc.children = append(sc.children, b)
+		}
+		return sc, nil
+
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+	}
+	return nil, fmt.Errorf("invalid type %v", v)
+}
+
+func (p *schemaParser) parseComplex(v map[string]interface{}, namespace string) (*schema, error) {
+	kind, ok := v["type"].(string)
+	if !ok {
+		// Like {"type": {"type": "array", ...}}.
+		return p.parse(v["type"], namespace)
+	}
+
+	sc := &schema{kind: kind}
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		if sc.kind == "error" {
+			sc.kind = "record"
+		}
+		name, _ := v["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("%s without a name", kind)
+		}
+		if ns, ok := v["namespace"].(string); ok {
+			namespace = ns
+		}
+		name = fullName(name, namespace)
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			namespace = name[:i]
+		}
+		// Registered before the fields, which may refer to it.
+		p.named[name] = sc
+
+	case "array":
+		items, e := p.parse(v["items"], namespace)
+		if e != nil {
+			return nil, e
+		}
+		sc.items = items
+		return sc, nil
+
+	case "map":
+		values, e := p.parse(v["values"], namespace)
+		if e != nil {
+			return nil, e
+		}
+		sc.items = values
+		return sc, nil
+
+	default:
+		// A primitive, maybe with a logical type, or a named type.
+		return p.parse(kind, namespace)
+	}
+
+	switch sc.kind {
+	case "record":
+		fields, _ := v["fields"].([]interface{})
+		for _, f := range fields {
+			field, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid field %v", f)
+			}
+			ft, e := p.parse(field["type"], namespace)
+			if e != nil {
+				return nil, e
+			}
+			sc.children = append(sc.children, ft)
+		}
+	case "fixed":
+		size, ok := v["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed without a size")
+		}
+		sc.size = int(size)
+	}
+	return sc, nil
+}
+
+func fullName(name, namespace string) string {
+	if strings.ContainsRune(name, '.') || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// skip returns the length of the datum of sc at the start of buf.
+func (sc *schema) skip(buf []byte) (int, error) {
+	switch sc.kind {
+	case "null":
+		return 0, nil
+	case "boolean":
+		return need(buf, 1)
+	case "int", "long", "enum":
+		_, n, e := readLong(buf)
+		return n, e
+	case "float":
+		return need(buf, 4)
+	case "double":
+		return need(buf, 8)
+	case "fixed":
+		return need(buf, sc.size)
+	case "bytes", "string":
+		l, n, e := readLong(buf)
+		if e != nil {
+			return 0, e
+		}
+		if l < 0 {
+			return 0, fmt.Errorf("negative length %d", l)
+		}
+		m, e := need(buf[n:], int(l))
+		return n + m, e
+
+	case "record":
+		n := 0
+		for _, f := range sc.children {
+			m, e := f.skip(buf[n:])
+			if e != nil {
+				return 0, e
+			}
+			n += m
+		}
+		return n, nil
+
+	case "union":
+		b, n, e := readLong(buf)
+		if e != nil {
+			return 0, e
+		}
+		if b < 0 || b >= int64(len(sc.children)) {
+			return 0, fmt.Errorf("union branch %d out of range", b)
+		}
+		m, e := sc.children[b].skip(buf[n:])
+		return n + m, e
+
+	case "array", "map":
+		return sc.skipBlocks(buf)
+	}
+	return 0, fmt.Errorf("unknown type %q", sc.kind)
+}
+
+// skipBlocks returns the length of the blocks of an array or a map.
+func (sc *schema) skipBlocks(buf []byte) (int, error) {
+	key := &schema{kind: "string"}
+	n := 0
+	for {
+		count, m, e := readLong(buf[n:])
+		if e != nil {
+			return 0, e
+		}
+		n += m
+		if count == 0 {
+			return n, nil
+		}
+
+		if count < 0 {
+			// The block is prefixed by its size.
+			size, m, e := readLong(buf[n:])
+			if e != nil {
+				return 0, e
+			}
+			if size < 0 {
+				return 0, fmt.Errorf("negative block size %d", size)
+			}
+			n += m
+			if _, e = need(buf[n:], int(size)); e != nil {
+				return 0, e
+			}
+			n += int(size)
+			continue
+		}
+
+		for i := int64(0); i < count; i++ {
+			if sc.kind == "map" {
+				if m, e = key.skip(buf[n:]); e != nil {
+					return 0, e
+				}
+				n += m
+			}
+			if m, e = sc.items.skip(buf[n:]); e != nil {
+				return 0, e
+			}
+			n += m
+		}
+	}
+}
+
+// need returns n if buf holds n bytes.
+func need(buf []byte, n int) (int, error) {
+	if n > len(buf) {
+		return 0, errTruncated
+	}
+	return n, nil
+}
@@ -0,0 +1,139 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// defaultBloomBitsPerKey is the bits per key of the Bloom filters of
+// the chunks appended to a file with filters, unless WithBloomFilter.
+const defaultBloomBitsPerKey = 10
+
+// WithBloomFilter makes the Writer build a Bloom filter of the keys of
+// the records of every chunk, written by WriteKV, of bitsPerKey bits
+// per key and the given number of hash functions, or about
+// bitsPerKey*ln(2) if hashes <= 0.  The filters are kept by the Index,
+// in the footer with WithFooterIndex, and let Reader.Lookup skip the
+// chunks without a key without decoding them; 10 bits per key make
+// about 1% of such chunks decoded anyway.  A bitsPerKey <= 0 disables
+// the filters.
+func WithBloomFilter(bitsPerKey, hashes int) Option {
+	return func(w *Writer) {
+		if hashes <= 0 {
+			hashes = int(math.Round(float64(bitsPerKey) * math.Ln2))
+		}
+		w.bloomBitsPerKey, w.bloomHashes = bitsPerKey, min(max(hashes, 1), 30)
+	}
+}
+
+// bloomFilter is the Bloom filter of the keys of a chunk, setting bits
+// by double hashing of the 64-bit FNV-1a hash of the keys.
+type bloomFilter struct {
+	hashes int
+	bits   []byte
+}
+
+// newBloomFilter returns the bloomFilter of keys.
+func newBloomFilter(keys [][]byte, bitsPerKey, hashes int) bloomFilter {
+	f := bloomFilter{hashes: hashes, bits: make([]byte, (max(len(keys)*bitsPerKey, 64)+7)/8)}
+	for _, key := range keys {
+		f.probe(key, func(byteIndex int, mask byte) bool {
+			f.bits[byteIndex] |= mask
+			return true
+		})
+	}
+	return f
+}
+
+// probe calls fn with the bits of key until it returns false, and
+// returns whether it never did.
+func (f bloomFilter) probe(key []byte, fn func(byteIndex int, mask byte) bool) bool {
+	h := hashKey(key)
+	h1, h2 := uint32(h), uint32(h>>32)
+	n := uint32(len(f.bits) * 8)
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint32(i)*h2) % n
+		if !fn(int(bit/8), 1<<(bit%8)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mayContain returns false if key is not in the filter.
+func (f bloomFilter) mayContain(key []byte) bool {
+	return f.probe(key, func(byteIndex int, mask byte) bool {
+		return f.bits[byteIndex]&mask != 0
+	})
+}
+
+// ChunkMayContain returns false if the Bloom filter of WithBloomFilter
+// rules out a record with key in the i-th chunk, and true otherwise,
+// including for an Index without filters.
+func (r *Index) ChunkMayContain(i int, key []byte) bool {
+	return r.blooms == nil || r.blooms[i].mayContain(key)
+}
+
+// lookupFiltered is Lookup by decoding the chunks whose Bloom filters
+// may contain key.
+func (r *Reader) lookupFiltered(key []byte) ([]byte, error) {
+	for ci := range r.index.blooms {
+		if !r.index.ChunkMayContain(ci, key) {
+			continue
+		}
+
+		ch, e := r.chunk(ci)
+		if e != nil {
+			return nil, e
+		}
+		for ri, k := range ch.keys {
+			if bytes.Equal(k, key) {
+				return ch.records[ri], nil
+			}
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// appendBloomFilters appends the filters of the chunks to buf as
+//
+//	numChunks * {
+//		hashes  uvarint
+//		bitsLen uvarint
+//		bits    [bitsLen]byte
+//	}
+func appendBloomFilters(buf []byte, blooms []bloomFilter) []byte {
+	for _, f := range blooms {
+		buf = appendUvarint(buf, uint64(f.hashes))
+		buf = appendUvarint(buf, uint64(len(f.bits)))
+		buf = append(buf, f.bits...)
+	}
+	return buf
+}
+
+// parseBloomFilters parses the filters of numChunks chunks by
+// appendBloomFilters, which must fill buf.
+func parseBloomFilters(buf []byte, numChunks int) ([]bloomFilter, error) {
+	blooms := make([]bloomFilter, numChunks)
+	for i := range blooms {
+		hashes, l := binary.Uvarint(buf)
+		if l <= 0 || hashes > 30 {
+			return nil, fmt.Errorf("Failed to parse Bloom filter of chunk %d", i)
+		}
+		buf = buf[l:]
+
+		n, l := binary.Uvarint(buf)
+		if l <= 0 || n == 0 || n > uint64(len(buf)-l) {
+			return nil, fmt.Errorf("Failed to parse Bloom filter of chunk %d", i)
+		}
+		blooms[i] = bloomFilter{int(hashes), append([]byte{}, buf[l:l+int(n)]...)}
+		buf = buf[l+int(n):]
+	}
+
+	if len(buf) > 0 {
+		return nil, fmt.Errorf("Bloom filters have %d bytes after the chunks", len(buf))
+	}
+	return blooms, nil
+}
@@ -0,0 +1,116 @@
+package recordio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// checkpointVersion starts the checkpoints of Checkpoint.
+const checkpointVersion = 1
+
+// appendCheckpoint returns the checkpoint of a scanner at the record-th
+// record of the shard-th file, with left records to scan, or -1 if
+// they extend till the end of the file:
+//
+//	version uint8
+//	shard   uvarint
+//	record  uvarint
+//	left    varint
+func appendCheckpoint(buf []byte, shard, record, left int) []byte {
+	buf = append(buf, checkpointVersion)
+	buf = appendUvarint(buf, uint64(shard))
+	buf = appendUvarint(buf, uint64(record))
+	return appendVarint(buf, int64(left))
+}
+
+// parseCheckpoint parses a checkpoint of appendCheckpoint.
+func parseCheckpoint(buf []byte) (shard, record, left int, e error) {
+	if len(buf) == 0 || buf[0] != checkpointVersion {
+		return 0, 0, 0, fmt.Errorf("Failed to parse checkpoint version")
+	}
+	buf = buf[1:]
+
+	var v [2]uint64
+	for i := range v {
+		n, l := binary.Uvarint(buf)
+		if l <= 0 || n > 1<<62 {
+			return 0, 0, 0, fmt.Errorf("Failed to parse checkpoint")
+		}
+		v[i], buf = n, buf[l:]
+	}
+	n, l := binary.Varint(buf)
+	if l <= 0 || l != len(buf) || n < -1 || n > 1<<62 {
+		return 0, 0, 0, fmt.Errorf("Failed to parse checkpoint")
+	}
+	return int(v[0]), int(v[1]), int(n), nil
+}
+
+// Checkpoint returns the position of the scanner, after the record
+// under the current cursor, for ResumeScanner to scan the records left
+// after a restart.
+func (s *RangeScanner) Checkpoint() []byte {
+	return appendCheckpoint(nil, 0, s.next(), s.end-s.next())
+}
+
+// next returns the index of the record after the current cursor.
+func (s *RangeScanner) next() int {
+	return min(s.cur+1, s.end)
+}
+
+// ResumeScanner creates a RangeScanner of the records of r left to
+// scan by the RangeScanner of checkpoint, of RangeScanner.Checkpoint,
+// which described r with index, or by a Scanner in the first file, of
+// which r is that.
+func ResumeScanner(r io.ReadSeeker, index *Index, checkpoint []byte, opts ...ReadOption) (*RangeScanner, error) {
+	shard, record, left, e := parseCheckpoint(checkpoint)
+	if e != nil {
+		return nil, e
+	}
+	if shard != 0 {
+		return nil, fmt.Errorf("Checkpoint is in file %d of a Scanner", shard)
+	}
+	if record > index.NumRecords {
+		return nil, fmt.Errorf("Record index out of range: %d", record)
+	}
+	return NewRangeScanner(r, index, record, left, opts...), nil
+}
+
+// Checkpoint returns the position of the scanner, the file and the
+// record after the one under the current cursor, for Resume to scan
+// the records left after a restart.
+func (s *Scanner) Checkpoint() []byte {
+	switch {
+	case s.end:
+		return appendCheckpoint(nil, len(s.paths), 0, -1)
+	case s.curScanner != nil:
+		return appendCheckpoint(nil, s.pathIdx-1, s.curScanner.next(), -1)
+	}
+	return appendCheckpoint(nil, s.pathIdx, 0, -1)
+}
+
+// Resume moves a Scanner that has not scanned yet to checkpoint, of
+// Scanner.Checkpoint of a Scanner of the same files, so that Scan
+// continues from the record after the last one scanned by that
+// Scanner.
+func (s *Scanner) Resume(checkpoint []byte) error {
+	if s.curScanner != nil || s.pathIdx > 0 || s.end {
+		return fmt.Errorf("Cannot resume a Scanner that has scanned")
+	}
+
+	shard, record, _, e := parseCheckpoint(checkpoint)
+	if e != nil {
+		return e
+	}
+	if shard > len(s.paths) || (shard == len(s.paths) && record > 0) {
+		return fmt.Errorf("Checkpoint is in file %d of %d", shard, len(s.paths))
+	}
+
+	if shard == len(s.paths) {
+		s.end = true
+		return nil
+	}
+	s.pathIdx = shard
+	_, e = s.nextFile(record)
+	return e
+}
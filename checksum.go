@@ -0,0 +1,200 @@
+package recordio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	// CRC32 is the CRC32 (IEEE) checksum of version 1 chunk headers,
+	// the default.
+	CRC32 = iota
+	// CRC32C is the CRC32 with the Castagnoli polynomial, which most
+	// CPUs compute in hardware.  Chunks checked by it have version 2
+	// headers, which older readers cannot parse.
+	CRC32C
+	// XXHash64 is a 64-bit non-cryptographic hash, faster than CRC32
+	// without hardware support, for hot paths.
+	XXHash64
+	// SHA256 is the SHA-256 cryptographic hash, for archives whose
+	// integrity matters more than speed.
+	SHA256
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	checksumsMu sync.RWMutex
+	checksums   = map[int]func() hash.Hash{
+		CRC32:    func() hash.Hash { return crc32.NewIEEE() },
+		CRC32C:   func() hash.Hash { return crc32.New(castagnoli) },
+		XXHash64: func() hash.Hash { return xxhash.New() },
+		SHA256:   sha256.New,
+	}
+)
+
+// RegisterChecksum makes newHash the checksum algorithm of the given
+// id, which is recorded in the header of every chunk it checks, so that
+// readers registering the same algorithm verify them.  Pass the id to
+// WithChecksum.  The size of the hashes must not exceed 65535 bytes.
+// It panics if the id is already registered, including the ids of the
+// algorithms of this package.
+func RegisterChecksum(id byte, newHash func() hash.Hash) {
+	checksumsMu.Lock()
+	defer checksumsMu.Unlock()
+
+	if newHash == nil {
+		panic("recordio: RegisterChecksum newHash is nil")
+	}
+	if _, dup := checksums[int(id)]; dup {
+		panic(fmt.Sprintf("recordio: RegisterChecksum called twice for id %d", id))
+	}
+	checksums[int(id)] = newHash
+}
+
+// ChecksumVerification tells readers whether to verify the checksums
+// of chunks.
+type ChecksumVerification int
+
+const (
+	// Strict verifies all checksums of a chunk, the default.
+	Strict ChecksumVerification = iota
+	// Skip verifies no checksum, trading corruption detection for
+	// speed when the storage already guarantees integrity.
+	Skip
+)
+
+func newChecksum(checksumType int) (hash.Hash, error) {
+	checksumsMu.RLock()
+	newHash, ok := checksums[checksumType]
+	checksumsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown checksum algorithm: %d", checksumType)
+	}
+	return newHash(), nil
+}
+
+// newHashes returns the hashes of the compressed and, if enabled, the
+// decompressed data of a chunk encoded by enc.
+func (enc chunkEncoding) newHashes() (hash.Hash, hash.Hash, error) {
+	sum, e := newChecksum(enc.checksum)
+	if e != nil || !enc.rawChecksum {
+		return sum, nil, e
+	}
+
+	raw, e := newChecksum(enc.checksum)
+	return sum, raw, e
+}
+
+// header returns the header of a chunk encoded by enc, given the
+// hashes of newHashes over its data and the flags of the per-record
+// fields of the chunk, like flagTimestamps.
+func (enc chunkEncoding) header(compressor int, compressedSize int64, numRecords int, layout uint8, sum, raw hash.Hash) *Header {
+	hdr := &Header{
+		compressor:     uint32(compressor),
+		compressedSize: uint32(compressedSize),
+		numRecords:     uint32(numRecords),
+	}
+
+	flags := enc.flags(layout)
+	if enc.checksum == CRC32 && flags == 0 {
+		hdr.checkSum = sum.(hash.Hash32).Sum32()
+		return hdr
+	}
+
+	hdr.checksumType = uint8(enc.checksum)
+	hdr.checksum = sum.Sum(nil)
+	hdr.flags = flags
+	if raw != nil {
+		hdr.rawChecksum = raw.Sum(nil)
+	}
+
+	var s [4]byte
+	copy(s[:], hdr.checksum)
+	hdr.checkSum = binary.LittleEndian.Uint32(s[:])
+	return hdr
+}
+
+// flags returns the flags of the header of a chunk encoded by enc,
+// given those of its per-record fields.
+func (enc chunkEncoding) flags(layout uint8) uint8 {
+	flags := layout
+	if enc.recordChecksums {
+		flags |= flagRecordChecksums
+	}
+	if enc.rawChecksum {
+		flags |= flagRawChecksum
+	}
+	if enc.aead != nil {
+		flags |= flagEncrypted
+	}
+	if enc.aead != nil && enc.keyID != nil {
+		flags |= flagKeyID
+	}
+	return flags
+}
+
+// errChecksum is returned for data not matching its checksum.
+var errChecksum = errors.New("Checksum checking failed.")
+
+// verify checks the checksum of the compressed data of the chunk.
+func (c *Header) verify(data []byte) error {
+	if c.checksum == nil {
+		if c.checkSum != crc32.ChecksumIEEE(data) {
+			return errChecksum
+		}
+		return nil
+	}
+	return verifySum(int(c.checksumType), c.checksum, data)
+}
+
+// verifyRaw checks the checksum of the decompressed data of the chunk,
+// if any.
+func (c *Header) verifyRaw(raw []byte) error {
+	if c.rawChecksum == nil {
+		return nil
+	}
+	return verifySum(int(c.checksumType), c.rawChecksum, raw)
+}
+
+func verifySum(checksumType int, sum, data []byte) error {
+	h, e := newChecksum(checksumType)
+	if e != nil {
+		return e
+	}
+
+	h.Write(data)
+	if !bytes.Equal(h.Sum(nil), sum) {
+		return errChecksum
+	}
+	return nil
+}
+
+// recordChecksum returns the checksum of WithRecordChecksums.
+func recordChecksum(record []byte) uint32 {
+	return crc32.Checksum(record, castagnoli)
+}
+
+// readRecordChecksum reads the checksum following record from r, and
+// verifies it unless v is Skip.
+func readRecordChecksum(r io.Reader, record []byte, v ChecksumVerification) error {
+	var sum [4]byte
+	if _, e := io.ReadFull(r, sum[:]); e != nil {
+		return fmt.Errorf("Failed to read record checksum: %v", e)
+	}
+
+	if v != Skip && binary.LittleEndian.Uint32(sum[:]) != recordChecksum(record) {
+		return fmt.Errorf("Record checksum checking failed.")
+	}
+	return nil
+}
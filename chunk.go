@@ -2,20 +2,35 @@ package recordio
 
 import (
 	"bytes"
-	"compress/gzip"
+	"crypto/cipher"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
-
-	"github.com/golang/snappy"
+	"io/ioutil"
+	"math"
+	"time"
 )
 
 // A Chunk contains the Header and optionally compressed records.  To
 // create a chunk, just use ch := &Chunk{}.
 type Chunk struct {
-	records  [][]byte
-	numBytes int // sum of record lengths.
+	records    [][]byte
+	numBytes   int      // sum of record lengths.
+	recordSums bool     // whether each record is followed by its CRC32C.
+	timestamps []int64  // in Unix nanoseconds, if the records have any.
+	keys       [][]byte // if the records have any.
+	tags       []uint16 // if the records have any.
+
+	buf *bytes.Buffer // the decompressed data of the records, of WithReuseBuffer.
+}
+
+// recordFields are the optional fields of a record, of which a chunk
+// holds those of its layout.
+type recordFields struct {
+	timestamp int64 // in Unix nanoseconds.
+	key       []byte
+	tag       uint16
 }
 
 func (ch *Chunk) add(record []byte) {
@@ -23,128 +38,485 @@ func (ch *Chunk) add(record []byte) {
 	ch.numBytes += len(record)
 }
 
-// dump the chunk into w, and clears the chunk and makes it ready for
-// the next add invocation.
-func (ch *Chunk) dump(w io.Writer, compressorIndex int) error {
-	// NOTE: don't check ch.numBytes instead, because empty
-	// records are allowed.
-	if len(ch.records) == 0 {
+// layout returns the flags of the per-record fields of the chunk,
+// which all its records share.
+func (ch *Chunk) layout() uint8 {
+	var layout uint8
+	if ch.timestamps != nil {
+		layout |= flagTimestamps
+	}
+	if ch.keys != nil {
+		layout |= flagKeys
+	}
+	if ch.tags != nil {
+		layout |= flagTags
+	}
+	return layout
+}
+
+// addRecord adds a record with the per-record fields of layout.
+func (ch *Chunk) addRecord(record []byte, layout uint8, f recordFields) {
+	ch.add(record)
+	if layout&flagTimestamps != 0 {
+		ch.timestamps = append(ch.timestamps, f.timestamp)
+	}
+	if layout&flagKeys != 0 {
+		ch.keys = append(ch.keys, f.key)
+	}
+	if layout&flagTags != 0 {
+		ch.tags = append(ch.tags, f.tag)
+	}
+}
+
+// fields returns the per-record fields of the i-th record, for
+// addRecord.
+func (ch *Chunk) fields(i int) recordFields {
+	f := recordFields{key: ch.key(i), tag: ch.tag(i)}
+	if ch.timestamps != nil {
+		f.timestamp = ch.timestamps[i]
+	}
+	return f
+}
+
+// appendFields appends the per-record fields of the i-th record, as
+// they precede its length in the chunk data, to buf.
+func (ch *Chunk) appendFields(buf []byte, i int) []byte {
+	if ch.timestamps != nil {
+		var prev int64
+		if i > 0 {
+			prev = ch.timestamps[i-1]
+		}
+		buf = binary.AppendVarint(buf, ch.timestamps[i]-prev)
+	}
+	if ch.keys != nil {
+		buf = appendUvarint(buf, uint64(len(ch.keys[i])))
+		buf = append(buf, ch.keys[i]...)
+	}
+	if ch.tags != nil {
+		buf = appendUvarint(buf, uint64(ch.tags[i]))
+	}
+	return buf
+}
+
+// key returns the key of the i-th record, or nil if the records have
+// none.
+func (ch *Chunk) key(i int) []byte {
+	if ch.keys == nil {
 		return nil
 	}
+	return ch.keys[i]
+}
+
+// tag returns the tag of the i-th record, or 0 if the records have
+// none.
+func (ch *Chunk) tag(i int) uint16 {
+	if ch.tags == nil {
+		return 0
+	}
+	return ch.tags[i]
+}
+
+// timestamp returns the timestamp of the i-th record, or the zero
+// Time if the records have none.
+func (ch *Chunk) timestamp(i int) time.Time {
+	if ch.timestamps == nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ch.timestamps[i])
+}
+
+// chunkEncoding configures how Chunk.encode compresses a chunk.
+type chunkEncoding struct {
+	compressor int
+	level      int     // 0 means the default of the compressor.
+	minSaving  float64 // of compression, below which chunks are stored uncompressed.
+	dict       []byte  // the Zstd dictionary of WithDictionary.
+
+	checksum        int  // the checksum algorithm.
+	rawChecksum     bool // whether to checksum the decompressed data too.
+	recordChecksums bool // whether to checksum every record.
+
+	aead  cipher.AEAD // of WithEncryption, or nil.
+	keyID []byte      // of WithKeyID, or nil.
+}
 
+// chunkCompressor returns the compressor recorded in the headers of
+// chunks compressed by enc.
+func (enc chunkEncoding) chunkCompressor() int {
+	if enc.compressor == Zstd && enc.dict != nil {
+		return zstdDict
+	}
+	return enc.compressor
+}
+
+// encode compresses the records of the chunk, and returns the chunk
+// header and the compressed data.
+func (ch *Chunk) encode(enc chunkEncoding) (*Header, []byte, error) {
 	// Write raw records and their lengths into data buffer.
 	var data bytes.Buffer
 
-	for _, r := range ch.records {
+	var fields []byte
+	for i, r := range ch.records {
+		fields = ch.appendFields(fields[:0], i)
+		data.Write(fields)
+
 		var rs [4]byte
 		binary.LittleEndian.PutUint32(rs[:], uint32(len(r)))
 
 		if _, e := data.Write(rs[:]); e != nil {
-			return fmt.Errorf("Failed to write record length: %v", e)
+			return nil, nil, fmt.Errorf("Failed to write record length: %v", e)
 		}
 
 		if _, e := data.Write(r); e != nil {
-			return fmt.Errorf("Failed to write record: %v", e)
+			return nil, nil, fmt.Errorf("Failed to write record: %v", e)
+		}
+
+		if enc.recordChecksums {
+			var sum [4]byte
+			binary.LittleEndian.PutUint32(sum[:], recordChecksum(r))
+			data.Write(sum[:])
 		}
 	}
 
-	compressed, e := compressData(&data, compressorIndex)
+	raw := data.Bytes()
+	compressed, e := compressData(&data, enc)
 	if e != nil {
-		return e
+		return nil, nil, e
 	}
 
-	// Write chunk header and compressed data.
-	hdr := &Header{
-		checkSum:       crc32.ChecksumIEEE(compressed.Bytes()),
-		compressor:     uint32(compressorIndex),
-		compressedSize: uint32(compressed.Len()),
-		numRecords:     uint32(len(ch.records)),
+	compressorIndex, out := enc.chunkCompressor(), compressed.Bytes()
+	if enc.minSaving > 0 && float64(len(out)) > float64(len(raw))*(1-enc.minSaving) {
+		compressorIndex, out = NoCompression, raw
 	}
 
+	var nonce, tag []byte
+	if enc.aead != nil {
+		if nonce, tag, out, e = enc.seal(compressorIndex, len(ch.records), ch.layout(), out); e != nil {
+			return nil, nil, e
+		}
+	}
+
+	sum, rawSum, e := enc.newHashes()
+	if e != nil {
+		return nil, nil, e
+	}
+
+	sum.Write(out)
+	if rawSum != nil {
+		rawSum.Write(raw)
+	}
+	hdr := enc.header(compressorIndex, int64(len(out)), len(ch.records), ch.layout(), sum, rawSum)
+	if enc.aead != nil {
+		hdr.nonce, hdr.tag, hdr.keyID = nonce, tag, enc.keyID
+	}
+	return hdr, out, nil
+}
+
+// writeChunk writes the chunk header and compressed data into w.
+func writeChunk(w io.Writer, hdr *Header, data []byte) error {
 	if _, e := hdr.write(w); e != nil {
 		return fmt.Errorf("Failed to write chunk header: %v", e)
 	}
 
-	if _, e := w.Write(compressed.Bytes()); e != nil {
+	if _, e := w.Write(data); e != nil {
 		return fmt.Errorf("Failed to write chunk data: %v", e)
 	}
+	return nil
+}
 
-	// Clear the current chunk.
-	ch.records = nil
-	ch.numBytes = 0
+func compressData(src io.Reader, enc chunkEncoding) (*bytes.Buffer, error) {
+	compressed := new(bytes.Buffer)
+	compressor, e := newCompressor(compressed, enc)
+	if e != nil {
+		return nil, e
+	}
 
-	return nil
+	if _, e := io.Copy(compressor, src); e != nil {
+		return nil, fmt.Errorf("Failed to compress chunk data: %v", e)
+	}
+	if e := compressor.Close(); e != nil {
+		return nil, fmt.Errorf("Failed to compress chunk data: %v", e)
+	}
+
+	return compressed, nil
 }
 
-type noopCompressor struct {
-	*bytes.Buffer
+// ErrRecordTooLarge is matched, via errors.Is, by the
+// *RecordTooLargeError of a record exceeding the maximum record size.
+var ErrRecordTooLarge = errors.New("recordio: record too large")
+
+// RecordTooLargeError reports a record larger than allowed by
+// WithMaxRecordSize or WithReadMaxRecordSize.  When reading, it means
+// a corrupted length field as often as a genuinely large record.
+type RecordTooLargeError struct {
+	Record int   // the record index, within the chunk when reading.
+	Offset int64 // the offset of the chunk when reading, or -1.
+	Size   int64
+	Max    int
 }
 
-func (c *noopCompressor) Close() error {
-	return nil
+func (e *RecordTooLargeError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("recordio: record %d has %d bytes, more than %d", e.Record, e.Size, e.Max)
+	}
+	return fmt.Sprintf("recordio: record %d of chunk at offset %d has %d bytes, more than %d", e.Record, e.Offset, e.Size, e.Max)
 }
 
-func compressData(src io.Reader, compressorIndex int) (*bytes.Buffer, error) {
-	compressed := new(bytes.Buffer)
-	var compressor io.WriteCloser
+// Unwrap returns ErrRecordTooLarge.
+func (e *RecordTooLargeError) Unwrap() error {
+	return ErrRecordTooLarge
+}
+
+// ErrChunkTooLarge is matched, via errors.Is, by the
+// *ChunkTooLargeError of a chunk exceeding the maximum decompressed
+// chunk size.
+var ErrChunkTooLarge = errors.New("recordio: decompressed chunk too large")
+
+// ChunkTooLargeError reports a chunk whose data decompresses to more
+// than allowed by WithMaxDecompressedChunkSize.
+type ChunkTooLargeError struct {
+	Offset int64 // the offset of the chunk.
+	Max    int
+}
+
+func (e *ChunkTooLargeError) Error() string {
+	return fmt.Sprintf("recordio: chunk at offset %d decompresses to more than %d bytes", e.Offset, e.Max)
+}
 
-	switch compressorIndex {
-	case NoCompression:
-		compressor = &noopCompressor{compressed}
-	case Snappy:
-		compressor = snappy.NewBufferedWriter(compressed)
-	case Gzip:
-		compressor = gzip.NewWriter(compressed)
-	default:
-		return nil, fmt.Errorf("Unknown compression algorithm: %d", compressorIndex)
+// Unwrap returns ErrChunkTooLarge.
+func (e *ChunkTooLargeError) Unwrap() error {
+	return ErrChunkTooLarge
+}
+
+// parse the specified chunk from r.  o may be nil for the defaults.
+func parseChunk(r io.ReadSeeker, chunkOffset int64, o *readOptions) (*Chunk, error) {
+	if o == nil {
+		o = newReadOptions(nil)
 	}
 
-	if _, e := io.Copy(compressor, src); e != nil {
-		return nil, fmt.Errorf("Failed to compress chunk data: %v", e)
+	if ch := o.cachedChunk(chunkOffset); ch != nil {
+		return ch, nil
 	}
-	compressor.Close()
 
-	return compressed, nil
+	hdr, data, e := readRawChunk(r, chunkOffset, o)
+	if e != nil {
+		return nil, e
+	}
+
+	ch, e := decodeChunk(hdr, data, chunkOffset, o)
+	if e != nil {
+		return nil, e
+	}
+	o.bufs.put(data)
+	o.cacheChunk(chunkOffset, ch)
+	return ch, nil
 }
 
-// parse the specified chunk from r.
-func parseChunk(r io.ReadSeeker, chunkOffset int64) (*Chunk, error) {
-	var e error
-	var hdr *Header
+// readRawChunk reads the header and the compressed data of the chunk
+// at chunkOffset from r, and the file header into o if the chunk needs
+// it, leaving decodeChunk the CPU intensive part.
+func readRawChunk(r io.ReadSeeker, chunkOffset int64, o *readOptions) (*Header, *bytes.Buffer, error) {
+	if _, e := r.Seek(chunkOffset, io.SeekStart); e != nil {
+		return nil, nil, fmt.Errorf("Failed to seek chunk: %v", e)
+	}
+
+	hdr, e := parseHeader(r)
+	if _, ok := e.(*UnsupportedVersionError); ok {
+		return nil, nil, e
+	}
+	if e != nil {
+		return nil, nil, fmt.Errorf("Failed to parse chunk header: %v", e)
+	}
 
-	if _, e = r.Seek(chunkOffset, io.SeekStart); e != nil {
+	if _, e = chunkDictionary(r, hdr, chunkOffset, o.header); e != nil {
+		return nil, nil, e
+	}
+	if hdr.flags&flagEncrypted != 0 && o.kms != nil {
+		// For the wrapped data key.
+		if _, e = chunkFileHeader(r, hdr, chunkOffset, o.header); e != nil {
+			return nil, nil, e
+		}
+	}
+
+	data := o.bufs.get()
+	if _, e = io.CopyN(data, r, int64(hdr.compressedSize)); e != nil {
+		return nil, nil, fmt.Errorf("Failed to read chunk data: %v", e)
+	}
+	return hdr, data, nil
+}
+
+// chunkDictionary returns the compression dictionary of the chunk at
+// chunkOffset following hdr in r, loading the file header into c if
+// needed, after which r is left at the chunk data again.
+func chunkDictionary(r io.ReadSeeker, hdr *Header, chunkOffset int64, c *headerCache) ([]byte, error) {
+	if hdr.compressor != zstdDict {
+		return nil, nil
+	}
+
+	fh, e := chunkFileHeader(r, hdr, chunkOffset, c)
+	if e != nil {
+		return nil, e
+	}
+	return fh.get(dictionaryKey), nil
+}
+
+// chunkFileHeader returns the file header of r, loading it into c if
+// needed, after which r is left at the data of the chunk at
+// chunkOffset following hdr again.
+func chunkFileHeader(r io.ReadSeeker, hdr *Header, chunkOffset int64, c *headerCache) (*fileHeader, error) {
+	fh, e := c.get(r)
+	if e != nil {
+		return nil, fmt.Errorf("Failed to read file header: %v", e)
+	}
+
+	if _, e = r.Seek(chunkOffset+hdr.size(), io.SeekStart); e != nil {
 		return nil, fmt.Errorf("Failed to seek chunk: %v", e)
 	}
+	return fh, nil
+}
 
-	hdr, e = parseHeader(r)
+// readChunk reads the data of the chunk at chunkOffset following hdr
+// from r.  o may be nil for the defaults.
+func readChunk(r io.Reader, hdr *Header, chunkOffset int64, o *readOptions) (*Chunk, error) {
+	data, e := readChunkData(r, hdr)
 	if e != nil {
-		return nil, fmt.Errorf("Failed to parse chunk header: %v", e)
+		return nil, e
 	}
+	return decodeChunk(hdr, data, chunkOffset, o)
+}
 
+// readChunkData reads the compressed data following hdr from r.
+func readChunkData(r io.Reader, hdr *Header) (*bytes.Buffer, error) {
 	var buf bytes.Buffer
-	if _, e = io.CopyN(&buf, r, int64(hdr.compressedSize)); e != nil {
+	if _, e := io.CopyN(&buf, r, int64(hdr.compressedSize)); e != nil {
 		return nil, fmt.Errorf("Failed to read chunk data: %v", e)
 	}
+	return &buf, nil
+}
+
+// decodeChunk verifies and decompresses the data of the chunk at
+// chunkOffset with header hdr.  o may be nil for the defaults.
+func decodeChunk(hdr *Header, buf *bytes.Buffer, chunkOffset int64, o *readOptions) (*Chunk, error) {
+	if o == nil {
+		o = newReadOptions(nil)
+	}
+
+	deflated, e := inflateChunk(hdr, buf, chunkOffset, o)
+	if e != nil {
+		return nil, e
+	}
 
-	if hdr.checkSum != crc32.ChecksumIEEE(buf.Bytes()) {
-		return nil, fmt.Errorf("Checksum checking failed.")
+	ch, e := parseRecords(hdr, deflated, chunkOffset, o)
+	if e != nil {
+		return nil, e
+	}
+	if o.bufs != nil {
+		ch.buf = deflated
 	}
 
-	deflated, e := deflateData(&buf, int(hdr.compressor))
+	if hdr.numRecords == 0 {
+		e = o.anomaly(EmptyChunk, chunkOffset, "no records")
+	} else if deflated.Len() > 0 {
+		e = o.anomaly(PaddingBytes, chunkOffset, "%d bytes after the last record", deflated.Len())
+	}
 	if e != nil {
 		return nil, e
 	}
+	return ch, nil
+}
+
+// inflateChunk verifies and decompresses the chunk data buf.
+func inflateChunk(hdr *Header, buf *bytes.Buffer, chunkOffset int64, o *readOptions) (*bytes.Buffer, error) {
+	if o.verify != Skip {
+		if e := hdr.verify(buf.Bytes()); e != nil {
+			return nil, e
+		}
+	}
 
-	ch := &Chunk{}
+	if hdr.flags&flagEncrypted != 0 {
+		plain, e := hdr.decrypt(buf.Bytes(), o)
+		if e != nil {
+			return nil, e
+		}
+		buf = bytes.NewBuffer(plain)
+	}
+
+	dict := o.header.loadedHeader().get(dictionaryKey)
+	deflated, e := deflateData(o.bufs.get(), buf, int(hdr.compressor), dict, o.maxChunkSize)
+	if e == errDeflateLimit {
+		return nil, &ChunkTooLargeError{Offset: chunkOffset, Max: o.maxChunkSize}
+	}
+	if e != nil {
+		return nil, e
+	}
+
+	if o.verify != Skip {
+		if e := hdr.verifyRaw(deflated.Bytes()); e != nil {
+			return nil, e
+		}
+	}
+	return deflated, nil
+}
+
+// parseRecords reads the records of a chunk from its decompressed data,
+// leaving any bytes after the last record in deflated.
+func parseRecords(hdr *Header, deflated *bytes.Buffer, chunkOffset int64, o *readOptions) (*Chunk, error) {
+	var e error
+	ch := &Chunk{recordSums: hdr.flags&flagRecordChecksums != 0}
+	timestamps, keys, tags := hdr.flags&flagTimestamps != 0, hdr.flags&flagKeys != 0, hdr.flags&flagTags != 0
+	var prev int64
 	for i := 0; i < int(hdr.numRecords); i++ {
+		if timestamps {
+			d, e := binary.ReadVarint(deflated)
+			if e != nil {
+				return nil, fmt.Errorf("Failed to read record timestamp: %v", e)
+			}
+			prev += d
+			ch.timestamps = append(ch.timestamps, prev)
+		}
+		if keys {
+			n, e := binary.ReadUvarint(deflated)
+			if e != nil {
+				return nil, fmt.Errorf("Failed to read record key length: %v", e)
+			}
+			if n > uint64(deflated.Len()) {
+				return nil, fmt.Errorf("Failed to read a record key: length %d exceeds chunk data", n)
+			}
+			ch.keys = append(ch.keys, append([]byte{}, deflated.Next(int(n))...))
+		}
+		if tags {
+			t, e := binary.ReadUvarint(deflated)
+			if e != nil || t > math.MaxUint16 {
+				return nil, fmt.Errorf("Failed to read record tag: %v", e)
+			}
+			ch.tags = append(ch.tags, uint16(t))
+		}
+
 		var rs [4]byte
 		if _, e = deflated.Read(rs[:]); e != nil {
 			return nil, fmt.Errorf("Failed to read record length: %v", e)
 		}
 
-		r := make([]byte, binary.LittleEndian.Uint32(rs[:]))
-		if _, e = deflated.Read(r); e != nil {
-			return nil, fmt.Errorf("Failed to read a record: %v", e)
+		n := int64(binary.LittleEndian.Uint32(rs[:]))
+		if o.maxRecordSize > 0 && n > int64(o.maxRecordSize) {
+			return nil, &RecordTooLargeError{Record: i, Offset: chunkOffset, Size: n, Max: o.maxRecordSize}
+		}
+
+		// Check before allocating, as a corrupted length could ask
+		// for gigabytes.
+		if n > int64(deflated.Len()) {
+			return nil, fmt.Errorf("Failed to read a record: length %d exceeds chunk data", n)
+		}
+
+		// The record is a slice of the chunk data, its capacity
+		// capped lest appending to it overwrite the next record.
+		r := deflated.Next(int(n))
+		r = r[:n:n]
+
+		if ch.recordSums {
+			if e = readRecordChecksum(deflated, r, o.recordVerify); e != nil {
+				return nil, fmt.Errorf("Record %d of chunk at offset %d: %v", i, chunkOffset, e)
+			}
 		}
 
 		ch.records = append(ch.records, r)
@@ -154,28 +526,142 @@ func parseChunk(r io.ReadSeeker, chunkOffset int64) (*Chunk, error) {
 	return ch, nil
 }
 
-func deflateData(src io.Reader, compressorIndex int) (*bytes.Buffer, error) {
-	var e error
-	var deflator io.Reader
-
-	switch compressorIndex {
-	case NoCompression:
-		deflator = src
-	case Snappy:
-		deflator = snappy.NewReader(src)
-	case Gzip:
-		deflator, e = gzip.NewReader(src)
-		if e != nil {
-			return nil, fmt.Errorf("Failed to create gzip reader: %v", e)
-		}
-	default:
-		return nil, fmt.Errorf("Unknown compression algorithm: %d", compressorIndex)
+// errDeflateLimit is returned by deflateData if the data exceeds the
+// limit.
+var errDeflateLimit = errors.New("recordio: deflate limit exceeded")
+
+// deflateData decompresses src into deflated, stopping with
+// errDeflateLimit after limit bytes unless limit is 0.
+func deflateData(deflated *bytes.Buffer, src io.Reader, compressorIndex int, dict []byte, limit int) (*bytes.Buffer, error) {
+	deflator, e := newDeflator(src, compressorIndex, dict)
+	if e != nil {
+		return nil, e
+	}
+
+	if limit > 0 {
+		deflator = io.LimitReader(deflator, int64(limit)+1)
 	}
 
-	deflated := new(bytes.Buffer)
 	if _, e = io.Copy(deflated, deflator); e != nil {
 		return nil, fmt.Errorf("Failed to deflate chunk data: %v", e)
 	}
 
+	if limit > 0 && deflated.Len() > limit {
+		return nil, errDeflateLimit
+	}
+
 	return deflated, nil
 }
+
+// recordOffsets returns the offset of each record within the
+// deflated data of the chunk.
+func (ch *Chunk) recordOffsets() []uint32 {
+	offsets := make([]uint32, len(ch.records))
+	offset := uint32(0)
+	var fields []byte
+	for i, r := range ch.records {
+		offsets[i] = offset
+		fields = ch.appendFields(fields[:0], i)
+		offset += uint32(len(fields))
+		offset += 4 + uint32(len(r))
+		if ch.recordSums {
+			offset += 4
+		}
+	}
+	return offsets
+}
+
+// parseRecord reads the record at recordOffset within the deflated
+// data of the chunk at chunkOffset, deflating only the data up to the
+// end of the record.  The chunk checksum is not verified, as that
+// would require reading the whole chunk, but the record checksum is,
+// if any.
+func parseRecord(r io.ReadSeeker, chunkOffset int64, recordOffset uint32) ([]byte, error) {
+	if _, e := r.Seek(chunkOffset, io.SeekStart); e != nil {
+		return nil, fmt.Errorf("Failed to seek chunk: %v", e)
+	}
+
+	hdr, e := parseHeader(r)
+	if e != nil {
+		return nil, fmt.Errorf("Failed to parse chunk header: %v", e)
+	}
+	if hdr.flags&flagEncrypted != 0 {
+		return nil, fmt.Errorf("Cannot read a record of an encrypted chunk alone")
+	}
+
+	var deflated io.Reader
+	if hdr.compressor == NoCompression {
+		if _, e = r.Seek(int64(recordOffset), io.SeekCurrent); e != nil {
+			return nil, fmt.Errorf("Failed to seek record: %v", e)
+		}
+		deflated = io.LimitReader(r, int64(hdr.compressedSize)-int64(recordOffset))
+	} else {
+		dict, e := chunkDictionary(r, hdr, chunkOffset, &headerCache{})
+		if e != nil {
+			return nil, e
+		}
+
+		deflated, e = newDeflator(io.LimitReader(r, int64(hdr.compressedSize)), int(hdr.compressor), dict)
+		if e != nil {
+			return nil, e
+		}
+
+		if _, e = io.CopyN(ioutil.Discard, deflated, int64(recordOffset)); e != nil {
+			return nil, fmt.Errorf("Failed to deflate chunk data: %v", e)
+		}
+	}
+
+	if hdr.flags&flagTimestamps != 0 {
+		if _, e = binary.ReadVarint(byteReader{deflated}); e != nil {
+			return nil, fmt.Errorf("Failed to read record timestamp: %v", e)
+		}
+	}
+	if hdr.flags&flagKeys != 0 {
+		n, e := binary.ReadUvarint(byteReader{deflated})
+		if e != nil {
+			return nil, fmt.Errorf("Failed to read record key length: %v", e)
+		}
+		if _, e = io.CopyN(ioutil.Discard, deflated, int64(n)); e != nil {
+			return nil, fmt.Errorf("Failed to read a record key: %v", e)
+		}
+	}
+	if hdr.flags&flagTags != 0 {
+		if _, e = binary.ReadUvarint(byteReader{deflated}); e != nil {
+			return nil, fmt.Errorf("Failed to read record tag: %v", e)
+		}
+	}
+
+	var rs [4]byte
+	if _, e = io.ReadFull(deflated, rs[:]); e != nil {
+		return nil, fmt.Errorf("Failed to read record length: %v", e)
+	}
+
+	// Read what the chunk holds rather than allocating what a
+	// corrupted length asks for, which could be gigabytes.
+	n := int64(binary.LittleEndian.Uint32(rs[:]))
+	var record bytes.Buffer
+	if _, e = io.CopyN(&record, deflated, n); e == io.EOF {
+		return nil, fmt.Errorf("Failed to read a record: length %d exceeds chunk data", n)
+	} else if e != nil {
+		return nil, fmt.Errorf("Failed to read a record: %v", e)
+	}
+
+	if hdr.flags&flagRecordChecksums != 0 {
+		if e = readRecordChecksum(deflated, record.Bytes(), Strict); e != nil {
+			return nil, e
+		}
+	}
+	return record.Bytes(), nil
+}
+
+// byteReader reads the varints of parseRecord byte by byte, so that
+// no data after them is consumed.
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, e := io.ReadFull(r.Reader, b[:])
+	return b[0], e
+}
@@ -0,0 +1,115 @@
+package recordio
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ChunkCache caches decoded chunks for any number of scanners and
+// Readers, of any number of files, so that access patterns revisiting
+// chunks, like shuffled epochs, decompress each chunk once.  It evicts
+// the least recently used chunks beyond its size in bytes.  It is safe
+// for concurrent use.  Records of cached chunks are shared by all
+// readers and must not be modified.
+type ChunkCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	order    *list.List // of *chunkCacheEntry, most recently used first.
+	entries  map[chunkKey]*list.Element
+}
+
+type chunkKey struct {
+	file   string
+	offset int64
+}
+
+type chunkCacheEntry struct {
+	key   chunkKey
+	chunk *Chunk
+	size  int64
+}
+
+// NewChunkCache creates a ChunkCache of up to maxBytes of records.
+func NewChunkCache(maxBytes int64) *ChunkCache {
+	return &ChunkCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[chunkKey]*list.Element),
+	}
+}
+
+// WithChunkCache makes scanners and Readers look up chunks in c before
+// decoding them, and add the chunks they decode to it.  fileID tells
+// the files sharing c apart, e.g. by their paths, and must be unique
+// to the contents of the file.
+func WithChunkCache(c *ChunkCache, fileID string) ReadOption {
+	return func(o *readOptions) {
+		o.cache = c
+		o.fileID = fileID
+	}
+}
+
+// Bytes returns the size of the cached chunks.
+func (c *ChunkCache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+func (c *ChunkCache) get(file string, offset int64) *Chunk {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[chunkKey{file, offset}]
+	if !ok {
+		return nil
+	}
+
+	c.order.MoveToFront(e)
+	return e.Value.(*chunkCacheEntry).chunk
+}
+
+func (c *ChunkCache) add(file string, offset int64, ch *Chunk) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := chunkKey{file, offset}
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+
+	// Count the slice headers of records too.
+	size := int64(ch.numBytes + 24*len(ch.records))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&chunkCacheEntry{key, ch, size})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		e := c.order.Back()
+		c.order.Remove(e)
+		old := e.Value.(*chunkCacheEntry)
+		delete(c.entries, old.key)
+		c.bytes -= old.size
+	}
+}
+
+// cachedChunk returns the chunk at offset from the cache of
+// WithChunkCache, if any.
+func (o *readOptions) cachedChunk(offset int64) *Chunk {
+	if o.cache == nil {
+		return nil
+	}
+	return o.cache.get(o.fileID, offset)
+}
+
+// cacheChunk adds the chunk at offset to the cache of WithChunkCache,
+// if any.
+func (o *readOptions) cacheChunk(offset int64, ch *Chunk) {
+	if o.cache != nil {
+		o.cache.add(o.fileID, offset, ch)
+	}
+}
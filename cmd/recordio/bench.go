@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func init() {
+	commands["bench"] = &command{
+		usage:   "[-records N] [-record-size B] [-codec C] [-chunk-bytes B] [-gets N]",
+		summary: "Measure sequential writes, sequential reads and random Gets on this machine, to tune the chunk size and codec.",
+		run:     bench,
+	}
+}
+
+func bench(fs *flag.FlagSet, args []string) error {
+	numRecords := fs.Int("records", 100000, "the number of records to write")
+	recordSize := byteSize(256)
+	fs.Var(&recordSize, "record-size", "the size of each record")
+	chunkBytes := byteSize(1 << 20)
+	fs.Var(&chunkBytes, "chunk-bytes", "the maximum size of chunks")
+	codec := fs.String("codec", "snappy", "the compressor")
+	gets := fs.Int("gets", 10000, "the number of random Gets")
+	cache := fs.Int("cache-chunks", 1, "the number of chunks cached by the Reader of Gets")
+	dir := fs.String("dir", "", "the directory of the benchmark file; defaults to the temporary directory")
+	parseArgs(fs, args, 0)
+
+	compressor, e := parseCompressor(*codec)
+	if e != nil {
+		return e
+	}
+
+	tmp, e := os.MkdirTemp(*dir, "recordio-bench")
+	if e != nil {
+		return e
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "bench.recordio")
+
+	// Distinct records of words of a random vocabulary compress like
+	// text; they repeat only beyond 64MB, past any chunk.
+	rnd := rand.New(rand.NewSource(1))
+	vocabulary := make([][]byte, 1000)
+	for i := range vocabulary {
+		vocabulary[i] = make([]byte, 3+rnd.Intn(6))
+		for j := range vocabulary[i] {
+			vocabulary[i][j] = 'a' + byte(rnd.Intn(26))
+		}
+	}
+	records := make([][]byte, min(*numRecords, max(1, 64<<20/int(recordSize))))
+	for i := range records {
+		var record []byte
+		for len(record) < int(recordSize) {
+			record = append(append(record, vocabulary[rnd.Intn(len(vocabulary))]...), ' ')
+		}
+		records[i] = record[:recordSize]
+	}
+	total := float64(*numRecords) * float64(recordSize)
+
+	f, e := os.Create(path)
+	if e != nil {
+		return e
+	}
+	start := time.Now()
+	w := recordio.NewWriter(f, int(chunkBytes), compressor, recordio.WithFooterIndex(true))
+	for i := 0; i < *numRecords; i++ {
+		if _, e = w.Write(records[i%len(records)]); e != nil {
+			return e
+		}
+	}
+	if e = w.Close(); e != nil {
+		return e
+	}
+	if e = f.Sync(); e != nil {
+		return e
+	}
+	if e = f.Close(); e != nil {
+		return e
+	}
+	report("write", time.Since(start), *numRecords, total)
+
+	fi, e := os.Stat(path)
+	if e != nil {
+		return e
+	}
+	idx := w.Index()
+	fmt.Printf("file:   %d bytes, %d chunks, ratio %s\n", fi.Size(), idx.NumChunks(), ratio(int64(total), fi.Size()))
+
+	f, e = os.Open(path)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	start = time.Now()
+	s := recordio.NewRangeScanner(f, idx, 0, -1)
+	for s.Scan() {
+	}
+	if e = s.Err(); e != nil {
+		return e
+	}
+	report("read", time.Since(start), *numRecords, total)
+
+	if *gets <= 0 || *numRecords == 0 {
+		return nil
+	}
+	r := recordio.NewReader(f, idx, *cache)
+	latencies := make([]time.Duration, *gets)
+	start = time.Now()
+	for i := range latencies {
+		t := time.Now()
+		if _, e = r.Get(rnd.Intn(*numRecords)); e != nil {
+			return e
+		}
+		latencies[i] = time.Since(t)
+	}
+	report("get", time.Since(start), *gets, float64(*gets)*float64(recordSize))
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Printf("get latency: p50 %v, p90 %v, p99 %v, max %v\n",
+		latencies[len(latencies)/2], latencies[len(latencies)*9/10],
+		latencies[len(latencies)*99/100], latencies[len(latencies)-1])
+	return nil
+}
+
+// report prints the throughput of n records of total bytes in d.
+func report(name string, d time.Duration, n int, total float64) {
+	sec := d.Seconds()
+	fmt.Printf("%-6s  %v, %.0f records/s, %.1f MB/s\n", name+":", d.Round(time.Millisecond), float64(n)/sec, total/sec/1e6)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func init() {
+	commands["cat"] = &command{
+		usage:   "FILE [-start N] [-count M] [-format raw|hex|base64|jsonl]",
+		summary: "Print the records of FILE, one per line.",
+		run:     cat,
+	}
+}
+
+func cat(fs *flag.FlagSet, args []string) error {
+	start := fs.Int("start", 0, "the index of the first record to print")
+	count := fs.Int("count", -1, "the number of records to print; -1 means all")
+	format := fs.String("format", "raw", "the format of records: raw, hex, base64, or jsonl, which prints JSON records as they are and others as JSON strings")
+	path := parseArgs(fs, args, 1)[0]
+
+	printRecord, ok := recordFormats[*format]
+	if !ok {
+		return fmt.Errorf("Unknown format: %s", *format)
+	}
+
+	f, idx, e := openIndexed(path)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	s := recordio.NewRangeScanner(f, idx, *start, *count)
+	for s.Scan() {
+		if e = printRecord(out, s.Record()); e != nil {
+			return e
+		}
+	}
+	if e = s.Err(); e != nil {
+		return e
+	}
+	return out.Flush()
+}
+
+// recordFormats print a record as a line.
+var recordFormats = map[string]func(w io.Writer, record []byte) error{
+	"raw": func(w io.Writer, record []byte) error {
+		_, e := fmt.Fprintf(w, "%s\n", record)
+		return e
+	},
+	"hex": func(w io.Writer, record []byte) error {
+		_, e := fmt.Fprintln(w, hex.EncodeToString(record))
+		return e
+	},
+	"base64": func(w io.Writer, record []byte) error {
+		_, e := fmt.Fprintln(w, base64.StdEncoding.EncodeToString(record))
+		return e
+	},
+	"jsonl": func(w io.Writer, record []byte) error {
+		var line bytes.Buffer
+		if json.Compact(&line, record) != nil {
+			line.Reset()
+			s, _ := json.Marshal(string(record))
+			line.Write(s)
+		}
+		line.WriteByte('\n')
+		_, e := w.Write(line.Bytes())
+		return e
+	},
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func init() {
+	commands["from-jsonl"] = &command{
+		usage:   "IN OUT [-codec C]",
+		summary: "Write every JSON line of IN, - for stdin, as a record of OUT.",
+		run:     fromJSONL,
+	}
+	commands["to-jsonl"] = &command{
+		usage:   "IN [-o OUT]",
+		summary: "Print the records of IN as JSON lines, quoting those that are not JSON.",
+		run:     toJSONL,
+	}
+	commands["from-csv"] = &command{
+		usage:   "IN OUT [-columns COL[=FIELD],...] [-codec C]",
+		summary: "Write every row of the CSV file IN, - for stdin, as a JSON object record of OUT, keyed by the header row.",
+		run:     fromCSV,
+	}
+	commands["to-csv"] = &command{
+		usage:   "IN [-columns FIELD[=COL],...] [-o OUT]",
+		summary: "Print the JSON object records of IN as CSV rows.",
+		run:     toCSV,
+	}
+}
+
+func fromJSONL(fs *flag.FlagSet, args []string) error {
+	codec := fs.String("codec", "snappy", "the compressor of OUT")
+	paths := parseArgs(fs, args, 2)
+
+	in, e := openInput(paths[0])
+	if e != nil {
+		return e
+	}
+	defer in.Close()
+
+	return writeRecords(paths[1], *codec, func(w *recordio.Writer) error {
+		r := bufio.NewReader(in)
+		for line := 1; ; line++ {
+			l, e := r.ReadBytes('\n')
+			if e != nil && e != io.EOF {
+				return e
+			}
+
+			if l = bytes.TrimSpace(l); len(l) > 0 {
+				if !json.Valid(l) {
+					return fmt.Errorf("Invalid JSON at line %d", line)
+				}
+				if _, e := w.Write(l); e != nil {
+					return e
+				}
+			}
+			if e == io.EOF {
+				return nil
+			}
+		}
+	})
+}
+
+func toJSONL(fs *flag.FlagSet, args []string) error {
+	outPath := fs.String("o", "-", "the output file; - for stdout")
+	path := parseArgs(fs, args, 1)[0]
+
+	return readRecords(path, *outPath, func(out io.Writer, record []byte) error {
+		return recordFormats["jsonl"](out, record)
+	}, nil)
+}
+
+func fromCSV(fs *flag.FlagSet, args []string) error {
+	columns := fs.String("columns", "", "the columns to keep, renamed to FIELD if given; defaults to all")
+	codec := fs.String("codec", "snappy", "the compressor of OUT")
+	paths := parseArgs(fs, args, 2)
+
+	in, e := openInput(paths[0])
+	if e != nil {
+		return e
+	}
+	defer in.Close()
+
+	r := csv.NewReader(in)
+	header, e := r.Read()
+	if e != nil {
+		return fmt.Errorf("Failed to read CSV header: %v", e)
+	}
+
+	// The fields of the columns of the header; "" drops a column.
+	fields := header
+	if *columns != "" {
+		mapping := parseMapping(*columns)
+		fields = make([]string, len(header))
+		for i, col := range header {
+			fields[i] = mapping[col]
+			delete(mapping, col)
+		}
+		if len(mapping) > 0 {
+			return fmt.Errorf("Unknown columns in -columns: %s", *columns)
+		}
+	}
+
+	return writeRecords(paths[1], *codec, func(w *recordio.Writer) error {
+		for {
+			row, e := r.Read()
+			if e == io.EOF {
+				return nil
+			}
+			if e != nil {
+				return e
+			}
+
+			obj := make(map[string]string, len(row))
+			for i, v := range row {
+				if fields[i] != "" {
+					obj[fields[i]] = v
+				}
+			}
+			record, e := json.Marshal(obj)
+			if e != nil {
+				return e
+			}
+			if _, e = w.Write(record); e != nil {
+				return e
+			}
+		}
+	})
+}
+
+func toCSV(fs *flag.FlagSet, args []string) error {
+	columns := fs.String("columns", "", "the fields to print, in columns named COL if given; defaults to the fields of the first record")
+	outPath := fs.String("o", "-", "the output file; - for stdout")
+	path := parseArgs(fs, args, 1)[0]
+
+	var fields []string
+	mapping := parseMapping(*columns)
+	for _, c := range strings.Split(*columns, ",") {
+		if c != "" {
+			fields = append(fields, strings.SplitN(c, "=", 2)[0])
+		}
+	}
+
+	var cw *csv.Writer
+	return readRecords(path, *outPath, func(out io.Writer, record []byte) error {
+		var obj map[string]json.RawMessage
+		if e := json.Unmarshal(record, &obj); e != nil {
+			return fmt.Errorf("Record is not a JSON object: %v", e)
+		}
+
+		if cw == nil {
+			cw = csv.NewWriter(out)
+			if fields == nil {
+				for k := range obj {
+					fields = append(fields, k)
+					mapping[k] = k
+				}
+				sort.Strings(fields)
+			}
+
+			header := make([]string, len(fields))
+			for i, f := range fields {
+				header[i] = mapping[f]
+			}
+			if e := cw.Write(header); e != nil {
+				return e
+			}
+		}
+
+		// Strings go unquoted, other values as JSON.
+		row := make([]string, len(fields))
+		for i, f := range fields {
+			if v, ok := obj[f]; ok && json.Unmarshal(v, &row[i]) != nil {
+				row[i] = string(v)
+			}
+		}
+		return cw.Write(row)
+	}, func() error {
+		if cw == nil {
+			return nil
+		}
+		cw.Flush()
+		return cw.Error()
+	})
+}
+
+// parseMapping parses a list of NAME[=RENAMED], where RENAMED defaults to
+// NAME.
+func parseMapping(list string) map[string]string {
+	m := map[string]string{}
+	for _, c := range strings.Split(list, ",") {
+		if c == "" {
+			continue
+		}
+		kv := strings.SplitN(c, "=", 2)
+		m[kv[0]] = kv[len(kv)-1]
+	}
+	return m
+}
+
+// openInput opens the file path, or stdin for -.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// writeRecords creates the recordio file path, with a footer index,
+// and writes the records of fn into it.
+func writeRecords(path, codec string, fn func(w *recordio.Writer) error) error {
+	compressor, e := parseCompressor(codec)
+	if e != nil {
+		return e
+	}
+
+	w, e := recordio.CreateAtomic(path, recordio.WithCompressor(compressor), recordio.WithFooterIndex(true))
+	if e != nil {
+		return e
+	}
+	if e = fn(w); e != nil {
+		w.Abort()
+		return e
+	}
+	return w.Close()
+}
+
+// readRecords calls fn with every record of the recordio file path and
+// the output file outPath, - for stdout, and then done if not nil.
+func readRecords(path, outPath string, fn func(out io.Writer, record []byte) error, done func() error) error {
+	f, idx, e := openIndexed(path)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	dst := os.Stdout
+	if outPath != "-" {
+		if dst, e = os.Create(outPath); e != nil {
+			return e
+		}
+		defer dst.Close()
+	}
+
+	out := bufio.NewWriter(dst)
+	s := recordio.NewRangeScanner(f, idx, 0, -1)
+	for s.Scan() {
+		if e = fn(out, s.Record()); e != nil {
+			return e
+		}
+	}
+	if e = s.Err(); e != nil {
+		return e
+	}
+	if done != nil {
+		if e = done(); e != nil {
+			return e
+		}
+	}
+	if e = out.Flush(); e != nil {
+		return e
+	}
+	if dst != os.Stdout {
+		return dst.Close()
+	}
+	return nil
+}
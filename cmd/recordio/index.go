@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+var indexFormats = map[string]recordio.IndexFormat{
+	"binary": recordio.IndexBinary,
+	"gob":    recordio.IndexGob,
+	"json":   recordio.IndexJSON,
+	"proto":  recordio.IndexProto,
+}
+
+func init() {
+	commands["index"] = &command{
+		usage:   "FILE [-o FILE.idx] [-format binary|gob|json|proto] [-footer COPY]",
+		summary: "Save the Index of FILE next to it, for LoadIndexFile, or write a copy of FILE with a footer index.",
+		run:     index,
+	}
+}
+
+func index(fs *flag.FlagSet, args []string) error {
+	outPath := fs.String("o", "", "the index file; defaults to FILE.idx")
+	format := fs.String("format", "binary", "the format of the index file")
+	footer := fs.String("footer", "", "write a copy of FILE with a footer index into COPY, instead of an index file")
+	path := parseArgs(fs, args, 1)[0]
+
+	if *footer != "" {
+		return copyWithFooter(path, *footer)
+	}
+
+	f, ok := indexFormats[*format]
+	if !ok {
+		return fmt.Errorf("Unknown index format: %s", *format)
+	}
+	if *outPath == "" {
+		*outPath = path + ".idx"
+	}
+
+	in, idx, e := openIndexed(path)
+	if e != nil {
+		return e
+	}
+	in.Close()
+
+	out, e := os.Create(*outPath)
+	if e != nil {
+		return e
+	}
+	if e = idx.SaveAs(out, f); e != nil {
+		out.Close()
+		return e
+	}
+	if e = out.Close(); e != nil {
+		return e
+	}
+
+	fmt.Printf("%s\t%d chunks\t%d records\n", *outPath, idx.NumChunks(), idx.NumRecords)
+	return nil
+}
+
+// copyWithFooter copies the recordio file path to dst, and appends a
+// footer index to dst unless it has one.
+func copyWithFooter(path, dst string) error {
+	in, e := os.Open(path)
+	if e != nil {
+		return e
+	}
+	defer in.Close()
+
+	out, e := os.Create(dst)
+	if e != nil {
+		return e
+	}
+	defer out.Close()
+
+	if _, e = io.Copy(out, in); e != nil {
+		return e
+	}
+
+	w, e := recordio.NewAppendWriter(out, -1, -1, recordio.WithFooterIndex(true))
+	if e == nil {
+		e = w.Close()
+	}
+	if e == nil {
+		e = out.Close()
+	}
+	if e != nil {
+		os.Remove(dst)
+		return fmt.Errorf("Failed to write footer index: %v", e)
+	}
+
+	idx := w.Index()
+	fmt.Printf("%s\t%d chunks\t%d records\n", dst, idx.NumChunks(), idx.NumRecords)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func init() {
+	commands["inspect"] = &command{
+		usage:   "FILE",
+		summary: "Print the chunks of FILE, their sizes and compression, and whether it has a footer index.",
+		run:     inspect,
+	}
+}
+
+func inspect(fs *flag.FlagSet, args []string) error {
+	chunks := fs.Bool("chunks", true, "print every chunk")
+	path := parseArgs(fs, args, 1)[0]
+
+	f, e := os.Open(path)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	rep, e := recordio.Verify(f)
+	if e != nil {
+		return e
+	}
+
+	var compressed, raw int64
+	for _, c := range rep.Chunks {
+		compressed += c.CompressedSize
+		raw += c.RawSize
+	}
+
+	fmt.Printf("chunks:       %d\n", len(rep.Chunks))
+	fmt.Printf("records:      %d\n", rep.NumRecords)
+	fmt.Printf("compressed:   %d bytes\n", compressed)
+	fmt.Printf("uncompressed: %d bytes (ratio %s)\n", raw, ratio(raw, compressed))
+	fmt.Printf("footer index: %s\n", presence(rep.Footer, rep.FooterErr))
+	if rep.HeaderErr != nil {
+		fmt.Printf("file header:  broken: %v\n", rep.HeaderErr)
+	}
+
+	if *chunks && len(rep.Chunks) > 0 {
+		fmt.Println()
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "chunk\toffset\trecords\tcodec\tcompressed\tuncompressed\tratio\t")
+		for i, c := range rep.Chunks {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%d\t%d\t%s\t", i, c.Offset, c.NumRecords,
+				compressorName(c.Compressor), c.CompressedSize, c.RawSize, ratio(c.RawSize, c.CompressedSize))
+			if c.Err != nil {
+				fmt.Fprintf(tw, " %v", c.Err)
+			}
+			fmt.Fprintln(tw)
+		}
+		tw.Flush()
+	}
+	return nil
+}
+
+// ratio formats the compression ratio of raw bytes compressed into
+// compressed bytes.
+func ratio(raw, compressed int64) string {
+	if compressed == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", float64(raw)/float64(compressed))
+}
+
+// presence formats whether a part of a file is present, and valid.
+func presence(present bool, e error) string {
+	if !present {
+		return "no"
+	}
+	if e != nil {
+		return fmt.Sprintf("broken: %v", e)
+	}
+	return "yes"
+}
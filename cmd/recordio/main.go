@@ -0,0 +1,170 @@
+// Command recordio inspects and manipulates RecordIO files.
+//
+// Usage:
+//
+//	recordio <command> [arguments]
+//
+// Run "recordio <command> -h" for the arguments of a command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+// A command is a subcommand of recordio.
+type command struct {
+	usage   string // the arguments, after the name of the command.
+	summary string
+	run     func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]*command{}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	name := os.Args[1]
+	c, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "recordio: unknown command %q\n", name)
+		usage()
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: recordio %s %s\n\n%s\n", name, c.usage, c.summary)
+		fs.PrintDefaults()
+	}
+	if e := c.run(fs, os.Args[2:]); e != nil {
+		fmt.Fprintf(os.Stderr, "recordio %s: %v\n", name, e)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: recordio <command> [arguments]\n\ncommands:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].summary)
+	}
+	os.Exit(2)
+}
+
+// parseArgs parses the flags of fs in args, which may follow the
+// positional arguments, and returns the n positional arguments, or all
+// of them if n < 0.
+func parseArgs(fs *flag.FlagSet, args []string, n int) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if n >= 0 && len(positional) != n {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return positional
+}
+
+// openIndexed opens the recordio file path and loads its Index, from
+// the footer if any.
+func openIndexed(path string) (*os.File, *recordio.Index, error) {
+	f, e := os.Open(path)
+	if e != nil {
+		return nil, nil, e
+	}
+
+	idx, e := recordio.LoadIndexFromFooter(f)
+	if e == recordio.ErrNoFooter {
+		if _, e = f.Seek(0, io.SeekStart); e == nil {
+			idx, e = recordio.LoadIndex(f)
+		}
+	}
+	if e != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("Failed to load index of %s: %v", path, e)
+	}
+	return f, idx, nil
+}
+
+var compressorNames = map[int]string{
+	recordio.NoCompression: "none",
+	recordio.Snappy:        "snappy",
+	recordio.Gzip:          "gzip",
+	recordio.Zstd:          "zstd",
+	recordio.LZ4:           "lz4",
+}
+
+// compressorName returns the name of a compressor for flags and
+// reports.
+func compressorName(c int) string {
+	if name, ok := compressorNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("codec%d", c)
+}
+
+// parseCompressor parses the name of a compressor.
+func parseCompressor(name string) (int, error) {
+	for c, n := range compressorNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown compressor: %s", name)
+}
+
+// byteSize is a flag of a size in bytes, with an optional suffix like
+// KiB, MiB or GiB, or their decimal KB, MB and GB.
+type byteSize int64
+
+var sizeSuffixes = []struct {
+	suffix string
+	scale  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	scale := int64(1)
+	for _, suffix := range sizeSuffixes {
+		if strings.HasSuffix(s, suffix.suffix) {
+			s, scale = strings.TrimSuffix(s, suffix.suffix), suffix.scale
+			break
+		}
+	}
+
+	n, e := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if e != nil {
+		return fmt.Errorf("Invalid size: %s", s)
+	}
+	*b = byteSize(n * scale)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func init() {
+	commands["merge"] = &command{
+		usage:   "OUT IN...",
+		summary: "Concatenate the files IN into OUT with a footer index, copying their chunks without recompressing them.",
+		run:     merge,
+	}
+}
+
+func merge(fs *flag.FlagSet, args []string) error {
+	paths := parseArgs(fs, args, -1)
+	if len(paths) < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	out, e := os.Create(paths[0])
+	if e != nil {
+		return e
+	}
+	defer out.Close()
+
+	w := recordio.NewWriter(out, -1, -1, recordio.WithFooterIndex(true))
+	for _, path := range paths[1:] {
+		if e = mergeFile(w, path); e != nil {
+			w.Abort()
+			out.Close()
+			os.Remove(paths[0])
+			return e
+		}
+	}
+
+	if e = w.Close(); e != nil {
+		return e
+	}
+	if e = out.Close(); e != nil {
+		return e
+	}
+
+	idx := w.Index()
+	fmt.Printf("%s\t%d chunks\t%d records\n", paths[0], idx.NumChunks(), idx.NumRecords)
+	return nil
+}
+
+// mergeFile copies the chunks of the file path into w.
+func mergeFile(w *recordio.Writer, path string) error {
+	f, idx, e := openIndexed(path)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	if e = w.CopyChunks(f, idx, 0, idx.NumChunks()); e != nil {
+		return fmt.Errorf("Failed to copy %s: %v", path, e)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func init() {
+	commands["repack"] = &command{
+		usage:   "IN OUT [-codec C] [-level N] [-chunk-bytes B] [-chunk-records N]",
+		summary: "Write the records of IN, in order, into OUT with another compression or chunking.",
+		run:     repack,
+	}
+}
+
+func repack(fs *flag.FlagSet, args []string) error {
+	codec := fs.String("codec", "snappy", "the compressor of OUT")
+	level := fs.Int("level", 0, "the compression level; 0 means the default of the compressor")
+	chunkBytes := byteSize(32 << 20)
+	fs.Var(&chunkBytes, "chunk-bytes", "the maximum size of the chunks of OUT")
+	chunkRecords := fs.Int("chunk-records", 0, "the maximum number of records of the chunks of OUT; 0 means no limit")
+	workers := fs.Int("workers", 1, "the number of compression goroutines")
+	paths := parseArgs(fs, args, 2)
+
+	compressor, e := parseCompressor(*codec)
+	if e != nil {
+		return e
+	}
+
+	f, idx, e := openIndexed(paths[0])
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	w, e := recordio.CreateAtomic(paths[1],
+		recordio.WithCompressor(compressor),
+		recordio.WithCompressionLevel(*level),
+		recordio.WithMaxChunkBytes(int(chunkBytes)),
+		recordio.WithMaxChunkRecords(*chunkRecords),
+		recordio.WithCompressionWorkers(*workers),
+		recordio.WithFooterIndex(true))
+	if e != nil {
+		return e
+	}
+
+	s := recordio.NewRangeScanner(f, idx, 0, -1, recordio.WithPrefetch(2, -1))
+	defer s.Close()
+	for s.Scan() {
+		if _, e = w.Write(s.Record()); e != nil {
+			break
+		}
+	}
+	if e == nil {
+		e = s.Err()
+	}
+	if e != nil {
+		w.Abort()
+		return e
+	}
+	if e = w.Close(); e != nil {
+		return e
+	}
+
+	out := w.Index()
+	fmt.Printf("%s\t%d chunks\t%d records\n", paths[1], out.NumChunks(), out.NumRecords)
+	return nil
+}
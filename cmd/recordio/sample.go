@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func init() {
+	commands["sample"] = &command{
+		usage:   "FILE -fraction F -o OUT [-seed S] [-codec C]",
+		summary: "Write a random subset of the records of FILE into OUT, the same for the same seed.",
+		run:     sample,
+	}
+}
+
+func sample(fs *flag.FlagSet, args []string) error {
+	fraction := fs.Float64("fraction", 0.01, "the probability of each record to be kept")
+	seed := fs.Int64("seed", 0, "the seed of the selection")
+	outPath := fs.String("o", "", "the output file")
+	codec := fs.String("codec", "snappy", "the compressor of OUT")
+	path := parseArgs(fs, args, 1)[0]
+
+	if *outPath == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *fraction < 0 || *fraction > 1 {
+		return fmt.Errorf("Invalid fraction: %v", *fraction)
+	}
+
+	f, idx, e := openIndexed(path)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	n := 0
+	e = writeRecords(*outPath, *codec, func(w *recordio.Writer) error {
+		s := recordio.NewSampleScanner(f, idx, *fraction, *seed)
+		for s.Scan() {
+			if _, e := w.Write(s.Record()); e != nil {
+				return e
+			}
+			n++
+		}
+		return s.Err()
+	})
+	if e != nil {
+		return e
+	}
+
+	fmt.Printf("%s\t%d of %d records\n", *outPath, n, idx.NumRecords)
+	return nil
+}
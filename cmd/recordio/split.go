@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func init() {
+	commands["split"] = &command{
+		usage:   "FILE -records-per-shard N | -bytes-per-shard N [-o PREFIX]",
+		summary: "Split FILE into shards PREFIX-00000-of-0000N, copying whole chunks without recompressing them.",
+		run:     split,
+	}
+}
+
+func split(fs *flag.FlagSet, args []string) error {
+	records := fs.Int("records-per-shard", 0, "the number of records of each shard, the last one aside")
+	bytes := fs.Int64("bytes-per-shard", 0, "the size of each shard, rounded up to whole chunks")
+	prefix := fs.String("o", "", "the prefix of the shards; defaults to FILE")
+	codec := fs.String("codec", "snappy", "the compressor of the chunks cut by -records-per-shard")
+	path := parseArgs(fs, args, 1)[0]
+
+	if (*records > 0) == (*bytes > 0) {
+		return fmt.Errorf("Exactly one of -records-per-shard and -bytes-per-shard must be positive")
+	}
+	compressor, e := parseCompressor(*codec)
+	if e != nil {
+		return e
+	}
+	if *prefix == "" {
+		*prefix = path
+	}
+
+	f, idx, e := openIndexed(path)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	// The records starting each shard, and after the last one.
+	cum := cumulativeRecords(idx)
+	cuts := []int{0}
+	if *records > 0 {
+		for n := *records; n < idx.NumRecords; n += *records {
+			cuts = append(cuts, n)
+		}
+	} else {
+		first := 0
+		for c := 1; c < idx.NumChunks(); c++ {
+			if idx.ChunkOffsets[c]-idx.ChunkOffsets[first] >= *bytes {
+				cuts = append(cuts, cum[c])
+				first = c
+			}
+		}
+	}
+	cuts = append(cuts, idx.NumRecords)
+
+	numShards := len(cuts) - 1
+	for i := 0; i < numShards; i++ {
+		name := recordio.ShardName(*prefix, i, numShards)
+		out, e := os.Create(name)
+		if e != nil {
+			return e
+		}
+
+		w := recordio.NewWriter(out, -1, compressor, recordio.WithFooterIndex(true))
+		e = copyRecords(w, f, idx, cum, cuts[i], cuts[i+1])
+		if ce := w.Close(); e == nil {
+			e = ce
+		}
+		if ce := out.Close(); e == nil {
+			e = ce
+		}
+		if e != nil {
+			return fmt.Errorf("Failed to write %s: %v", name, e)
+		}
+		fmt.Printf("%s\t%d records\n", name, cuts[i+1]-cuts[i])
+	}
+	return nil
+}
+
+// cumulativeRecords returns the number of records before each chunk
+// of idx, and in total.
+func cumulativeRecords(idx *recordio.Index) []int {
+	cum := make([]int, idx.NumChunks()+1)
+	for c, n := range idx.ChunkRecords {
+		cum[c+1] = cum[c] + n
+	}
+	return cum
+}
+
+// copyRecords writes the records [start, end) of f into w, copying the
+// chunks holding only such records as they are, and writing the
+// records of the others again.
+func copyRecords(w *recordio.Writer, f *os.File, idx *recordio.Index, cum []int, start, end int) error {
+	for c := 0; c < idx.NumChunks() && cum[c] < end; {
+		if cum[c+1] <= start {
+			c++
+			continue
+		}
+
+		if start <= cum[c] && cum[c+1] <= end {
+			last := c + 1
+			for last < idx.NumChunks() && cum[last+1] <= end {
+				last++
+			}
+			if e := w.CopyChunks(f, idx, c, last); e != nil {
+				return e
+			}
+			c = last
+			continue
+		}
+
+		from, to := max(start, cum[c]), min(end, cum[c+1])
+		s := recordio.NewRangeScanner(f, idx, from, to-from)
+		for s.Scan() {
+			if _, e := w.Write(s.Record()); e != nil {
+				return e
+			}
+		}
+		if e := s.Err(); e != nil {
+			return e
+		}
+		c++
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+
+	// Chunks of uneven numbers of records, so that shards cut some of
+	// them and copy others whole.
+	chunkLens := []int{5, 1, 4, 3, 7, 2}
+	var records []string
+	f, e := os.Create(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	w := recordio.NewWriter(f, -1, recordio.Snappy)
+	for _, n := range chunkLens {
+		for i := 0; i < n; i++ {
+			r := fmt.Sprintf("record %d", len(records))
+			if _, e := w.Write([]byte(r)); e != nil {
+				t.Fatal(e)
+			}
+			records = append(records, r)
+		}
+		if e := w.Flush(); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e := w.Close(); e != nil {
+		t.Fatal(e)
+	}
+	if e := f.Close(); e != nil {
+		t.Fatal(e)
+	}
+
+	for _, perShard := range []int{1, 3, 4, 5, 7, 21, 100} {
+		prefix := filepath.Join(dir, "shard"+strconv.Itoa(perShard))
+		args := []string{"-records-per-shard", strconv.Itoa(perShard), "-o", prefix, path}
+		if e := split(flag.NewFlagSet("split", flag.ContinueOnError), args); e != nil {
+			t.Fatalf("split -records-per-shard %d: %v", perShard, e)
+		}
+
+		numShards := (len(records) + perShard - 1) / perShard
+		var got []string
+		for i := 0; i < numShards; i++ {
+			name := recordio.ShardName(prefix, i, numShards)
+			s, e := recordio.NewScanner(name)
+			if e != nil {
+				t.Fatal(e)
+			}
+			n := 0
+			for s.Scan() {
+				got = append(got, string(s.Record()))
+				n++
+			}
+			if e := s.Err(); e != nil {
+				t.Fatalf("%s: %v", name, e)
+			}
+			s.Close()
+
+			if want := min(perShard, len(records)-i*perShard); n != want {
+				t.Fatalf("%s has %d records, want %d", name, n, want)
+			}
+		}
+
+		if len(got) != len(records) {
+			t.Fatalf("shards of %d records hold %d records, want %d", perShard, len(got), len(records))
+		}
+		for i := range records {
+			if got[i] != records[i] {
+				t.Fatalf("shards of %d records: record %d is %q, want %q", perShard, i, got[i], records[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+// errCorrupt makes verify exit with status 1 once all files are
+// reported.
+var errCorrupt = errors.New("corruption found")
+
+func init() {
+	commands["verify"] = &command{
+		usage:   "FILE... [-v]",
+		summary: "Check the checksums and structure of every FILE, exiting with status 1 on corruption.",
+		run:     verify,
+	}
+}
+
+func verify(fs *flag.FlagSet, args []string) error {
+	verbose := fs.Bool("v", false, "print valid chunks too")
+	paths := parseArgs(fs, args, -1)
+	if len(paths) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var failed error
+	for _, path := range paths {
+		ok, e := verifyFile(path, *verbose)
+		if e != nil {
+			return e
+		}
+		if !ok {
+			failed = errCorrupt
+		}
+	}
+	return failed
+}
+
+// verifyFile prints the report of Verify on path, and tells whether it
+// is free of errors.
+func verifyFile(path string, verbose bool) (bool, error) {
+	f, e := os.Open(path)
+	if e != nil {
+		return false, e
+	}
+	defer f.Close()
+
+	rep, e := recordio.Verify(f)
+	if e != nil {
+		return false, fmt.Errorf("Failed to verify %s: %v", path, e)
+	}
+
+	if rep.HeaderErr != nil {
+		fmt.Printf("%s: file header: %v\n", path, rep.HeaderErr)
+	}
+	broken := 0
+	for i, c := range rep.Chunks {
+		if c.Err != nil {
+			broken++
+			fmt.Printf("%s: chunk %d at %d: %v\n", path, i, c.Offset, c.Err)
+		} else if verbose {
+			fmt.Printf("%s: chunk %d at %d: %d records, ok\n", path, i, c.Offset, c.NumRecords)
+		}
+	}
+	if rep.FooterErr != nil {
+		fmt.Printf("%s: footer index: %v\n", path, rep.FooterErr)
+	}
+
+	status := "ok"
+	if !rep.OK() {
+		status = "CORRUPT"
+	}
+	fmt.Printf("%s: %s: %d chunks, %d broken, %d valid records, footer index: %s\n",
+		path, status, len(rep.Chunks), broken, rep.NumRecords, presence(rep.Footer, rep.FooterErr))
+	return rep.OK(), nil
+}
@@ -0,0 +1,45 @@
+// Package codecs provides the codecs of recordio.TypedWriter and
+// recordio.TypedScanner that depend on third-party packages: protobuf
+// and MessagePack.
+package codecs
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Proto encodes protobuf messages in the binary wire format.  T is the
+// pointer type of generated messages, like *examplepb.Example:
+//
+//	w := recordio.NewTypedWriter(rw, codecs.Proto[*examplepb.Example]{})
+type Proto[T proto.Message] struct{}
+
+// Marshal implements recordio.Codec.
+func (Proto[T]) Marshal(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+// Unmarshal implements recordio.Codec, allocating a new message, as
+// *v is the nil pointer.
+func (Proto[T]) Unmarshal(data []byte, v *T) error {
+	m := (*v).ProtoReflect().Type().New().Interface()
+	if e := proto.Unmarshal(data, m); e != nil {
+		return e
+	}
+	*v = m.(T)
+	return nil
+}
+
+// Msgpack encodes values in MessagePack, by the struct tags "msgpack"
+// of github.com/vmihailenco/msgpack.
+type Msgpack[T any] struct{}
+
+// Marshal implements recordio.Codec.
+func (Msgpack[T]) Marshal(v T) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal implements recordio.Codec.
+func (Msgpack[T]) Unmarshal(data []byte, v *T) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,65 @@
+package codecs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/codecs"
+)
+
+func TestProto(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewTypedWriter(recordio.NewWriter(&buf, -1, recordio.Snappy), codecs.Proto[*wrapperspb.StringValue]{})
+	for _, s := range []string{"a", "", "c"} {
+		if err := w.Write(wrapperspb.String(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	s := recordio.NewTypedScanner(recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), codecs.Proto[*wrapperspb.StringValue]{})
+	var got []string
+	for s.Scan() {
+		got = append(got, s.Value().GetValue())
+	}
+	if s.Err() != nil || len(got) != 3 || got[0] != "a" || got[1] != "" || got[2] != "c" {
+		t.Fatal("unexpected values:", got, s.Err())
+	}
+
+	// Records of another message fail to decode.
+	s2 := recordio.NewTypedScanner(recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), codecs.Proto[*structpb.ListValue]{})
+	if s2.Scan() || s2.Err() == nil {
+		t.Fatal("expected an error of a mismatched message")
+	}
+}
+
+type example struct {
+	ID     int       `msgpack:"id"`
+	Label  string    `msgpack:"label"`
+	Values []float32 `msgpack:"values"`
+}
+
+func TestMsgpack(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewTypedWriter(recordio.NewWriter(&buf, -1, recordio.NoCompression), codecs.Msgpack[example]{})
+	for i := 0; i < 100; i++ {
+		w.Write(example{ID: i, Label: "cat", Values: []float32{float32(i), 0.5}})
+	}
+	w.Close()
+
+	s := recordio.NewTypedScanner(recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), codecs.Msgpack[example]{})
+	n := 0
+	for s.Scan() {
+		if v := s.Value(); v.ID != n || v.Label != "cat" || len(v.Values) != 2 || v.Values[0] != float32(n) {
+			t.Fatal("unexpected value:", v)
+		}
+		n++
+	}
+	if s.Err() != nil || n != 100 {
+		t.Fatal("unexpected scan:", s.Err(), n)
+	}
+}
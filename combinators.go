@@ -0,0 +1,170 @@
+package recordio
+
+import (
+	"fmt"
+	"io"
+)
+
+// Concat returns a RecordScanner of the records of srcs, one scanner
+// after the other.  It stops at the first error of one.
+func Concat(srcs ...RecordScanner) RecordScanner {
+	return &concatScanner{srcs: srcs}
+}
+
+type concatScanner struct {
+	srcs []RecordScanner
+	cur  int
+	err  error
+}
+
+func (s *concatScanner) Scan() bool {
+	for s.err == nil && s.cur < len(s.srcs) {
+		if s.srcs[s.cur].Scan() {
+			return true
+		}
+		if s.err = s.srcs[s.cur].Err(); s.err == nil {
+			s.cur++
+		}
+	}
+	return false
+}
+
+func (s *concatScanner) Record() []byte {
+	return s.srcs[s.cur].Record()
+}
+
+func (s *concatScanner) Err() error {
+	return s.err
+}
+
+// Take returns a RecordScanner of the first n records of src.
+func Take(src RecordScanner, n int) RecordScanner {
+	return &takeScanner{src: src, left: n}
+}
+
+type takeScanner struct {
+	src  RecordScanner
+	left int
+}
+
+func (s *takeScanner) Scan() bool {
+	if s.left <= 0 {
+		return false
+	}
+	s.left--
+	return s.src.Scan()
+}
+
+func (s *takeScanner) Record() []byte {
+	return s.src.Record()
+}
+
+func (s *takeScanner) Err() error {
+	return s.src.Err()
+}
+
+// Repeat returns a RecordScanner of the records of k scanners returned
+// by open one after the other, like k passes over a file, or forever if
+// k < 0.  Scanners are closed at their end if they are io.Closers.
+func Repeat(open func() (RecordScanner, error), k int) RecordScanner {
+	return &repeatScanner{open: open, left: k}
+}
+
+type repeatScanner struct {
+	open func() (RecordScanner, error)
+	left int
+	cur  RecordScanner
+	err  error
+}
+
+func (s *repeatScanner) Scan() bool {
+	for s.err == nil {
+		if s.cur != nil {
+			if s.cur.Scan() {
+				return true
+			}
+			if s.err = s.cur.Err(); s.err != nil {
+				return false
+			}
+			if c, ok := s.cur.(io.Closer); ok {
+				if s.err = c.Close(); s.err != nil {
+					return false
+				}
+			}
+			s.cur = nil
+		}
+
+		if s.left == 0 {
+			return false
+		}
+		s.left--
+		s.cur, s.err = s.open()
+	}
+	return false
+}
+
+func (s *repeatScanner) Record() []byte {
+	return s.cur.Record()
+}
+
+func (s *repeatScanner) Err() error {
+	return s.err
+}
+
+// ZipScanner scans parallel RecordScanners record by record, like the
+// files of the features and the labels of a dataset, as returned by
+// Zip.
+type ZipScanner struct {
+	srcs    []RecordScanner
+	records [][]byte
+	n       int // the number of records scanned.
+	err     error
+}
+
+// Zip creates a ZipScanner of srcs, which must have the same number of
+// records.
+func Zip(srcs ...RecordScanner) *ZipScanner {
+	return &ZipScanner{srcs: srcs, records: make([][]byte, len(srcs))}
+}
+
+// Scan moves the cursor of every scanner forward for one record.  It
+// returns false at the end of the scanners, and with an error if some
+// of them end before the others.
+func (s *ZipScanner) Scan() bool {
+	if s.err != nil || len(s.srcs) == 0 {
+		return false
+	}
+
+	var ended []int
+	for i, src := range s.srcs {
+		if src.Scan() {
+			s.records[i] = src.Record()
+			continue
+		}
+		if s.err = src.Err(); s.err != nil {
+			return false
+		}
+		ended = append(ended, i)
+	}
+
+	if ended == nil {
+		s.n++
+		return true
+	}
+	if len(ended) < len(s.srcs) {
+		s.err = fmt.Errorf("Zipped scanners %v ended after %d records, before the others", ended, s.n)
+	}
+	return false
+}
+
+// Records returns the records under the cursors of the scanners, in
+// the order of the scanners.  The slice is reused by Scan.
+func (s *ZipScanner) Records() [][]byte {
+	return s.records
+}
+
+// Err returns the first non-EOF error that was encountered by one of
+// the scanners, or the error of scanners of different lengths.
+func (s *ZipScanner) Err() error {
+	return s.err
+}
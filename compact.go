@@ -0,0 +1,187 @@
+package recordio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// compactSpan is the chunks [from, to) of an input of Compact, copied
+// into an output.
+type compactSpan struct {
+	input    int
+	from, to int
+}
+
+// Compact rewrites the recordio files inputs, in order, into shard
+// files of about targetBytes each, named by out, like ShardNames, for
+// datasets written as many small shards.  Chunks are copied as they
+// are, as by Writer.CopyChunks, and a shard holds whole chunks, so
+// that it may exceed targetBytes by up to a chunk.  Only the records
+// of chunks of pathological sizes, those of less than a quarter or
+// more than twice the chunk size of the Writer, like the partial last
+// chunks of small shards, are written again, so that they are merged,
+// or split, into chunks of the usual size, along with the following
+// chunks that fit in the same chunk.  The records keep their order,
+// from the first record of the first input to the last of the last.
+// The shards are written by CreateAtomic with opts, and described by
+// the returned ShardInfos.
+func Compact(inputs []string, targetBytes int64, out ShardNamer, opts ...Option) ([]ShardInfo, error) {
+	if targetBytes <= 0 {
+		return nil, fmt.Errorf("Invalid target shard size: %d", targetBytes)
+	}
+
+	var (
+		shards [][]compactSpan
+		size   int64 // of the last shard.
+	)
+	for i, path := range inputs {
+		sizes, e := chunkSizes(path)
+		if e != nil {
+			return nil, e
+		}
+
+		for j, n := range sizes {
+			if len(shards) == 0 || (size > 0 && size+n > targetBytes) {
+				shards, size = append(shards, nil), 0
+			}
+			last := &shards[len(shards)-1]
+			if k := len(*last) - 1; k >= 0 && (*last)[k].input == i {
+				(*last)[k].to = j + 1
+			} else {
+				*last = append(*last, compactSpan{i, j, j + 1})
+			}
+			size += n
+		}
+	}
+
+	var infos []ShardInfo
+	for k, spans := range shards {
+		info, e := compactShard(inputs, spans, out(k, len(shards)), opts)
+		if e != nil {
+			return nil, e
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// chunkSizes returns the sizes of the chunks of the recordio file
+// path, headers included, from their offsets and the end of the chunk
+// data, at the footer if any.
+func chunkSizes(path string) ([]int64, error) {
+	f, idx, end, e := openIndexedFile(path)
+	if e != nil {
+		return nil, e
+	}
+	f.Close()
+
+	sizes := make([]int64, idx.NumChunks())
+	for i := range sizes {
+		next := end
+		if i+1 < len(sizes) {
+			next = idx.ChunkOffsets[i+1]
+		}
+		sizes[i] = next - idx.ChunkOffsets[i]
+	}
+	return sizes, nil
+}
+
+// openIndexedFile opens the recordio file path, and returns its Index,
+// from the footer or by scanning the file, and the end of its chunks.
+func openIndexedFile(path string) (*os.File, *Index, int64, error) {
+	f, e := os.Open(path)
+	if e != nil {
+		return nil, nil, 0, e
+	}
+
+	idx, end, e := loadIndexAndEnd(f)
+	if e != nil {
+		f.Close()
+		return nil, nil, 0, fmt.Errorf("Failed to load index of %s: %v", path, e)
+	}
+	return f, idx, end, nil
+}
+
+// loadIndexAndEnd returns the Index of r, from the footer or by
+// scanning r, and the end of its chunks.
+func loadIndexAndEnd(r io.ReadSeeker) (*Index, int64, error) {
+	idx, end, e := readFooter(r)
+	if e == ErrNoFooter {
+		if end, e = r.Seek(0, io.SeekEnd); e == nil {
+			if _, e = r.Seek(0, io.SeekStart); e == nil {
+				idx, e = LoadIndex(r)
+			}
+		}
+	}
+	return idx, end, e
+}
+
+// compactShard writes the chunks of spans of inputs into the shard
+// file path.
+func compactShard(inputs []string, spans []compactSpan, path string, opts []Option) (ShardInfo, error) {
+	w, e := CreateAtomic(path, opts...)
+	if e != nil {
+		return ShardInfo{}, e
+	}
+
+	numRecords := 0
+	for _, span := range spans {
+		n, e := w.compactSpan(inputs[span.input], span.from, span.to)
+		if e != nil {
+			w.Abort()
+			return ShardInfo{}, fmt.Errorf("Failed to compact %s: %v", inputs[span.input], e)
+		}
+		numRecords += n
+	}
+	if e = w.Close(); e != nil {
+		return ShardInfo{}, e
+	}
+
+	fi, e := os.Stat(path)
+	if e != nil {
+		return ShardInfo{}, e
+	}
+	return ShardInfo{Path: path, Size: fi.Size(), NumRecords: numRecords}, nil
+}
+
+// compactSpan writes the chunks [from, to) of the recordio file path
+// for Compact, and returns the number of their records.
+func (w *Writer) compactSpan(path string, from, to int) (int, error) {
+	f, idx, _, e := openIndexedFile(path)
+	if e != nil {
+		return 0, e
+	}
+	defer f.Close()
+
+	numRecords := 0
+	o := w.copyOptions()
+	for i := from; i < to; i++ {
+		offset := idx.ChunkOffsets[i]
+		hdr, data, e := readRawChunk(f, offset, o)
+		if e != nil {
+			return 0, e
+		}
+
+		raw := data.Bytes()
+		ch, e := decodeChunk(hdr, bytes.NewBuffer(raw), offset, o)
+		if e != nil {
+			return 0, e
+		}
+		numRecords += len(ch.records)
+
+		if ch.numBytes < w.maxChunkSize/4 || ch.numBytes > 2*w.maxChunkSize ||
+			(len(w.chunk.records) > 0 && w.chunk.numBytes+ch.numBytes <= w.maxChunkSize) {
+			e = w.writeRecords(ch)
+		} else if e = w.flushChunk(); e == nil {
+			if e = w.writePending(true); e == nil {
+				e = w.copyChunk(hdr, raw, ch, o)
+			}
+		}
+		if e != nil {
+			return 0, e
+		}
+	}
+	return numRecords, nil
+}
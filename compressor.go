@@ -0,0 +1,220 @@
+package recordio
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// A Compressor compresses and decompresses chunk data.  To plug in a
+// codec not provided by this package, like brotli or xz, register it
+// by RegisterCompressor and pass its id as the compressor to
+// NewWriter.
+type Compressor interface {
+	// NewWriter returns a writer compressing into w.  All data must
+	// be written into w when its Close returns.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader decompressing r.
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// zstdDict is recorded in the headers of Zstd chunks compressed with
+// the dictionary in the file header.
+const zstdDict = LZ4 + 1
+
+// A LevelCompressor is a Compressor supporting the compression levels
+// of WithCompressionLevel.
+type LevelCompressor interface {
+	Compressor
+	// NewLevelWriter is NewWriter at the given level, which is
+	// never 0.
+	NewLevelWriter(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[int]Compressor{
+		NoCompression: &codec{
+			func(w io.Writer) (io.WriteCloser, error) { return &noopCompressor{w}, nil },
+			func(r io.Reader) (io.Reader, error) { return r, nil },
+		},
+		Snappy: &codec{
+			func(w io.Writer) (io.WriteCloser, error) { return snappy.NewBufferedWriter(w), nil },
+			func(r io.Reader) (io.Reader, error) { return snappy.NewReader(r), nil },
+		},
+		Gzip: &levelCodec{codec{
+			func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+			func(r io.Reader) (io.Reader, error) {
+				deflator, e := gzip.NewReader(r)
+				if e != nil {
+					return nil, fmt.Errorf("Failed to create gzip reader: %v", e)
+				}
+				return deflator, nil
+			}},
+			func(w io.Writer, level int) (io.WriteCloser, error) {
+				return gzip.NewWriterLevel(w, level)
+			},
+		},
+		Zstd: &levelCodec{codec{
+			func(w io.Writer) (io.WriteCloser, error) {
+				return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+			},
+			func(r io.Reader) (io.Reader, error) {
+				// A single goroutine decodes synchronously, so
+				// the decoder needs no Close.
+				deflator, e := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+				if e != nil {
+					return nil, fmt.Errorf("Failed to create zstd reader: %v", e)
+				}
+				return deflator, nil
+			}},
+			func(w io.Writer, level int) (io.WriteCloser, error) {
+				return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1),
+					zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+			},
+		},
+		LZ4: &levelCodec{codec{
+			func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil },
+			func(r io.Reader) (io.Reader, error) { return lz4.NewReader(r), nil }},
+			func(w io.Writer, level int) (io.WriteCloser, error) {
+				if level < 1 || level > 9 {
+					return nil, fmt.Errorf("Invalid LZ4 compression level: %d", level)
+				}
+
+				lw := lz4.NewWriter(w)
+				e := lw.Apply(lz4.CompressionLevelOption(lz4.Level1 << (level - 1)))
+				return lw, e
+			},
+		},
+		// Reserved, as newCompressor and newDeflator handle it.
+		zstdDict: &codec{
+			func(w io.Writer) (io.WriteCloser, error) { return nil, errNoDictionary },
+			func(r io.Reader) (io.Reader, error) { return nil, errNoDictionary },
+		},
+	}
+)
+
+// RegisterCompressor makes c the compressor of the given id, which is
+// recorded in the header of every chunk it compresses, so that readers
+// registering the same compressor decode them.  It panics if the id is
+// already registered, including the ids of the compressors of this
+// package.
+func RegisterCompressor(id byte, c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+
+	if c == nil {
+		panic("recordio: RegisterCompressor compressor is nil")
+	}
+	if _, dup := compressors[int(id)]; dup {
+		panic(fmt.Sprintf("recordio: RegisterCompressor called twice for id %d", id))
+	}
+	compressors[int(id)] = c
+}
+
+func lookupCompressor(compressorIndex int) (Compressor, error) {
+	compressorsMu.RLock()
+	c, ok := compressors[compressorIndex]
+	compressorsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("Unknown compression algorithm: %d", compressorIndex)
+	}
+	return c, nil
+}
+
+var errNoDictionary = errors.New("recordio: chunk compressed with a missing dictionary")
+
+// newCompressor returns a writer compressing into w as configured by
+// enc.
+func newCompressor(w io.Writer, enc chunkEncoding) (io.WriteCloser, error) {
+	if enc.chunkCompressor() == zstdDict {
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1), zstd.WithEncoderDict(enc.dict)}
+		if enc.level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(enc.level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	}
+
+	c, e := lookupCompressor(enc.compressor)
+	if e != nil {
+		return nil, e
+	}
+
+	if lc, ok := c.(LevelCompressor); ok && enc.level != 0 {
+		return lc.NewLevelWriter(w, enc.level)
+	}
+	return c.NewWriter(w)
+}
+
+// newDeflator returns a reader decompressing src, using dict for
+// chunks compressed with the dictionary of the file.
+func newDeflator(src io.Reader, compressorIndex int, dict []byte) (io.Reader, error) {
+	if compressorIndex == zstdDict {
+		if dict == nil {
+			return nil, errNoDictionary
+		}
+
+		deflator, e := zstd.NewReader(src, zstd.WithDecoderConcurrency(1), zstd.WithDecoderDicts(dict))
+		if e != nil {
+			return nil, fmt.Errorf("Failed to create zstd reader: %v", e)
+		}
+		return deflator, nil
+	}
+
+	c, e := lookupCompressor(compressorIndex)
+	if e != nil {
+		return nil, e
+	}
+	return c.NewReader(src)
+}
+
+// codec is a Compressor made of functions.
+type codec struct {
+	newWriter func(io.Writer) (io.WriteCloser, error)
+	newReader func(io.Reader) (io.Reader, error)
+}
+
+func (c *codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return c.newWriter(w)
+}
+
+func (c *codec) NewReader(r io.Reader) (io.Reader, error) {
+	return c.newReader(r)
+}
+
+// levelCodec is a LevelCompressor made of functions.
+type levelCodec struct {
+	codec
+	newLevelWriter func(io.Writer, int) (io.WriteCloser, error)
+}
+
+func (c *levelCodec) NewLevelWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return c.newLevelWriter(w, level)
+}
+
+type noopCompressor struct {
+	io.Writer
+}
+
+func (c *noopCompressor) Close() error {
+	return nil
+}
+
+// TrainDictionary builds a Zstd dictionary from sample records, for
+// WithDictionary.  Dictionaries pay off for small, similar records,
+// which compress poorly on their own.
+func TrainDictionary(samples [][]byte) ([]byte, error) {
+	d, e := dict.BuildZstdDict(samples, dict.Options{MaxDictSize: 110 << 10, HashBytes: 6})
+	if e != nil {
+		return nil, fmt.Errorf("Failed to train dictionary: %v", e)
+	}
+	return d, nil
+}
@@ -0,0 +1,101 @@
+package recordio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// CopyChunks writes the chunks [fromChunk, toChunk) of index, of the
+// recordio file r, after the records written so far, as they are in r,
+// without recompressing them, to split or concatenate files cheaply.
+// The chunks are verified on the way; a chunk compressed with a
+// dictionary other than that of the Writer is decoded and its records
+// written again.  Encrypted chunks are copied as they are too, and
+// require a Writer of WithEncryption with their key to be verified.
+// Records written before are flushed as a chunk first.
+func (w *Writer) CopyChunks(r io.ReadSeeker, index *Index, fromChunk, toChunk int) error {
+	if w.Writer == nil {
+		return fmt.Errorf("Cannot write since writer had been closed")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if e := w.flushChunk(); e != nil {
+		return e
+	}
+	if e := w.writePending(true); e != nil {
+		return e
+	}
+
+	o := w.copyOptions()
+	for i := fromChunk; i < toChunk; i++ {
+		offset := index.ChunkOffsets[i]
+		hdr, data, e := readRawChunk(r, offset, o)
+		if e != nil {
+			return e
+		}
+
+		raw := data.Bytes()
+		ch, e := decodeChunk(hdr, bytes.NewBuffer(raw), offset, o)
+		if e != nil {
+			return e
+		}
+		if e = w.copyChunk(hdr, raw, ch, o); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// copyOptions returns the readOptions of the chunks copied by the
+// Writer, which decrypts them with the key of WithEncryption.
+func (w *Writer) copyOptions() *readOptions {
+	o := newReadOptions(nil)
+	o.aead = w.aead
+	return o
+}
+
+// copyChunk writes ch, read from a file with o as hdr and raw, as
+// CopyChunks.  The records written before must have been flushed.
+func (w *Writer) copyChunk(hdr *Header, raw []byte, ch *Chunk, o *readOptions) error {
+	if hdr.compressor == zstdDict && !bytes.Equal(o.header.loadedHeader().get(dictionaryKey), w.dict) {
+		if e := w.writeRecords(ch); e != nil {
+			return e
+		}
+		if e := w.flushChunk(); e != nil {
+			return e
+		}
+		return w.writePending(true)
+	}
+
+	if w.sortedKeys {
+		if e := w.checkChunkKeys(ch); e != nil {
+			return e
+		}
+		w.ranges = append(w.ranges, ch.keyRange())
+	}
+	w.addBloomFilter(ch.keys)
+	if w.stats != nil {
+		for _, record := range ch.records {
+			w.stats.addRecord(int64(len(record)))
+		}
+	}
+	if w.keyIndex {
+		for j, key := range ch.keys {
+			w.keys = append(w.keys, keyEntry{hashKey(key), w.index.NumRecords + j})
+		}
+	}
+	return w.writeChunk(hdr, raw, int64(ch.numBytes))
+}
+
+// writeRecords writes the records of ch as by Write, with their
+// fields.
+func (w *Writer) writeRecords(ch *Chunk) error {
+	for j, record := range ch.records {
+		if _, e := w.write(record, ch.layout(), ch.fields(j)); e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package recordio
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dataset numbers the records of a list of shard files as one, from
+// the first record of the first shard to the last record of the last.
+// Shards are opened and their indexes loaded when first needed, in
+// order: NumRecords opens them all, Get those up to the record, and a
+// DatasetScanner one after the other.  Opened shards stay open until
+// Close.  A Dataset is safe for concurrent use.
+type Dataset struct {
+	names []string
+	open  func(name string) (fs.File, error)
+	opts  []ReadOption
+
+	mu      sync.Mutex // guards the fields below.
+	files   []*FSFile  // the shards opened so far.
+	readers []*Reader  // of files, for Get.
+	starts  []int      // starts[i] is the index of the first record of files[i].
+}
+
+// NewDataset creates a Dataset of the files matching paths, as
+// filepath.Glob, in the given order, with the files matching a path in
+// lexical order.  It fails if none matches.
+func NewDataset(paths []string, opts ...ReadOption) (*Dataset, error) {
+	var names []string
+	for _, p := range paths {
+		match, e := filepath.Glob(p)
+		if e != nil {
+			return nil, e
+		}
+		names = append(names, match...)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No files match %v", paths)
+	}
+
+	return &Dataset{
+		names: names,
+		open:  func(name string) (fs.File, error) { return os.Open(name) },
+		opts:  opts,
+	}, nil
+}
+
+// NewDatasetFS creates a Dataset of the files of fsys matching pattern,
+// as fs.Glob, in lexical order.  It fails if none matches.
+func NewDatasetFS(fsys fs.FS, pattern string, opts ...ReadOption) (*Dataset, error) {
+	names, e := fs.Glob(fsys, pattern)
+	if e != nil {
+		return nil, e
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No files match %s", pattern)
+	}
+
+	return &Dataset{names: names, open: fsys.Open, opts: opts}, nil
+}
+
+// NumShards returns the number of shard files.
+func (d *Dataset) NumShards() int {
+	return len(d.names)
+}
+
+// ShardNames returns the names of the shard files, in order.
+func (d *Dataset) ShardNames() []string {
+	return append([]string(nil), d.names...)
+}
+
+// NumRecords returns the number of records of all shards, opening them.
+func (d *Dataset) NumRecords() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e := d.load(len(d.names) - 1); e != nil {
+		return 0, e
+	}
+	return d.starts[len(d.names)-1] + d.files[len(d.names)-1].Index.NumRecords, nil
+}
+
+// Get returns the i-th record of the Dataset.  Like that of
+// Reader.Get, the returned slice must not be modified.
+func (d *Dataset) Get(i int) ([]byte, error) {
+	shard, ri, e := d.Locate(i)
+	if e != nil {
+		return nil, e
+	}
+
+	d.mu.Lock()
+	r := d.readers[shard]
+	d.mu.Unlock()
+	return r.Get(ri)
+}
+
+// Locate returns the shard holding the i-th record of the Dataset, and
+// the index of the record in the shard, opening the shards up to it.
+func (d *Dataset) Locate(i int) (int, int, error) {
+	if i < 0 {
+		return 0, 0, fmt.Errorf("Record index out of range: %d", i)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for len(d.files) == 0 || i >= d.starts[len(d.files)-1]+d.files[len(d.files)-1].Index.NumRecords {
+		if len(d.files) == len(d.names) {
+			return 0, 0, fmt.Errorf("Record index out of range: %d", i)
+		}
+		if e := d.load(len(d.files)); e != nil {
+			return 0, 0, e
+		}
+	}
+
+	shard := sort.SearchInts(d.starts, i+1) - 1
+	return shard, i - d.starts[shard], nil
+}
+
+// load opens the shards up to the i-th.  d.mu must be held.
+func (d *Dataset) load(i int) error {
+	for len(d.files) <= i {
+		name := d.names[len(d.files)]
+		f, e := d.open(name)
+		if e != nil {
+			return e
+		}
+
+		file, e := newFSFile(name, f)
+		if e != nil {
+			return e
+		}
+
+		start := 0
+		if n := len(d.files); n > 0 {
+			start = d.starts[n-1] + d.files[n-1].Index.NumRecords
+		}
+		d.files = append(d.files, file)
+		d.readers = append(d.readers, file.NewReader(-1, d.opts...))
+		d.starts = append(d.starts, start)
+	}
+	return nil
+}
+
+// shard returns the i-th shard and the index of its first record,
+// opening the shards up to it.
+func (d *Dataset) shard(i int) (*FSFile, int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e := d.load(i); e != nil {
+		return nil, 0, e
+	}
+	return d.files[i], d.starts[i], nil
+}
+
+// reader returns the Reader of the i-th shard and the index of its
+// first record, opening the shards up to it.
+func (d *Dataset) reader(i int) (*Reader, int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e := d.load(i); e != nil {
+		return nil, 0, e
+	}
+	return d.readers[i], d.starts[i], nil
+}
+
+// NewScanner creates a scanner of all records of the Dataset, in
+// order.  Scanners of a Dataset may be used concurrently if its files
+// are io.ReaderAt, as os.File and those of embed.FS and os.DirFS are.
+func (d *Dataset) NewScanner() *DatasetScanner {
+	return &DatasetScanner{d: d, shard: -1}
+}
+
+// Close closes the shards opened so far.
+func (d *Dataset) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var err error
+	for _, f := range d.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	d.files, d.readers, d.starts = nil, nil, nil
+	return err
+}
+
+var _ TimestampedScanner = (*DatasetScanner)(nil)
+
+// DatasetScanner scans the records of a Dataset, opening its shards
+// one after the other.
+type DatasetScanner struct {
+	d     *Dataset
+	shard int
+	start int // the index of the first record of the shard.
+	cur   *RangeScanner
+	err   error
+}
+
+// Scan moves the cursor forward for one record, moving to the next
+// shard at the end of one.
+func (s *DatasetScanner) Scan() bool {
+	for s.err == nil {
+		if s.cur != nil && s.cur.Scan() {
+			return true
+		}
+		if s.cur != nil {
+			if s.err = s.cur.Err(); s.err != nil {
+				return false
+			}
+		}
+
+		if s.shard+1 >= s.d.NumShards() {
+			return false
+		}
+		s.shard++
+
+		s.Close()
+		var f *FSFile
+		if f, s.start, s.err = s.d.shard(s.shard); s.err == nil {
+			s.cur = f.NewRangeScanner(0, -1, s.d.opts...)
+		}
+	}
+	return false
+}
+
+// Close stops the background decoding of WithPrefetch in the current
+// shard.  It is needed only when a scan with WithPrefetch stops before
+// the end of the Dataset.
+func (s *DatasetScanner) Close() error {
+	if s.cur != nil {
+		return s.cur.Close()
+	}
+	return nil
+}
+
+// Record returns the record under the current cursor, without
+// copying it, as RangeScanner.Record does.
+func (s *DatasetScanner) Record() []byte {
+	return s.cur.Record()
+}
+
+// RecordCopy returns a copy of the record under the current cursor,
+// which the caller owns.
+func (s *DatasetScanner) RecordCopy() []byte {
+	return s.cur.RecordCopy()
+}
+
+// RecordIndex returns the index in the Dataset of the record under the
+// current cursor.
+func (s *DatasetScanner) RecordIndex() int {
+	return s.start + s.cur.cur
+}
+
+// Shard returns the index of the shard of the record under the current
+// cursor.
+func (s *DatasetScanner) Shard() int {
+	return s.shard
+}
+
+// Key returns the key of the record under the current cursor, or nil
+// if it has none.
+func (s *DatasetScanner) Key() []byte {
+	return s.cur.Key()
+}
+
+// Tag returns the type tag of the record under the current cursor, or
+// 0 if it has none.
+func (s *DatasetScanner) Tag() uint16 {
+	return s.cur.Tag()
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, or the zero Time if it has none.
+func (s *DatasetScanner) Timestamp() time.Time {
+	return s.cur.Timestamp()
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// scanner.
+func (s *DatasetScanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,188 @@
+package recordio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// ErrEncrypted is returned reading a chunk encrypted by WithEncryption
+// without WithDecryptionKey.
+var ErrEncrypted = errors.New("recordio: chunk is encrypted")
+
+// WithEncryption makes the Writer encrypt the data of every chunk,
+// once compressed, with AES-256-GCM under key, of 32 bytes, for data
+// that must be encrypted at rest.  Every chunk has a random nonce,
+// stored in its header with the authentication tag, which also covers
+// the fields of the header describing the data.  The checksums of the
+// header are of the encrypted data, so that the file can be verified,
+// by Verify, and repaired, by Repair, without the key.  Records, with
+// their keys and timestamps, are encrypted, but the Index in the
+// footer and the file header are not, including the keys of
+// WithSortedKeys.  Readers need WithDecryptionKey.
+func WithEncryption(key []byte) Option {
+	return func(w *Writer) {
+		w.encryptionKey = key
+	}
+}
+
+// WithKeyID makes the Writer store id, of at most 255 bytes, in the
+// header of every chunk encrypted by WithEncryption, for readers of
+// WithKeyProvider to pick the key of the chunk, so that files spanning
+// a key rotation, like those appended to over months, remain readable.
+// IDs are stored in the clear.
+func WithKeyID(id string) Option {
+	return func(w *Writer) {
+		w.keyID = []byte(id)
+	}
+}
+
+// WithDecryptionKey makes readers decrypt the chunks of WithEncryption
+// with key, whatever their IDs of WithKeyID.  Reading an encrypted
+// chunk without it or WithKeyProvider fails with ErrEncrypted.
+func WithDecryptionKey(key []byte) ReadOption {
+	return func(o *readOptions) {
+		o.aead, o.aeadErr = newAEAD(key)
+	}
+}
+
+// A KeyProvider returns the keys of encrypted chunks by their IDs of
+// WithKeyID, like a key store does.  The ID of chunks written without
+// WithKeyID is "".  It must be safe for concurrent use.
+type KeyProvider interface {
+	Key(id string) ([]byte, error)
+}
+
+// WithKeyProvider makes readers decrypt every chunk of WithEncryption
+// with the key p returns for its ID, asking p once per ID.  It
+// overrides WithDecryptionKey.
+func WithKeyProvider(p KeyProvider) ReadOption {
+	return func(o *readOptions) {
+		o.keys = &keyring{provider: p, aeads: make(map[string]cipher.AEAD)}
+	}
+}
+
+// keyring caches the AEADs of the keys of a KeyProvider.
+type keyring struct {
+	provider KeyProvider
+	mu       sync.Mutex
+	aeads    map[string]cipher.AEAD
+}
+
+// aead returns the AEAD of the key of id.
+func (k *keyring) aead(id string) (cipher.AEAD, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if a, ok := k.aeads[id]; ok {
+		return a, nil
+	}
+
+	key, e := k.provider.Key(id)
+	if e != nil {
+		return nil, fmt.Errorf("Failed to get key %q: %v", id, e)
+	}
+	a, e := newAEAD(key)
+	if e != nil {
+		return nil, fmt.Errorf("Failed to use key %q: %v", id, e)
+	}
+	k.aeads[id] = a
+	return a, nil
+}
+
+// newAEAD returns the AES-256-GCM of key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Invalid AES-256 key of %d bytes", len(key))
+	}
+
+	block, e := aes.NewCipher(key)
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkAAD returns the additional data authenticated with the data of
+// a chunk, the fields of its header describing the data.
+func chunkAAD(compressor, compressedSize, numRecords uint32, flags uint8) []byte {
+	buf := make([]byte, 13)
+	binary.LittleEndian.PutUint32(buf[0:4], compressor)
+	binary.LittleEndian.PutUint32(buf[4:8], compressedSize)
+	binary.LittleEndian.PutUint32(buf[8:12], numRecords)
+	buf[12] = flags
+	return buf
+}
+
+// seal encrypts the data of a chunk, and returns the nonce, the tag
+// and the encrypted data, of the size of data.
+func (enc chunkEncoding) seal(compressor, numRecords int, layout uint8, data []byte) ([]byte, []byte, []byte, error) {
+	nonce := make([]byte, gcmNonceSize)
+	if _, e := rand.Read(nonce); e != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to generate nonce: %v", e)
+	}
+
+	aad := chunkAAD(uint32(compressor), uint32(len(data)), uint32(numRecords), enc.flags(layout))
+	sealed := enc.aead.Seal(nil, nonce, data, aad)
+	n := len(sealed) - gcmTagSize
+	return nonce, sealed[n:], sealed[:n], nil
+}
+
+// decrypt returns the decrypted data of the chunk of c.
+func (c *Header) decrypt(data []byte, o *readOptions) ([]byte, error) {
+	aead, e := c.aead(o)
+	if e != nil {
+		return nil, e
+	}
+
+	sealed := make([]byte, 0, len(data)+len(c.tag))
+	sealed = append(append(sealed, data...), c.tag...)
+	plain, e := aead.Open(nil, c.nonce, sealed, chunkAAD(c.compressor, c.compressedSize, c.numRecords, c.flags))
+	if e != nil {
+		return nil, fmt.Errorf("Failed to decrypt chunk: %v", e)
+	}
+	return plain, nil
+}
+
+// aead returns the AEAD of the key of the chunk of c.
+func (c *Header) aead(o *readOptions) (cipher.AEAD, error) {
+	wrapped := o.header.loadedHeader().get(wrappedKeyKey)
+	switch {
+	case o.kms != nil && wrapped != nil:
+		return o.kms.aead(wrapped)
+	case o.keys != nil:
+		return o.keys.aead(string(c.keyID))
+	case o.aeadErr != nil:
+		return nil, o.aeadErr
+	case o.aead == nil:
+		return nil, ErrEncrypted
+	}
+	return o.aead, nil
+}
+
+// hasKey tells whether o may decrypt chunks, rather than only check
+// the checksums of their encrypted data.
+func (o *readOptions) hasKey() bool {
+	return o.aead != nil || o.aeadErr != nil || o.keys != nil ||
+		(o.kms != nil && o.header.loadedHeader().get(wrappedKeyKey) != nil)
+}
+
+// verifySealed checks the checksums of the encrypted data of the chunk
+// following hdr in r, for reading it without the key.
+func verifySealed(r io.Reader, hdr *Header) error {
+	data, e := readChunkData(r, hdr)
+	if e != nil {
+		return e
+	}
+	return hdr.verify(data.Bytes())
+}
@@ -0,0 +1,143 @@
+package recordio
+
+import (
+	"math/rand"
+	"time"
+)
+
+var _ TimestampedScanner = (*EpochIterator)(nil)
+
+// EpochIterator yields complete passes over the records of a Dataset,
+// epochs, for training loops.  Every epoch visits the shards in a new
+// random order, and the chunks of every shard in a new random order,
+// while the records of a chunk keep their order, so that an epoch
+// decodes every chunk once.  Combine it with a ShuffleReader to shuffle
+// records across chunks.  A training loop reads
+//
+//	it := recordio.NewEpochIterator(d, seed)
+//	for it.NextEpoch() && it.Epoch() < numEpochs {
+//		for it.Scan() {
+//			train(it.Record())
+//		}
+//		if e := it.Err(); e != nil {
+//			…
+//		}
+//	}
+type EpochIterator struct {
+	d     *Dataset
+	rand  *rand.Rand // of the seeds of the epochs.
+	epoch int
+
+	shards []int // the order of the shards in the epoch.
+	si     int   // the position in shards of the current shard.
+	r      *Reader
+	start  int // the index in the Dataset of the first record of the shard.
+
+	chunks []int // the order of the chunks of the current shard.
+	ci     int   // the position in chunks of the current chunk.
+	chunk  *Chunk
+	ri     int // the index of the current record in chunk.
+
+	order *rand.Rand // of the epoch.
+	err   error
+}
+
+// NewEpochIterator creates an EpochIterator of d, whose epochs are
+// shuffled with seeds derived from seed, so that the same seed and
+// Dataset give the same epochs.
+func NewEpochIterator(d *Dataset, seed int64) *EpochIterator {
+	return &EpochIterator{d: d, rand: rand.New(rand.NewSource(seed)), epoch: -1}
+}
+
+// NextEpoch starts the next epoch, shuffling the order of the shards,
+// and returns false after an error.  It may be called before the end
+// of an epoch to skip the rest of it.
+func (it *EpochIterator) NextEpoch() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.epoch++
+	it.order = rand.New(rand.NewSource(it.rand.Int63()))
+	it.shards = it.order.Perm(it.d.NumShards())
+	it.si, it.chunks, it.ci, it.chunk = -1, nil, 0, nil
+	return true
+}
+
+// Epoch returns the number of the current epoch, from 0, or -1 before
+// NextEpoch.
+func (it *EpochIterator) Epoch() int {
+	return it.epoch
+}
+
+// Scan moves the cursor to the next record of the epoch, and returns
+// false at the end of the epoch or on error.
+func (it *EpochIterator) Scan() bool {
+	if it.err != nil || it.shards == nil {
+		return false
+	}
+
+	it.ri++
+	for it.chunk == nil || it.ri >= len(it.chunk.records) {
+		if it.ci+1 < len(it.chunks) {
+			it.ci++
+			if it.chunk, it.err = it.r.chunk(it.chunks[it.ci]); it.err != nil {
+				return false
+			}
+			it.ri = 0
+			continue
+		}
+
+		if it.si+1 >= len(it.shards) {
+			it.chunk = nil
+			return false
+		}
+		it.si++
+		if it.r, it.start, it.err = it.d.reader(it.shards[it.si]); it.err != nil {
+			return false
+		}
+		it.chunks, it.ci, it.chunk = it.order.Perm(it.r.index.NumChunks()), -1, nil
+	}
+	return true
+}
+
+// Record returns the record under the current cursor.
+func (it *EpochIterator) Record() []byte {
+	return it.chunk.records[it.ri]
+}
+
+// RecordIndex returns the index in the Dataset of the record under the
+// current cursor.
+func (it *EpochIterator) RecordIndex() int {
+	return it.start + it.r.index.chunkStart(it.chunks[it.ci]) + it.ri
+}
+
+// Shard returns the index of the shard of the record under the current
+// cursor.
+func (it *EpochIterator) Shard() int {
+	return it.shards[it.si]
+}
+
+// Key returns the key of the record under the current cursor, or nil
+// if it has none.
+func (it *EpochIterator) Key() []byte {
+	return it.chunk.key(it.ri)
+}
+
+// Tag returns the type tag of the record under the current cursor, or
+// 0 if it has none.
+func (it *EpochIterator) Tag() uint16 {
+	return it.chunk.tag(it.ri)
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, or the zero Time if it has none.
+func (it *EpochIterator) Timestamp() time.Time {
+	return it.chunk.timestamp(it.ri)
+}
+
+// Err returns the first error that was encountered by the
+// EpochIterator.
+func (it *EpochIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,211 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"sync"
+)
+
+// A file header is an optional block before the first chunk, written
+// only by features that need it, like WithDictionary, so that files
+// without it remain readable by older readers:
+//
+//	fileHeaderMagic uint32
+//	payloadLen      uint32
+//	checkSum        uint32 // CRC32 (IEEE) of the payload.
+//	payload         [payloadLen]byte
+//
+// The payload is a sequence of entries sorted by key, each
+//
+//	uvarint(len(key))   key
+//	uvarint(len(value)) value
+//
+// The entry versionKey holds the uvarint format version of the file,
+// so that readers reject files of newer versions instead of misreading
+// them.
+const (
+	fileHeaderMagic      uint32 = 0x01020307
+	fileHeaderHeaderSize        = 12
+
+	// formatVersion is the newest format version this package reads
+	// and writes.  Version 1 lacks the file header.
+	formatVersion = 2
+
+	versionKey    = "format.version"
+	dictionaryKey = "zstd.dictionary"
+)
+
+// errFileHeader is returned by parseHeader when it meets the file
+// header instead of a chunk header.
+var errFileHeader = errors.New("recordio: file header reached")
+
+// fileHeader holds the entries of a file header.
+type fileHeader struct {
+	entries map[string][]byte
+}
+
+// newFileHeader returns a file header of the current format version.
+func newFileHeader() *fileHeader {
+	h := &fileHeader{}
+	h.set(versionKey, appendUvarint(nil, formatVersion))
+	return h
+}
+
+func (h *fileHeader) get(key string) []byte {
+	if h == nil {
+		return nil
+	}
+	return h.entries[key]
+}
+
+func (h *fileHeader) set(key string, value []byte) {
+	if h.entries == nil {
+		h.entries = make(map[string][]byte)
+	}
+	h.entries[key] = value
+}
+
+func (h *fileHeader) encodedPayload() []byte {
+	keys := make([]string, 0, len(h.entries))
+	for k := range h.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var payload []byte
+	for _, k := range keys {
+		payload = appendUvarint(payload, uint64(len(k)))
+		payload = append(payload, k...)
+		payload = appendUvarint(payload, uint64(len(h.entries[k])))
+		payload = append(payload, h.entries[k]...)
+	}
+	return payload
+}
+
+// write writes the file header into w.
+func (h *fileHeader) write(w io.Writer) (int, error) {
+	payload := h.encodedPayload()
+
+	var buf bytes.Buffer
+	var hdr [fileHeaderHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], fileHeaderMagic)
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(hdr[8:12], crc32.ChecksumIEEE(payload))
+	buf.Write(hdr[:])
+	buf.Write(payload)
+
+	n, e := w.Write(buf.Bytes())
+	if e != nil {
+		return n, fmt.Errorf("Failed to write file header: %v", e)
+	}
+	return n, nil
+}
+
+// readFileHeader reads the file header at the current position of r,
+// and returns nil if there is none.  Either way, r is left at the
+// first chunk.
+func readFileHeader(r io.ReadSeeker) (*fileHeader, error) {
+	var magic [4]byte
+	n, e := io.ReadFull(r, magic[:])
+	if _, se := r.Seek(-int64(n), io.SeekCurrent); se != nil {
+		return nil, se
+	}
+	if e == io.EOF || e == io.ErrUnexpectedEOF || binary.LittleEndian.Uint32(magic[:]) != fileHeaderMagic {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return parseFileHeader(r)
+}
+
+// parseFileHeader reads the file header from r, which must start with
+// fileHeaderMagic.
+func parseFileHeader(r io.Reader) (*fileHeader, error) {
+	var hdr [fileHeaderHeaderSize]byte
+	if _, e := io.ReadFull(r, hdr[:]); e != nil {
+		return nil, fmt.Errorf("Failed to read file header: %v", e)
+	}
+
+	// The payload grows as it is read, so that a corrupted length
+	// fails on the end of the file instead of allocating up to 4GB.
+	var buf bytes.Buffer
+	if _, e := io.CopyN(&buf, r, int64(binary.LittleEndian.Uint32(hdr[4:8]))); e != nil {
+		return nil, fmt.Errorf("Failed to read file header: %v", e)
+	}
+	payload := buf.Bytes()
+
+	if binary.LittleEndian.Uint32(hdr[8:12]) != crc32.ChecksumIEEE(payload) {
+		return nil, fmt.Errorf("File header checksum checking failed.")
+	}
+
+	h := &fileHeader{}
+	for len(payload) > 0 {
+		var kv [2][]byte
+		for i := range kv {
+			n, l := binary.Uvarint(payload)
+			if l <= 0 || n > uint64(len(payload)-l) {
+				return nil, fmt.Errorf("Failed to parse file header entry")
+			}
+			kv[i] = payload[l : l+int(n)]
+			payload = payload[l+int(n):]
+		}
+		h.set(string(kv[0]), kv[1])
+	}
+
+	if v := h.get(versionKey); v != nil {
+		n, l := binary.Uvarint(v)
+		if l <= 0 {
+			return nil, fmt.Errorf("Failed to parse file format version")
+		}
+		if n > formatVersion {
+			return nil, &UnsupportedVersionError{Part: "file header", Version: n}
+		}
+	}
+	return h, nil
+}
+
+// headerCache loads the file header of a file once, when a chunk
+// needs it.
+type headerCache struct {
+	mu     sync.Mutex
+	loaded bool
+	hdr    *fileHeader
+	err    error
+}
+
+// get returns the file header at the start of r, reading it on the
+// first call.
+func (c *headerCache) get(r io.ReadSeeker) (*fileHeader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded {
+		if _, c.err = r.Seek(0, io.SeekStart); c.err == nil {
+			c.hdr, c.err = readFileHeader(r)
+		}
+		c.loaded = true
+	}
+	return c.hdr, c.err
+}
+
+// put stores a file header read otherwise, e.g. from a stream.
+func (c *headerCache) put(h *fileHeader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hdr, c.err, c.loaded = h, nil, true
+}
+
+// loadedHeader returns the file header if already loaded.
+func (c *headerCache) loadedHeader() *fileHeader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hdr
+}
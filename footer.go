@@ -0,0 +1,296 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// A footer is an optional block written after the last chunk.  It
+// holds the binary encoded Index of the file:
+//
+//	footerMagic  uint32
+//	payloadLen   uint32
+//	checkSum     uint32 // CRC32 (IEEE) of the payload.
+//	payload      [payloadLen]byte
+//
+// and is followed by a fixed-size trailer at the very end of the file
+// pointing back to it:
+//
+//	footerOffset uint64
+//	trailerMagic uint32
+const (
+	trailerMagic      uint32 = 0x01020306
+	footerHeaderSize         = 12
+	footerTrailerSize        = 12
+
+	indexEncodingVersion uint32 = 4
+)
+
+// The sections of version 4 of the index encoding.
+const (
+	sectionMetadata  = 1 // the entries of Index.Metadata, by appendMetadata.
+	sectionKeyIndex  = 2 // the KeyIndex, by appendKeyIndex.
+	sectionKeyRanges = 3 // the keys of sorted chunks, by appendKeyRanges.
+	sectionBlooms    = 4 // the Bloom filters of chunks, by appendBloomFilters.
+	sectionStats     = 5 // the FileStats, by appendStats.
+)
+
+// ErrNoFooter is returned by LoadIndexFromFooter if the file was not
+// written with WithFooterIndex.
+var ErrNoFooter = errors.New("recordio: no footer index")
+
+// errFooter is returned by parseHeader when it meets the footer
+// instead of a chunk header, which marks the end of the chunks.
+var errFooter = errors.New("recordio: footer reached")
+
+// writeFooter writes the footer holding idx and the trailer into w,
+// assuming the footer starts at offset.
+func writeFooter(w io.Writer, offset int64, idx *Index) (int, error) {
+	payload := encodeIndex(idx)
+
+	var buf bytes.Buffer
+	var hdr [footerHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], footerMagic)
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(hdr[8:12], crc32.ChecksumIEEE(payload))
+	buf.Write(hdr[:])
+	buf.Write(payload)
+
+	var trailer [footerTrailerSize]byte
+	binary.LittleEndian.PutUint64(trailer[0:8], uint64(offset))
+	binary.LittleEndian.PutUint32(trailer[8:12], trailerMagic)
+	buf.Write(trailer[:])
+
+	n, e := w.Write(buf.Bytes())
+	if e != nil {
+		return n, fmt.Errorf("Failed to write footer: %v", e)
+	}
+	return n, nil
+}
+
+// LoadIndexFromFooter reads the Index stored in the footer of a file
+// written with WithFooterIndex.  Unlike LoadIndex, it reads a constant
+// number of bytes regardless of the number of chunks.  It returns
+// ErrNoFooter if the file has no footer.
+func LoadIndexFromFooter(r io.ReadSeeker) (*Index, error) {
+	idx, _, e := readFooter(r)
+	return idx, e
+}
+
+// readFooter returns the Index in the footer of r and the offset of
+// the footer.
+func readFooter(r io.ReadSeeker) (*Index, int64, error) {
+	size, e := r.Seek(0, io.SeekEnd)
+	if e != nil {
+		return nil, 0, e
+	}
+
+	if size < footerHeaderSize+footerTrailerSize {
+		return nil, 0, ErrNoFooter
+	}
+
+	var trailer [footerTrailerSize]byte
+	if _, e = r.Seek(size-footerTrailerSize, io.SeekStart); e != nil {
+		return nil, 0, e
+	}
+	if _, e = io.ReadFull(r, trailer[:]); e != nil {
+		return nil, 0, e
+	}
+
+	if binary.LittleEndian.Uint32(trailer[8:12]) != trailerMagic {
+		return nil, 0, ErrNoFooter
+	}
+
+	offset := int64(binary.LittleEndian.Uint64(trailer[0:8]))
+	if offset < 0 || offset > size-footerHeaderSize-footerTrailerSize {
+		return nil, 0, fmt.Errorf("Invalid footer offset: %d", offset)
+	}
+
+	if _, e = r.Seek(offset, io.SeekStart); e != nil {
+		return nil, 0, e
+	}
+
+	var hdr [footerHeaderSize]byte
+	if _, e = io.ReadFull(r, hdr[:]); e != nil {
+		return nil, 0, fmt.Errorf("Failed to read footer: %v", e)
+	}
+
+	if binary.LittleEndian.Uint32(hdr[0:4]) != footerMagic {
+		return nil, 0, fmt.Errorf("Failed to parse footer magic number")
+	}
+
+	payloadLen := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+	if offset+footerHeaderSize+payloadLen != size-footerTrailerSize {
+		return nil, 0, fmt.Errorf("Invalid footer length: %d", payloadLen)
+	}
+
+	payload := make([]byte, payloadLen)
+	if _, e = io.ReadFull(r, payload); e != nil {
+		return nil, 0, fmt.Errorf("Failed to read footer: %v", e)
+	}
+
+	if binary.LittleEndian.Uint32(hdr[8:12]) != crc32.ChecksumIEEE(payload) {
+		return nil, 0, fmt.Errorf("Footer checksum checking failed.")
+	}
+
+	idx, e := decodeIndex(payload)
+	return idx, offset, e
+}
+
+// encodeIndex encodes idx in little endian as
+//
+//	version      uint32
+//	numChunks    uint64
+//	numChunks * {
+//		offset     int64
+//		numRecords uint32
+//		checkSum   uint32
+//	}
+//	sections // of version 4, or the metadata entries of version 3.
+//
+// where each section is
+//
+//	tag  uvarint // like sectionMetadata.
+//	len  uvarint
+//	data [len]byte
+//
+// and readers skip sections of unknown tags.  Version 1 of the
+// encoding lacks checkSum, and version 2 metadata.  An Index is
+// encoded in the oldest version holding it, which older readers read.
+func encodeIndex(idx *Index) []byte {
+	version := indexEncodingVersion
+	if idx.keys == nil && idx.keyRanges == nil && idx.blooms == nil && idx.stats == nil {
+		version = 3
+	}
+	if version == 3 && len(idx.metadata) == 0 {
+		version = 2
+	}
+
+	buf := make([]byte, 12+16*idx.NumChunks())
+	binary.LittleEndian.PutUint32(buf[0:4], version)
+	binary.LittleEndian.PutUint64(buf[4:12], uint64(idx.NumChunks()))
+
+	p := buf[12:]
+	for i, offset := range idx.ChunkOffsets {
+		binary.LittleEndian.PutUint64(p[0:8], uint64(offset))
+		binary.LittleEndian.PutUint32(p[8:12], uint32(idx.ChunkRecords[i]))
+		binary.LittleEndian.PutUint32(p[12:16], idx.chunkChecksum(i))
+		p = p[16:]
+	}
+	if version < 4 {
+		return appendMetadata(buf, idx.metadata)
+	}
+
+	if len(idx.metadata) > 0 {
+		buf = appendSection(buf, sectionMetadata, appendMetadata(nil, idx.metadata))
+	}
+	if idx.keys != nil {
+		buf = appendSection(buf, sectionKeyIndex, appendKeyIndex(nil, idx.keys))
+	}
+	if idx.keyRanges != nil {
+		buf = appendSection(buf, sectionKeyRanges, appendKeyRanges(nil, idx.keyRanges))
+	}
+	if idx.blooms != nil {
+		buf = appendSection(buf, sectionBlooms, appendBloomFilters(nil, idx.blooms))
+	}
+	if idx.stats != nil {
+		buf = appendSection(buf, sectionStats, appendStats(nil, idx.stats))
+	}
+	return buf
+}
+
+func appendSection(buf []byte, tag uint64, data []byte) []byte {
+	buf = appendUvarint(buf, tag)
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func decodeIndex(buf []byte) (*Index, error) {
+	if len(buf) < 12 {
+		return nil, fmt.Errorf("Index encoding too short: %d bytes", len(buf))
+	}
+
+	var size uint64
+	v := binary.LittleEndian.Uint32(buf[0:4])
+	switch v {
+	case 1:
+		size = 12
+	case 2, 3, 4:
+		size = 16
+	default:
+		return nil, &UnsupportedVersionError{Part: "index", Version: uint64(v)}
+	}
+
+	n := binary.LittleEndian.Uint64(buf[4:12])
+	p := buf[12:]
+	if n > uint64(len(p))/size || (v < 3 && uint64(len(p)) != size*n) {
+		return nil, fmt.Errorf("Index encoding has %d bytes for %d chunks", len(p), n)
+	}
+
+	idx := newIndex()
+	for i := uint64(0); i < n; i++ {
+		var checkSum uint32
+		if size == 16 {
+			checkSum = binary.LittleEndian.Uint32(p[12:16])
+		}
+		idx.addChunk(int64(binary.LittleEndian.Uint64(p[0:8])), int(binary.LittleEndian.Uint32(p[8:12])), checkSum)
+		p = p[size:]
+	}
+
+	if size == 12 {
+		idx.ChunkChecksums = nil
+	}
+	if v == 3 {
+		md, e := parseMetadata(p)
+		if e != nil {
+			return nil, e
+		}
+		idx.metadata = md
+	}
+	if v == 4 {
+		if e := idx.parseSections(p); e != nil {
+			return nil, e
+		}
+	}
+	return idx, nil
+}
+
+// parseSections parses the sections of the version 4 encoding.
+func (r *Index) parseSections(p []byte) error {
+	for len(p) > 0 {
+		tag, l := binary.Uvarint(p)
+		if l <= 0 {
+			return fmt.Errorf("Failed to parse index section")
+		}
+		p = p[l:]
+
+		n, l := binary.Uvarint(p)
+		if l <= 0 || n > uint64(len(p)-l) {
+			return fmt.Errorf("Failed to parse index section %d", tag)
+		}
+		data := p[l : l+int(n)]
+		p = p[l+int(n):]
+
+		var e error
+		switch tag {
+		case sectionMetadata:
+			r.metadata, e = parseMetadata(data)
+		case sectionKeyIndex:
+			r.keys, e = parseKeyIndex(data)
+		case sectionKeyRanges:
+			r.keyRanges, e = parseKeyRanges(data, r.NumChunks())
+		case sectionBlooms:
+			r.blooms, e = parseBloomFilters(data, r.NumChunks())
+		case sectionStats:
+			r.stats, e = parseStats(data)
+		}
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package recordio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// FSFile is a recordio file opened from an fs.FS, like an embed.FS, a
+// zip archive or a virtual filesystem, with its Index.
+type FSFile struct {
+	Name  string
+	Index *Index
+
+	schema *Schema
+	f      fs.File
+	r      io.ReadSeeker
+	ra     io.ReaderAt // nil if the file is no io.ReaderAt.
+}
+
+// OpenFS opens the recordio files of fsys matching pattern, as
+// fs.Glob, in lexical order.  It fails if none matches.
+func OpenFS(fsys fs.FS, pattern string) ([]*FSFile, error) {
+	names, e := fs.Glob(fsys, pattern)
+	if e != nil {
+		return nil, e
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No files match %s", pattern)
+	}
+
+	files := make([]*FSFile, 0, len(names))
+	for _, name := range names {
+		f, e := OpenFSFile(fsys, name)
+		if e != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, e
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// OpenFSFile opens the recordio file name of fsys and loads its Index,
+// from the footer if any.  Files that cannot seek, like compressed
+// entries of zip archives, are read into memory.
+func OpenFSFile(fsys fs.FS, name string) (*FSFile, error) {
+	f, e := fsys.Open(name)
+	if e != nil {
+		return nil, e
+	}
+	return newFSFile(name, f)
+}
+
+// newFSFile loads the Index of f, opened as name, closing f on error.
+func newFSFile(name string, f fs.File) (*FSFile, error) {
+	file := &FSFile{Name: name, f: f}
+	if rs, ok := f.(io.ReadSeeker); ok {
+		file.r = rs
+		file.ra, _ = f.(io.ReaderAt)
+	} else {
+		data, e := io.ReadAll(f)
+		if e != nil {
+			f.Close()
+			return nil, fmt.Errorf("Failed to read %s: %v", name, e)
+		}
+		r := bytes.NewReader(data)
+		file.r, file.ra = r, r
+	}
+
+	idx, e := LoadIndexFromFooter(file.r)
+	if e == ErrNoFooter {
+		if _, e = file.r.Seek(0, io.SeekStart); e == nil {
+			idx, e = LoadIndex(file.r)
+		}
+	}
+	if e != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to load the index of %s: %v", name, e)
+	}
+	if file.schema, e = ReadSchema(file.r); e != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to read the schema of %s: %v", name, e)
+	}
+
+	file.Index = idx
+	return file, nil
+}
+
+// Schema returns the Schema embedded in the file by WithSchema, or nil
+// if there is none.
+func (f *FSFile) Schema() *Schema {
+	return f.schema
+}
+
+// NewRangeScanner creates a RangeScanner of the records in [start,
+// start+len) of the file.  Scanners of a file may be used concurrently
+// if the file is an io.ReaderAt, as those of embed.FS and os.DirFS
+// are, or was read into memory.
+func (f *FSFile) NewRangeScanner(start, len int, opts ...ReadOption) *RangeScanner {
+	if f.ra != nil {
+		return NewRangeScannerAt(f.ra, f.Index, start, len, opts...)
+	}
+	return NewRangeScanner(f.r, f.Index, start, len, opts...)
+}
+
+// NewReader creates a Reader of the records of the file.
+func (f *FSFile) NewReader(cacheChunks int, opts ...ReadOption) *Reader {
+	if f.ra != nil {
+		return NewReaderAt(f.ra, f.Index, cacheChunks, opts...)
+	}
+	return NewReader(f.r, f.Index, cacheChunks, opts...)
+}
+
+// Close closes the file.
+func (f *FSFile) Close() error {
+	return f.f.Close()
+}
@@ -2,6 +2,7 @@ package recordio
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -17,21 +18,135 @@ const (
 	// Gzip is a well-known compression algorithm.  It is
 	// recommmended only you are looking for compression ratio.
 	Gzip
+	// Zstd (Zstandard) compresses about as well as Gzip and
+	// decompresses several times faster.
+	Zstd
+	// LZ4 compresses and decompresses fastest, at a lower ratio,
+	// for pipelines bound by CPU rather than I/O.
+	LZ4
 
-	magicNumber       uint32 = 0x01020304
+	magicNumber   uint32 = 0x01020304
+	footerMagic   uint32 = 0x01020305
+	magicNumberV2 uint32 = 0x01020308
+	// magicPrefix is shared by all magic numbers of the format, past
+	// and future, so that readers tell newer versions from garbage.
+	magicPrefix       uint32 = 0x01020300
 	defaultCompressor        = Snappy
+
+	headerSize = 20 // the size of an encoded Header, without v2 checksums.
+
+	// flagRawChecksum marks v2 headers holding a checksum of the
+	// decompressed data too.
+	flagRawChecksum = 1 << 0
+	// flagRecordChecksums marks v2 headers of chunks whose records
+	// are each followed by the CRC32C of the record.
+	flagRecordChecksums = 1 << 1
+	// flagTimestamps marks v2 headers of chunks whose records are
+	// each preceded by a timestamp, as the varint difference in Unix
+	// nanoseconds from that of the previous record, or from 0.
+	flagTimestamps = 1 << 2
+	// flagKeys marks v2 headers of chunks whose records are each
+	// preceded by a key, as its uvarint length and bytes, after the
+	// timestamp if any.
+	flagKeys = 1 << 3
+	// flagTags marks v2 headers of chunks whose records are each
+	// preceded by a uint16 type tag, as a uvarint, after the key if
+	// any.
+	flagTags = 1 << 4
+	// flagEncrypted marks v2 headers of chunks whose data is
+	// encrypted by WithEncryption, holding the nonce and the tag of
+	// AES-GCM after the checksums.
+	flagEncrypted = 1 << 5
+	// flagKeyID marks v2 headers of encrypted chunks holding the ID
+	// of their key, of WithKeyID, after the tag.
+	flagKeyID = 1 << 6
+	// knownFlags are the flags this version understands; others
+	// may change the layout of the header.
+	knownFlags = flagRawChecksum | flagRecordChecksums | flagTimestamps | flagKeys | flagTags | flagEncrypted | flagKeyID
 )
 
-// Header is the metadata of Chunk.
+// ErrUnsupportedVersion is matched, via errors.Is, by the
+// *UnsupportedVersionError of a file written by a newer version of the
+// format.
+var ErrUnsupportedVersion = errors.New("recordio: unsupported format version")
+
+// UnsupportedVersionError reports a part of a file, like a chunk
+// header, in a version of the format newer than this package reads.
+type UnsupportedVersionError struct {
+	Part    string // like "chunk header", "file header" or "index".
+	Version uint64 // the version, or the magic number of a chunk header.
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("recordio: unsupported %s version %#x", e.Part, e.Version)
+}
+
+// Unwrap returns ErrUnsupportedVersion.
+func (e *UnsupportedVersionError) Unwrap() error {
+	return ErrUnsupportedVersion
+}
+
+// Header is the metadata of Chunk.  It is encoded in one of two
+// versions.  Version 1, written by default, holds a CRC32 (IEEE) of the
+// compressed data:
+//
+//	magicNumber    uint32
+//	checkSum       uint32
+//	compressor     uint32
+//	compressedSize uint32
+//	numRecords     uint32
+//
+// Version 2, written for other checksums, holds checksums of any
+// length, as given by the checksum type:
+//
+//	magicNumberV2  uint32
+//	compressor     uint32
+//	compressedSize uint32
+//	numRecords     uint32
+//	checksumType   uint8
+//	flags          uint8
+//	checksumLen    uint16
+//	checksum       [checksumLen]byte // of the compressed data.
+//	rawChecksum    [checksumLen]byte // of the decompressed data, if flagRawChecksum.
+//	nonce          [12]byte          // of AES-GCM, if flagEncrypted.
+//	tag            [16]byte          // of AES-GCM, if flagEncrypted.
+//	keyIDLen       uint8             // if flagKeyID.
+//	keyID          [keyIDLen]byte    // if flagKeyID.
 type Header struct {
+	// The CRC32 of version 1, or the first 4 bytes of checksum, as
+	// kept by Index.ChunkChecksums.
 	checkSum       uint32
 	compressor     uint32
 	compressedSize uint32
 	numRecords     uint32
+
+	// Version 2 only; checksum is nil in version 1.
+	checksumType uint8
+	flags        uint8
+	checksum     []byte
+	rawChecksum  []byte
+	nonce, tag   []byte // of flagEncrypted.
+	keyID        []byte // of flagKeyID.
+}
+
+// size returns the size of the encoded Header.
+func (c *Header) size() int64 {
+	if c.checksum == nil {
+		return headerSize
+	}
+	n := headerSize + int64(len(c.checksum)+len(c.rawChecksum)+len(c.nonce)+len(c.tag))
+	if c.flags&flagKeyID != 0 {
+		n += 1 + int64(len(c.keyID))
+	}
+	return n
 }
 
 func (c *Header) write(w io.Writer) (int, error) {
-	var buf [20]byte
+	if c.checksum != nil {
+		return c.writeV2(w)
+	}
+
+	var buf [headerSize]byte
 	binary.LittleEndian.PutUint32(buf[0:4], magicNumber)
 	binary.LittleEndian.PutUint32(buf[4:8], c.checkSum)
 	binary.LittleEndian.PutUint32(buf[8:12], c.compressor)
@@ -40,14 +155,47 @@ func (c *Header) write(w io.Writer) (int, error) {
 	return w.Write(buf[:])
 }
 
+func (c *Header) writeV2(w io.Writer) (int, error) {
+	buf := make([]byte, headerSize, c.size())
+	binary.LittleEndian.PutUint32(buf[0:4], magicNumberV2)
+	binary.LittleEndian.PutUint32(buf[4:8], c.compressor)
+	binary.LittleEndian.PutUint32(buf[8:12], c.compressedSize)
+	binary.LittleEndian.PutUint32(buf[12:16], c.numRecords)
+	buf[16] = c.checksumType
+	buf[17] = c.flags
+	binary.LittleEndian.PutUint16(buf[18:20], uint16(len(c.checksum)))
+	buf = append(buf, c.checksum...)
+	buf = append(buf, c.rawChecksum...)
+	buf = append(buf, c.nonce...)
+	buf = append(buf, c.tag...)
+	if c.flags&flagKeyID != 0 {
+		buf = append(append(buf, uint8(len(c.keyID))), c.keyID...)
+	}
+	return w.Write(buf)
+}
+
+// errMagic is returned by parseHeader for data that is no header.
+var errMagic = errors.New("Failed to parse magic number")
+
 func parseHeader(r io.Reader) (*Header, error) {
-	var buf [20]byte
-	if _, e := r.Read(buf[:]); e != nil {
+	var buf [headerSize]byte
+	if _, e := io.ReadFull(r, buf[:]); e != nil {
 		return nil, e
 	}
 
-	if v := binary.LittleEndian.Uint32(buf[0:4]); v != magicNumber {
-		return nil, fmt.Errorf("Failed to parse magic number")
+	switch binary.LittleEndian.Uint32(buf[0:4]) {
+	case magicNumber:
+	case magicNumberV2:
+		return parseHeaderV2(r, buf)
+	case footerMagic:
+		return nil, errFooter
+	case fileHeaderMagic:
+		return nil, errFileHeader
+	default:
+		if m := binary.LittleEndian.Uint32(buf[0:4]); m&^0xff == magicPrefix {
+			return nil, &UnsupportedVersionError{Part: "chunk header", Version: uint64(m)}
+		}
+		return nil, errMagic
 	}
 
 	return &Header{
@@ -57,3 +205,67 @@ func parseHeader(r io.Reader) (*Header, error) {
 		numRecords:     binary.LittleEndian.Uint32(buf[16:20]),
 	}, nil
 }
+
+// parseHeaderV2 reads the checksums following the fixed part buf of a
+// version 2 header from r.
+func parseHeaderV2(r io.Reader, buf [headerSize]byte) (*Header, error) {
+	c := &Header{
+		compressor:     binary.LittleEndian.Uint32(buf[4:8]),
+		compressedSize: binary.LittleEndian.Uint32(buf[8:12]),
+		numRecords:     binary.LittleEndian.Uint32(buf[12:16]),
+		checksumType:   buf[16],
+		flags:          buf[17],
+	}
+
+	if c.flags&^knownFlags != 0 {
+		return nil, &UnsupportedVersionError{Part: "chunk header flags", Version: uint64(c.flags)}
+	}
+
+	n := int(binary.LittleEndian.Uint16(buf[18:20]))
+	if c.flags&flagRawChecksum != 0 {
+		n *= 2
+	}
+	sealed := 0
+	if c.flags&flagEncrypted != 0 {
+		sealed = gcmNonceSize + gcmTagSize
+	}
+
+	read := func(n int) ([]byte, error) {
+		p := make([]byte, n)
+		_, e := io.ReadFull(r, p)
+		if e == io.EOF {
+			e = io.ErrUnexpectedEOF // within the header.
+		}
+		return p, e
+	}
+
+	sums, e := read(n + sealed)
+	if e != nil {
+		return nil, e
+	}
+
+	if sealed > 0 {
+		c.nonce, c.tag = sums[n:n+gcmNonceSize], sums[n+gcmNonceSize:]
+	}
+	sums = sums[:n]
+
+	if c.flags&flagKeyID != 0 {
+		l, e := read(1)
+		if e == nil {
+			c.keyID, e = read(int(l[0]))
+		}
+		if e != nil {
+			return nil, e
+		}
+	}
+
+	c.checksum = sums
+	if c.flags&flagRawChecksum != 0 {
+		c.checksum, c.rawChecksum = sums[:n/2], sums[n/2:]
+	}
+
+	var sum [4]byte
+	copy(sum[:], c.checksum)
+	c.checkSum = binary.LittleEndian.Uint32(sum[:])
+	return c, nil
+}
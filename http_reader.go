@@ -0,0 +1,160 @@
+package recordio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	httpAttempts = 3
+	httpBackoff  = 100 * time.Millisecond
+)
+
+// ErrRemoteChanged is returned by an HTTPReaderAt if the file changed
+// on the server after NewHTTPReaderAt, so that records of the old and
+// the new file are never mixed.
+var ErrRemoteChanged = errors.New("recordio: remote file changed")
+
+// HTTPReaderAt reads a file served over HTTP(S), like a dataset on a
+// CDN, by Range requests, for the constructors taking an io.ReaderAt.
+// Each request carries If-Range with the ETag, or else Last-Modified,
+// seen by NewHTTPReaderAt, and fails with ErrRemoteChanged if the file
+// changed since.  Failed requests and server errors are retried a few
+// times.  It is also a RangeReader, so that NewRangeReaderAt can cache
+// and coalesce the many small reads of scanners:
+//
+//	h, err := recordio.NewHTTPReaderAt(url, nil)
+//	...
+//	r := recordio.NewRangeReaderAt(h, h.Size(), -1, -1)
+type HTTPReaderAt struct {
+	url       string
+	client    *http.Client
+	size      int64
+	validator string // of If-Range.
+}
+
+// NewHTTPReaderAt creates an HTTPReaderAt of url, sending a HEAD
+// request for its size and validator.  client nil means
+// http.DefaultClient.
+func NewHTTPReaderAt(url string, client *http.Client) (*HTTPReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	h := &HTTPReaderAt{url: url, client: client}
+
+	resp, e := h.do(http.MethodHead, "")
+	if e != nil {
+		return nil, e
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to stat %s: %s", url, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("Failed to stat %s: unknown size", url)
+	}
+
+	h.size = resp.ContentLength
+	h.validator = resp.Header.Get("ETag")
+	if h.validator == "" {
+		h.validator = resp.Header.Get("Last-Modified")
+	}
+	return h, nil
+}
+
+// Size returns the size of the file.
+func (h *HTTPReaderAt) Size() int64 {
+	return h.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (h *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Invalid offset: %d", off)
+	}
+	if off >= h.size {
+		return 0, io.EOF
+	}
+
+	length := int64(len(p))
+	if off+length > h.size {
+		length = h.size - off
+	}
+	if length == 0 {
+		return 0, nil
+	}
+
+	body, e := h.ReadRange(off, length)
+	if e != nil {
+		return 0, e
+	}
+	defer body.Close()
+
+	n, e := io.ReadFull(body, p[:length])
+	if e != nil {
+		return n, fmt.Errorf("Failed to read %s: %w", h.url, e)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// ReadRange implements RangeReader.
+func (h *HTTPReaderAt) ReadRange(offset, length int64) (io.ReadCloser, error) {
+	resp, e := h.do(http.MethodGet, fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	if e != nil {
+		return nil, e
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// If-Range failed, or the server ignores ranges.
+		resp.Body.Close()
+		if h.validator != "" && resp.Header.Get("ETag") != h.validator && resp.Header.Get("Last-Modified") != h.validator {
+			return nil, ErrRemoteChanged
+		}
+		return nil, fmt.Errorf("Failed to read %s: the server ignores Range", h.url)
+	}
+
+	resp.Body.Close()
+	return nil, fmt.Errorf("Failed to read %s: %s", h.url, resp.Status)
+}
+
+// do sends a request, retrying on errors and on server errors.
+func (h *HTTPReaderAt) do(method, byteRange string) (*http.Response, error) {
+	var resp *http.Response
+	var e error
+	for attempt := 0; attempt < httpAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(httpBackoff << (attempt - 1))
+		}
+
+		var req *http.Request
+		if req, e = http.NewRequest(method, h.url, nil); e != nil {
+			return nil, e
+		}
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+			if h.validator != "" {
+				req.Header.Set("If-Range", h.validator)
+			}
+		}
+
+		resp, e = h.client.Do(req)
+		if e == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if e == nil {
+			resp.Body.Close()
+			e = fmt.Errorf("%s", resp.Status)
+		}
+	}
+	return nil, fmt.Errorf("Failed to request %s: %w", h.url, e)
+}
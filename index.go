@@ -0,0 +1,480 @@
+package recordio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync/atomic"
+)
+
+// IndexFormat is the encoding of an Index saved by Index.SaveAs.
+type IndexFormat int
+
+const (
+	// IndexBinary is a stable little-endian binary encoding,
+	// documented at encodeIndex, which tools in other languages
+	// can consume.
+	IndexBinary IndexFormat = iota
+	// IndexGob is the Gob encoding of Index.
+	IndexGob
+	// IndexJSON is the JSON encoding documented at
+	// Index.MarshalJSON.
+	IndexJSON
+	// IndexProto is the protobuf encoding of the Index message in
+	// index.proto.
+	IndexProto
+)
+
+// indexFileMagic starts an Index saved in IndexBinary.  Its first
+// byte can never start a Gob stream or a JSON document, which lets
+// LoadIndexFile tell the formats apart.
+var indexFileMagic = []byte("\x89RIX")
+
+// Index consists offsets and sizes of the consequetive chunks in a RecordIO file.
+//
+// Index supports Gob. Every field in the Index needs to be exported
+// for the correct encoding and decoding using Gob.
+type Index struct {
+	ChunkOffsets []int64
+	ChunkLens    []uint32
+	NumRecords   int   // the number of all records in a file.
+	ChunkRecords []int // the number of records in chunks.
+
+	// ChunkChecksums holds the checksums recorded in the chunk
+	// headers, which Validate compares against the file.  It is
+	// empty for indexes saved before it was introduced.
+	ChunkChecksums []uint32
+
+	// RecordOffsets optionally holds, for each chunk, the offsets
+	// of its records within the deflated chunk data.  It is filled
+	// by LoadRecordOffsets and lets ReadRecord deflate only the
+	// bytes up to the requested record.
+	RecordOffsets [][]uint32
+
+	metadata map[string]string // see Metadata.
+	keys     *KeyIndex         // see KeyIndex.
+	// keyRanges holds the first and last keys of each chunk if the
+	// records are sorted by key; see SortedByKey.
+	keyRanges []keyRange
+	blooms    []bloomFilter // of WithBloomFilter, for each chunk.
+	stats     *FileStats    // of WithStats, of the whole file.
+
+	// cum holds the []int of cumulative, stored atomically, as it
+	// is built lazily by the read-only methods.  An Index must thus
+	// not be copied once in use: build it in place instead.
+	cum atomic.Value
+}
+
+// LoadIndex scans the file and parse chunkOffsets, chunkLens, and len.
+func LoadIndex(r io.ReadSeeker) (*Index, error) {
+	idx, _, e := loadIndex(r, -1)
+	return idx, e
+}
+
+// LoadIndexLenient is LoadIndex for files whose writer may have died
+// in the middle of a chunk: instead of failing, it returns the Index
+// of the complete chunks, all readable, and whether the file ends with
+// a truncated chunk.
+func LoadIndexLenient(r io.ReadSeeker) (*Index, bool, error) {
+	size, e := r.Seek(0, io.SeekEnd)
+	if e != nil {
+		return nil, false, e
+	}
+	if _, e = r.Seek(0, io.SeekStart); e != nil {
+		return nil, false, e
+	}
+	return loadIndex(r, size)
+}
+
+// loadIndex is LoadIndex, which also reports a truncated chunk if the
+// size of the file is known, i.e. not -1.
+func loadIndex(r io.ReadSeeker, size int64) (*Index, bool, error) {
+	fh, e := readFileHeader(r)
+	if e != nil {
+		return nil, false, e
+	}
+
+	offset, e := r.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return nil, false, e
+	}
+
+	f := newIndex()
+	f.metadata = fh.metadata()
+	var hdr *Header
+
+	for {
+		hdr, e = parseHeader(r)
+		if e != nil {
+			break
+		}
+
+		if size >= 0 && offset+hdr.size()+int64(hdr.compressedSize) > size {
+			return f, true, nil
+		}
+
+		f.addChunk(offset, int(hdr.numRecords), hdr.checkSum)
+
+		offset, e = r.Seek(int64(hdr.compressedSize), io.SeekCurrent)
+		if e != nil {
+			break
+		}
+	}
+
+	if e == io.EOF || e == errFooter {
+		return f, false, nil
+	}
+	if e == io.ErrUnexpectedEOF && size >= 0 {
+		return f, true, nil
+	}
+	return nil, false, e
+}
+
+// NumChunks returns the total number of chunks in a RecordIO file.
+func (r *Index) NumChunks() int {
+	return len(r.ChunkLens)
+}
+
+// ChunkIndex return the Index of i-th Chunk.
+func (r *Index) ChunkIndex(i int) *Index {
+	return r.Slice(i, i+1)
+}
+
+// Slice returns the Index of the chunks in [fromChunk, toChunk), with
+// records numbered from the first record of fromChunk.  Chunk offsets
+// are kept, so the returned Index reads the same file; it is how a
+// contiguous range of chunks is assigned to a worker.  Like slicing,
+// it panics unless 0 <= fromChunk <= toChunk <= NumChunks().
+func (r *Index) Slice(fromChunk, toChunk int) *Index {
+	if fromChunk < 0 || fromChunk > toChunk || toChunk > r.NumChunks() {
+		panic(fmt.Sprintf("recordio: chunk range [%d, %d) out of range [0, %d)", fromChunk, toChunk, r.NumChunks()))
+	}
+
+	idx := newIndex()
+	for i := fromChunk; i < toChunk; i++ {
+		idx.addChunk(r.ChunkOffsets[i], r.ChunkRecords[i], r.chunkChecksum(i))
+	}
+
+	if !r.hasChecksums() {
+		idx.ChunkChecksums = nil
+	}
+	if r.RecordOffsets != nil {
+		idx.RecordOffsets = r.RecordOffsets[fromChunk:toChunk]
+	}
+	idx.metadata = r.metadata
+	if r.keys != nil {
+		from := 0
+		for _, n := range r.ChunkRecords[:fromChunk] {
+			from += n
+		}
+		idx.keys = r.keys.slice(from, from+idx.NumRecords)
+	}
+	if r.keyRanges != nil {
+		idx.keyRanges = r.keyRanges[fromChunk:toChunk]
+	}
+	if r.blooms != nil {
+		idx.blooms = r.blooms[fromChunk:toChunk]
+	}
+	return idx
+}
+
+// Locate returns the index of chunk that contains the given record,
+// and the record index within the chunk.  It returns (-1, -1) if the
+// record is out of range.  It takes O(log(NumChunks())) time.
+//
+// The cumulative record counts it searches are maintained by the
+// functions in this package that create an Index; for an Index
+// assembled by hand they are computed on the first call to Locate.
+// It is safe for concurrent use, as are the other methods reading
+// the Index.
+func (r *Index) Locate(recordIndex int) (int, int) {
+	cum := r.cumulative()
+	if recordIndex < 0 || recordIndex >= cum[len(r.ChunkLens)] {
+		return -1, -1
+	}
+
+	i := sort.SearchInts(cum, recordIndex+1) - 1
+	return i, recordIndex - cum[i]
+}
+
+// chunkStart returns the index of the first record of the i-th chunk,
+// or NumRecords for i == NumChunks().
+func (r *Index) chunkStart(i int) int {
+	return r.cumulative()[i]
+}
+
+// cumulative returns the cumulative record counts of r: the i-th is
+// the number of records in chunks before the i-th chunk, and the
+// NumChunks()-th is the total.  Concurrent calls on an Index assembled
+// by hand may each build them.
+func (r *Index) cumulative() []int {
+	if cum, _ := r.cum.Load().([]int); len(cum) == len(r.ChunkLens)+1 {
+		return cum
+	}
+
+	cum := make([]int, len(r.ChunkLens)+1)
+	for i, l := range r.ChunkLens {
+		cum[i+1] = cum[i] + int(l)
+	}
+	r.cum.Store(cum)
+	return cum
+}
+
+// newIndex returns an empty Index ready for addChunk.
+func newIndex() *Index {
+	r := &Index{}
+	r.cum.Store([]int{0})
+	return r
+}
+
+// LoadRecordOffsets parses every chunk of the Index in r to fill
+// RecordOffsets.  It is as expensive as scanning the whole file, and
+// pays off when the Index is saved and reused for many ReadRecord
+// calls.
+func (r *Index) LoadRecordOffsets(rs io.ReadSeeker) error {
+	offsets := make([][]uint32, r.NumChunks())
+	for i, offset := range r.ChunkOffsets {
+		ch, e := parseChunk(rs, offset, nil)
+		if e != nil {
+			return e
+		}
+		offsets[i] = ch.recordOffsets()
+	}
+
+	r.RecordOffsets = offsets
+	return nil
+}
+
+// ReadRecord reads the record of the given index from r.  If the Index
+// has RecordOffsets, only the part of the chunk up to the record is
+// deflated, and the chunk checksum is not verified; otherwise the
+// whole chunk is parsed.
+func ReadRecord(r io.ReadSeeker, index *Index, recordIndex int) ([]byte, error) {
+	ci, ri := index.Locate(recordIndex)
+	if ci < 0 {
+		return nil, fmt.Errorf("Record index out of range: %d", recordIndex)
+	}
+
+	if index.RecordOffsets != nil {
+		return parseRecord(r, index.ChunkOffsets[ci], index.RecordOffsets[ci][ri])
+	}
+
+	ch, e := parseChunk(r, index.ChunkOffsets[ci], nil)
+	if e != nil {
+		return nil, e
+	}
+	return ch.records[ri], nil
+}
+
+// Validate re-reads the chunk headers at the offsets recorded in the
+// Index of a whole file, and returns an *IndexMismatchError if the
+// file does not match: a chunk with a different record count or
+// checksum, chunks not adjacent to each other, or data after the last
+// chunk.  Use it before trusting an Index loaded from a sidecar file
+// that may have been written for an older version of the data file.
+func (r *Index) Validate(rs io.ReadSeeker) error {
+	next := int64(0)
+	if r.NumChunks() > 0 {
+		next = r.ChunkOffsets[0]
+	}
+
+	for i, offset := range r.ChunkOffsets {
+		if offset != next {
+			return &IndexMismatchError{Chunk: i, Offset: offset,
+				Reason: fmt.Sprintf("previous chunk ends at %d", next)}
+		}
+
+		if _, e := rs.Seek(offset, io.SeekStart); e != nil {
+			return e
+		}
+
+		hdr, e := parseHeader(rs)
+		if e != nil {
+			return &IndexMismatchError{Chunk: i, Offset: offset,
+				Reason: fmt.Sprintf("failed to parse chunk header: %v", e)}
+		}
+
+		if int(hdr.numRecords) != r.ChunkRecords[i] {
+			return &IndexMismatchError{Chunk: i, Offset: offset,
+				Reason: fmt.Sprintf("%d records in file, %d in index", hdr.numRecords, r.ChunkRecords[i])}
+		}
+
+		if r.hasChecksums() && hdr.checkSum != r.ChunkChecksums[i] {
+			return &IndexMismatchError{Chunk: i, Offset: offset,
+				Reason: "checksum mismatch"}
+		}
+
+		next = offset + hdr.size() + int64(hdr.compressedSize)
+	}
+
+	if _, e := rs.Seek(next, io.SeekStart); e != nil {
+		return e
+	}
+
+	if _, e := parseHeader(rs); e != io.EOF && e != errFooter {
+		return &IndexMismatchError{Chunk: r.NumChunks(), Offset: next,
+			Reason: "unindexed data after the last chunk"}
+	}
+	return nil
+}
+
+// IndexMismatchError is returned by Index.Validate when the Index does
+// not describe the file.
+type IndexMismatchError struct {
+	Chunk  int   // the index of the offending chunk.
+	Offset int64 // the offset of the offending chunk.
+	Reason string
+}
+
+func (e *IndexMismatchError) Error() string {
+	return fmt.Sprintf("recordio: index mismatch at chunk %d (offset %d): %s", e.Chunk, e.Offset, e.Reason)
+}
+
+// chunkChecksum returns the checksum of the i-th chunk, or 0 if
+// ChunkChecksums is not filled.
+func (r *Index) chunkChecksum(i int) uint32 {
+	if !r.hasChecksums() {
+		return 0
+	}
+	return r.ChunkChecksums[i]
+}
+
+// hasChecksums returns whether ChunkChecksums is filled.
+func (r *Index) hasChecksums() bool {
+	return len(r.ChunkChecksums) == r.NumChunks() && r.NumChunks() > 0
+}
+
+// addChunk appends a chunk to the Index.
+func (r *Index) addChunk(offset int64, numRecords int, checkSum uint32) {
+	cum := r.cumulative()
+
+	r.ChunkOffsets = append(r.ChunkOffsets, offset)
+	r.ChunkLens = append(r.ChunkLens, uint32(numRecords))
+	r.ChunkRecords = append(r.ChunkRecords, numRecords)
+	r.ChunkChecksums = append(r.ChunkChecksums, checkSum)
+	r.NumRecords += numRecords
+	r.cum.Store(append(cum, cum[len(cum)-1]+numRecords))
+}
+
+// Save writes the Index into w in IndexBinary.  An Index saved next to
+// its data file (e.g. data.recordio.idx) can be reused by other
+// processes via LoadIndexFile instead of LoadIndex.
+func (r *Index) Save(w io.Writer) error {
+	return r.SaveAs(w, IndexBinary)
+}
+
+// SaveAs writes the Index into w in the given format.
+func (r *Index) SaveAs(w io.Writer, format IndexFormat) error {
+	switch format {
+	case IndexBinary:
+		payload := encodeIndex(r)
+
+		var hdr [8]byte
+		copy(hdr[0:4], indexFileMagic)
+		binary.LittleEndian.PutUint32(hdr[4:8], crc32.ChecksumIEEE(payload))
+
+		if _, e := w.Write(hdr[:]); e != nil {
+			return fmt.Errorf("Failed to write index: %v", e)
+		}
+		if _, e := w.Write(payload); e != nil {
+			return fmt.Errorf("Failed to write index: %v", e)
+		}
+		return nil
+	case IndexGob:
+		return gob.NewEncoder(w).Encode(r)
+	case IndexJSON:
+		return json.NewEncoder(w).Encode(r)
+	case IndexProto:
+		if _, e := w.Write(r.MarshalProto()); e != nil {
+			return fmt.Errorf("Failed to write index: %v", e)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unknown index format: %d", format)
+	}
+}
+
+// LoadIndexFile reads an Index written by Index.Save or Index.SaveAs,
+// detecting the format automatically.  IndexProto has no distinctive
+// prefix and must be read with LoadIndexFileAs.
+func LoadIndexFile(r io.Reader) (*Index, error) {
+	br := bufio.NewReader(r)
+	prefix, e := br.Peek(64)
+	if e != nil && e != io.EOF {
+		return nil, e
+	}
+
+	format := IndexGob
+	if bytes.HasPrefix(prefix, indexFileMagic) {
+		format = IndexBinary
+	} else if isJSONObject(prefix) {
+		format = IndexJSON
+	}
+	return LoadIndexFileAs(br, format)
+}
+
+// isJSONObject returns whether prefix starts a JSON object.  A Gob
+// stream may start with '{' as a message length, but is never
+// followed by a key or the end of the object.
+func isJSONObject(prefix []byte) bool {
+	const space = " \t\r\n"
+	p := bytes.TrimLeft(prefix, space)
+	if len(p) == 0 || p[0] != '{' {
+		return false
+	}
+
+	p = bytes.TrimLeft(p[1:], space)
+	return len(p) > 0 && (p[0] == '"' || p[0] == '}')
+}
+
+// LoadIndexFileAs reads an Index written by Index.SaveAs in the given
+// format.
+func LoadIndexFileAs(r io.Reader, format IndexFormat) (*Index, error) {
+	idx := &Index{}
+	switch format {
+	case IndexBinary:
+		buf, e := ioutil.ReadAll(r)
+		if e != nil {
+			return nil, e
+		}
+
+		if len(buf) < 8 || !bytes.Equal(buf[0:4], indexFileMagic) {
+			return nil, fmt.Errorf("Failed to parse index file magic number")
+		}
+
+		payload := buf[8:]
+		if binary.LittleEndian.Uint32(buf[4:8]) != crc32.ChecksumIEEE(payload) {
+			return nil, fmt.Errorf("Index checksum checking failed.")
+		}
+		return decodeIndex(payload)
+	case IndexGob:
+		if e := gob.NewDecoder(r).Decode(idx); e != nil {
+			return nil, fmt.Errorf("Failed to decode index: %v", e)
+		}
+		idx.cumulative()
+		return idx, nil
+	case IndexJSON:
+		if e := json.NewDecoder(r).Decode(idx); e != nil {
+			return nil, fmt.Errorf("Failed to decode index: %v", e)
+		}
+		return idx, nil
+	case IndexProto:
+		buf, e := ioutil.ReadAll(r)
+		if e != nil {
+			return nil, e
+		}
+		if e = idx.UnmarshalProto(buf); e != nil {
+			return nil, e
+		}
+		return idx, nil
+	default:
+		return nil, fmt.Errorf("Unknown index format: %d", format)
+	}
+}
@@ -0,0 +1,142 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+const (
+	// minProbeRange is the smallest byte range LoadIndexAt hands to
+	// a goroutine, so that small files are not split pointlessly.
+	minProbeRange = 1024 * 1024
+	probeWindow   = 64 * 1024
+)
+
+// LoadIndexAt builds the Index of the recordio file of the given size
+// in r, like LoadIndex, but probes chunk headers with up to
+// concurrency goroutines.
+//
+// The file is split into byte ranges.  Each goroutine looks for the
+// first chunk magic number in its range and walks the chunk headers
+// from there via their compressedSize field.  Headers found this way
+// are only trusted if the chain of headers starting at offset 0
+// reaches them, so magic numbers appearing inside record data do no
+// harm; they merely cost a sequential walk over the affected range.
+func LoadIndexAt(r io.ReaderAt, size int64, concurrency int) (*Index, error) {
+	n := int(size / minProbeRange)
+	if n > concurrency {
+		n = concurrency
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	rangeSize := size / int64(n)
+	probes := make([]map[int64]*Header, n)
+
+	var wg sync.WaitGroup
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			end := int64(i+1) * rangeSize
+			if i == n-1 {
+				end = size
+			}
+			probes[i] = probeChunks(r, size, int64(i)*rangeSize, end)
+		}(i)
+	}
+	wg.Wait()
+
+	sr := io.NewSectionReader(r, 0, size)
+	fh, e := readFileHeader(sr)
+	if e != nil {
+		return nil, e
+	}
+	offset, _ := sr.Seek(0, io.SeekCurrent)
+
+	f := newIndex()
+	f.metadata = fh.metadata()
+	for offset < size {
+		w := int(offset / rangeSize)
+		if w >= n {
+			w = n - 1
+		}
+
+		hdr, ok := probes[w][offset]
+		if !ok {
+			var e error
+			hdr, e = headerAt(r, offset)
+			if e == io.EOF || e == errFooter {
+				break
+			}
+			if e != nil {
+				return nil, e
+			}
+		}
+
+		f.addChunk(offset, int(hdr.numRecords), hdr.checkSum)
+		offset += hdr.size() + int64(hdr.compressedSize)
+	}
+	return f, nil
+}
+
+// probeChunks finds the first chunk magic number, of either header
+// version, in [start, end) of r
+// and returns the chunk headers reachable from it that start before
+// end, keyed by offset.
+func probeChunks(r io.ReaderAt, size, start, end int64) map[int64]*Header {
+	probed := make(map[int64]*Header)
+
+	offset := int64(-1)
+	buf := make([]byte, probeWindow+3)
+	for pos := start; pos < end && offset < 0; pos += probeWindow {
+		n, e := r.ReadAt(buf, pos)
+		if i := indexMagic(buf[:n]); i >= 0 && pos+int64(i) < end {
+			offset = pos + int64(i)
+		}
+		if e != nil {
+			break
+		}
+	}
+
+	for offset >= 0 && offset < end {
+		hdr, e := headerAt(r, offset)
+		if e != nil {
+			break
+		}
+
+		next := offset + hdr.size() + int64(hdr.compressedSize)
+		if next > size {
+			break
+		}
+
+		probed[offset] = hdr
+		offset = next
+	}
+	return probed
+}
+
+// headerAt parses the chunk header at offset of r.
+func headerAt(r io.ReaderAt, offset int64) (*Header, error) {
+	return parseHeader(io.NewSectionReader(r, offset, math.MaxInt64-offset))
+}
+
+// indexMagic returns the index of the first chunk magic number, of
+// either header version, in buf, or -1 if there is none.
+func indexMagic(buf []byte) int {
+	var magics [2][4]byte
+	binary.LittleEndian.PutUint32(magics[0][:], magicNumber)
+	binary.LittleEndian.PutUint32(magics[1][:], magicNumberV2)
+
+	first := -1
+	for _, magic := range magics {
+		if i := bytes.Index(buf, magic[:]); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	return first
+}
@@ -0,0 +1,180 @@
+package recordio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// indexCacheMagic starts an entry of an IndexCache.
+var indexCacheMagic = []byte("\x89RIC")
+
+// Validator identifies a version of a file, to tell whether an Index
+// cached for it is still valid.
+type Validator struct {
+	Size int64
+	// Token is that of the version, like an ETag, or a modification
+	// time.  Empty means that Size alone identifies the version.
+	Token string
+}
+
+// FileValidator returns the Validator of a local file, made of its size
+// and modification time.
+func FileValidator(fi fs.FileInfo) Validator {
+	return Validator{Size: fi.Size(), Token: strconv.FormatInt(fi.ModTime().UnixNano(), 10)}
+}
+
+// Validator returns the Validator of the remote file, made of its size
+// and its ETag, or else Last-Modified.
+func (h *HTTPReaderAt) Validator() Validator {
+	return Validator{Size: h.size, Token: h.validator}
+}
+
+// IndexCache caches the Indexes of files in a directory, so that
+// readers of remote files, which take long to scan, or processes
+// started afresh, skip LoadIndex when the files did not change:
+//
+//	h, err := recordio.NewHTTPReaderAt(url, nil)
+//	...
+//	idx, err := cache.Load(url, h.Validator(), func() (*recordio.Index, error) {
+//		return recordio.LoadIndex(io.NewSectionReader(h, 0, h.Size()))
+//	})
+//
+// An entry is keyed by the location of the file, a URL or path, and
+// records the Validator of the file it was made of, which must match
+// that of the file now for the entry to be used.  Entries are written
+// atomically, so the directory is safe to share between processes.
+type IndexCache struct {
+	dir string
+}
+
+// NewIndexCache creates an IndexCache in dir, creating dir if needed.
+func NewIndexCache(dir string) (*IndexCache, error) {
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return nil, fmt.Errorf("Failed to create index cache: %v", e)
+	}
+	return &IndexCache{dir: dir}, nil
+}
+
+// Get returns the Index cached for the file at location, or nil if
+// there is none, or if it was made of a version of the file other than
+// that of v.  Unreadable entries are treated as missing.
+func (c *IndexCache) Get(location string, v Validator) (*Index, error) {
+	buf, e := os.ReadFile(c.path(location))
+	if os.IsNotExist(e) {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, fmt.Errorf("Failed to read index cache: %v", e)
+	}
+
+	l, cached, idx, e := decodeIndexCacheEntry(buf)
+	if e != nil || l != location || cached != v {
+		return nil, nil
+	}
+	return idx, nil
+}
+
+// Put caches idx as the Index of the version v of the file at location.
+func (c *IndexCache) Put(location string, v Validator, idx *Index) error {
+	buf := append([]byte(nil), indexCacheMagic...)
+	buf = appendString(buf, location)
+	buf = appendUvarint(buf, uint64(v.Size))
+	buf = appendString(buf, v.Token)
+
+	b := bytes.NewBuffer(buf)
+	if e := idx.Save(b); e != nil {
+		return e
+	}
+
+	f, e := os.CreateTemp(c.dir, ".tmp*")
+	if e != nil {
+		return fmt.Errorf("Failed to write index cache: %v", e)
+	}
+	_, e = f.Write(b.Bytes())
+	if ce := f.Close(); e == nil {
+		e = ce
+	}
+	if e == nil {
+		e = os.Rename(f.Name(), c.path(location))
+	}
+	if e != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Failed to write index cache: %v", e)
+	}
+	return nil
+}
+
+// Load returns the Index cached for the file at location, after
+// checking that it was made of the version v of the file.  Otherwise,
+// it calls load and caches the Index it returns.
+func (c *IndexCache) Load(location string, v Validator, load func() (*Index, error)) (*Index, error) {
+	idx, e := c.Get(location, v)
+	if idx != nil || e != nil {
+		return idx, e
+	}
+
+	if idx, e = load(); e != nil {
+		return nil, e
+	}
+	return idx, c.Put(location, v, idx)
+}
+
+// Remove removes the entry of the file at location, if any.
+func (c *IndexCache) Remove(location string) error {
+	if e := os.Remove(c.path(location)); e != nil && !os.IsNotExist(e) {
+		return e
+	}
+	return nil
+}
+
+// path returns the path of the entry of location, named by its hash as
+// locations may be long or hold any characters.
+func (c *IndexCache) path(location string) string {
+	sum := sha256.Sum256([]byte(location))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".idx")
+}
+
+func decodeIndexCacheEntry(buf []byte) (string, Validator, *Index, error) {
+	var v Validator
+	if !bytes.HasPrefix(buf, indexCacheMagic) {
+		return "", v, nil, fmt.Errorf("Failed to parse index cache magic number")
+	}
+	buf = buf[len(indexCacheMagic):]
+
+	location, buf, e := readString(buf)
+	if e != nil {
+		return "", v, nil, e
+	}
+	size, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return "", v, nil, fmt.Errorf("Failed to parse index cache entry")
+	}
+	v.Size = int64(size)
+	if v.Token, buf, e = readString(buf[n:]); e != nil {
+		return "", v, nil, e
+	}
+
+	idx, e := LoadIndexFileAs(bytes.NewReader(buf), IndexBinary)
+	return location, v, idx, e
+}
+
+func appendString(buf []byte, s string) []byte {
+	return append(appendUvarint(buf, uint64(len(s))), s...)
+}
+
+// readString reads a string written by appendString, returning the
+// rest of buf.
+func readString(buf []byte) (string, []byte, error) {
+	l, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < l {
+		return "", nil, fmt.Errorf("Failed to parse index cache entry")
+	}
+	return string(buf[n : n+int(l)]), buf[n+int(l):], nil
+}
@@ -0,0 +1,118 @@
+package recordio
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonIndex is the JSON encoding of Index, with names following the
+// protobuf message in index.proto:
+//
+//	{
+//	  "num_records": 5,
+//	  "chunks": [
+//	    {"offset": 0, "num_records": 3, "checksum": 1234, "record_offsets": [0, 9, 15]},
+//	    {"offset": 52, "num_records": 2, "checksum": 5678}
+//	  ],
+//	  "metadata": {"dataset": "train"}
+//	}
+//
+// num_records of the Index is informational; readers recompute it
+// from the chunks.
+type jsonIndex struct {
+	NumRecords int               `json:"num_records"`
+	Chunks     []jsonChunk       `json:"chunks"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+type jsonChunk struct {
+	Offset        int64    `json:"offset"`
+	NumRecords    int      `json:"num_records"`
+	Checksum      *uint32  `json:"checksum,omitempty"`
+	RecordOffsets []uint32 `json:"record_offsets,omitempty"`
+}
+
+// MarshalJSON encodes the Index in JSON for readers in other
+// languages.
+func (r *Index) MarshalJSON() ([]byte, error) {
+	j := jsonIndex{NumRecords: r.NumRecords, Chunks: make([]jsonChunk, r.NumChunks()), Metadata: r.metadata}
+	for i, offset := range r.ChunkOffsets {
+		c := &j.Chunks[i]
+		c.Offset = offset
+		c.NumRecords = r.ChunkRecords[i]
+		if r.hasChecksums() {
+			c.Checksum = &r.ChunkChecksums[i]
+		}
+		if r.RecordOffsets != nil {
+			c.RecordOffsets = r.RecordOffsets[i]
+		}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes an Index encoded by MarshalJSON.
+func (r *Index) UnmarshalJSON(data []byte) error {
+	var j jsonIndex
+	if e := json.Unmarshal(data, &j); e != nil {
+		return e
+	}
+
+	// The Index is decoded in place, as it must not be copied.
+	*r = Index{}
+	idx := r
+	checksums, recordOffsets := true, true
+	for _, c := range j.Chunks {
+		if c.RecordOffsets != nil && len(c.RecordOffsets) != c.NumRecords {
+			return fmt.Errorf("Chunk at %d has %d records but %d record offsets", c.Offset, c.NumRecords, len(c.RecordOffsets))
+		}
+
+		var checkSum uint32
+		if c.Checksum != nil {
+			checkSum = *c.Checksum
+		}
+		idx.addChunk(c.Offset, c.NumRecords, checkSum)
+		idx.RecordOffsets = append(idx.RecordOffsets, c.RecordOffsets)
+
+		checksums = checksums && c.Checksum != nil
+		recordOffsets = recordOffsets && len(c.RecordOffsets) == c.NumRecords
+	}
+
+	if !checksums || len(j.Chunks) == 0 {
+		idx.ChunkChecksums = nil
+	}
+	if !recordOffsets || len(j.Chunks) == 0 {
+		idx.RecordOffsets = nil
+	}
+	if len(j.Metadata) > 0 {
+		idx.metadata = j.Metadata
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes the MergedIndex in JSON as
+//
+//	{"index": {...}, "shard_chunk_bases": [...], "shard_record_bases": [...]}
+//
+// where index is encoded by Index.MarshalJSON.
+func (m *MergedIndex) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMergedIndex{&m.Index, m.ShardChunkBases, m.ShardRecordBases})
+}
+
+// UnmarshalJSON decodes a MergedIndex encoded by MarshalJSON.
+func (m *MergedIndex) UnmarshalJSON(data []byte) error {
+	j := jsonMergedIndex{Index: &m.Index}
+	if e := json.Unmarshal(data, &j); e != nil {
+		return e
+	}
+
+	m.ShardChunkBases = j.ShardChunkBases
+	m.ShardRecordBases = j.ShardRecordBases
+	return nil
+}
+
+type jsonMergedIndex struct {
+	Index            *Index `json:"index"`
+	ShardChunkBases  []int  `json:"shard_chunk_bases"`
+	ShardRecordBases []int  `json:"shard_record_bases"`
+}
@@ -0,0 +1,68 @@
+package recordio
+
+import "sort"
+
+// MergedIndex is a single logical Index spanning several shard files,
+// e.g. train-00000-of-00128 … train-00127-of-00128, with one global
+// numbering of chunks and records.  Its ChunkOffsets remain offsets
+// within the shard file that holds each chunk; use Shard to find out
+// which one.
+type MergedIndex struct {
+	Index
+	ShardChunkBases  []int // the global index of the first chunk of each shard.
+	ShardRecordBases []int // the global index of the first record of each shard.
+}
+
+// MergeIndexes concatenates the indexes of shard files, in the given
+// order, into a MergedIndex.
+func MergeIndexes(idx ...*Index) *MergedIndex {
+	m := &MergedIndex{}
+	checksums := true
+	for _, shard := range idx {
+		m.ShardChunkBases = append(m.ShardChunkBases, m.NumChunks())
+		m.ShardRecordBases = append(m.ShardRecordBases, m.NumRecords)
+		for i, offset := range shard.ChunkOffsets {
+			m.addChunk(offset, shard.ChunkRecords[i], shard.chunkChecksum(i))
+		}
+		checksums = checksums && (shard.hasChecksums() || shard.NumChunks() == 0)
+	}
+
+	if !checksums {
+		m.ChunkChecksums = nil
+	}
+	return m
+}
+
+// NumShards returns the number of merged shards.
+func (m *MergedIndex) NumShards() int {
+	return len(m.ShardChunkBases)
+}
+
+// Shard returns the shard holding the given global chunk.
+func (m *MergedIndex) Shard(chunkIndex int) int {
+	return sort.SearchInts(m.ShardChunkBases, chunkIndex+1) - 1
+}
+
+// LocateShard returns the shard that contains the given global
+// record, and the record index within the shard.  It returns (-1, -1)
+// if the record is out of range.
+func (m *MergedIndex) LocateShard(recordIndex int) (int, int) {
+	if recordIndex < 0 || recordIndex >= m.NumRecords {
+		return -1, -1
+	}
+
+	ci, _ := m.Locate(recordIndex)
+	shard := m.Shard(ci)
+	return shard, recordIndex - m.ShardRecordBases[shard]
+}
+
+// ShardIndex returns the Index of the i-th shard, suitable for
+// scanning the shard file.
+func (m *MergedIndex) ShardIndex(i int) *Index {
+	end := m.NumChunks()
+	if i+1 < m.NumShards() {
+		end = m.ShardChunkBases[i+1]
+	}
+
+	return m.Slice(m.ShardChunkBases[i], end)
+}
@@ -0,0 +1,224 @@
+package recordio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Protobuf wire types used by index.proto.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// MarshalProto encodes the Index as the Index message of index.proto.
+func (r *Index) MarshalProto() []byte {
+	var buf, chunk []byte
+	for i, offset := range r.ChunkOffsets {
+		chunk = chunk[:0]
+		chunk = appendProtoVarint(chunk, 1, uint64(offset))
+		chunk = appendProtoVarint(chunk, 2, uint64(r.ChunkRecords[i]))
+		if r.hasChecksums() {
+			chunk = appendProtoTag(chunk, 3, wireFixed32)
+			chunk = appendFixed32(chunk, r.ChunkChecksums[i])
+		}
+		if r.RecordOffsets != nil && len(r.RecordOffsets[i]) > 0 {
+			var packed []byte
+			for _, o := range r.RecordOffsets[i] {
+				packed = appendUvarint(packed, uint64(o))
+			}
+			chunk = appendProtoBytes(chunk, 4, packed)
+		}
+		buf = appendProtoBytes(buf, 1, chunk)
+	}
+	buf = appendProtoVarint(buf, 2, uint64(r.NumRecords))
+
+	keys := make([]string, 0, len(r.metadata))
+	for k := range r.metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		entry := appendProtoBytes(nil, 1, []byte(k))
+		entry = appendProtoBytes(entry, 2, []byte(r.metadata[k]))
+		buf = appendProtoBytes(buf, 3, entry)
+	}
+	return buf
+}
+
+// UnmarshalProto decodes the Index message of index.proto.  Unknown
+// fields are skipped.
+func (r *Index) UnmarshalProto(buf []byte) error {
+	// The Index is decoded in place, as it must not be copied.
+	*r = Index{}
+	idx := r
+	checksums, recordOffsets := true, true
+
+	e := walkProto(buf, func(field int, wire int, v uint64, data []byte) error {
+		if field == 3 && wire == wireBytes {
+			return idx.unmarshalProtoMetadata(data)
+		}
+		if field != 1 || wire != wireBytes {
+			return nil // num_records is recomputed.
+		}
+
+		var offset int64
+		var numRecords int
+		var checkSum *uint32
+		var offsets []uint32
+		e := walkProto(data, func(field int, wire int, v uint64, data []byte) error {
+			switch {
+			case field == 1 && wire == wireVarint:
+				offset = int64(v)
+			case field == 2 && wire == wireVarint:
+				numRecords = int(uint32(v))
+			case field == 3 && wire == wireFixed32:
+				c := uint32(v)
+				checkSum = &c
+			case field == 4 && wire == wireVarint:
+				offsets = append(offsets, uint32(v))
+			case field == 4 && wire == wireBytes:
+				for len(data) > 0 {
+					o, n := binary.Uvarint(data)
+					if n <= 0 {
+						return fmt.Errorf("Malformed record_offsets")
+					}
+					offsets = append(offsets, uint32(o))
+					data = data[n:]
+				}
+			}
+			return nil
+		})
+		if e != nil {
+			return e
+		}
+
+		if offsets != nil && len(offsets) != numRecords {
+			return fmt.Errorf("Chunk at %d has %d records but %d record offsets", offset, numRecords, len(offsets))
+		}
+
+		var c uint32
+		if checkSum != nil {
+			c = *checkSum
+		}
+		idx.addChunk(offset, numRecords, c)
+		idx.RecordOffsets = append(idx.RecordOffsets, offsets)
+
+		checksums = checksums && checkSum != nil
+		recordOffsets = recordOffsets && len(offsets) == numRecords
+		return nil
+	})
+	if e != nil {
+		return fmt.Errorf("Failed to decode index: %v", e)
+	}
+
+	if !checksums || idx.NumChunks() == 0 {
+		idx.ChunkChecksums = nil
+	}
+	if !recordOffsets || idx.NumChunks() == 0 {
+		idx.RecordOffsets = nil
+	}
+
+	return nil
+}
+
+// unmarshalProtoMetadata decodes an entry of the metadata map.
+func (r *Index) unmarshalProtoMetadata(entry []byte) error {
+	var key, value string
+	e := walkProto(entry, func(field int, wire int, v uint64, data []byte) error {
+		switch {
+		case field == 1 && wire == wireBytes:
+			key = string(data)
+		case field == 2 && wire == wireBytes:
+			value = string(data)
+		}
+		return nil
+	})
+	if e != nil {
+		return e
+	}
+
+	if r.metadata == nil {
+		r.metadata = make(map[string]string)
+	}
+	r.metadata[key] = value
+	return nil
+}
+
+// walkProto calls fn with every field of the protobuf message in buf.
+// v holds the value of varint and fixed fields, and data the value of
+// length-delimited fields.
+func walkProto(buf []byte, fn func(field int, wire int, v uint64, data []byte) error) error {
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return fmt.Errorf("malformed tag")
+		}
+		buf = buf[n:]
+
+		var v uint64
+		var data []byte
+		wire := int(tag & 7)
+		switch wire {
+		case wireVarint:
+			v, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return fmt.Errorf("malformed varint")
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return fmt.Errorf("truncated fixed64")
+			}
+			v = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return fmt.Errorf("truncated fixed32")
+			}
+			v = uint64(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(buf)
+			if n <= 0 || l > uint64(len(buf)-n) {
+				return fmt.Errorf("malformed length-delimited field")
+			}
+			data = buf[n : n+int(l)]
+			buf = buf[n+int(l):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+
+		if e := fn(int(tag>>3), wire, v, data); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func appendFixed32(buf []byte, v uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendProtoTag(buf []byte, field, wire int) []byte {
+	return appendUvarint(buf, uint64(field)<<3|uint64(wire))
+}
+
+func appendProtoVarint(buf []byte, field int, v uint64) []byte {
+	return appendUvarint(appendProtoTag(buf, field, wireVarint), v)
+}
+
+func appendProtoBytes(buf []byte, field int, data []byte) []byte {
+	buf = appendUvarint(appendProtoTag(buf, field, wireBytes), uint64(len(data)))
+	return append(buf, data...)
+}
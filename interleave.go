@@ -0,0 +1,113 @@
+package recordio
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// InterleaveReader yields the records of several RecordScanners, like
+// those of the shards of a dataset, as one mixed stream, which lessens
+// the bias of the order of the shards without a full shuffle.  Records
+// of the same scanner keep their order.  A scanner is read until its
+// end, and the InterleaveReader stops at the first error of one.
+type InterleaveReader struct {
+	srcs    []RecordScanner
+	weights []float64 // nil for round-robin.
+	rand    *rand.Rand
+	active  []int // the sources not yet at their end, in order.
+	next    int   // the position in active of the next source, in round-robin.
+	cur     int   // the source of the current record, or -1.
+	err     error
+}
+
+// NewInterleaveReader creates an InterleaveReader taking a record from
+// each of srcs in turn, skipping those at their end.
+func NewInterleaveReader(srcs ...RecordScanner) *InterleaveReader {
+	s := &InterleaveReader{srcs: srcs, cur: -1}
+	for i := range srcs {
+		s.active = append(s.active, i)
+	}
+	return s
+}
+
+// NewWeightedInterleaveReader creates an InterleaveReader taking each
+// record from a source picked at random among those of srcs not at
+// their end, with probabilities in proportion to weights, like the
+// sampling of datasets of tf.data.  Sources of weights <= 0 are never
+// read.  The same seed and sources give the same order.
+func NewWeightedInterleaveReader(srcs []RecordScanner, weights []float64, seed int64) *InterleaveReader {
+	if len(weights) != len(srcs) {
+		panic(fmt.Sprintf("recordio: %d weights for %d scanners", len(weights), len(srcs)))
+	}
+
+	s := &InterleaveReader{
+		srcs:    srcs,
+		weights: weights,
+		rand:    rand.New(rand.NewSource(seed)),
+		cur:     -1,
+	}
+	for i, w := range weights {
+		if w > 0 {
+			s.active = append(s.active, i)
+		}
+	}
+	return s
+}
+
+// Scan moves the cursor to the next record of the next source.
+func (s *InterleaveReader) Scan() bool {
+	s.cur = -1
+	for s.err == nil && len(s.active) > 0 {
+		k := s.pick()
+		i := s.active[k]
+		if s.srcs[i].Scan() {
+			s.cur, s.next = i, k+1
+			return true
+		}
+
+		s.err = s.srcs[i].Err()
+		s.active = append(s.active[:k], s.active[k+1:]...)
+		s.next = k
+	}
+	return false
+}
+
+// pick returns the position in s.active of the source of the next
+// record.
+func (s *InterleaveReader) pick() int {
+	if s.weights == nil {
+		if s.next >= len(s.active) {
+			s.next = 0
+		}
+		return s.next
+	}
+
+	total := 0.0
+	for _, i := range s.active {
+		total += s.weights[i]
+	}
+	r := s.rand.Float64() * total
+	for k, i := range s.active {
+		if r -= s.weights[i]; r < 0 {
+			return k
+		}
+	}
+	return len(s.active) - 1
+}
+
+// Record returns the record under the current cursor.
+func (s *InterleaveReader) Record() []byte {
+	return s.srcs[s.cur].Record()
+}
+
+// Source returns the index, in the sources of the InterleaveReader, of
+// the scanner of the record under the current cursor.
+func (s *InterleaveReader) Source() int {
+	return s.cur
+}
+
+// Err returns the first non-EOF error that was encountered by one of
+// the sources.
+func (s *InterleaveReader) Err() error {
+	return s.err
+}
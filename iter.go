@@ -0,0 +1,51 @@
+package recordio
+
+import (
+	"io"
+	"iter"
+)
+
+// All returns an iterator over the remaining records of the scanner
+// and their indexes, for use as
+//
+//	for i, record := range s.All() {
+//		...
+//	}
+//	if err := s.Err(); err != nil {
+//		...
+//	}
+//
+// The iteration stops at the first error, which is reported by Err.
+func (s *RangeScanner) All() iter.Seq2[int, []byte] {
+	return func(yield func(int, []byte) bool) {
+		for s.Scan() {
+			if !yield(s.cur, s.Record()) {
+				return
+			}
+		}
+	}
+}
+
+// Records returns an iterator over all records in r described by
+// index.  An error stops the iteration after being yielded with a nil
+// record:
+//
+//	for record, err := range recordio.Records(f, idx) {
+//		if err != nil {
+//			...
+//		}
+//	}
+func Records(r io.ReadSeeker, index *Index) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		s := NewRangeScanner(r, index, 0, -1)
+		for s.Scan() {
+			if !yield(s.Record(), nil) {
+				return
+			}
+		}
+
+		if e := s.Err(); e != nil {
+			yield(nil, e)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package kafkaio archives Kafka topics into recordio files and replays
+// recordio files into topics.
+//
+// It works through the small Consumer and Producer interfaces rather
+// than a particular client.  Those of github.com/segmentio/kafka-go
+// are adapted by converting messages:
+//
+//	type consumer struct{ r *kafka.Reader }
+//
+//	func (c consumer) FetchMessage(ctx context.Context) (kafkaio.Message, error) {
+//		m, e := c.r.FetchMessage(ctx)
+//		return kafkaio.Message{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset,
+//			Key: m.Key, Value: m.Value, Time: m.Time}, e
+//	}
+//
+//	func (c consumer) CommitMessages(ctx context.Context, msgs ...kafkaio.Message) error {
+//		...
+//	}
+//
+// A Sink stores every message as a record holding its topic, partition,
+// offset, time, key and headers as well as its value, encoded by
+// AppendMessage; Replay decodes those records back into messages.
+package kafkaio
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+const (
+	messageVersion   = 1
+	replayBatchSize  = 100
+	maxMessageFields = 1 << 20 // of headers.
+)
+
+// ErrMessage is returned when a record is not a message encoded by
+// AppendMessage.
+var ErrMessage = errors.New("kafkaio: invalid message record")
+
+// Message is a Kafka message.
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte // nil means no key.
+	Value     []byte
+	Headers   []Header
+	Time      time.Time
+}
+
+// Header is a header of a Message.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// A Consumer fetches messages of Kafka topics, and commits their
+// offsets once they are archived.
+type Consumer interface {
+	// FetchMessage returns the next message, or the error of ctx once
+	// it is done.
+	FetchMessage(ctx context.Context) (Message, error)
+	// CommitMessages commits the offsets of msgs.
+	CommitMessages(ctx context.Context, msgs ...Message) error
+}
+
+// A Producer writes messages into Kafka topics.
+type Producer interface {
+	WriteMessages(ctx context.Context, msgs ...Message) error
+}
+
+// AppendMessage appends the record of m to b:
+//
+//	version   byte // 1.
+//	uvarint(len(topic)) topic
+//	uvarint(partition)
+//	uvarint(offset)
+//	varint(time) // in Unix nanoseconds; 0 means none.
+//	uvarint(len(key)+1) key // 0 means no key.
+//	uvarint(len(headers))
+//	headers, each uvarint(len(key)) key uvarint(len(value)) value
+//	value // the rest of the record.
+func AppendMessage(b []byte, m *Message) []byte {
+	b = append(b, messageVersion)
+	b = appendBytes(b, []byte(m.Topic))
+	b = binary.AppendUvarint(b, uint64(m.Partition))
+	b = binary.AppendUvarint(b, uint64(m.Offset))
+	var t int64
+	if !m.Time.IsZero() {
+		t = m.Time.UnixNano()
+	}
+	b = binary.AppendVarint(b, t)
+
+	if m.Key == nil {
+		b = binary.AppendUvarint(b, 0)
+	} else {
+		b = binary.AppendUvarint(b, uint64(len(m.Key))+1)
+		b = append(b, m.Key...)
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(m.Headers)))
+	for _, h := range m.Headers {
+		b = appendBytes(b, []byte(h.Key))
+		b = appendBytes(b, h.Value)
+	}
+	return append(b, m.Value...)
+}
+
+// ParseMessage parses a record of AppendMessage.  The key, values and
+// headers of the message alias record.
+func ParseMessage(record []byte) (Message, error) {
+	var m Message
+	p := parser{b: record}
+	if v := p.byte(); v != messageVersion {
+		return m, fmt.Errorf("%w: version %d", ErrMessage, v)
+	}
+
+	m.Topic = string(p.bytes())
+	m.Partition = int(p.uvarint())
+	m.Offset = int64(p.uvarint())
+	if t := p.varint(); t != 0 {
+		m.Time = time.Unix(0, t)
+	}
+	if n := p.uvarint(); n > 0 {
+		m.Key = p.take(n - 1)
+	}
+
+	n := p.uvarint()
+	if n > maxMessageFields {
+		p.fail()
+	}
+	for i := uint64(0); i < n && !p.failed; i++ {
+		m.Headers = append(m.Headers, Header{Key: string(p.bytes()), Value: p.bytes()})
+	}
+
+	if p.failed {
+		return Message{}, ErrMessage
+	}
+	m.Value = p.b
+	return m, nil
+}
+
+// Replay writes the messages of s, whose records were written by a
+// Sink, into p in batches, returning their number.  The messages go to
+// topic, or to their own topics if topic is "", with their keys,
+// values, headers and times; their partitions and offsets are left to
+// p.
+func Replay(ctx context.Context, p Producer, s recordio.RecordScanner, topic string) (int, error) {
+	return produce(ctx, p, s, func(record []byte) (Message, error) {
+		m, e := ParseMessage(append([]byte(nil), record...))
+		if e != nil {
+			return m, e
+		}
+		if topic != "" {
+			m.Topic = topic
+		}
+		m.Partition, m.Offset = 0, 0
+		return m, nil
+	})
+}
+
+// Publish writes the records of s as the values of messages without
+// keys into topic, in batches, returning their number.
+func Publish(ctx context.Context, p Producer, s recordio.RecordScanner, topic string) (int, error) {
+	return produce(ctx, p, s, func(record []byte) (Message, error) {
+		return Message{Topic: topic, Value: append([]byte(nil), record...)}, nil
+	})
+}
+
+func produce(ctx context.Context, p Producer, s recordio.RecordScanner, message func([]byte) (Message, error)) (int, error) {
+	n := 0
+	batch := make([]Message, 0, replayBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if e := p.WriteMessages(ctx, batch...); e != nil {
+			return fmt.Errorf("Failed to write messages: %v", e)
+		}
+		n += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for s.Scan() {
+		m, e := message(s.Record())
+		if e != nil {
+			return n, fmt.Errorf("Failed to parse record %d: %w", n+len(batch), e)
+		}
+		if batch = append(batch, m); len(batch) == replayBatchSize {
+			if e = flush(); e != nil {
+				return n, e
+			}
+		}
+	}
+	if e := s.Err(); e != nil {
+		return n, e
+	}
+	return n, flush()
+}
+
+func appendBytes(b, v []byte) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(v))), v...)
+}
+
+// parser parses the fields of a message record, failing once one is
+// truncated.
+type parser struct {
+	b      []byte
+	failed bool
+}
+
+func (p *parser) fail() {
+	p.failed, p.b = true, nil
+}
+
+func (p *parser) byte() byte {
+	if len(p.b) == 0 {
+		p.fail()
+		return 0
+	}
+	v := p.b[0]
+	p.b = p.b[1:]
+	return v
+}
+
+func (p *parser) uvarint() uint64 {
+	v, n := binary.Uvarint(p.b)
+	if n <= 0 {
+		p.fail()
+		return 0
+	}
+	p.b = p.b[n:]
+	return v
+}
+
+func (p *parser) varint() int64 {
+	v, n := binary.Varint(p.b)
+	if n <= 0 {
+		p.fail()
+		return 0
+	}
+	p.b = p.b[n:]
+	return v
+}
+
+func (p *parser) take(n uint64) []byte {
+	if n > uint64(len(p.b)) {
+		p.fail()
+		return nil
+	}
+	v := p.b[:n:n]
+	p.b = p.b[n:]
+	return v
+}
+
+func (p *parser) bytes() []byte {
+	return p.take(p.uvarint())
+}
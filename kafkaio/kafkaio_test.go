@@ -0,0 +1,145 @@
+package kafkaio_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/kafkaio"
+)
+
+// fakeConsumer returns its messages, then cancels the consumption.
+type fakeConsumer struct {
+	messages  []kafkaio.Message
+	cancel    func()
+	committed map[string]int64 // of topic/partition.
+}
+
+func (c *fakeConsumer) FetchMessage(ctx context.Context) (kafkaio.Message, error) {
+	if len(c.messages) == 0 {
+		c.cancel()
+		return kafkaio.Message{}, ctx.Err()
+	}
+	m := c.messages[0]
+	c.messages = c.messages[1:]
+	return m, nil
+}
+
+func (c *fakeConsumer) CommitMessages(ctx context.Context, msgs ...kafkaio.Message) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for _, m := range msgs {
+		c.committed[fmt.Sprintf("%s/%d", m.Topic, m.Partition)] = m.Offset
+	}
+	return nil
+}
+
+type fakeProducer struct {
+	messages []kafkaio.Message
+	batches  int
+}
+
+func (p *fakeProducer) WriteMessages(ctx context.Context, msgs ...kafkaio.Message) error {
+	p.messages = append(p.messages, msgs...)
+	p.batches++
+	return nil
+}
+
+func message(i int) kafkaio.Message {
+	m := kafkaio.Message{
+		Topic:     "events",
+		Partition: i % 2,
+		Offset:    int64(1000 + i/2),
+		Value:     []byte(fmt.Sprintf("event %d", i)),
+		Time:      time.Unix(1700000000, int64(i)),
+	}
+	if i%3 != 0 {
+		m.Key = []byte(fmt.Sprintf("key %d", i%3))
+	}
+	if i%5 == 0 {
+		m.Headers = []kafkaio.Header{{Key: "h", Value: []byte("v")}}
+	}
+	return m
+}
+
+func TestMessage(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		m := message(i)
+		got, err := kafkaio.ParseMessage(kafkaio.AppendMessage(nil, &m))
+		if err != nil || !reflect.DeepEqual(got, m) {
+			t.Fatal("unexpected message:", got, err)
+		}
+	}
+
+	m := message(1)
+	record := kafkaio.AppendMessage(nil, &m)
+	if _, err := kafkaio.ParseMessage(record[:5]); !errors.Is(err, kafkaio.ErrMessage) {
+		t.Fatal("expected an error of a truncated message:", err)
+	}
+	if _, err := kafkaio.ParseMessage([]byte("plain record")); !errors.Is(err, kafkaio.ErrMessage) {
+		t.Fatal("expected an error of a plain record:", err)
+	}
+}
+
+func TestSinkReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &fakeConsumer{cancel: cancel, committed: make(map[string]int64)}
+	for i := 0; i < 250; i++ {
+		c.messages = append(c.messages, message(i))
+	}
+
+	prefix := filepath.Join(t.TempDir(), "archive")
+	s := kafkaio.NewSink(c, prefix, 50, -1, recordio.WithCompressor(recordio.Snappy))
+	if err := s.Run(ctx); err != context.Canceled {
+		t.Fatal("unexpected end of run:", err)
+	}
+	if c.committed["events/0"] != 1124 || c.committed["events/1"] != 1124 {
+		t.Fatal("unexpected commits:", c.committed)
+	}
+
+	shards, _ := filepath.Glob(prefix + "-*")
+	if len(shards) != 6 || filepath.Base(shards[1]) != "archive-events-0-00000000000000001050" {
+		t.Fatal("unexpected shards:", shards)
+	}
+
+	p := &fakeProducer{}
+	sc, err := recordio.NewScanner(shards...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	if n, err := kafkaio.Replay(context.Background(), p, sc, "replayed"); err != nil || n != 250 {
+		t.Fatal("unexpected replay:", n, err)
+	}
+
+	m := p.messages[0]
+	want := message(0)
+	if m.Topic != "replayed" || m.Partition != 0 || m.Offset != 0 || string(m.Value) != string(want.Value) ||
+		m.Key != nil || !m.Time.Equal(want.Time) || len(m.Headers) != 1 {
+		t.Fatal("unexpected replayed message:", m)
+	}
+
+	// Records that are not messages.
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.NoCompression)
+	for i := 0; i < 250; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	p = &fakeProducer{}
+	if _, err := kafkaio.Replay(context.Background(), p, recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), ""); !errors.Is(err, kafkaio.ErrMessage) {
+		t.Fatal("expected an error of plain records:", err)
+	}
+	n, err := kafkaio.Publish(context.Background(), p, recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), "plain")
+	if err != nil || n != 250 || p.batches != 3 || string(p.messages[249].Value) != "record 249" || p.messages[0].Topic != "plain" {
+		t.Fatal("unexpected publish:", n, err, p.batches)
+	}
+}
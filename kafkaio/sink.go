@@ -0,0 +1,129 @@
+package kafkaio
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+// Sink archives the messages of a Consumer into recordio shards, one
+// open shard per topic partition, named
+//
+//	prefix-topic-partition-offset
+//
+// after the partition and the offset of their first message, zero
+// padded to 20 digits, so that the shards of a partition sort by
+// offset.  A shard is rotated once it holds maxShardRecords messages
+// or maxShardBytes bytes of records, <= 0 meaning no limit.
+//
+// Each shard is written by recordio.CreateAtomic, and the offsets of
+// its messages are committed only after it is closed, so that messages
+// are archived at least once: after a crash, the partitions are
+// consumed again from the start of their open shards, which are
+// written again under the same names.
+type Sink struct {
+	c               Consumer
+	prefix          string
+	maxShardRecords int
+	maxShardBytes   int64
+	opts            []recordio.Option
+
+	shards map[partition]*sinkShard
+}
+
+type partition struct {
+	topic     string
+	partition int
+}
+
+// sinkShard is the open shard of a partition.
+type sinkShard struct {
+	w          *recordio.Writer
+	numRecords int
+	numBytes   int64
+	last       Message // to commit.
+}
+
+// NewSink creates a Sink.  opts are passed to recordio.CreateAtomic for
+// every shard.
+func NewSink(c Consumer, prefix string, maxShardRecords int, maxShardBytes int64, opts ...recordio.Option) *Sink {
+	return &Sink{
+		c:               c,
+		prefix:          prefix,
+		maxShardRecords: maxShardRecords,
+		maxShardBytes:   maxShardBytes,
+		opts:            opts,
+		shards:          make(map[partition]*sinkShard),
+	}
+}
+
+// Run archives messages until ctx is done, returning its error, or
+// until an error.  Either way, it closes the open shards and commits
+// their messages before returning.
+func (s *Sink) Run(ctx context.Context) error {
+	var e error
+	for e == nil {
+		var m Message
+		if m, e = s.c.FetchMessage(ctx); e != nil {
+			if ctx.Err() != nil {
+				e = ctx.Err()
+			} else {
+				e = fmt.Errorf("Failed to fetch message: %v", e)
+			}
+			break
+		}
+		e = s.write(ctx, m)
+	}
+
+	// Commit with the values of ctx, past its cancelation.
+	cctx := context.WithoutCancel(ctx)
+	for p, shard := range s.shards {
+		if ce := s.close(cctx, p, shard); ce != nil && (e == nil || e == ctx.Err()) {
+			e = ce
+		}
+	}
+	return e
+}
+
+// write writes m into the shard of its partition, rotating it if full.
+func (s *Sink) write(ctx context.Context, m Message) error {
+	p := partition{m.Topic, m.Partition}
+	shard := s.shards[p]
+	if shard == nil {
+		path := fmt.Sprintf("%s-%s-%d-%020d", s.prefix, m.Topic, m.Partition, m.Offset)
+		w, e := recordio.CreateAtomic(path, s.opts...)
+		if e != nil {
+			return fmt.Errorf("Failed to create shard: %v", e)
+		}
+		shard = &sinkShard{w: w}
+		s.shards[p] = shard
+	}
+
+	record := AppendMessage(nil, &m)
+	if _, e := shard.w.Write(record); e != nil {
+		shard.w.Abort()
+		delete(s.shards, p)
+		return fmt.Errorf("Failed to write message at offset %d of %s/%d: %v", m.Offset, m.Topic, m.Partition, e)
+	}
+	shard.numRecords++
+	shard.numBytes += int64(len(record))
+	shard.last = m
+	if (s.maxShardRecords > 0 && shard.numRecords >= s.maxShardRecords) ||
+		(s.maxShardBytes > 0 && shard.numBytes >= s.maxShardBytes) {
+		return s.close(ctx, p, shard)
+	}
+	return nil
+}
+
+// close closes the shard of p and commits its messages.
+func (s *Sink) close(ctx context.Context, p partition, shard *sinkShard) error {
+	delete(s.shards, p)
+	if e := shard.w.Close(); e != nil {
+		return fmt.Errorf("Failed to close shard: %v", e)
+	}
+	if e := s.c.CommitMessages(ctx, shard.last); e != nil {
+		return fmt.Errorf("Failed to commit messages of %s/%d: %v", p.topic, p.partition, e)
+	}
+	return nil
+}
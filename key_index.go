@@ -0,0 +1,194 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+)
+
+// ErrNoKeyIndex is returned by Reader.Lookup if the Index has no
+// KeyIndex or Bloom filters and the records are not sorted by key.
+var ErrNoKeyIndex = errors.New("recordio: no key index")
+
+// ErrKeyNotFound is returned by Reader.Lookup for a key of no record.
+var ErrKeyNotFound = errors.New("recordio: key not found")
+
+// KeyIndex maps the keys of the records written by Writer.WriteKV to
+// the indexes of the records, through the 64-bit FNV-1a hashes of the
+// keys, so that Reader.Lookup decodes a single chunk per key.  The
+// Index of a file holds its KeyIndex if the file was written with
+// WithKeyIndex, or after Index.SetKeyIndex with one of BuildKeyIndex.
+// Only the binary encoding of the Index, in the footer or saved in
+// IndexBinary, holds the KeyIndex.
+type KeyIndex struct {
+	entries []keyEntry // sorted by hash, then record.
+}
+
+type keyEntry struct {
+	hash   uint64
+	record int
+}
+
+func hashKey(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// newKeyIndex returns the KeyIndex of a copy of entries.
+func newKeyIndex(entries []keyEntry) *KeyIndex {
+	k := &KeyIndex{entries: append([]keyEntry(nil), entries...)}
+	sort.Slice(k.entries, func(i, j int) bool {
+		a, b := k.entries[i], k.entries[j]
+		return a.hash < b.hash || (a.hash == b.hash && a.record < b.record)
+	})
+	return k
+}
+
+// BuildKeyIndex scans the records of r described by index for their
+// keys, to index the keys of files written without WithKeyIndex.
+func BuildKeyIndex(r io.ReadSeeker, index *Index, opts ...ReadOption) (*KeyIndex, error) {
+	var entries []keyEntry
+	s := NewRangeScanner(r, index, -1, -1, opts...)
+	for i := 0; s.Scan(); i++ {
+		if key := s.Key(); key != nil {
+			entries = append(entries, keyEntry{hashKey(key), i})
+		}
+	}
+	if e := s.Err(); e != nil {
+		return nil, e
+	}
+	return newKeyIndex(entries), nil
+}
+
+// Len returns the number of keys in the KeyIndex.
+func (k *KeyIndex) Len() int {
+	return len(k.entries)
+}
+
+// Records returns, in file order, the indexes of the records whose
+// keys hash like key.  They are the records with key, except for the
+// rare hash collision, which Reader.Lookup rules out by comparing the
+// keys.
+func (k *KeyIndex) Records(key []byte) []int {
+	h := hashKey(key)
+	i := sort.Search(len(k.entries), func(i int) bool { return k.entries[i].hash >= h })
+
+	var records []int
+	for ; i < len(k.entries) && k.entries[i].hash == h; i++ {
+		records = append(records, k.entries[i].record)
+	}
+	return records
+}
+
+// slice returns the KeyIndex of the records in [from, to), numbered
+// from from.
+func (k *KeyIndex) slice(from, to int) *KeyIndex {
+	s := &KeyIndex{}
+	for _, e := range k.entries {
+		if e.record >= from && e.record < to {
+			s.entries = append(s.entries, keyEntry{e.hash, e.record - from})
+		}
+	}
+	return s
+}
+
+// KeyIndex returns the KeyIndex of the records, or nil if it has none.
+func (r *Index) KeyIndex() *KeyIndex {
+	return r.keys
+}
+
+// SetKeyIndex sets the KeyIndex of the records, like one built by
+// BuildKeyIndex, for Reader.Lookup and to be saved with the Index.
+func (r *Index) SetKeyIndex(k *KeyIndex) {
+	r.keys = k
+}
+
+// Lookup returns the first record with key, written by Writer.WriteKV,
+// with the KeyIndex of the Index of the Reader, by binary search if the
+// records are sorted by key, or else by decoding the chunks the Bloom
+// filters of WithBloomFilter don't rule out.  It returns
+// ErrKeyNotFound if no record has key, and ErrNoKeyIndex if the Index
+// has none of them.  Like that of Get, the returned slice must not be
+// modified.
+func (r *Reader) Lookup(key []byte) ([]byte, error) {
+	switch {
+	case r.index.keys != nil:
+		return r.lookupIndexed(key)
+	case r.index.SortedByKey():
+		return r.lookupSorted(key)
+	case r.index.blooms != nil:
+		return r.lookupFiltered(key)
+	}
+	return nil, ErrNoKeyIndex
+}
+
+// lookupIndexed is Lookup with the KeyIndex.
+func (r *Reader) lookupIndexed(key []byte) ([]byte, error) {
+	for _, i := range r.index.keys.Records(key) {
+		ci, ri := r.index.Locate(i)
+		if ci < 0 {
+			return nil, fmt.Errorf("Key index refers to record %d out of range", i)
+		}
+
+		ch, e := r.chunk(ci)
+		if e != nil {
+			return nil, e
+		}
+		if ch.keys != nil && bytes.Equal(ch.keys[ri], key) {
+			return ch.records[ri], nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// appendKeyIndex appends the entries of k to buf as
+//
+//	numEntries uvarint
+//	numEntries * {
+//		hashDelta uvarint // from the hash of the previous entry, or 0.
+//		record    uvarint
+//	}
+func appendKeyIndex(buf []byte, k *KeyIndex) []byte {
+	buf = appendUvarint(buf, uint64(len(k.entries)))
+	var prev uint64
+	for _, e := range k.entries {
+		buf = appendUvarint(buf, e.hash-prev)
+		buf = appendUvarint(buf, uint64(e.record))
+		prev = e.hash
+	}
+	return buf
+}
+
+// parseKeyIndex parses the KeyIndex of appendKeyIndex, which must fill
+// buf.
+func parseKeyIndex(buf []byte) (*KeyIndex, error) {
+	n, l := binary.Uvarint(buf)
+	if l <= 0 || n > uint64(len(buf)-l)/2 {
+		return nil, fmt.Errorf("Failed to parse key index")
+	}
+	buf = buf[l:]
+
+	k := &KeyIndex{entries: make([]keyEntry, n)}
+	var prev uint64
+	for i := range k.entries {
+		var v [2]uint64
+		for j := range v {
+			if v[j], l = binary.Uvarint(buf); l <= 0 {
+				return nil, fmt.Errorf("Failed to parse key index entry %d", i)
+			}
+			buf = buf[l:]
+		}
+		prev += v[0]
+		k.entries[i] = keyEntry{prev, int(v[1])}
+	}
+
+	if len(buf) > 0 {
+		return nil, fmt.Errorf("Key index has %d bytes after the entries", len(buf))
+	}
+	return k, nil
+}
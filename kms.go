@@ -0,0 +1,104 @@
+package recordio
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// wrappedKeyKey is the file header entry of the data key of WithKMS,
+// wrapped by the KMS.
+const wrappedKeyKey = "encryption.wrapped_key"
+
+// A KMS is an external key management service wrapping the data keys
+// of files, like the key rings of cloud providers, so that operators
+// never handle raw keys and the KMS audits every access.  It must be
+// safe for concurrent use.
+type KMS interface {
+	// EncryptDataKey returns dataKey wrapped by a key of the KMS.
+	EncryptDataKey(dataKey []byte) ([]byte, error)
+	// DecryptDataKey returns the data key wrapped by EncryptDataKey.
+	DecryptDataKey(wrapped []byte) ([]byte, error)
+}
+
+// WithKMS makes the Writer encrypt the chunks, as WithEncryption does,
+// with a random data key of the file, which NewWriter wraps with kms
+// and stores in the file header.  It overrides the key of
+// WithEncryption.  Records appended by NewAppendWriter are encrypted
+// with the data key of the file, which kms unwraps.  Readers need
+// WithReadKMS.
+func WithKMS(kms KMS) Option {
+	return func(w *Writer) {
+		w.kms = kms
+	}
+}
+
+// withWrappedKey makes NewWriter unwrap the data key of WithKMS from
+// wrapped instead of creating one, for NewAppendWriter.
+func withWrappedKey(wrapped []byte) Option {
+	return func(w *Writer) {
+		w.wrappedKey = wrapped
+	}
+}
+
+// setupKMS sets the data key of WithKMS, and returns the wrapped key
+// to store in the file header.
+func (w *Writer) setupKMS() ([]byte, error) {
+	dataKey := make([]byte, 32)
+	wrapped := w.wrappedKey
+	if wrapped != nil {
+		var e error
+		if dataKey, e = w.kms.DecryptDataKey(wrapped); e != nil {
+			return nil, fmt.Errorf("Failed to decrypt data key: %v", e)
+		}
+	} else {
+		if _, e := rand.Read(dataKey); e != nil {
+			return nil, fmt.Errorf("Failed to generate data key: %v", e)
+		}
+		var e error
+		if wrapped, e = w.kms.EncryptDataKey(dataKey); e != nil {
+			return nil, fmt.Errorf("Failed to encrypt data key: %v", e)
+		}
+	}
+
+	w.encryptionKey = dataKey
+	return wrapped, nil
+}
+
+// WithReadKMS makes readers decrypt the chunks of files of WithKMS with
+// the data key of the file, which kms unwraps once per reader.  Chunks
+// of files without a wrapped key are decrypted as without it.
+func WithReadKMS(kms KMS) ReadOption {
+	return func(o *readOptions) {
+		o.kms = &envelope{kms: kms, aeads: make(map[string]cipher.AEAD)}
+	}
+}
+
+// envelope caches the AEADs of the data keys unwrapped by a KMS.
+type envelope struct {
+	kms   KMS
+	mu    sync.Mutex
+	aeads map[string]cipher.AEAD // by wrapped key.
+}
+
+// aead returns the AEAD of the data key wrapped as wrapped.
+func (v *envelope) aead(wrapped []byte) (cipher.AEAD, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if a, ok := v.aeads[string(wrapped)]; ok {
+		return a, nil
+	}
+
+	key, e := v.kms.DecryptDataKey(wrapped)
+	if e != nil {
+		return nil, fmt.Errorf("Failed to decrypt data key: %v", e)
+	}
+	a, e := newAEAD(key)
+	if e != nil {
+		return nil, e
+	}
+	v.aeads[string(wrapped)] = a
+	return a, nil
+}
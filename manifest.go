@@ -0,0 +1,180 @@
+package recordio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Manifest lists the shard files of a dataset, with their sizes,
+// numbers of records and checksums, and the metadata of the dataset, so
+// that consumers can verify and open the dataset from a single file.
+//
+// A manifest is saved by WriteManifest as a JSON object:
+//
+//	{
+//	  "shards": [
+//	    {"path": "train-00000-of-00002", "size": 1048576, "num_records": 1000, "sha256": "…"},
+//	    …
+//	  ],
+//	  "metadata": {"source": "…"}
+//	}
+//
+// Paths are saved relative to the directory of the manifest when they
+// are under it, and resolved against it by OpenManifest.
+type Manifest struct {
+	Shards   []ShardInfo       `json:"shards"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// NewManifest creates the Manifest of the recordio files paths, in
+// order, reading each file for its number of records and its SHA-256
+// checksum.
+func NewManifest(paths []string, metadata map[string]string) (*Manifest, error) {
+	m := &Manifest{Metadata: metadata}
+	for _, path := range paths {
+		info, e := describeShard(path)
+		if e != nil {
+			return nil, e
+		}
+		m.Shards = append(m.Shards, info)
+	}
+	return m, nil
+}
+
+// describeShard returns the ShardInfo of the recordio file path,
+// including its checksum.
+func describeShard(path string) (ShardInfo, error) {
+	f, idx, _, e := openIndexedFile(path)
+	if e != nil {
+		return ShardInfo{}, e
+	}
+	defer f.Close()
+
+	if _, e = f.Seek(0, io.SeekStart); e != nil {
+		return ShardInfo{}, e
+	}
+	h := sha256.New()
+	size, e := io.Copy(h, f)
+	if e != nil {
+		return ShardInfo{}, fmt.Errorf("Failed to read %s: %v", path, e)
+	}
+
+	return ShardInfo{
+		Path:       path,
+		Size:       size,
+		NumRecords: idx.NumRecords,
+		SHA256:     hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// WriteManifest saves m as the manifest file path.
+func WriteManifest(path string, m *Manifest) error {
+	dir := filepath.Dir(path)
+	saved := *m
+	saved.Shards = make([]ShardInfo, len(m.Shards))
+	for i, info := range m.Shards {
+		if rel, e := filepath.Rel(dir, info.Path); e == nil && filepath.IsLocal(rel) {
+			info.Path = filepath.ToSlash(rel)
+		}
+		saved.Shards[i] = info
+	}
+
+	buf, e := json.MarshalIndent(&saved, "", "  ")
+	if e != nil {
+		return e
+	}
+	if e = os.WriteFile(path, append(buf, '\n'), 0644); e != nil {
+		return fmt.Errorf("Failed to write manifest: %v", e)
+	}
+	return nil
+}
+
+// OpenManifest loads the manifest file path, as saved by WriteManifest,
+// or the list of shards saved by a ShardedWriter, and checks that its
+// shards exist and have their sizes.  Call Verify to check their
+// contents too.
+func OpenManifest(path string) (*Manifest, error) {
+	buf, e := os.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+
+	m := &Manifest{}
+	if buf = bytes.TrimSpace(buf); len(buf) > 0 && buf[0] == '[' {
+		e = json.Unmarshal(buf, &m.Shards)
+	} else {
+		e = json.Unmarshal(buf, m)
+	}
+	if e != nil {
+		return nil, fmt.Errorf("Failed to parse manifest %s: %v", path, e)
+	}
+
+	dir := filepath.Dir(path)
+	for i := range m.Shards {
+		info := &m.Shards[i]
+		if p := filepath.FromSlash(info.Path); !filepath.IsAbs(p) {
+			info.Path = filepath.Join(dir, p)
+		}
+
+		fi, e := os.Stat(info.Path)
+		if e != nil {
+			return nil, fmt.Errorf("Failed to open shard %d of manifest: %v", i, e)
+		}
+		if fi.Size() != info.Size {
+			return nil, fmt.Errorf("Shard %s has %d bytes, not %d", info.Path, fi.Size(), info.Size)
+		}
+	}
+	return m, nil
+}
+
+// Verify checks that the shards of m have their numbers of records and
+// their checksums, if any, reading every shard.
+func (m *Manifest) Verify() error {
+	for _, info := range m.Shards {
+		got, e := describeShard(info.Path)
+		if e != nil {
+			return e
+		}
+		if got.Size != info.Size || got.NumRecords != info.NumRecords {
+			return fmt.Errorf("Shard %s has %d bytes and %d records, not %d and %d",
+				info.Path, got.Size, got.NumRecords, info.Size, info.NumRecords)
+		}
+		if info.SHA256 != "" && got.SHA256 != info.SHA256 {
+			return fmt.Errorf("Shard %s has checksum %s, not %s", info.Path, got.SHA256, info.SHA256)
+		}
+	}
+	return nil
+}
+
+// NumRecords returns the total number of records of the shards.
+func (m *Manifest) NumRecords() int {
+	n := 0
+	for _, info := range m.Shards {
+		n += info.NumRecords
+	}
+	return n
+}
+
+// Dataset returns the Dataset of the shards of m, in order.
+func (m *Manifest) Dataset(opts ...ReadOption) (*Dataset, error) {
+	if len(m.Shards) == 0 {
+		return nil, fmt.Errorf("Manifest has no shards")
+	}
+
+	names := make([]string, len(m.Shards))
+	for i, info := range m.Shards {
+		names[i] = info.Path
+	}
+	return &Dataset{
+		names: names,
+		open:  func(name string) (fs.File, error) { return os.Open(name) },
+		opts:  opts,
+	}, nil
+}
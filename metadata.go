@@ -0,0 +1,149 @@
+package recordio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"sort"
+	"strings"
+)
+
+// metadataPrefix prefixes the keys of the file header entries holding
+// the user metadata of WithMetadata, apart from those of the format.
+const metadataPrefix = "meta."
+
+// WithMetadata stores md, like the name of a dataset, its creation
+// time or the version of its producer, in the file header, from which
+// ReadMetadata and Index.Metadata return it.  Metadata known only after
+// writing the records is stored in the footer by SetMetadata instead.
+// It makes writes fail with WithPaddleCompat, whose files have no file
+// header.
+func WithMetadata(md map[string]string) Option {
+	return func(w *Writer) {
+		w.metadata = md
+	}
+}
+
+// SetMetadata sets the metadata of key to value in the footer index,
+// for metadata known only after writing records, like their count or
+// hash.  It overrides the metadata of WithMetadata of the same key.
+// It fails unless the Writer writes a footer index.
+func (w *Writer) SetMetadata(key, value string) error {
+	if w.Writer == nil {
+		return fmt.Errorf("Cannot set metadata since writer had been closed")
+	}
+	if !w.footerIndex {
+		return fmt.Errorf("Cannot set metadata without a footer index")
+	}
+
+	w.index.setMetadata(key, value)
+	return nil
+}
+
+// Metadata returns the user metadata of the file written by
+// WithMetadata and Writer.SetMetadata: all of it for an Index of
+// LoadIndexFromFooter or Writer.Index, but only that of the file header
+// for an Index of LoadIndex, which does not read the footer.  It is
+// kept by Index.SaveAs in every format but IndexGob.  The map must not
+// be modified.
+func (r *Index) Metadata() map[string]string {
+	return r.metadata
+}
+
+// setMetadata sets the metadata of key, copying the map, which slices
+// of r share.
+func (r *Index) setMetadata(key, value string) {
+	md := maps.Clone(r.metadata)
+	if md == nil {
+		md = make(map[string]string)
+	}
+	md[key] = value
+	r.metadata = md
+}
+
+// ReadMetadata returns the user metadata of the recordio file r, from
+// its file header and its footer index, if any, without reading the
+// chunks.
+func ReadMetadata(r io.ReadSeeker) (map[string]string, error) {
+	if _, e := r.Seek(0, io.SeekStart); e != nil {
+		return nil, e
+	}
+	fh, e := readFileHeader(r)
+	if e != nil {
+		return nil, e
+	}
+	md := fh.metadata()
+
+	idx, _, e := readFooter(r)
+	if e == ErrNoFooter {
+		return md, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	for k, v := range idx.metadata {
+		if md == nil {
+			md = make(map[string]string)
+		}
+		md[k] = v
+	}
+	return md, nil
+}
+
+// metadata returns the user metadata in the entries of h.
+func (h *fileHeader) metadata() map[string]string {
+	var md map[string]string
+	if h == nil {
+		return md
+	}
+	for k, v := range h.entries {
+		if strings.HasPrefix(k, metadataPrefix) {
+			if md == nil {
+				md = make(map[string]string)
+			}
+			md[strings.TrimPrefix(k, metadataPrefix)] = string(v)
+		}
+	}
+	return md
+}
+
+// appendMetadata appends the entries of md sorted by key, each
+//
+//	uvarint(len(key))   key
+//	uvarint(len(value)) value
+//
+// as in the payload of a file header.
+func appendMetadata(buf []byte, md map[string]string) []byte {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		buf = appendUvarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+		buf = appendUvarint(buf, uint64(len(md[k])))
+		buf = append(buf, md[k]...)
+	}
+	return buf
+}
+
+// parseMetadata parses the entries of appendMetadata.
+func parseMetadata(buf []byte) (map[string]string, error) {
+	md := make(map[string]string)
+	for len(buf) > 0 {
+		var kv [2]string
+		for i := range kv {
+			n, l := binary.Uvarint(buf)
+			if l <= 0 || n > uint64(len(buf)-l) {
+				return nil, fmt.Errorf("Failed to parse metadata entry")
+			}
+			kv[i] = string(buf[l : l+int(n)])
+			buf = buf[l+int(n):]
+		}
+		md[kv[0]] = kv[1]
+	}
+	return md, nil
+}
@@ -0,0 +1,121 @@
+package recordio
+
+import (
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+var _ TimestampedScanner = (*MultiScanner)(nil)
+
+// MultiScanner scans the records of the files of an fs.FS matching a
+// glob as one stream, in lexical order of the file names.  Each file is
+// opened, with its Index loaded, when the scanner reaches it, and
+// closed when it reaches the next one, so that at most one file is
+// open at a time.
+type MultiScanner struct {
+	fsys  fs.FS
+	names []string
+	opts  []ReadOption
+	next  int // the index in names of the next file.
+
+	file *FSFile
+	cur  *RangeScanner
+	err  error
+}
+
+// NewMultiScanner creates a MultiScanner of the files of fsys matching
+// pattern, as fs.Glob.  It fails if none matches.
+func NewMultiScanner(fsys fs.FS, pattern string, opts ...ReadOption) (*MultiScanner, error) {
+	names, e := fs.Glob(fsys, pattern)
+	if e != nil {
+		return nil, e
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No files match %s", pattern)
+	}
+	return &MultiScanner{fsys: fsys, names: names, opts: opts}, nil
+}
+
+// Scan moves the cursor forward for one record, moving to the next
+// file at the end of one.
+func (s *MultiScanner) Scan() bool {
+	for s.err == nil {
+		if s.cur != nil && s.cur.Scan() {
+			return true
+		}
+		if s.cur != nil {
+			if s.err = s.cur.Err(); s.err != nil {
+				return false
+			}
+		}
+
+		if s.err = s.closeFile(); s.err != nil || s.next >= len(s.names) {
+			return false
+		}
+
+		if s.file, s.err = OpenFSFile(s.fsys, s.names[s.next]); s.err == nil {
+			s.cur = s.file.NewRangeScanner(0, -1, s.opts...)
+		}
+		s.next++
+	}
+	return false
+}
+
+// closeFile closes the current file, if any, stopping the prefetching
+// of its scanner.
+func (s *MultiScanner) closeFile() error {
+	if s.cur != nil {
+		s.cur.Close()
+		s.cur = nil
+	}
+	if s.file == nil {
+		return nil
+	}
+
+	e := s.file.Close()
+	s.file = nil
+	return e
+}
+
+// Record returns the record under the current cursor.
+func (s *MultiScanner) Record() []byte {
+	return s.cur.Record()
+}
+
+// Name returns the name of the file of the record under the current
+// cursor.
+func (s *MultiScanner) Name() string {
+	return s.file.Name
+}
+
+// Key returns the key of the record under the current cursor, or nil
+// if it has none.
+func (s *MultiScanner) Key() []byte {
+	return s.cur.Key()
+}
+
+// Tag returns the type tag of the record under the current cursor, or
+// 0 if it has none.
+func (s *MultiScanner) Tag() uint16 {
+	return s.cur.Tag()
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, or the zero Time if it has none.
+func (s *MultiScanner) Timestamp() time.Time {
+	return s.cur.Timestamp()
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// scanner, like a file that failed to open.
+func (s *MultiScanner) Err() error {
+	return s.err
+}
+
+// Close closes the current file, for a scanner abandoned before the
+// end.  Scan closes the last file at the end.
+func (s *MultiScanner) Close() error {
+	s.next = len(s.names)
+	return s.closeFile()
+}
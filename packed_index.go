@@ -0,0 +1,187 @@
+package recordio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// A Locator maps record indexes to chunks.  It is implemented by
+// Index and PackedIndex.
+type Locator interface {
+	// NumChunks returns the total number of chunks.
+	NumChunks() int
+	// Locate returns the index of chunk that contains the given
+	// record, and the record index within the chunk, or (-1, -1)
+	// if the record is out of range.
+	Locate(recordIndex int) (int, int)
+}
+
+var (
+	_ Locator = (*Index)(nil)
+	_ Locator = (*PackedIndex)(nil)
+)
+
+// packBlock is the number of chunks PackedIndex decodes sequentially
+// after a binary search.
+const packBlock = 64
+
+// PackedIndex is a compact, read-only representation of an Index for
+// files with millions of chunks.  Chunks are delta and varint encoded
+// into a byte slice, costing a few bytes per chunk instead of the
+// dozens used by Index, and decoded on access.  Locate takes
+// O(log(NumChunks()/64) + 64) time.
+//
+// RecordOffsets are not kept.  To scan chunks, unpack the range of
+// interest with Slice.
+type PackedIndex struct {
+	numChunks  int
+	numRecords int
+	checksums  bool
+
+	// Every packBlock chunks, in order: uvarint(offset delta),
+	// uvarint(numRecords), and, if checksums, the checksum as
+	// little endian uint32.
+	data []byte
+
+	// For each block of packBlock chunks: the position of the block
+	// in data, the offset of the chunk before the block, and the
+	// number of records before the block.
+	blockPos     []int
+	blockOffsets []int64
+	blockRecords []int
+}
+
+// Pack returns the PackedIndex of the Index.
+func (r *Index) Pack() *PackedIndex {
+	p := &PackedIndex{
+		numChunks:  r.NumChunks(),
+		numRecords: r.NumRecords,
+		checksums:  r.hasChecksums(),
+	}
+
+	prev := int64(0)
+	records := 0
+	for i, offset := range r.ChunkOffsets {
+		if i%packBlock == 0 {
+			p.blockPos = append(p.blockPos, len(p.data))
+			p.blockOffsets = append(p.blockOffsets, prev)
+			p.blockRecords = append(p.blockRecords, records)
+		}
+
+		p.data = appendVarint(p.data, offset-prev)
+		p.data = appendUvarint(p.data, uint64(r.ChunkRecords[i]))
+		if p.checksums {
+			p.data = appendFixed32(p.data, r.ChunkChecksums[i])
+		}
+		prev = offset
+		records += r.ChunkRecords[i]
+	}
+
+	// Drop the spare capacity from appending.
+	p.data = append([]byte(nil), p.data...)
+	return p
+}
+
+// NumChunks returns the total number of chunks.
+func (p *PackedIndex) NumChunks() int {
+	return p.numChunks
+}
+
+// NumRecords returns the number of all records.
+func (p *PackedIndex) NumRecords() int {
+	return p.numRecords
+}
+
+// Locate returns the index of chunk that contains the given record,
+// and the record index within the chunk.  It returns (-1, -1) if the
+// record is out of range.
+func (p *PackedIndex) Locate(recordIndex int) (int, int) {
+	if recordIndex < 0 || recordIndex >= p.numRecords {
+		return -1, -1
+	}
+
+	b := sort.SearchInts(p.blockRecords, recordIndex+1) - 1
+	records := p.blockRecords[b]
+	ci := -1
+	p.decodeBlock(b, func(i int, _ int64, numRecords int, _ uint32) bool {
+		if recordIndex < records+numRecords {
+			ci = i
+			return false
+		}
+		records += numRecords
+		return true
+	})
+	return ci, recordIndex - records
+}
+
+// Chunk returns the offset, record count, and checksum (0 if unknown)
+// of the i-th chunk.
+func (p *PackedIndex) Chunk(i int) (offset int64, numRecords int, checkSum uint32) {
+	if i < 0 || i >= p.numChunks {
+		panic(fmt.Sprintf("recordio: chunk %d out of range [0, %d)", i, p.numChunks))
+	}
+
+	p.decodeBlock(i/packBlock, func(j int, o int64, n int, c uint32) bool {
+		offset, numRecords, checkSum = o, n, c
+		return j < i
+	})
+	return
+}
+
+// Slice returns the Index of the chunks in [fromChunk, toChunk), like
+// Index.Slice.
+func (p *PackedIndex) Slice(fromChunk, toChunk int) *Index {
+	if fromChunk < 0 || fromChunk > toChunk || toChunk > p.numChunks {
+		panic(fmt.Sprintf("recordio: chunk range [%d, %d) out of range [0, %d)", fromChunk, toChunk, p.numChunks))
+	}
+
+	idx := newIndex()
+	for b := fromChunk / packBlock; b*packBlock < toChunk; b++ {
+		p.decodeBlock(b, func(i int, offset int64, numRecords int, checkSum uint32) bool {
+			if i >= fromChunk && i < toChunk {
+				idx.addChunk(offset, numRecords, checkSum)
+			}
+			return i < toChunk
+		})
+	}
+
+	if !p.checksums {
+		idx.ChunkChecksums = nil
+	}
+	return idx
+}
+
+// Unpack returns the Index represented by the PackedIndex.
+func (p *PackedIndex) Unpack() *Index {
+	return p.Slice(0, p.numChunks)
+}
+
+// decodeBlock calls fn with the chunks of the b-th block in order,
+// until fn returns false.
+func (p *PackedIndex) decodeBlock(b int, fn func(i int, offset int64, numRecords int, checkSum uint32) bool) {
+	data := p.data[p.blockPos[b]:]
+	offset := p.blockOffsets[b]
+	for i := b * packBlock; i < p.numChunks && i < (b+1)*packBlock; i++ {
+		delta, n := binary.Varint(data)
+		data = data[n:]
+		numRecords, n := binary.Uvarint(data)
+		data = data[n:]
+
+		var checkSum uint32
+		if p.checksums {
+			checkSum = binary.LittleEndian.Uint32(data)
+			data = data[4:]
+		}
+
+		offset += delta
+		if !fn(i, offset, int(numRecords), checkSum) {
+			return
+		}
+	}
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], v)]...)
+}
@@ -0,0 +1,79 @@
+// Package parquetio exports the records of recordio files into Parquet
+// files, so that analytics engines like Spark or DuckDB can query data
+// stored as recordio.
+package parquetio
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+// batchSize is the number of rows handed to the Parquet writer at once.
+const batchSize = 1024
+
+// Row is the row of ExportRecords, and a ready-made row for Export
+// whose mapping only extracts the key or timestamp of records.
+type Row struct {
+	Index int64  `parquet:"index"`
+	Key   []byte `parquet:"key,optional"`
+	// Timestamp is in nanoseconds since the Unix epoch.
+	Timestamp *int64 `parquet:"timestamp,optional,timestamp(nanosecond)"`
+	Data      []byte `parquet:"data"`
+}
+
+// Export writes the records of s into the Parquet file w, as rows of
+// type T made by mapRow of each record and its index in the scan.  The
+// schema of the file is that of T, as derived by
+// parquet.SchemaOf(new(T)): define it by the struct tags of T.  It
+// returns the number of rows written.
+func Export[T any](w io.Writer, s recordio.RecordScanner, mapRow func(index int, record []byte) (T, error), opts ...parquet.WriterOption) (int, error) {
+	pw := parquet.NewGenericWriter[T](w, opts...)
+
+	n := 0
+	rows := make([]T, 0, batchSize)
+	flush := func() error {
+		if _, e := pw.Write(rows); e != nil {
+			return fmt.Errorf("Failed to write rows: %v", e)
+		}
+		rows = rows[:0]
+		return nil
+	}
+
+	for s.Scan() {
+		row, e := mapRow(n, s.Record())
+		if e != nil {
+			return n, fmt.Errorf("Failed to map record %d: %v", n, e)
+		}
+		rows = append(rows, row)
+		n++
+
+		if len(rows) == batchSize {
+			if e = flush(); e != nil {
+				return n, e
+			}
+		}
+	}
+	if e := s.Err(); e != nil {
+		return n, e
+	}
+
+	if e := flush(); e != nil {
+		return n, e
+	}
+	if e := pw.Close(); e != nil {
+		return n, fmt.Errorf("Failed to close Parquet file: %v", e)
+	}
+	return n, nil
+}
+
+// ExportRecords writes the records of s into the Parquet file w as Rows
+// of their index and data.
+func ExportRecords(w io.Writer, s recordio.RecordScanner, opts ...parquet.WriterOption) (int, error) {
+	return Export(w, s, func(index int, record []byte) (Row, error) {
+		return Row{Index: int64(index), Data: record}, nil
+	}, opts...)
+}
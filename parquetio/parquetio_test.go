@@ -0,0 +1,98 @@
+package parquetio_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/parquetio"
+)
+
+func writeRecords(t *testing.T, n int) ([]byte, *recordio.Index) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(100))
+	for i := 0; i < n; i++ {
+		w.Write([]byte(fmt.Sprintf(`{"user": "user%d", "ts": %d, "score": %d}`, i%7, 1000*i, i)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), w.Index()
+}
+
+func TestExportRecords(t *testing.T) {
+	data, idx := writeRecords(t, 3000)
+
+	var out bytes.Buffer
+	s := recordio.NewRangeScanner(bytes.NewReader(data), idx, 0, -1)
+	if n, err := parquetio.ExportRecords(&out, s); err != nil || n != 3000 {
+		t.Fatal("unexpected export:", n, err)
+	}
+
+	rows, err := parquet.Read[parquetio.Row](bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil || len(rows) != 3000 {
+		t.Fatal("unexpected rows:", len(rows), err)
+	}
+	for i, row := range rows {
+		if row.Index != int64(i) || row.Key != nil || row.Timestamp != nil ||
+			string(row.Data) != fmt.Sprintf(`{"user": "user%d", "ts": %d, "score": %d}`, i%7, 1000*i, i) {
+			t.Fatal("unexpected row:", i, row)
+		}
+	}
+}
+
+type scoreRow struct {
+	User  string `parquet:"user"`
+	Score int64  `parquet:"score"`
+}
+
+func TestExport(t *testing.T) {
+	data, idx := writeRecords(t, 100)
+
+	var out bytes.Buffer
+	s := recordio.NewRangeScanner(bytes.NewReader(data), idx, 0, -1)
+	n, err := parquetio.Export(&out, s, func(index int, record []byte) (scoreRow, error) {
+		var row scoreRow
+		err := json.Unmarshal(record, &row)
+		return row, err
+	})
+	if err != nil || n != 100 {
+		t.Fatal("unexpected export:", n, err)
+	}
+
+	rows, err := parquet.Read[scoreRow](bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil || len(rows) != 100 || rows[42].User != "user0" || rows[42].Score != 42 {
+		t.Fatal("unexpected rows:", len(rows), err)
+	}
+
+	_, err = parquetio.Export(&out, recordio.NewRangeScanner(bytes.NewReader(data), idx, 0, -1),
+		func(index int, record []byte) (parquetio.Row, error) {
+			return parquetio.Row{}, fmt.Errorf("bad record")
+		})
+	if err == nil {
+		t.Fatal("expected the error of the mapping")
+	}
+
+	// Key and timestamp are filled by the mapping.
+	out.Reset()
+	s = recordio.NewRangeScanner(bytes.NewReader(data), idx, 0, -1)
+	_, err = parquetio.Export(&out, s, func(index int, record []byte) (parquetio.Row, error) {
+		var v struct {
+			User string `json:"user"`
+			TS   int64  `json:"ts"`
+		}
+		err := json.Unmarshal(record, &v)
+		return parquetio.Row{Index: int64(index), Key: []byte(v.User), Timestamp: &v.TS, Data: record}, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := parquet.Read[parquetio.Row](bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil || string(full[3].Key) != "user3" || *full[3].Timestamp != 3000 {
+		t.Fatal("unexpected rows:", err)
+	}
+}
@@ -0,0 +1,91 @@
+package recordio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ParseMode tells scanners what to do with anomalies: oddities of a
+// file that do not keep its records from being read, but that a
+// data-quality job may want to know about.
+type ParseMode int
+
+const (
+	// IgnoreAnomalies reads past anomalies silently, the default.
+	IgnoreAnomalies ParseMode = iota
+	// CollectAnomalies reads past anomalies and collects them for
+	// the Diagnostics method of the scanner.
+	CollectAnomalies
+	// FailOnAnomalies makes the first anomaly, a *Diagnostic, the
+	// error of the scan.
+	FailOnAnomalies
+)
+
+// Anomaly is a kind of anomaly.
+type Anomaly int
+
+const (
+	// EmptyChunk is a chunk without records.
+	EmptyChunk Anomaly = iota + 1
+	// NonMonotonicOffset is a chunk whose offset in the Index is not
+	// after that of the chunk before it.
+	NonMonotonicOffset
+	// PaddingBytes are bytes after the last record in the
+	// decompressed data of a chunk.
+	PaddingBytes
+)
+
+func (a Anomaly) String() string {
+	switch a {
+	case EmptyChunk:
+		return "empty chunk"
+	case NonMonotonicOffset:
+		return "nonmonotonic chunk offset"
+	case PaddingBytes:
+		return "padding bytes"
+	}
+	return fmt.Sprintf("anomaly %d", int(a))
+}
+
+// Diagnostic reports an anomaly in the chunk at Offset.
+type Diagnostic struct {
+	Anomaly Anomaly
+	Offset  int64
+	Detail  string
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("recordio: %v in chunk at offset %d: %s", d.Anomaly, d.Offset, d.Detail)
+}
+
+// diagnostics collects the anomalies met by a scanner, whose chunks
+// may be decoded concurrently.
+type diagnostics struct {
+	mu   sync.Mutex
+	list []Diagnostic
+}
+
+// anomaly handles an anomaly according to the parse mode, returning
+// an error if it is fatal.
+func (o *readOptions) anomaly(a Anomaly, offset int64, format string, args ...interface{}) error {
+	if o.parseMode == IgnoreAnomalies {
+		return nil
+	}
+
+	d := Diagnostic{Anomaly: a, Offset: offset, Detail: fmt.Sprintf(format, args...)}
+	if o.parseMode == FailOnAnomalies {
+		return &d
+	}
+
+	o.diags.mu.Lock()
+	defer o.diags.mu.Unlock()
+	o.diags.list = append(o.diags.list, d)
+	return nil
+}
+
+// diagnostics returns the anomalies collected so far.
+func (o *readOptions) diagnostics() []Diagnostic {
+	o.diags.mu.Lock()
+	defer o.diags.mu.Unlock()
+	return append([]Diagnostic(nil), o.diags.list...)
+}
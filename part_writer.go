@@ -0,0 +1,80 @@
+package recordio
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const defaultPartSize = 8 * 1024 * 1024
+
+// A PartWriter uploads a file in parts, like an S3 multipart upload.
+type PartWriter interface {
+	// WritePart uploads the part of the given number, counting from
+	// 1.  data is only valid during the call.
+	WritePart(number int, data []byte) error
+	// Complete makes the file of the parts written so far.
+	Complete() error
+	// Abort cancels the upload, discarding the parts.
+	Abort() error
+}
+
+// NewPartWriter creates a Writer uploading the file through pw, so
+// that producers stream files to object storage without staging them
+// on disk.  Written chunks are buffered into parts of at least
+// partSize bytes, as object stores require a minimum size of all parts
+// but the last, like 5MB for S3; partSize <= 0 means 8MB.  Close
+// uploads the last part and completes the upload; a failed Close, or
+// Abort, aborts it.  The other arguments are those of NewWriter.
+func NewPartWriter(pw PartWriter, partSize, maxChunkSize, compressor int, opts ...Option) *Writer {
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+
+	p := &partBuffer{pw: pw, size: partSize}
+	w := NewWriter(p, maxChunkSize, compressor, opts...)
+	w.onClose = func(e error) error {
+		if e == nil && (p.buf.Len() > 0 || p.parts == 0) {
+			e = p.writePart()
+		}
+		if e == nil {
+			if e = pw.Complete(); e != nil {
+				e = fmt.Errorf("Failed to complete upload: %v", e)
+			}
+		}
+
+		if e != nil {
+			if ae := pw.Abort(); e == errAborted {
+				return ae
+			}
+		}
+		return e
+	}
+	return w
+}
+
+// partBuffer is an io.Writer buffering parts for a PartWriter.
+type partBuffer struct {
+	pw    PartWriter
+	size  int
+	buf   bytes.Buffer
+	parts int // written so far.
+}
+
+func (p *partBuffer) Write(data []byte) (int, error) {
+	p.buf.Write(data)
+	if p.buf.Len() >= p.size {
+		if e := p.writePart(); e != nil {
+			return 0, e
+		}
+	}
+	return len(data), nil
+}
+
+func (p *partBuffer) writePart() error {
+	p.parts++
+	if e := p.pw.WritePart(p.parts, p.buf.Bytes()); e != nil {
+		return fmt.Errorf("Failed to upload part %d: %v", p.parts, e)
+	}
+	p.buf.Reset()
+	return nil
+}
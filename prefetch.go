@@ -0,0 +1,204 @@
+package recordio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// prefetcher decodes chunks ahead of a RangeScanner in the background.
+// A reading goroutine, the only user of the reader until it exits,
+// reads the compressed chunks in order, and one or more decoding
+// goroutines decode them; the queue keeps them in order.
+type prefetcher struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []*prefetched
+	held     int // bytes in queue.
+	chunks   int // the capacity of queue.
+	maxBytes int
+	closed   bool
+	finished bool // the background goroutines have exited.
+	done     chan struct{}
+	opts     *readOptions // for releaseChunk of the dropped chunks.
+}
+
+type prefetched struct {
+	chunkIndex int
+	chunk      *Chunk
+	err        error
+	size       int  // compressed until decoded, then decoded.
+	decoded    bool // chunk or err is set.
+}
+
+// decodeJob is a compressed chunk for a decoding goroutine.
+type decodeJob struct {
+	slot   *prefetched
+	hdr    *Header
+	data   *bytes.Buffer
+	offset int64
+}
+
+// newPrefetcher starts decoding the non-empty chunks in [from, to] of
+// index.
+func newPrefetcher(r io.ReadSeeker, index *Index, from, to int, o *readOptions) *prefetcher {
+	workers := o.decodeParallelism
+	if workers < 1 {
+		workers = 1
+	}
+
+	chunks := o.prefetchChunks
+	if chunks < workers {
+		chunks = workers
+	}
+
+	p := &prefetcher{
+		chunks:   chunks,
+		maxBytes: o.prefetchBytes,
+		done:     make(chan struct{}),
+		opts:     o,
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	jobs := make(chan decodeJob, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				ch, e := decodeChunk(j.hdr, j.data, j.offset, o)
+				if e == nil {
+					o.bufs.put(j.data)
+					o.cacheChunk(j.offset, ch)
+				}
+				p.decoded(j.slot, ch, e)
+			}
+		}()
+	}
+
+	go func() {
+		defer func() {
+			close(jobs)
+			wg.Wait()
+
+			p.mu.Lock()
+			p.finished = true
+			p.cond.Broadcast()
+			p.mu.Unlock()
+			close(p.done)
+		}()
+
+		for ci := from; ci <= to; ci++ {
+			if index.ChunkRecords[ci] == 0 {
+				continue
+			}
+
+			slot := p.reserve(ci)
+			if slot == nil {
+				return
+			}
+
+			if ch := o.cachedChunk(index.ChunkOffsets[ci]); ch != nil {
+				p.decoded(slot, ch, nil)
+				continue
+			}
+
+			hdr, data, e := readRawChunk(r, index.ChunkOffsets[ci], o)
+			if e != nil {
+				p.decoded(slot, nil, e)
+				return
+			}
+
+			p.mu.Lock()
+			slot.size = data.Len()
+			p.held += slot.size
+			p.mu.Unlock()
+
+			jobs <- decodeJob{slot, hdr, data, index.ChunkOffsets[ci]}
+		}
+	}()
+	return p
+}
+
+// reserve waits for room in the queue and appends a slot for the
+// given chunk to it.  It returns nil if the prefetcher has been
+// closed.
+func (p *prefetcher) reserve(chunkIndex int) *prefetched {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !p.closed && len(p.queue) > 0 &&
+		(len(p.queue) >= p.chunks || (p.maxBytes > 0 && p.held >= p.maxBytes)) {
+		p.cond.Wait()
+	}
+
+	if p.closed {
+		return nil
+	}
+
+	slot := &prefetched{chunkIndex: chunkIndex}
+	p.queue = append(p.queue, slot)
+	return slot
+}
+
+// decoded fills the slot of a chunk.
+func (p *prefetcher) decoded(slot *prefetched, ch *Chunk, e error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	slot.chunk, slot.err, slot.decoded = ch, e, true
+	if p.closed {
+		p.opts.releaseChunk(ch)
+	} else {
+		p.held -= slot.size
+		slot.size = 0
+		if ch != nil {
+			slot.size = ch.numBytes
+		}
+		p.held += slot.size
+	}
+	p.cond.Broadcast()
+}
+
+// next returns the chunk of the given index, dropping the chunks
+// before it.
+func (p *prefetcher) next(chunkIndex int) (*Chunk, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		for (len(p.queue) == 0 && !p.finished) || (len(p.queue) > 0 && !p.queue[0].decoded) {
+			p.cond.Wait()
+		}
+
+		if len(p.queue) == 0 {
+			return nil, fmt.Errorf("Chunk %d is not prefetched", chunkIndex)
+		}
+
+		c := p.queue[0]
+		p.queue = p.queue[1:]
+		p.held -= c.size
+		p.cond.Broadcast()
+
+		if c.err != nil || c.chunkIndex == chunkIndex {
+			return c.chunk, c.err
+		}
+		p.opts.releaseChunk(c.chunk)
+	}
+}
+
+// close stops the background goroutines and waits for them to exit.
+func (p *prefetcher) close() {
+	p.mu.Lock()
+	p.closed = true
+	for _, c := range p.queue {
+		p.opts.releaseChunk(c.chunk)
+	}
+	p.queue = nil
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	<-p.done
+}
@@ -0,0 +1,156 @@
+// Package protodelim reads and writes streams of length-delimited
+// messages, each prefixed by its length as a varint, as written by
+// writeDelimitedTo of protobuf in Java or protodelim.MarshalTo in Go,
+// and converts them from and to recordio files, so that serialized
+// logs are repacked with compression and an index.  Messages are not
+// parsed, and need not be protobufs.
+package protodelim
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+// DefaultMaxSize is the default limit of the size of messages read, as
+// a corrupted length would otherwise make Scan allocate huge buffers.
+const DefaultMaxSize = 64 << 20
+
+// Reader scans the messages of a length-delimited stream.  It
+// implements recordio.RecordScanner.
+type Reader struct {
+	r       *bufio.Reader
+	maxSize uint64
+	record  []byte
+	offset  int64 // of the next message.
+	err     error
+}
+
+// NewReader creates a Reader of r, failing on messages longer than
+// maxSize bytes; <= 0 means DefaultMaxSize.
+func NewReader(r io.Reader, maxSize int) *Reader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &Reader{r: bufio.NewReader(r), maxSize: uint64(maxSize)}
+}
+
+// Scan reads the next message, returning false at the end of the
+// stream or on error.
+func (r *Reader) Scan() bool {
+	if r.err != nil {
+		return false
+	}
+
+	cr := &countingByteReader{r: r.r}
+	n, e := binary.ReadUvarint(cr)
+	if e == io.EOF && cr.n == 0 {
+		r.err = io.EOF
+		return false
+	}
+	if e != nil {
+		r.err = fmt.Errorf("Failed to read message length at %d: %v", r.offset, noEOF(e))
+		return false
+	}
+	if n > r.maxSize {
+		r.err = fmt.Errorf("Message at %d too large: %d bytes", r.offset, n)
+		return false
+	}
+
+	r.record = make([]byte, n)
+	if _, e = io.ReadFull(r.r, r.record); e != nil {
+		r.err = fmt.Errorf("Failed to read message at %d: %v", r.offset, noEOF(e))
+		return false
+	}
+	r.offset += int64(cr.n) + int64(n)
+	return true
+}
+
+// Record returns the message read by the last Scan.
+func (r *Reader) Record() []byte {
+	return r.record
+}
+
+// Err returns the first error of Scan other than the end of the
+// stream.
+func (r *Reader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// countingByteReader counts the bytes read through it.
+type countingByteReader struct {
+	r io.ByteReader
+	n int
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, e := c.r.ReadByte()
+	if e == nil {
+		c.n++
+	}
+	return b, e
+}
+
+func noEOF(e error) error {
+	if e == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return e
+}
+
+// Writer writes length-delimited messages.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter creates a Writer into w.  Messages are written through
+// unbuffered; wrap w in a bufio.Writer for small messages.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes a message.
+func (w *Writer) Write(message []byte) (int, error) {
+	buf := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(message)), uint64(len(message)))
+	if _, e := w.w.Write(append(buf, message...)); e != nil {
+		return 0, fmt.Errorf("Failed to write message: %v", e)
+	}
+	return len(message), nil
+}
+
+// ToRecordIO writes the messages of the stream r into w, a record each,
+// returning their number.  w is not closed.
+func ToRecordIO(w *recordio.Writer, r io.Reader) (int, error) {
+	return copyRecords(w, NewReader(r, -1))
+}
+
+// FromRecordIO writes the records of s, like a recordio.RangeScanner,
+// into w as a length-delimited stream, returning their number.
+func FromRecordIO(w io.Writer, s recordio.RecordScanner) (int, error) {
+	bw := bufio.NewWriter(w)
+	n, e := copyRecords(NewWriter(bw), s)
+	if e != nil {
+		return n, e
+	}
+	if e = bw.Flush(); e != nil {
+		return n, fmt.Errorf("Failed to write message: %v", e)
+	}
+	return n, nil
+}
+
+func copyRecords(w io.Writer, s recordio.RecordScanner) (int, error) {
+	n := 0
+	for s.Scan() {
+		if _, e := w.Write(s.Record()); e != nil {
+			return n, e
+		}
+		n++
+	}
+	return n, s.Err()
+}
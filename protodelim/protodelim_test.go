@@ -0,0 +1,71 @@
+package protodelim_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/protodelim"
+)
+
+func TestFormat(t *testing.T) {
+	var buf bytes.Buffer
+	w := protodelim.NewWriter(&buf)
+	w.Write([]byte("\x08\x96\x01")) // a message {1: 150}.
+	w.Write(nil)
+	w.Write([]byte(strings.Repeat("x", 300)))
+	if !bytes.HasPrefix(buf.Bytes(), []byte("\x03\x08\x96\x01\x00\xac\x02x")) || buf.Len() != 4+1+2+300 {
+		t.Fatalf("unexpected encoding: %q", buf.Bytes()[:10])
+	}
+
+	r := protodelim.NewReader(bytes.NewReader(buf.Bytes()), -1)
+	var records []string
+	for r.Scan() {
+		records = append(records, string(r.Record()))
+	}
+	if r.Err() != nil || len(records) != 3 || records[0] != "\x08\x96\x01" || records[1] != "" || len(records[2]) != 300 {
+		t.Fatal("unexpected records:", r.Err(), len(records))
+	}
+
+	// Truncated streams, and messages over the limit, fail.
+	for _, n := range []int{1, 6, buf.Len() - 1} {
+		r = protodelim.NewReader(bytes.NewReader(buf.Bytes()[:n]), -1)
+		for r.Scan() {
+		}
+		if r.Err() == nil {
+			t.Fatal("expected an error of a stream truncated at", n)
+		}
+	}
+	r = protodelim.NewReader(bytes.NewReader(buf.Bytes()), 100)
+	for r.Scan() {
+	}
+	if r.Err() == nil {
+		t.Fatal("expected an error of a message over the limit")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var stream bytes.Buffer
+	w := protodelim.NewWriter(&stream)
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("message %d", i)))
+	}
+
+	var rio bytes.Buffer
+	rw := recordio.NewWriter(&rio, -1, recordio.Zstd, recordio.WithMaxChunkRecords(100))
+	if n, err := protodelim.ToRecordIO(rw, bytes.NewReader(stream.Bytes())); err != nil || n != 1000 {
+		t.Fatal("unexpected conversion:", n, err)
+	}
+	rw.Close()
+
+	var out bytes.Buffer
+	s := recordio.NewRangeScanner(bytes.NewReader(rio.Bytes()), rw.Index(), 0, -1)
+	if n, err := protodelim.FromRecordIO(&out, s); err != nil || n != 1000 {
+		t.Fatal("unexpected conversion:", n, err)
+	}
+	if !bytes.Equal(out.Bytes(), stream.Bytes()) {
+		t.Fatal("expected the stream back")
+	}
+}
@@ -0,0 +1,217 @@
+package recordio
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	defaultRangeBlockSize   = 1024 * 1024
+	defaultRangeCacheBlocks = 16
+)
+
+// A RangeReader reads byte ranges of a remote object, like a GET of an
+// S3 or MinIO object with a Range header.  An adapter of the AWS SDK
+// looks like
+//
+//	func (o *s3Object) ReadRange(offset, length int64) (io.ReadCloser, error) {
+//		out, e := o.client.GetObject(context.TODO(), &s3.GetObjectInput{
+//			Bucket: &o.bucket,
+//			Key:    &o.key,
+//			Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+//		})
+//		if e != nil {
+//			return nil, e
+//		}
+//		return out.Body, nil
+//	}
+type RangeReader interface {
+	// ReadRange returns the length bytes of the object at offset.
+	ReadRange(offset, length int64) (io.ReadCloser, error)
+}
+
+// RangeReaderFunc adapts a function to a RangeReader.
+type RangeReaderFunc func(offset, length int64) (io.ReadCloser, error)
+
+// ReadRange calls f.
+func (f RangeReaderFunc) ReadRange(offset, length int64) (io.ReadCloser, error) {
+	return f(offset, length)
+}
+
+// RangeReaderAt is an io.ReaderAt of a remote object read by a
+// RangeReader, for the constructors taking an io.ReaderAt, like
+// NewRangeScannerAt, to read a file without downloading it whole.
+//
+// As chunks are read in many small reads, the object is fetched in
+// blocks, and the recently used blocks are cached.  A read missing
+// several adjacent blocks fetches them in one request, and concurrent
+// reads of a block being fetched wait for the same request.  It is
+// safe for concurrent use.
+type RangeReaderAt struct {
+	rr        RangeReader
+	size      int64
+	blockSize int64
+
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // of *rangeBlock, most recently used first.
+	blocks   map[int64]*list.Element
+}
+
+// rangeBlock is a cached block, being fetched until done is closed.
+type rangeBlock struct {
+	index int64
+	done  chan struct{}
+	data  []byte
+	err   error
+}
+
+// NewRangeReaderAt creates a RangeReaderAt of the object of the given
+// size read by rr.  It fetches blocks of blockSize bytes and caches up
+// to cacheBlocks of them; -1 means the defaults of 1MB and 16 blocks.
+func NewRangeReaderAt(rr RangeReader, size int64, blockSize, cacheBlocks int) *RangeReaderAt {
+	if blockSize <= 0 {
+		blockSize = defaultRangeBlockSize
+	}
+	if cacheBlocks < 0 {
+		cacheBlocks = defaultRangeCacheBlocks
+	}
+
+	return &RangeReaderAt{
+		rr:        rr,
+		size:      size,
+		blockSize: int64(blockSize),
+		capacity:  cacheBlocks,
+		order:     list.New(),
+		blocks:    make(map[int64]*list.Element),
+	}
+}
+
+// Size returns the size of the object.
+func (r *RangeReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *RangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Invalid offset: %d", off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	if end == off {
+		return 0, nil
+	}
+
+	blocks := r.acquire(off/r.blockSize, (end-1)/r.blockSize)
+
+	n := 0
+	for _, b := range blocks {
+		<-b.done
+		if b.err != nil {
+			return n, b.err
+		}
+
+		start := b.index * r.blockSize
+		from := off + int64(n) - start
+		n += copy(p[n:end-off], b.data[from:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// acquire returns the blocks [first, last], starting to fetch the
+// missing ones.
+func (r *RangeReaderAt) acquire(first, last int64) []*rangeBlock {
+	var blocks, missing []*rangeBlock
+
+	r.mu.Lock()
+	for i := first; i <= last; i++ {
+		if e, ok := r.blocks[i]; ok {
+			r.order.MoveToFront(e)
+			blocks = append(blocks, e.Value.(*rangeBlock))
+			continue
+		}
+
+		b := &rangeBlock{index: i, done: make(chan struct{})}
+		r.add(b)
+		blocks = append(blocks, b)
+		missing = append(missing, b)
+	}
+	r.mu.Unlock()
+
+	// Fetch each run of adjacent missing blocks in one request.
+	for len(missing) > 0 {
+		n := 1
+		for n < len(missing) && missing[n].index == missing[n-1].index+1 {
+			n++
+		}
+		go r.fetch(missing[:n])
+		missing = missing[n:]
+	}
+	return blocks
+}
+
+// add caches b, evicting the least recently used blocks beyond
+// capacity.  r.mu must be held.
+func (r *RangeReaderAt) add(b *rangeBlock) {
+	r.blocks[b.index] = r.order.PushFront(b)
+	for r.order.Len() > r.capacity {
+		e := r.order.Back()
+		r.order.Remove(e)
+		delete(r.blocks, e.Value.(*rangeBlock).index)
+	}
+}
+
+// fetch fetches the adjacent blocks in one request.
+func (r *RangeReaderAt) fetch(blocks []*rangeBlock) {
+	start := blocks[0].index * r.blockSize
+	end := (blocks[len(blocks)-1].index + 1) * r.blockSize
+	if end > r.size {
+		end = r.size
+	}
+
+	data := make([]byte, end-start)
+	body, e := r.rr.ReadRange(start, end-start)
+	if e == nil {
+		_, e = io.ReadFull(body, data)
+		if ce := body.Close(); e == nil {
+			e = ce
+		}
+	}
+	if e != nil {
+		e = fmt.Errorf("Failed to read range [%d, %d): %w", start, end, e)
+	}
+
+	r.mu.Lock()
+	for i, b := range blocks {
+		if e != nil {
+			b.err = e
+			// Let later reads retry.
+			if el, ok := r.blocks[b.index]; ok && el.Value == b {
+				r.order.Remove(el)
+				delete(r.blocks, b.index)
+			}
+		} else {
+			from := int64(i) * r.blockSize
+			to := from + r.blockSize
+			if to > int64(len(data)) {
+				to = int64(len(data))
+			}
+			b.data = data[from:to]
+		}
+		close(b.done)
+	}
+	r.mu.Unlock()
+}
@@ -1,79 +1,10 @@
 package recordio
 
-import "io"
-
-// Index consists offsets and sizes of the consequetive chunks in a RecordIO file.
-//
-// Index supports Gob. Every field in the Index needs to be exported
-// for the correct encoding and decoding using Gob.
-type Index struct {
-	ChunkOffsets []int64
-	ChunkLens    []uint32
-	NumRecords   int   // the number of all records in a file.
-	ChunkRecords []int // the number of records in chunks.
-}
-
-// LoadIndex scans the file and parse chunkOffsets, chunkLens, and len.
-func LoadIndex(r io.ReadSeeker) (*Index, error) {
-	offset, e := r.Seek(0, io.SeekCurrent)
-	if e != nil {
-		return nil, e
-	}
-
-	f := &Index{}
-	var hdr *Header
-
-	for {
-		hdr, e = parseHeader(r)
-		if e != nil {
-			break
-		}
-
-		f.ChunkOffsets = append(f.ChunkOffsets, offset)
-		f.ChunkLens = append(f.ChunkLens, hdr.numRecords)
-		f.ChunkRecords = append(f.ChunkRecords, int(hdr.numRecords))
-		f.NumRecords += int(hdr.numRecords)
-
-		offset, e = r.Seek(int64(hdr.compressedSize), io.SeekCurrent)
-		if e != nil {
-			break
-		}
-	}
-
-	if e == io.EOF {
-		return f, nil
-	}
-	return nil, e
-}
-
-// NumChunks returns the total number of chunks in a RecordIO file.
-func (r *Index) NumChunks() int {
-	return len(r.ChunkLens)
-}
-
-// ChunkIndex return the Index of i-th Chunk.
-func (r *Index) ChunkIndex(i int) *Index {
-	idx := &Index{}
-	idx.ChunkOffsets = []int64{r.ChunkOffsets[i]}
-	idx.ChunkLens = []uint32{r.ChunkLens[i]}
-	idx.ChunkRecords = []int{r.ChunkRecords[i]}
-	idx.NumRecords = idx.ChunkRecords[0]
-	return idx
-}
-
-// Locate returns the index of chunk that contains the given record,
-// and the record index within the chunk.  It returns (-1, -1) if the
-// record is out of range.
-func (r *Index) Locate(recordIndex int) (int, int) {
-	sum := 0
-	for i, l := range r.ChunkLens {
-		sum += int(l)
-		if recordIndex < sum {
-			return i, recordIndex - sum + int(l)
-		}
-	}
-	return -1, -1
-}
+import (
+	"fmt"
+	"io"
+	"time"
+)
 
 // RangeScanner scans records in a specified range within [0, numRecords).
 type RangeScanner struct {
@@ -81,14 +12,19 @@ type RangeScanner struct {
 	index           *Index
 	start, end, cur int
 	chunkIndex      int
+	chunkStart      int // index of the first record in chunk.
 	chunk           *Chunk
 	err             error
+
+	opts     *readOptions
+	prefetch *prefetcher // nil unless WithPrefetch or WithDecodeParallelism.
+	checked  bool        // whether checkIndex has run.
 }
 
 // NewRangeScanner creates a scanner that sequencially reads records in the
 // range [start, start+len).  If start < 0, it scans from the
 // beginning.  If len < 0, it scans till the end of file.
-func NewRangeScanner(r io.ReadSeeker, index *Index, start, len int) *RangeScanner {
+func NewRangeScanner(r io.ReadSeeker, index *Index, start, len int, opts ...ReadOption) *RangeScanner {
 	if start < 0 {
 		start = 0
 	}
@@ -96,6 +32,11 @@ func NewRangeScanner(r io.ReadSeeker, index *Index, start, len int) *RangeScanne
 		len = index.NumRecords - start
 	}
 
+	o := newReadOptions(opts)
+	if o.readAhead > 0 {
+		r = newReadAheadReader(r, o.readAhead)
+	}
+
 	return &RangeScanner{
 		reader:     r,
 		index:      index,
@@ -104,30 +45,182 @@ func NewRangeScanner(r io.ReadSeeker, index *Index, start, len int) *RangeScanne
 		cur:        start - 1, // The intial status required by Scan.
 		chunkIndex: -1,
 		chunk:      &Chunk{},
+		opts:       o,
 	}
 }
 
 // Scan moves the cursor forward for one record and loads the chunk
 // containing the record if not yet.
 func (s *RangeScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	if !s.checked {
+		s.checked = true
+		if s.err = s.checkIndex(); s.err != nil {
+			return false
+		}
+	}
+
 	s.cur++
 
 	if s.cur >= s.end {
 		s.err = io.EOF
-	} else {
-		if ci, _ := s.index.Locate(s.cur); s.chunkIndex != ci {
-			s.chunkIndex = ci
-			s.chunk, s.err = parseChunk(s.reader, s.index.ChunkOffsets[ci])
-		}
+	} else if s.chunkIndex < 0 || s.cur < s.chunkStart || s.cur-s.chunkStart >= len(s.chunk.records) {
+		ci, ri := s.index.Locate(s.cur)
+		s.chunkIndex = ci
+		s.chunkStart = s.cur - ri
+		s.opts.releaseChunk(s.chunk)
+		s.chunk, s.err = s.loadChunk(ci)
 	}
 
 	return s.err == nil
 }
 
-// Record returns the record under the current cursor.
+// checkIndex reports the anomalies of the chunks of the Index in the
+// range of the scanner.
+func (s *RangeScanner) checkIndex() error {
+	if s.opts.parseMode == IgnoreAnomalies || s.start >= s.end {
+		return nil
+	}
+
+	first, _ := s.index.Locate(s.start)
+	last, _ := s.index.Locate(s.end - 1)
+	for i := first; i <= last; i++ {
+		offset := s.index.ChunkOffsets[i]
+		if i > first && offset <= s.index.ChunkOffsets[i-1] {
+			if e := s.opts.anomaly(NonMonotonicOffset, offset, "after chunk at offset %d", s.index.ChunkOffsets[i-1]); e != nil {
+				return e
+			}
+		}
+
+		if s.index.ChunkRecords[i] == 0 {
+			if e := s.opts.anomaly(EmptyChunk, offset, "no records"); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// Diagnostics returns the anomalies met so far with CollectAnomalies.
+func (s *RangeScanner) Diagnostics() []Diagnostic {
+	return s.opts.diagnostics()
+}
+
+// loadChunk returns the i-th chunk, from the prefetcher if enabled.
+func (s *RangeScanner) loadChunk(i int) (*Chunk, error) {
+	if s.opts.prefetchChunks <= 0 && s.opts.decodeParallelism <= 1 {
+		return parseChunk(s.reader, s.index.ChunkOffsets[i], s.opts)
+	}
+
+	if s.prefetch == nil {
+		last, _ := s.index.Locate(s.end - 1)
+		s.prefetch = newPrefetcher(s.reader, s.index, i, last, s.opts)
+	}
+	return s.prefetch.next(i)
+}
+
+// Close stops the background decoding of WithPrefetch.  It is needed
+// only when a scan with WithPrefetch stops before the end of the
+// range.
+func (s *RangeScanner) Close() error {
+	if s.prefetch != nil {
+		s.prefetch.close()
+	}
+	return nil
+}
+
+// Seek moves the cursor so that the next Scan reads the record of the
+// given index, which must be within the range of the scanner or at its
+// end.  Chunks between the current and the new position are not read.
+func (s *RangeScanner) Seek(recordIndex int) error {
+	if recordIndex < s.start || recordIndex > s.end {
+		return fmt.Errorf("Record index %d out of range [%d, %d]", recordIndex, s.start, s.end)
+	}
+
+	if s.err != nil && s.err != io.EOF {
+		return s.err
+	}
+	s.err = nil
+
+	if s.prefetch != nil && s.chunk != nil &&
+		(recordIndex < s.chunkStart || recordIndex >= s.chunkStart+len(s.chunk.records)) {
+		// The prefetcher decodes chunks in order from where it
+		// started, so restart it at the new position.
+		s.prefetch.close()
+		s.prefetch = nil
+		s.chunkIndex = -1
+	}
+
+	s.cur = recordIndex - 1
+	return nil
+}
+
+// Skip moves the cursor forward so that the next Scan skips n records.
+func (s *RangeScanner) Skip(n int) error {
+	if n < 0 {
+		return fmt.Errorf("Cannot skip %d records", n)
+	}
+	return s.Seek(s.cur + 1 + n)
+}
+
+// Position describes where a record is stored.
+type Position struct {
+	Chunk         int   // the index of the chunk holding the record.
+	RecordInChunk int   // the index of the record within the chunk.
+	Record        int   // the index of the record in the file.
+	Offset        int64 // the byte offset of the chunk in the file.
+}
+
+// Position returns the position of the record under the current
+// cursor, or the zero Position if no chunk is loaded, as before the
+// first Scan.
+func (s *RangeScanner) Position() Position {
+	if s.chunkIndex < 0 {
+		return Position{}
+	}
+	return Position{
+		Chunk:         s.chunkIndex,
+		RecordInChunk: s.cur - s.chunkStart,
+		Record:        s.cur,
+		Offset:        s.index.ChunkOffsets[s.chunkIndex],
+	}
+}
+
+// Record returns the record under the current cursor, without
+// copying it: the slice points into the decoded data of its chunk,
+// which it keeps in memory.  It must not be modified, and is
+// overwritten after the scanner moves to another chunk with
+// WithReuseBuffer.  Use RecordCopy to keep the record.
 func (s *RangeScanner) Record() []byte {
-	_, ri := s.index.Locate(s.cur)
-	return s.chunk.records[ri]
+	return s.chunk.records[s.cur-s.chunkStart]
+}
+
+// RecordCopy returns a copy of the record under the current cursor,
+// which the caller owns.
+func (s *RangeScanner) RecordCopy() []byte {
+	return append([]byte{}, s.Record()...)
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, as written by Writer.WriteWithTimestamp, or the zero Time if
+// it has none.
+func (s *RangeScanner) Timestamp() time.Time {
+	return s.chunk.timestamp(s.cur - s.chunkStart)
+}
+
+// Key returns the key of the record under the current cursor, as
+// written by Writer.WriteKV, or nil if it has none.
+func (s *RangeScanner) Key() []byte {
+	return s.chunk.key(s.cur - s.chunkStart)
+}
+
+// Tag returns the type tag of the record under the current cursor, as
+// written by Writer.WriteTagged, or 0 if it has none.
+func (s *RangeScanner) Tag() uint16 {
+	return s.chunk.tag(s.cur - s.chunkStart)
 }
 
 // Err returns the first non-EOF error that was encountered by the
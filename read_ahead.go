@@ -0,0 +1,109 @@
+package recordio
+
+import (
+	"bufio"
+	"io"
+)
+
+// WithReadAhead makes sequential scanners, RangeScanner and
+// StreamScanner, read the file in reads of n bytes ahead of the
+// cursor, which are then served from memory, hiding the latency of
+// spinning disks and network filesystems behind fewer, larger reads.
+// n <= 0 disables it, the default.
+func WithReadAhead(n int) ReadOption {
+	return func(o *readOptions) {
+		o.readAhead = n
+	}
+}
+
+// readAheadReader is an io.ReadSeeker reading r in large reads.
+type readAheadReader struct {
+	r    io.ReadSeeker
+	buf  []byte // the data of r at off.
+	off  int64
+	pos  int64 // the position of the reader.
+	rpos int64 // the position of r.
+}
+
+func newReadAheadReader(r io.ReadSeeker, n int) *readAheadReader {
+	pos, _ := r.Seek(0, io.SeekCurrent)
+	return &readAheadReader{r: r, buf: make([]byte, 0, n), pos: pos, rpos: pos}
+}
+
+func (r *readAheadReader) Read(p []byte) (int, error) {
+	if r.pos < r.off || r.pos >= r.off+int64(len(r.buf)) {
+		if len(p) >= cap(r.buf) {
+			// Too large to gain from the buffer.
+			if e := r.seekR(); e != nil {
+				return 0, e
+			}
+			n, e := r.r.Read(p)
+			r.pos += int64(n)
+			r.rpos = r.pos
+			return n, e
+		}
+
+		if e := r.fill(); e != nil {
+			return 0, e
+		}
+		if len(r.buf) == 0 {
+			return 0, io.EOF
+		}
+	}
+
+	n := copy(p, r.buf[r.pos-r.off:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// fill reads the buffer at the position of the reader.
+func (r *readAheadReader) fill() error {
+	if e := r.seekR(); e != nil {
+		return e
+	}
+
+	n, e := io.ReadFull(r.r, r.buf[:cap(r.buf)])
+	r.buf, r.off = r.buf[:n], r.pos
+	r.rpos = r.pos + int64(n)
+	if e == io.EOF || e == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return e
+}
+
+// seekR moves r to the position of the reader.
+func (r *readAheadReader) seekR() error {
+	if r.rpos == r.pos {
+		return nil
+	}
+
+	if _, e := r.r.Seek(r.pos, io.SeekStart); e != nil {
+		return e
+	}
+	r.rpos = r.pos
+	return nil
+}
+
+func (r *readAheadReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		r.pos = offset
+	case io.SeekCurrent:
+		r.pos += offset
+	default:
+		pos, e := r.r.Seek(offset, whence)
+		if e != nil {
+			return 0, e
+		}
+		r.pos, r.rpos = pos, pos
+	}
+	return r.pos, nil
+}
+
+// readAheadStream returns r read in reads of n bytes if n > 0.
+func readAheadStream(r io.Reader, n int) io.Reader {
+	if n <= 0 {
+		return r
+	}
+	return bufio.NewReaderSize(r, n)
+}
@@ -0,0 +1,106 @@
+package recordio
+
+import "crypto/cipher"
+
+// A ReadOption configures how scanners and readers read chunks.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	prefetchChunks    int // 0 disables prefetching.
+	prefetchBytes     int
+	decodeParallelism int // <= 1 decodes in the prefetching goroutine.
+	maxRecordSize     int // 0 means no limit.
+	maxChunkSize      int // decompressed; 0 means no limit.
+	verify            ChecksumVerification
+	recordVerify      ChecksumVerification
+	parseMode         ParseMode
+	cache             *ChunkCache // of WithChunkCache.
+	fileID            string
+	readAhead         int         // bytes; 0 disables read-ahead.
+	aead              cipher.AEAD // of WithDecryptionKey.
+	aeadErr           error       // of an invalid key of WithDecryptionKey.
+	keys              *keyring    // of WithKeyProvider.
+	kms               *envelope   // of WithReadKMS.
+	bufs              *bufferPool // of WithReuseBuffer.
+
+	header *headerCache // of the file being read.
+	diags  *diagnostics // met by the scanner.
+}
+
+func newReadOptions(opts []ReadOption) *readOptions {
+	o := &readOptions{header: &headerCache{}, diags: &diagnostics{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithPrefetch makes a RangeScanner decode up to chunks chunks ahead
+// of the one being scanned in a background goroutine, holding at most
+// about maxBytes of decoded records; maxBytes <= 0 means no limit.  A
+// chunk larger than maxBytes is still decoded, one at a time.  It
+// helps sequential scans over gzip or other slowly decompressed
+// chunks.  Close the RangeScanner when stopping a scan early.
+func WithPrefetch(chunks, maxBytes int) ReadOption {
+	return func(o *readOptions) {
+		o.prefetchChunks = chunks
+		o.prefetchBytes = maxBytes
+	}
+}
+
+// WithDecodeParallelism makes a RangeScanner decode up to n chunks
+// ahead concurrently, in n goroutines, while still returning records
+// in order.  It implies WithPrefetch(n, 0), or raises the number of
+// chunks of WithPrefetch to n, whose byte limit bounds the memory held
+// by decoded chunks.  Close the RangeScanner when stopping a scan
+// early.
+func WithDecodeParallelism(n int) ReadOption {
+	return func(o *readOptions) {
+		o.decodeParallelism = n
+	}
+}
+
+// WithReadMaxRecordSize makes reading a record longer than n bytes
+// fail with a *RecordTooLargeError, rather than allocating whatever a
+// corrupted length field asks for.  n <= 0 means no limit.
+func WithReadMaxRecordSize(n int) ReadOption {
+	return func(o *readOptions) {
+		o.maxRecordSize = n
+	}
+}
+
+// WithMaxDecompressedChunkSize makes reading a chunk whose data
+// decompresses to more than n bytes fail with a *ChunkTooLargeError,
+// so that a corrupted or malicious chunk cannot exhaust memory.  n <= 0
+// means no limit.
+func WithMaxDecompressedChunkSize(n int) ReadOption {
+	return func(o *readOptions) {
+		o.maxChunkSize = n
+	}
+}
+
+// WithChecksumVerification sets whether to verify the checksums of
+// chunks.  Strict, the default, fails reading a chunk whose data does
+// not match its checksums; Skip trusts the storage instead.
+func WithChecksumVerification(v ChecksumVerification) ReadOption {
+	return func(o *readOptions) {
+		o.verify = v
+	}
+}
+
+// WithRecordChecksumVerification sets whether to verify the checksums
+// of records written with WithRecordChecksums, independently of
+// WithChecksumVerification.  Strict is the default.
+func WithRecordChecksumVerification(v ChecksumVerification) ReadOption {
+	return func(o *readOptions) {
+		o.recordVerify = v
+	}
+}
+
+// WithParseMode sets what to do with anomalies, like empty chunks.
+// IgnoreAnomalies is the default.
+func WithParseMode(m ParseMode) ReadOption {
+	return func(o *readOptions) {
+		o.parseMode = m
+	}
+}
@@ -0,0 +1,164 @@
+package recordio
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+const defaultCacheChunks = 8
+
+// Reader reads records by index, caching recently decoded chunks, so
+// that sampling records at random doesn't require a RangeScanner per
+// lookup.  It is safe for concurrent use.
+type Reader struct {
+	mu    sync.Mutex // guards cache, and r if ra is nil.
+	r     io.ReadSeeker
+	ra    io.ReaderAt // of NewReaderAt, read without mu.
+	index *Index
+	cache *chunkLRU
+	opts  *readOptions
+}
+
+// NewReader creates a Reader of the records in r described by index.
+// It caches up to cacheChunks decoded chunks; -1 means the default
+// and 0 disables caching.
+func NewReader(r io.ReadSeeker, index *Index, cacheChunks int, opts ...ReadOption) *Reader {
+	if cacheChunks < 0 {
+		cacheChunks = defaultCacheChunks
+	}
+
+	return &Reader{r: r, index: index, cache: newChunkLRU(cacheChunks), opts: newReadOptions(opts)}
+}
+
+// NumRecords returns the number of records readable by the Reader.
+func (r *Reader) NumRecords() int {
+	return r.index.NumRecords
+}
+
+// Get returns the i-th record.  The returned slice is shared with the
+// chunk cache and must not be modified.
+func (r *Reader) Get(i int) ([]byte, error) {
+	ci, ri := r.index.Locate(i)
+	if ci < 0 {
+		return nil, fmt.Errorf("Record index out of range: %d", i)
+	}
+
+	ch, e := r.chunk(ci)
+	if e != nil {
+		return nil, e
+	}
+	return ch.records[ri], nil
+}
+
+// MultiGet returns the records of the given indexes, in the given
+// order.  Each chunk involved is decoded at most once.
+func (r *Reader) MultiGet(indices []int) ([][]byte, error) {
+	type loc struct{ i, ci, ri int }
+	locs := make([]loc, len(indices))
+	for i, recordIndex := range indices {
+		ci, ri := r.index.Locate(recordIndex)
+		if ci < 0 {
+			return nil, fmt.Errorf("Record index out of range: %d", recordIndex)
+		}
+		locs[i] = loc{i, ci, ri}
+	}
+
+	sort.Slice(locs, func(a, b int) bool { return locs[a].ci < locs[b].ci })
+
+	records := make([][]byte, len(indices))
+	var ch *Chunk
+	ci := -1
+	for _, l := range locs {
+		if l.ci != ci {
+			var e error
+			if ch, e = r.chunk(l.ci); e != nil {
+				return nil, e
+			}
+			ci = l.ci
+		}
+		records[l.i] = ch.records[l.ri]
+	}
+	return records, nil
+}
+
+// chunk returns the i-th chunk from the cache, or parses it.
+func (r *Reader) chunk(i int) (*Chunk, error) {
+	offset := r.index.ChunkOffsets[i]
+
+	r.mu.Lock()
+	if ch := r.cache.get(offset); ch != nil {
+		r.mu.Unlock()
+		return ch, nil
+	}
+
+	var ch *Chunk
+	var e error
+	if r.ra == nil {
+		ch, e = parseChunk(r.r, offset, r.opts)
+	} else {
+		r.mu.Unlock()
+		ch, e = parseChunk(newSectionReader(r.ra), offset, r.opts)
+		r.mu.Lock()
+	}
+	defer r.mu.Unlock()
+
+	if e != nil {
+		return nil, e
+	}
+
+	r.cache.add(offset, ch)
+	return ch, nil
+}
+
+// chunkLRU caches decoded chunks by offset, evicting the least
+// recently used one beyond capacity.
+type chunkLRU struct {
+	capacity int
+	order    *list.List // of *lruEntry, most recently used first.
+	entries  map[int64]*list.Element
+}
+
+type lruEntry struct {
+	offset int64
+	chunk  *Chunk
+}
+
+func newChunkLRU(capacity int) *chunkLRU {
+	return &chunkLRU{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[int64]*list.Element),
+	}
+}
+
+func (c *chunkLRU) get(offset int64) *Chunk {
+	e, ok := c.entries[offset]
+	if !ok {
+		return nil
+	}
+
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).chunk
+}
+
+func (c *chunkLRU) add(offset int64, ch *Chunk) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	// Concurrent misses of NewReaderAt decode a chunk twice.
+	if e, ok := c.entries[offset]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[offset] = c.order.PushFront(&lruEntry{offset, ch})
+	for c.order.Len() > c.capacity {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*lruEntry).offset)
+	}
+}
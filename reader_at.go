@@ -0,0 +1,40 @@
+package recordio
+
+import (
+	"io"
+	"math"
+)
+
+// The constructors below take an io.ReaderAt, like *os.File, instead
+// of an io.ReadSeeker.  Each scanner reads through a view of its own,
+// so any number of them, in any number of goroutines, can share one
+// file without serializing on its seek position.
+
+// newSectionReader returns a view of r with its own position.
+func newSectionReader(r io.ReaderAt) io.ReadSeeker {
+	return io.NewSectionReader(r, 0, math.MaxInt64)
+}
+
+// NewRangeScannerAt is NewRangeScanner reading from r.
+func NewRangeScannerAt(r io.ReaderAt, index *Index, start, len int, opts ...ReadOption) *RangeScanner {
+	return NewRangeScanner(newSectionReader(r), index, start, len, opts...)
+}
+
+// NewReverseScannerAt is NewReverseScanner reading from r.
+func NewReverseScannerAt(r io.ReaderAt, index *Index, start, len int, opts ...ReadOption) *ReverseScanner {
+	return NewReverseScanner(newSectionReader(r), index, start, len, opts...)
+}
+
+// NewSampleScannerAt is NewSampleScanner reading from r.
+func NewSampleScannerAt(r io.ReaderAt, index *Index, fraction float64, seed int64, opts ...ReadOption) *SampleScanner {
+	return NewSampleScanner(newSectionReader(r), index, fraction, seed, opts...)
+}
+
+// NewReaderAt is NewReader reading from r.  Unlike a Reader of an
+// io.ReadSeeker, it decodes chunks for concurrent calls concurrently,
+// holding its lock only to access the cache.
+func NewReaderAt(r io.ReaderAt, index *Index, cacheChunks int, opts ...ReadOption) *Reader {
+	rd := NewReader(nil, index, cacheChunks, opts...)
+	rd.ra = r
+	return rd
+}
@@ -2,8 +2,15 @@ package recordio
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
-	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -24,6 +31,26 @@ func TestChunkHead(t *testing.T) {
 	cc, e := parseHeader(&buf)
 	assert.Nil(e)
 	assert.Equal(c, cc)
+
+	c = &Header{
+		checkSum:       0x04030201,
+		compressor:     456,
+		compressedSize: 789,
+		numRecords:     10,
+		checksumType:   CRC32C,
+		flags:          flagRawChecksum,
+		checksum:       []byte{1, 2, 3, 4},
+		rawChecksum:    []byte{5, 6, 7, 8},
+	}
+
+	buf.Reset()
+	n, e := c.write(&buf)
+	assert.Nil(e)
+	assert.Equal(int(c.size()), n)
+
+	cc, e = parseHeader(&buf)
+	assert.Nil(e)
+	assert.Equal(c, cc)
 }
 
 func TestWriteAndRead(t *testing.T) {
@@ -61,8 +88,7 @@ func TestWriteAndRead(t *testing.T) {
 	assert.Equal([]uint32{2, 1}, idx.ChunkLens)
 	assert.Equal(
 		[]int64{0,
-			int64(4 + // magic number
-				unsafe.Sizeof(Header{}) +
+			int64(headerSize + // magic number and v1 header
 				5 + // first record
 				4 + // second record
 				2*4)}, // two record legnths
@@ -88,3 +114,254 @@ func TestWriteEmptyFile(t *testing.T) {
 	assert.Nil(e)
 	assert.Equal(0, idx.NumRecords)
 }
+
+func TestLocate(t *testing.T) {
+	assert := assert.New(t)
+
+	idx := &Index{ChunkLens: []uint32{2, 0, 3, 1}}
+	for i, expected := range [][2]int{
+		{0, 0}, {0, 1}, {2, 0}, {2, 1}, {2, 2}, {3, 0}, {-1, -1},
+	} {
+		ci, ri := idx.Locate(i)
+		assert.Equal(expected, [2]int{ci, ri}, "record %d", i)
+	}
+
+	ci, ri := idx.Locate(-1)
+	assert.Equal([2]int{-1, -1}, [2]int{ci, ri})
+
+	// Concurrent first calls on an Index assembled by hand, for the
+	// race detector.
+	idx = &Index{ChunkLens: []uint32{2, 0, 3, 1}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ci, ri := idx.Locate(5)
+			assert.Equal([2]int{3, 0}, [2]int{ci, ri})
+		}()
+	}
+	wg.Wait()
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	h := &fileHeader{}
+	h.set(versionKey, appendUvarint(nil, formatVersion+1))
+	_, e := h.write(&buf)
+	assert.Nil(e)
+
+	_, e = parseFileHeader(&buf)
+	assert.ErrorIs(e, ErrUnsupportedVersion)
+
+	buf.Reset()
+	c := &Header{flags: 1 << 7, checksum: []byte{1, 2, 3, 4}}
+	_, e = c.write(&buf)
+	assert.Nil(e)
+
+	_, e = parseHeader(&buf)
+	assert.ErrorIs(e, ErrUnsupportedVersion)
+
+	idx := encodeIndex(newIndex())
+	idx[0] = 9
+	_, e = decodeIndex(idx)
+	assert.ErrorIs(e, ErrUnsupportedVersion)
+}
+
+func TestFileHeaderLength(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	_, e := newFileHeader().write(&buf)
+	assert.Nil(e)
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint32(b[4:8], math.MaxUint32)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, e = parseFileHeader(bytes.NewReader(b))
+	runtime.ReadMemStats(&after)
+	assert.NotNil(e)
+	assert.Less(after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
+
+func TestParseMode(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	ch := &Chunk{}
+	ch.add([]byte("a"))
+	hdr, data, e := ch.encode(chunkEncoding{})
+	assert.Nil(e)
+	assert.Nil(writeChunk(&buf, hdr, data))
+
+	// An empty chunk, and one with padding bytes.
+	assert.Nil(writeChunk(&buf, &Header{}, nil))
+	data = []byte{1, 0, 0, 0, 'b', 0, 0}
+	assert.Nil(writeChunk(&buf, &Header{checkSum: crc32.ChecksumIEEE(data), numRecords: 1, compressedSize: uint32(len(data))}, data))
+
+	idx, e := LoadIndex(bytes.NewReader(buf.Bytes()))
+	assert.Nil(e)
+
+	scan := func(opts ...ReadOption) (int, []Diagnostic, error) {
+		s := NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1, opts...)
+		n := 0
+		for ; s.Scan(); n++ {
+		}
+		return n, s.Diagnostics(), s.Err()
+	}
+
+	n, diags, e := scan()
+	assert.Equal(2, n)
+	assert.Empty(diags)
+	assert.Nil(e)
+
+	n, diags, e = scan(WithParseMode(CollectAnomalies))
+	assert.Equal(2, n)
+	assert.Nil(e)
+	if assert.Len(diags, 2) {
+		assert.Equal(EmptyChunk, diags[0].Anomaly)
+		assert.Equal(idx.ChunkOffsets[1], diags[0].Offset)
+		assert.Equal(PaddingBytes, diags[1].Anomaly)
+		assert.Equal(idx.ChunkOffsets[2], diags[1].Offset)
+	}
+
+	_, _, e = scan(WithParseMode(FailOnAnomalies))
+	var d *Diagnostic
+	if assert.ErrorAs(e, &d) {
+		assert.Equal(EmptyChunk, d.Anomaly)
+	}
+
+	s := NewStreamScanner(bytes.NewReader(buf.Bytes()), WithParseMode(CollectAnomalies))
+	for s.Scan() {
+	}
+	assert.Nil(s.Err())
+	assert.Len(s.Diagnostics(), 2)
+
+	idx.ChunkOffsets[2] = idx.ChunkOffsets[0]
+	_, diags, _ = scan(WithParseMode(CollectAnomalies))
+	if assert.Len(diags, 2) {
+		assert.Equal(NonMonotonicOffset, diags[1].Anomaly)
+	}
+}
+
+// readPaddle reads a file as the original PaddlePaddle recordio does,
+// which knows only version 1 chunk headers and three compressors.
+func readPaddle(data []byte) ([]string, error) {
+	var records []string
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		if binary.LittleEndian.Uint32(data[len(data)-r.Len():]) != magicNumber {
+			return nil, fmt.Errorf("Failed to parse magic number")
+		}
+
+		hdr, e := parseHeader(r)
+		if e != nil {
+			return nil, e
+		}
+		if hdr.compressor > Gzip || hdr.size() != headerSize {
+			return nil, fmt.Errorf("Unknown chunk: %+v", hdr)
+		}
+
+		data, e := readChunkData(r, hdr)
+		if e != nil {
+			return nil, e
+		}
+		if hdr.checkSum != crc32.ChecksumIEEE(data.Bytes()) {
+			return nil, fmt.Errorf("Checksum checking failed.")
+		}
+
+		ch, e := decodeChunk(hdr, data, 0, nil)
+		if e != nil {
+			return nil, e
+		}
+		for _, record := range ch.records {
+			records = append(records, string(record))
+		}
+	}
+	return records, nil
+}
+
+func TestPaddleCompat(t *testing.T) {
+	assert := assert.New(t)
+
+	var expected []string
+	for i := 0; i < 50; i++ {
+		expected = append(expected, fmt.Sprintf("paddle record %d", i))
+	}
+
+	// Files written by PaddlePaddle recordio, in chunks of 100 bytes.
+	for _, name := range []string{"none", "snappy", "gzip"} {
+		f, e := os.Open(filepath.Join("testdata", "paddle_"+name+".recordio"))
+		assert.Nil(e)
+
+		idx, e := LoadIndex(f)
+		assert.Nil(e)
+		assert.True(idx.NumChunks() > 1)
+
+		s := NewRangeScanner(f, idx, 0, -1)
+		var records []string
+		for s.Scan() {
+			records = append(records, string(s.Record()))
+		}
+		assert.Nil(s.Err())
+		assert.Equal(expected, records)
+		f.Close()
+	}
+
+	// Files written in compatibility mode are read by it, despite the
+	// options asking for newer features.
+	for _, compressor := range []int{NoCompression, Snappy, Gzip} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, 100, compressor,
+			WithPaddleCompat(true),
+			WithFooterIndex(true),
+			WithFileHeader(true),
+			WithChecksum(CRC32C),
+			WithRecordChecksums(true),
+			WithCompressionWorkers(2))
+		for _, record := range expected {
+			_, e := w.Write([]byte(record))
+			assert.Nil(e)
+		}
+		assert.Nil(w.Close())
+
+		records, e := readPaddle(buf.Bytes())
+		assert.Nil(e)
+		assert.Equal(expected, records)
+	}
+
+	w := NewWriter(&bytes.Buffer{}, -1, Zstd, WithPaddleCompat(true))
+	_, e := w.Write([]byte("Hello"))
+	assert.NotNil(e)
+
+	// The first error is kept.
+	w = NewWriter(&bytes.Buffer{}, -1, Zstd, WithPaddleCompat(true), WithMetadata(map[string]string{"k": "v"}))
+	_, e = w.Write([]byte("Hello"))
+	assert.ErrorContains(e, "Compressor")
+
+	for _, opt := range []Option{WithKeyIndex(true), WithSortedKeys(true), WithBloomFilter(10, 7), WithStats(true)} {
+		w = NewWriter(&bytes.Buffer{}, -1, Snappy, WithPaddleCompat(true), opt)
+		_, e = w.Write([]byte("Hello"))
+		assert.NotNil(e)
+	}
+}
+
+func TestParseRecordCorruptLength(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, -1, NoCompression)
+	w.Write([]byte("hello"))
+	assert.Nil(w.Close())
+
+	hdr, e := parseHeader(bytes.NewReader(buf.Bytes()))
+	assert.Nil(e)
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[hdr.size():], 0xfffffff0)
+
+	_, e = parseRecord(bytes.NewReader(data), 0, 0)
+	assert.ErrorContains(e, "exceeds chunk data")
+}
@@ -1,11 +1,30 @@
 package recordio_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/PaddlePaddle/recordio"
 )
@@ -158,3 +177,4317 @@ func TestChunkIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestFooterIndex(t *testing.T) {
+	const total = 100
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 100, -1, recordio.WithFooterIndex(true))
+	for i := 0; i < total; i++ {
+		_, err := w.Write(make([]byte, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndexFromFooter(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanned, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(idx, scanned) {
+		t.Fatal("footer index does not match:", idx, scanned)
+	}
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1)
+	i := 0
+	for s.Scan() {
+		if !reflect.DeepEqual(s.Record(), make([]byte, i)) {
+			t.Fatal("not equal:", len(s.Record()), len(make([]byte, i)))
+		}
+		i++
+	}
+
+	if i != total {
+		t.Fatal("total count not match:", i, total)
+	}
+}
+
+func TestLoadIndexFromFooterWithoutFooter(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, -1)
+	w.Write([]byte("Hello"))
+	w.Close()
+
+	_, err := recordio.LoadIndexFromFooter(bytes.NewReader(buf.Bytes()))
+	if err != recordio.ErrNoFooter {
+		t.Fatal("expecting ErrNoFooter, got:", err)
+	}
+}
+
+func TestIndexSaveAndLoad(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 10, -1)
+	for i := 0; i < 100; i++ {
+		w.Write(make([]byte, i%17))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []recordio.IndexFormat{recordio.IndexBinary, recordio.IndexGob, recordio.IndexJSON} {
+		var f bytes.Buffer
+		if err := idx.SaveAs(&f, format); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := recordio.LoadIndexFile(&f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(idx, loaded) {
+			t.Fatal("loaded index does not match:", format, idx, loaded)
+		}
+	}
+
+	// Record offsets are kept by the formats other than IndexBinary.
+	if err := idx.LoadRecordOffsets(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []recordio.IndexFormat{recordio.IndexGob, recordio.IndexJSON, recordio.IndexProto} {
+		var f bytes.Buffer
+		if err := idx.SaveAs(&f, format); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := recordio.LoadIndexFileAs(&f, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(idx, loaded) {
+			t.Fatal("loaded index does not match:", format, idx, loaded)
+		}
+	}
+}
+
+func TestLoadIndexAt(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 10000, recordio.NoCompression)
+	for i := 0; i < 5000; i++ {
+		// Records holding the chunk magic number must not
+		// confuse the probing goroutines.
+		r := bytes.Repeat([]byte{4, 3, 2, 1, byte(i), byte(i >> 8), 0, 0}, 128)
+		w.Write(r[:i%1024])
+	}
+	w.Close()
+
+	expected, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []int{1, 4, 16} {
+		r := bytes.NewReader(buf.Bytes())
+		idx, err := recordio.LoadIndexAt(r, int64(buf.Len()), concurrency)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(idx, expected) {
+			t.Fatal("index does not match with concurrency", concurrency)
+		}
+	}
+
+	// The metadata of the file header is kept, as by LoadIndex.
+	buf.Reset()
+	w = recordio.NewWriter(&buf, -1, -1, recordio.WithMetadata(map[string]string{"name": "test"}))
+	w.Write([]byte("record"))
+	w.Close()
+	idx, err := recordio.LoadIndexAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 4)
+	if err != nil || idx.Metadata()["name"] != "test" {
+		t.Fatal("unexpected metadata:", err)
+	}
+}
+
+func TestMergeIndexes(t *testing.T) {
+	var shards []*recordio.Index
+	var bufs [][]byte
+	for s := 0; s < 3; s++ {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, 10, -1)
+		for i := 0; i < 10*(s+1); i++ {
+			w.Write([]byte(fmt.Sprintf("%d-%d", s, i)))
+		}
+		w.Close()
+
+		idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, idx)
+		bufs = append(bufs, buf.Bytes())
+	}
+
+	m := recordio.MergeIndexes(shards...)
+	if m.NumShards() != 3 || m.NumRecords != 60 {
+		t.Fatal("unexpected merged index:", m.NumShards(), m.NumRecords)
+	}
+
+	global := 0
+	for s := 0; s < 3; s++ {
+		if !reflect.DeepEqual(m.ShardIndex(s), shards[s]) {
+			t.Fatal("shard index does not match:", s)
+		}
+
+		for i := 0; i < 10*(s+1); i++ {
+			shard, ri := m.LocateShard(global)
+			if shard != s || ri != i {
+				t.Fatal("unexpected location of record", global, shard, ri)
+			}
+
+			ci, _ := m.Locate(global)
+			if m.Shard(ci) != s {
+				t.Fatal("unexpected shard of chunk", ci, m.Shard(ci))
+			}
+			global++
+		}
+	}
+
+	if shard, ri := m.LocateShard(global); shard != -1 || ri != -1 {
+		t.Fatal("expecting out of range:", shard, ri)
+	}
+}
+
+func TestReadRecord(t *testing.T) {
+	for _, compressor := range []int{recordio.NoCompression, recordio.Snappy, recordio.Gzip} {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, 100, compressor)
+		for i := 0; i < 100; i++ {
+			w.Write([]byte(fmt.Sprintf("record-%d", i)))
+		}
+		w.Close()
+
+		r := bytes.NewReader(buf.Bytes())
+		idx, err := recordio.LoadIndex(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, withOffsets := range []bool{false, true} {
+			if withOffsets {
+				if err := idx.LoadRecordOffsets(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, i := range []int{0, 1, 13, 50, 99} {
+				rec, err := recordio.ReadRecord(r, idx, i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(rec) != fmt.Sprintf("record-%d", i) {
+					t.Fatal("unexpected record:", string(rec), i)
+				}
+			}
+
+			if _, err := recordio.ReadRecord(r, idx, 100); err == nil {
+				t.Fatal("expecting error for out of range record")
+			}
+		}
+	}
+}
+
+func TestIndexValidate(t *testing.T) {
+	write := func(prefix string, footer bool) []byte {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, 10, -1, recordio.WithFooterIndex(footer))
+		for i := 0; i < 10; i++ {
+			w.Write([]byte(fmt.Sprintf("%s-%d", prefix, i)))
+		}
+		w.Close()
+		return buf.Bytes()
+	}
+
+	for _, footer := range []bool{false, true} {
+		data := write("a", footer)
+		idx, err := recordio.LoadIndex(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := idx.Validate(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The same layout with different contents.
+		err = idx.Validate(bytes.NewReader(write("b", footer)))
+		if _, ok := err.(*recordio.IndexMismatchError); !ok {
+			t.Fatal("expecting IndexMismatchError, got:", err)
+		}
+
+		partial := idx.ChunkIndex(0)
+		err = partial.Validate(bytes.NewReader(data))
+		if _, ok := err.(*recordio.IndexMismatchError); !ok {
+			t.Fatal("expecting IndexMismatchError, got:", err)
+		}
+	}
+}
+
+func TestIndexSlice(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 10, -1)
+	for i := 0; i < 30; i++ {
+		w.Write([]byte(fmt.Sprintf("%02d-", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three records per chunk.
+	sub := idx.Slice(2, 5)
+	if sub.NumChunks() != 3 || sub.NumRecords != 9 {
+		t.Fatal("unexpected slice:", sub.NumChunks(), sub.NumRecords)
+	}
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), sub, -1, -1)
+	i := 6
+	for s.Scan() {
+		if string(s.Record()) != fmt.Sprintf("%02d-", i) {
+			t.Fatal("unexpected record:", string(s.Record()), i)
+		}
+		i++
+	}
+
+	if i != 15 {
+		t.Fatal("unexpected end of slice:", i)
+	}
+
+	if empty := idx.Slice(3, 3); empty.NumRecords != 0 || empty.NumChunks() != 0 {
+		t.Fatal("expecting empty slice")
+	}
+}
+
+func TestPackedIndex(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 20, -1)
+	for i := 0; i < 1000; i++ {
+		w.Write(make([]byte, i%31))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := idx.Pack()
+	if p.NumChunks() != idx.NumChunks() || p.NumRecords() != idx.NumRecords {
+		t.Fatal("unexpected packed index size:", p.NumChunks(), p.NumRecords())
+	}
+
+	var l recordio.Locator = p
+	for i := -1; i <= idx.NumRecords; i++ {
+		ci, ri := l.Locate(i)
+		eci, eri := idx.Locate(i)
+		if ci != eci || ri != eri {
+			t.Fatal("unexpected location of record", i, ci, ri, eci, eri)
+		}
+	}
+
+	if !reflect.DeepEqual(p.Unpack(), idx) {
+		t.Fatal("unpacked index does not match")
+	}
+
+	if !reflect.DeepEqual(p.Slice(60, 130), idx.Slice(60, 130)) {
+		t.Fatal("sliced index does not match")
+	}
+
+	offset, numRecords, _ := p.Chunk(100)
+	if offset != idx.ChunkOffsets[100] || numRecords != idx.ChunkRecords[100] {
+		t.Fatal("unexpected chunk:", offset, numRecords)
+	}
+}
+
+func TestReaderGet(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 30, -1)
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cacheChunks := range []int{-1, 0, 1} {
+		r := recordio.NewReader(bytes.NewReader(buf.Bytes()), idx, cacheChunks)
+		for _, i := range []int{99, 0, 1, 50, 51, 0} {
+			rec, err := r.Get(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rec) != fmt.Sprintf("record-%d", i) {
+				t.Fatal("unexpected record:", string(rec), i)
+			}
+		}
+
+		indices := []int{42, 3, 97, 4, 42}
+		records, err := r.MultiGet(indices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, i := range indices {
+			if string(records[j]) != fmt.Sprintf("record-%d", i) {
+				t.Fatal("unexpected record:", string(records[j]), i)
+			}
+		}
+
+		if _, err := r.Get(100); err == nil {
+			t.Fatal("expecting error for out of range record")
+		}
+	}
+}
+
+func TestReverseScanner(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 30, -1)
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct{ start, len, first, last int }{
+		{-1, -1, 99, 0},
+		{90, -1, 99, 90},
+		{10, 20, 29, 10},
+	} {
+		s := recordio.NewReverseScanner(bytes.NewReader(buf.Bytes()), idx, c.start, c.len)
+		i := c.first
+		for s.Scan() {
+			if string(s.Record()) != fmt.Sprintf("record-%d", i) {
+				t.Fatal("unexpected record:", string(s.Record()), i)
+			}
+			i--
+		}
+
+		if s.Err() != nil {
+			t.Fatal(s.Err())
+		}
+		if i != c.last-1 {
+			t.Fatal("unexpected end of scan:", i, c)
+		}
+	}
+}
+
+func TestRangeScannerPrefetch(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 100, recordio.Gzip)
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, maxBytes := range []int{0, 1, 1000} {
+		s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, 5, 990,
+			recordio.WithPrefetch(4, maxBytes))
+		i := 5
+		for s.Scan() {
+			if string(s.Record()) != fmt.Sprintf("record-%d", i) {
+				t.Fatal("unexpected record:", string(s.Record()), i)
+			}
+			i++
+		}
+
+		if s.Err() != nil || i != 995 {
+			t.Fatal("unexpected end of scan:", i, s.Err())
+		}
+		s.Close()
+	}
+
+	// Stop early.
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1,
+		recordio.WithPrefetch(4, 0))
+	s.Scan()
+	s.Close()
+}
+
+func TestIterators(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 30, -1)
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, 10, 50)
+	n := 0
+	for i, record := range s.All() {
+		if string(record) != fmt.Sprintf("record-%d", i) {
+			t.Fatal("unexpected record:", string(record), i)
+		}
+		n++
+	}
+	if n != 50 || s.Err() != nil {
+		t.Fatal("unexpected end of scan:", n, s.Err())
+	}
+
+	n = 0
+	for record, err := range recordio.Records(bytes.NewReader(buf.Bytes()), idx) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(record) != fmt.Sprintf("record-%d", n) {
+			t.Fatal("unexpected record:", string(record), n)
+		}
+		n++
+		if n == 20 {
+			break
+		}
+	}
+	if n != 20 {
+		t.Fatal("unexpected end of iteration:", n)
+	}
+}
+
+func TestRangeScannerSeek(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 30, -1)
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]recordio.ReadOption{nil, {recordio.WithPrefetch(2, 0)}} {
+		s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, 10, 80, opts...)
+		expect := func(i int) {
+			if !s.Scan() {
+				t.Fatal("unexpected end of scan:", s.Err())
+			}
+			if string(s.Record()) != fmt.Sprintf("record-%d", i) {
+				t.Fatal("unexpected record:", string(s.Record()), i)
+			}
+		}
+
+		expect(10)
+		if err := s.Seek(75); err != nil {
+			t.Fatal(err)
+		}
+		expect(75)
+		if err := s.Skip(3); err != nil {
+			t.Fatal(err)
+		}
+		expect(79)
+		if err := s.Seek(11); err != nil {
+			t.Fatal(err)
+		}
+		expect(11)
+		expect(12)
+
+		if err := s.Seek(90); err != nil {
+			t.Fatal(err)
+		}
+		if s.Scan() {
+			t.Fatal("expecting end of scan")
+		}
+		if err := s.Seek(9); err == nil {
+			t.Fatal("expecting error seeking out of range")
+		}
+		if err := s.Seek(89); err != nil {
+			t.Fatal(err)
+		}
+		expect(89)
+		s.Close()
+	}
+}
+
+func TestStreamScanner(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 30, -1, recordio.WithFooterIndex(true))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	w.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		// Feed the pipe in small pieces.
+		data := buf.Bytes()
+		for len(data) > 0 {
+			n := 7
+			if n > len(data) {
+				n = len(data)
+			}
+			pw.Write(data[:n])
+			data = data[n:]
+		}
+		pw.Close()
+	}()
+
+	s := recordio.NewStreamScanner(pr)
+	i := 0
+	for s.Scan() {
+		if string(s.Record()) != fmt.Sprintf("record-%d", i) {
+			t.Fatal("unexpected record:", string(s.Record()), i)
+		}
+		i++
+	}
+
+	if s.Err() != nil || i != 100 {
+		t.Fatal("unexpected end of scan:", i, s.Err())
+	}
+}
+
+func TestRangeScannerPosition(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 30, -1)
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	s := recordio.NewRangeScanner(r, idx, 5, -1)
+	if p := s.Position(); p != (recordio.Position{}) {
+		t.Fatal("unexpected position before Scan:", p)
+	}
+	for s.Scan() {
+		p := s.Position()
+		ci, ri := idx.Locate(p.Record)
+		if p.Chunk != ci || p.RecordInChunk != ri || p.Offset != idx.ChunkOffsets[ci] {
+			t.Fatal("unexpected position:", p, ci, ri)
+		}
+
+		rec, err := recordio.ReadRecord(r, idx.ChunkIndex(p.Chunk), p.RecordInChunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rec, s.Record()) {
+			t.Fatal("unexpected record at position:", p)
+		}
+	}
+}
+
+func TestSampleScanner(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 100, -1)
+	for i := 0; i < 10000; i++ {
+		w.Write([]byte(fmt.Sprintf("record-%d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sample := func(fraction float64, seed int64) []int {
+		var selected []int
+		s := recordio.NewSampleScanner(bytes.NewReader(buf.Bytes()), idx, fraction, seed)
+		for s.Scan() {
+			i := s.RecordIndex()
+			if string(s.Record()) != fmt.Sprintf("record-%d", i) {
+				t.Fatal("unexpected record:", string(s.Record()), i)
+			}
+			selected = append(selected, i)
+		}
+		if s.Err() != nil {
+			t.Fatal(s.Err())
+		}
+		return selected
+	}
+
+	a := sample(0.1, 42)
+	if len(a) < 800 || len(a) > 1200 {
+		t.Fatal("unexpected sample size:", len(a))
+	}
+	if !reflect.DeepEqual(a, sample(0.1, 42)) {
+		t.Fatal("sample is not reproducible")
+	}
+	if reflect.DeepEqual(a, sample(0.1, 43)) {
+		t.Fatal("sample does not depend on seed")
+	}
+	if len(sample(0, 42)) != 0 || len(sample(1, 42)) != 10000 {
+		t.Fatal("unexpected sample size of fraction 0 or 1")
+	}
+}
+
+func TestShuffleReader(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 100, -1)
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("%d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shuffle := func(maxRecords, maxBytes int, seed int64) []string {
+		s := recordio.NewShuffleReader(
+			recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1),
+			maxRecords, maxBytes, seed)
+		var records []string
+		for s.Scan() {
+			records = append(records, string(s.Record()))
+		}
+		if s.Err() != nil {
+			t.Fatal(s.Err())
+		}
+		return records
+	}
+
+	a := shuffle(100, 0, 1)
+	if len(a) != 1000 {
+		t.Fatal("unexpected number of records:", len(a))
+	}
+
+	seen := make(map[string]bool)
+	inOrder := true
+	for i, r := range a {
+		seen[r] = true
+		inOrder = inOrder && r == fmt.Sprintf("%d", i)
+	}
+	if len(seen) != 1000 || inOrder {
+		t.Fatal("records are not shuffled")
+	}
+
+	if !reflect.DeepEqual(a, shuffle(100, 0, 1)) {
+		t.Fatal("shuffle is not reproducible")
+	}
+	if len(shuffle(0, 50, 1)) != 1000 {
+		t.Fatal("unexpected number of records")
+	}
+}
+
+func TestWriterChunkLimits(t *testing.T) {
+	for _, c := range []struct {
+		opts      []recordio.Option
+		numChunks int
+	}{
+		{nil, 1},
+		{[]recordio.Option{recordio.WithMaxChunkRecords(10)}, 10},
+		{[]recordio.Option{recordio.WithMaxChunkBytes(100)}, 20},
+		{[]recordio.Option{recordio.WithMaxChunkBytes(100), recordio.WithMaxChunkRecords(3)}, 34},
+	} {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, -1, -1, c.opts...)
+		for i := 0; i < 100; i++ {
+			w.Write(make([]byte, 20))
+		}
+		w.Close()
+
+		idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx.NumChunks() != c.numChunks || idx.NumRecords != 100 {
+			t.Fatal("unexpected chunks:", idx.NumChunks(), c.numChunks)
+		}
+	}
+}
+
+// memFile is an in-memory io.ReadWriteSeeker.
+type memFile struct {
+	data []byte
+	pos  int64
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.pos >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[f.pos:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if end := f.pos + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	n := copy(f.data[f.pos:], p)
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func TestAppendWriter(t *testing.T) {
+	for _, footer := range []bool{false, true} {
+		f := &memFile{}
+		w := recordio.NewWriter(f, 30, -1, recordio.WithFooterIndex(footer))
+		for i := 0; i < 10; i++ {
+			w.Write([]byte(fmt.Sprintf("record-%d", i)))
+		}
+		w.Close()
+
+		for round := 1; round <= 2; round++ {
+			w, err := recordio.NewAppendWriter(f, 30, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 10 * round; i < 10*(round+1); i++ {
+				w.Write([]byte(fmt.Sprintf("record-%d", i)))
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r := bytes.NewReader(f.data)
+		idx, err := recordio.LoadIndexFromFooter(r)
+		if footer != (err == nil) {
+			t.Fatal("unexpected footer error:", err)
+		}
+		if !footer {
+			r.Seek(0, io.SeekStart)
+			if idx, err = recordio.LoadIndex(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := idx.Validate(r); err != nil {
+			t.Fatal(err)
+		}
+
+		s := recordio.NewRangeScanner(r, idx, -1, -1)
+		i := 0
+		for s.Scan() {
+			if string(s.Record()) != fmt.Sprintf("record-%d", i) {
+				t.Fatal("unexpected record:", string(s.Record()), i)
+			}
+			i++
+		}
+		if i != 30 {
+			t.Fatal("unexpected number of records:", i)
+		}
+	}
+
+	// Refuse to append to a truncated file.
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, -1)
+	w.Write([]byte("Hello"))
+	w.Close()
+	if _, err := recordio.NewAppendWriter(&memFile{data: buf.Bytes()[:buf.Len()-1]}, -1, -1); err == nil {
+		t.Fatal("expecting error appending to a truncated file")
+	}
+}
+
+// syncBuffer counts calls to Sync.
+type syncBuffer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (b *syncBuffer) Sync() error {
+	b.syncs++
+	return nil
+}
+
+func TestWriterFlushAndSync(t *testing.T) {
+	var buf syncBuffer
+	w := recordio.NewWriter(&buf, -1, -1, recordio.WithSync(true))
+	w.Write([]byte("Hello"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flushed record is readable before Close.
+	s := recordio.NewStreamScanner(bytes.NewReader(buf.Bytes()))
+	if !s.Scan() || string(s.Record()) != "Hello" {
+		t.Fatal("flushed record not readable:", s.Err())
+	}
+	if buf.syncs != 1 {
+		t.Fatal("unexpected number of syncs:", buf.syncs)
+	}
+
+	// Flushing an empty chunk writes nothing.
+	n := buf.Len()
+	w.Flush()
+	if buf.Len() != n {
+		t.Fatal("empty flush wrote data")
+	}
+
+	w.Write([]byte("World!"))
+	w.Close()
+	if buf.syncs != 2 {
+		t.Fatal("unexpected number of syncs:", buf.syncs)
+	}
+	if err := w.Flush(); err == nil {
+		t.Fatal("expecting error flushing a closed writer")
+	}
+}
+
+func TestWriterCompressionWorkers(t *testing.T) {
+	write := func(opts ...recordio.Option) []byte {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, 1000, recordio.Gzip, opts...)
+		for i := 0; i < 10000; i++ {
+			w.Write([]byte(fmt.Sprintf("record-%d", i)))
+			if i == 5000 {
+				w.Flush()
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	expected := write()
+	for _, n := range []int{2, 8} {
+		if !bytes.Equal(write(recordio.WithCompressionWorkers(n)), expected) {
+			t.Fatal("unexpected output with compression workers:", n)
+		}
+	}
+}
+
+func TestWriterIndex(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 10, -1, recordio.WithCompressionWorkers(2))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("%02d", i)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w.Index(), idx) {
+		t.Fatal("writer index differs from the loaded index")
+	}
+}
+
+func TestShardedWriter(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "train")
+	w := recordio.NewShardedWriter(prefix, 200, 100, recordio.NoCompression)
+	for i := 0; i < 100; i++ {
+		if _, err := w.Write([]byte(fmt.Sprintf("record-%02d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	shards := w.Shards()
+	if len(shards) < 2 {
+		t.Fatal("expected several shards, got", len(shards))
+	}
+
+	var paths []string
+	total := 0
+	for i, shard := range shards {
+		if expected := fmt.Sprintf("%s-%05d-of-%05d", prefix, i, len(shards)); shard.Path != expected {
+			t.Fatal("unexpected shard path:", shard.Path)
+		}
+		paths = append(paths, shard.Path)
+		total += shard.NumRecords
+	}
+	if total != 100 {
+		t.Fatal("unexpected number of records:", total)
+	}
+
+	buf, err := os.ReadFile(prefix + ".manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest []recordio.ShardInfo
+	if err := json.Unmarshal(buf, &manifest); err != nil || !reflect.DeepEqual(manifest, shards) {
+		t.Fatal("unexpected manifest:", string(buf), err)
+	}
+
+	s, err := recordio.NewScanner(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; s.Scan(); i++ {
+		if string(s.Record()) != fmt.Sprintf("record-%02d", i) {
+			t.Fatal("unexpected record:", string(s.Record()))
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterWriteFrom(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 100000)
+	check := func(data []byte) {
+		idx, err := recordio.LoadIndex(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := recordio.NewRangeScanner(bytes.NewReader(data), idx, -1, -1)
+		var records [][]byte
+		for s.Scan() {
+			records = append(records, append([]byte(nil), s.Record()...))
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(records, [][]byte{[]byte("a"), large, []byte("b")}) {
+			t.Fatal("unexpected records:", len(records))
+		}
+	}
+
+	write := func(w io.Writer) {
+		rw := recordio.NewWriter(w, -1, recordio.Gzip)
+		rw.Write([]byte("a"))
+		if n, err := rw.WriteFrom(bytes.NewReader(large), int64(len(large))); err != nil || n != int64(len(large)) {
+			t.Fatal(n, err)
+		}
+		rw.Write([]byte("b"))
+		if err := rw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	write(&buf)
+	check(buf.Bytes())
+
+	path := filepath.Join(t.TempDir(), "large")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(f)
+	f.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(data)
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Fatal("unexpected output writing to a file")
+	}
+
+	rw := recordio.NewWriter(&buf, -1, -1)
+	if _, err := rw.WriteFrom(bytes.NewReader([]byte("short")), 10); err == nil {
+		t.Fatal("expected an error on a short reader")
+	}
+	if _, err := rw.Write([]byte("a")); err == nil {
+		t.Fatal("expected a sticky error after a failed WriteFrom")
+	}
+}
+
+func TestMaxRecordSize(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, -1, recordio.WithMaxRecordSize(4))
+	w.Write([]byte("1234"))
+	_, err := w.Write([]byte("12345"))
+	var tooLarge *recordio.RecordTooLargeError
+	if !errors.Is(err, recordio.ErrRecordTooLarge) || !errors.As(err, &tooLarge) || tooLarge.Record != 1 || tooLarge.Size != 5 {
+		t.Fatal("unexpected error:", err)
+	}
+	w.Close()
+
+	buf.Reset()
+	w = recordio.NewWriter(&buf, -1, -1)
+	w.Write([]byte("1234"))
+	w.Write([]byte("12345"))
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1, recordio.WithReadMaxRecordSize(4))
+	for s.Scan() {
+	}
+	if !errors.As(s.Err(), &tooLarge) || tooLarge.Record != 1 || tooLarge.Offset != 0 {
+		t.Fatal("unexpected error:", s.Err())
+	}
+
+	ss := recordio.NewStreamScanner(bytes.NewReader(buf.Bytes()), recordio.WithReadMaxRecordSize(5))
+	n := 0
+	for ss.Scan() {
+		n++
+	}
+	if ss.Err() != nil || n != 2 {
+		t.Fatal("unexpected scan:", n, ss.Err())
+	}
+}
+
+func TestOnChunkFlush(t *testing.T) {
+	var stats []recordio.ChunkStats
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.NoCompression,
+		recordio.WithMaxChunkRecords(2),
+		recordio.OnChunkFlush(func(s recordio.ChunkStats) { stats = append(stats, s) }))
+	for _, r := range []string{"a", "bb", "ccc"} {
+		w.Write([]byte(r))
+	}
+	w.Close()
+
+	expected := []recordio.ChunkStats{
+		{Chunk: 0, Offset: 0, NumRecords: 2, RecordBytes: 3, CompressedSize: 11},
+		{Chunk: 1, Offset: 31, NumRecords: 1, RecordBytes: 3, CompressedSize: 7},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Fatal("unexpected chunk stats:", stats)
+	}
+}
+
+func TestCreateAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+
+	w, err := recordio.CreateAtomic(path, recordio.WithCompressor(recordio.Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Hello"))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("file exists before Close:", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := recordio.NewScanner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Scan() || string(s.Record()) != "Hello" {
+		t.Fatal("unexpected records:", s.Err())
+	}
+
+	w, err = recordio.CreateAtomic(filepath.Join(dir, "aborted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Hello"))
+	w.Flush()
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "data" {
+		t.Fatal("unexpected files:", entries, err)
+	}
+
+	// The file has the permissions of os.Create.
+	ref, err := os.Create(filepath.Join(t.TempDir(), "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Close()
+	want, _ := os.Stat(ref.Name())
+	if fi, err := os.Stat(path); err != nil || fi.Mode() != want.Mode() {
+		t.Fatal("unexpected mode:", fi.Mode(), want.Mode(), err)
+	}
+
+	// A bare file name is written in the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	w, err = recordio.CreateAtomic("bare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Hello"))
+	if entries, err := os.ReadDir("."); err != nil || len(entries) != 2 || !strings.HasPrefix(entries[0].Name(), ".bare.tmp") {
+		t.Fatal("expected the temporary file in the working directory:", entries, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bare")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompressors(t *testing.T) {
+	var buf bytes.Buffer
+	var expected []string
+	compressors := []int{recordio.NoCompression, recordio.Snappy, recordio.Gzip, recordio.Zstd, recordio.LZ4}
+	for _, c := range compressors {
+		// Concatenated files make a file of mixed chunks.
+		w := recordio.NewWriter(&buf, 100, c)
+		for i := 0; i < 50; i++ {
+			r := fmt.Sprintf("compressor %d record %d", c, i)
+			w.Write([]byte(r))
+			expected = append(expected, r)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []string
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1)
+	for s.Scan() {
+		records = append(records, string(s.Record()))
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Fatal("unexpected records:", records)
+	}
+
+	if err := idx.LoadRecordOffsets(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range expected {
+		record, err := recordio.ReadRecord(bytes.NewReader(buf.Bytes()), idx, i)
+		if err != nil || string(record) != r {
+			t.Fatal("unexpected record:", i, string(record), err)
+		}
+	}
+}
+
+// xorCompressor is a toy Compressor flipping all bits.
+type xorCompressor struct{}
+
+type xorWriter struct{ io.Writer }
+
+func (w xorWriter) Write(p []byte) (int, error) {
+	q := make([]byte, len(p))
+	for i, b := range p {
+		q[i] = ^b
+	}
+	return w.Writer.Write(q)
+}
+
+func (w xorWriter) Close() error { return nil }
+
+type xorReader struct{ io.Reader }
+
+func (r xorReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	for i := range p[:n] {
+		p[i] = ^p[i]
+	}
+	return n, err
+}
+
+func (xorCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) { return xorWriter{w}, nil }
+func (xorCompressor) NewReader(r io.Reader) (io.Reader, error)      { return xorReader{r}, nil }
+
+var registerXor sync.Once
+
+func TestRegisterCompressor(t *testing.T) {
+	const xor = 100
+	registerXor.Do(func() { recordio.RegisterCompressor(xor, xorCompressor{}) })
+
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, xor)
+	w.Write([]byte("Hello"))
+	w.Close()
+	if bytes.Contains(buf.Bytes(), []byte("Hello")) {
+		t.Fatal("record not compressed")
+	}
+
+	s := recordio.NewStreamScanner(bytes.NewReader(buf.Bytes()))
+	if !s.Scan() || string(s.Record()) != "Hello" {
+		t.Fatal("unexpected record:", s.Err())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic registering a duplicate id")
+		}
+	}()
+	recordio.RegisterCompressor(recordio.Gzip, xorCompressor{})
+}
+
+func TestCompressionLevel(t *testing.T) {
+	size := func(compressor, level int) int {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, -1, compressor, recordio.WithCompressionLevel(level))
+		for i := 0; i < 1000; i++ {
+			w.Write([]byte(fmt.Sprintf("record %d of a level test", i%100)))
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(compressor, level, err)
+		}
+
+		s := recordio.NewStreamScanner(bytes.NewReader(buf.Bytes()))
+		n := 0
+		for ; s.Scan(); n++ {
+		}
+		if s.Err() != nil || n != 1000 {
+			t.Fatal("unexpected scan:", compressor, level, n, s.Err())
+		}
+		return buf.Len()
+	}
+
+	for _, c := range []int{recordio.Gzip, recordio.Zstd, recordio.LZ4} {
+		if size(c, 9) >= size(c, 0) {
+			t.Fatal("best compression not smaller than the default:", c)
+		}
+	}
+	size(recordio.Snappy, 9)
+}
+
+func TestAdaptiveCompression(t *testing.T) {
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(0)).Read(random)
+
+	var stats []recordio.ChunkStats
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Gzip,
+		recordio.WithAdaptiveCompression(0.1),
+		recordio.WithMaxChunkRecords(1),
+		recordio.OnChunkFlush(func(s recordio.ChunkStats) { stats = append(stats, s) }))
+	w.Write(random)
+	w.Write(make([]byte, 10000))
+	w.Close()
+
+	if stats[0].CompressedSize != 10004 || stats[1].CompressedSize >= 1000 {
+		t.Fatal("unexpected chunk sizes:", stats)
+	}
+
+	s := recordio.NewStreamScanner(bytes.NewReader(buf.Bytes()))
+	if !s.Scan() || !bytes.Equal(s.Record(), random) || !s.Scan() || !bytes.Equal(s.Record(), make([]byte, 10000)) {
+		t.Fatal("unexpected records:", s.Err())
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 200; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"user": "user-%d", "action": "click", "page": "/item/%d"}`, i%37, i)))
+	}
+	dict, err := recordio.TrainDictionary(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(opts ...recordio.Option) []byte {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, -1, recordio.Zstd, append(opts, recordio.WithMaxChunkRecords(10))...)
+		for _, s := range samples {
+			w.Write(s)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	data := write(recordio.WithDictionary(dict))
+	if plain := write(); len(data) >= len(plain) {
+		t.Fatal("dictionary does not help:", len(data), len(plain))
+	}
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at, err := recordio.LoadIndexAt(bytes.NewReader(data), int64(len(data)), 4); err != nil || !reflect.DeepEqual(at, idx) {
+		t.Fatal("unexpected index from LoadIndexAt:", err)
+	}
+
+	scanners := []recordio.RecordScanner{
+		recordio.NewRangeScanner(bytes.NewReader(data), idx, -1, -1),
+		recordio.NewRangeScanner(bytes.NewReader(data), idx, -1, -1, recordio.WithPrefetch(2, 0)),
+		recordio.NewStreamScanner(bytes.NewReader(data)),
+	}
+	for _, s := range scanners {
+		i := 0
+		for ; s.Scan(); i++ {
+			if !bytes.Equal(s.Record(), samples[i]) {
+				t.Fatal("unexpected record:", i, string(s.Record()))
+			}
+		}
+		if s.Err() != nil || i != len(samples) {
+			t.Fatal("unexpected scan:", i, s.Err())
+		}
+	}
+
+	if err := idx.LoadRecordOffsets(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := recordio.ReadRecord(bytes.NewReader(data), idx, 123); err != nil || !bytes.Equal(r, samples[123]) {
+		t.Fatal("unexpected record:", string(r), err)
+	}
+
+	f := &memFile{data: append([]byte(nil), data...)}
+	w, err := recordio.NewAppendWriter(f, -1, recordio.Zstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(samples[0])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s := recordio.NewStreamScanner(bytes.NewReader(f.data))
+	n := 0
+	for ; s.Scan(); n++ {
+	}
+	if s.Err() != nil || n != len(samples)+1 {
+		t.Fatal("unexpected scan after append:", n, s.Err())
+	}
+}
+
+func TestMaxDecompressedChunkSize(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Gzip, recordio.WithMaxChunkRecords(1))
+	w.Write(make([]byte, 100))
+	w.Write(make([]byte, 1<<20))
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1, recordio.WithMaxDecompressedChunkSize(1000))
+	if !s.Scan() || len(s.Record()) != 100 {
+		t.Fatal("unexpected first record:", s.Err())
+	}
+
+	var tooLarge *recordio.ChunkTooLargeError
+	if s.Scan() || !errors.Is(s.Err(), recordio.ErrChunkTooLarge) || !errors.As(s.Err(), &tooLarge) || tooLarge.Offset != idx.ChunkOffsets[1] {
+		t.Fatal("unexpected error:", s.Err())
+	}
+}
+
+func TestRangeScannerDecodeParallelism(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Gzip, recordio.WithMaxChunkRecords(7))
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]recordio.ReadOption{
+		{recordio.WithDecodeParallelism(4)},
+		{recordio.WithDecodeParallelism(4), recordio.WithPrefetch(16, 100)},
+	} {
+		s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, 3, 990, opts...)
+		i := 3
+		for ; s.Scan(); i++ {
+			if string(s.Record()) != fmt.Sprintf("record %d", i) {
+				t.Fatal("unexpected record:", i, string(s.Record()))
+			}
+		}
+		if s.Err() != nil || i != 993 {
+			t.Fatal("unexpected scan:", i, s.Err())
+		}
+		s.Close()
+	}
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1, recordio.WithDecodeParallelism(4))
+	s.Scan()
+	s.Close()
+}
+
+func TestChecksum(t *testing.T) {
+	write := func(w io.Writer, opts ...recordio.Option) {
+		rw := recordio.NewWriter(w, -1, recordio.NoCompression, append(opts, recordio.WithMaxChunkRecords(10))...)
+		for i := 0; i < 100; i++ {
+			rw.Write([]byte(fmt.Sprintf("record %d", i)))
+		}
+		large := []byte("large record")
+		rw.WriteFrom(bytes.NewReader(large), int64(len(large)))
+		if err := rw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(data []byte, opts ...recordio.ReadOption) (int, error) {
+		idx, err := recordio.LoadIndex(bytes.NewReader(data))
+		if err != nil {
+			return 0, err
+		}
+		s := recordio.NewRangeScanner(bytes.NewReader(data), idx, -1, -1, opts...)
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		return n, s.Err()
+	}
+
+	var v1 bytes.Buffer
+	write(&v1)
+
+	for _, opts := range [][]recordio.Option{
+		{recordio.WithChecksum(recordio.CRC32C)},
+		{recordio.WithChecksum(recordio.CRC32C), recordio.WithUncompressedChecksum(true)},
+		{recordio.WithUncompressedChecksum(true)},
+		{recordio.WithChecksum(recordio.XXHash64)},
+		{recordio.WithChecksum(recordio.SHA256), recordio.WithUncompressedChecksum(true)},
+	} {
+		var buf bytes.Buffer
+		write(&buf, opts...)
+		f := &memFile{}
+		write(f, opts...)
+		if !bytes.Equal(buf.Bytes(), f.data) {
+			t.Fatal("unexpected WriteFrom through a seeker")
+		}
+
+		data := buf.Bytes()
+		if len(data) <= v1.Len() {
+			t.Fatal("expected version 2 headers:", len(data), v1.Len())
+		}
+
+		if n, err := scan(data); err != nil || n != 101 {
+			t.Fatal("unexpected scan:", n, err)
+		}
+
+		idx, err := recordio.LoadIndexAt(bytes.NewReader(data), int64(len(data)), 4)
+		if err != nil || idx.NumRecords != 101 {
+			t.Fatal("unexpected LoadIndexAt:", err)
+		}
+
+		s := recordio.NewStreamScanner(bytes.NewReader(data))
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		if s.Err() != nil || n != 101 {
+			t.Fatal("unexpected stream scan:", n, s.Err())
+		}
+
+		// Corrupt a record, which is stored raw.
+		corrupted := append([]byte(nil), data...)
+		i := bytes.Index(corrupted, []byte("record 42"))
+		corrupted[i] = 'R'
+		if _, err := scan(corrupted); err == nil {
+			t.Fatal("expected checksum error")
+		}
+		if n, err := scan(corrupted, recordio.WithChecksumVerification(recordio.Skip)); err != nil || n != 101 {
+			t.Fatal("unexpected scan without verification:", n, err)
+		}
+	}
+}
+
+var registerFNV sync.Once
+
+func TestRegisterChecksum(t *testing.T) {
+	const fnv128 = 100
+	registerFNV.Do(func() { recordio.RegisterChecksum(fnv128, fnv.New128a) })
+
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.NoCompression, recordio.WithChecksum(fnv128))
+	w.Write([]byte("Hello"))
+	w.Close()
+
+	s := recordio.NewStreamScanner(bytes.NewReader(buf.Bytes()))
+	if !s.Scan() || string(s.Record()) != "Hello" {
+		t.Fatal("unexpected record:", s.Err())
+	}
+
+	var unknown bytes.Buffer
+	w = recordio.NewWriter(&unknown, -1, recordio.NoCompression, recordio.WithChecksum(101))
+	w.Write([]byte("Hello"))
+	if err := w.Close(); err == nil {
+		t.Fatal("expected an error with an unknown checksum")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic registering a duplicate id")
+		}
+	}()
+	recordio.RegisterChecksum(recordio.SHA256, fnv.New128a)
+}
+
+func TestRecoveryScanner(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(10), recordio.WithFooterIndex(true))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the data of chunk 3, the magic number of chunk 6 and
+	// append garbage.
+	data := append([]byte(nil), buf.Bytes()...)
+	data[idx.ChunkOffsets[3]+25] ^= 0xff
+	data[idx.ChunkOffsets[6]] ^= 0xff
+
+	var skipped []recordio.SkippedRange
+	scan := func(data []byte) []string {
+		skipped = nil
+		s := recordio.NewRecoveryScanner(bytes.NewReader(data), func(r recordio.SkippedRange) {
+			skipped = append(skipped, r)
+		})
+		var records []string
+		for s.Scan() {
+			records = append(records, string(s.Record()))
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+
+	records := scan(data)
+	var want []string
+	for i := 0; i < 100; i++ {
+		if i/10 != 3 && i/10 != 6 {
+			want = append(want, fmt.Sprintf("record %d", i))
+		}
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatal("unexpected records:", records)
+	}
+
+	if len(skipped) != 2 ||
+		skipped[0].Offset != idx.ChunkOffsets[3] || skipped[0].Offset+skipped[0].Length != idx.ChunkOffsets[4] ||
+		skipped[1].Offset != idx.ChunkOffsets[6] || skipped[1].Offset+skipped[1].Length != idx.ChunkOffsets[7] {
+		t.Fatal("unexpected skipped ranges:", skipped)
+	}
+
+	// Without the footer, trailing garbage is skipped too.
+	truncated := append(data[:idx.ChunkOffsets[9]+5:idx.ChunkOffsets[9]+5], "garbage"...)
+	if records = scan(truncated); len(records) != 70 || len(skipped) != 3 || skipped[2].Offset != idx.ChunkOffsets[9] {
+		t.Fatal("unexpected recovery of a truncated file:", len(records), skipped)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crashed")
+	write := func(opts ...recordio.Option) *recordio.Index {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, -1, recordio.Gzip, append(opts, recordio.WithMaxChunkRecords(10))...)
+		for i := 0; i < 100; i++ {
+			w.Write([]byte(fmt.Sprintf("record %d", i)))
+		}
+		w.Close()
+
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+
+	repair := func() recordio.RepairReport {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		rep, err := recordio.Repair(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rep
+	}
+
+	// An intact file with a footer is left alone.
+	write(recordio.WithFooterIndex(true))
+	fi, _ := os.Stat(path)
+	if rep := repair(); rep.BytesDropped != 0 || rep.Size != fi.Size() || rep.NumRecords != 100 || rep.NumChunks != 10 {
+		t.Fatal("unexpected repair of an intact file:", rep)
+	}
+
+	// Errors other than corruption leave the file alone.
+	f, _ := os.OpenFile(path, os.O_RDWR, 0)
+	if _, err := recordio.Repair(f, recordio.WithMaxDecompressedChunkSize(10)); err == nil {
+		t.Fatal("expected an error for chunks over the limit, got", err)
+	}
+	f.Close()
+	if after, _ := os.Stat(path); after.Size() != fi.Size() {
+		t.Fatal("file changed by a failed repair:", after.Size())
+	}
+
+	// Cut the last chunk and append garbage.
+	idx := write()
+	if err := os.Truncate(path, idx.ChunkOffsets[9]+30); err != nil {
+		t.Fatal(err)
+	}
+	f, _ = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte("garbage"))
+	f.Close()
+
+	rep := repair()
+	if rep.Size != idx.ChunkOffsets[9] || rep.BytesDropped != 37 || rep.NumRecords != 90 || rep.RecordsDropped != 10 {
+		t.Fatal("unexpected repair:", rep)
+	}
+
+	data, _ := os.ReadFile(path)
+	repaired, err := recordio.LoadIndex(bytes.NewReader(data))
+	if err != nil || repaired.NumRecords != 90 {
+		t.Fatal("unexpected repaired file:", err)
+	}
+
+	// The repaired file takes appends.
+	f, _ = os.OpenFile(path, os.O_RDWR, 0)
+	w, err := recordio.NewAppendWriter(f, -1, recordio.Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("appended"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestVerify(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(10), recordio.WithFooterIndex(true))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	rep, err := recordio.Verify(bytes.NewReader(buf.Bytes()))
+	if err != nil || !rep.OK() || len(rep.Chunks) != 10 || rep.NumRecords != 100 || !rep.Footer {
+		t.Fatal("unexpected report of a valid file:", rep, err)
+	}
+	if c := rep.Chunks[0]; c.Compressor != recordio.Snappy || c.RawSize < 80 {
+		t.Fatal("unexpected chunk status:", c)
+	}
+
+	idx, _ := recordio.LoadIndexFromFooter(bytes.NewReader(buf.Bytes()))
+	data := append([]byte(nil), buf.Bytes()...)
+	data[idx.ChunkOffsets[4]+25] ^= 0xff
+	rep, err = recordio.Verify(bytes.NewReader(data))
+	if err != nil || rep.OK() || len(rep.Chunks) != 10 || rep.NumRecords != 90 || rep.FooterErr != nil {
+		t.Fatal("unexpected report of a corrupted chunk:", rep, err)
+	}
+	for i, c := range rep.Chunks {
+		if (c.Err != nil) != (i == 4) || c.Offset != idx.ChunkOffsets[i] {
+			t.Fatal("unexpected chunk status:", i, c)
+		}
+	}
+
+	// A truncated file loses its footer and its last chunk.
+	rep, err = recordio.Verify(bytes.NewReader(buf.Bytes()[:idx.ChunkOffsets[9]+30]))
+	if err != nil || rep.OK() || rep.Footer || len(rep.Chunks) != 10 || rep.Chunks[9].Err == nil || rep.NumRecords != 90 {
+		t.Fatal("unexpected report of a truncated file:", rep, err)
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithFileHeader(true))
+	w.Write([]byte("Hello"))
+	w.Close()
+
+	if binary.LittleEndian.Uint32(buf.Bytes()) != 0x01020307 {
+		t.Fatal("expected a file header")
+	}
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil || idx.NumRecords != 1 {
+		t.Fatal("unexpected index:", err)
+	}
+	if rec, err := recordio.ReadRecord(bytes.NewReader(buf.Bytes()), idx, 0); err != nil || string(rec) != "Hello" {
+		t.Fatal("unexpected record:", string(rec), err)
+	}
+
+	// A chunk header of a future version.
+	data := append([]byte(nil), buf.Bytes()...)
+	binary.LittleEndian.PutUint32(data[idx.ChunkOffsets[0]:], 0x01020309)
+
+	if _, err := recordio.LoadIndex(bytes.NewReader(data)); !errors.Is(err, recordio.ErrUnsupportedVersion) {
+		t.Fatal("unexpected LoadIndex error:", err)
+	}
+
+	s := recordio.NewStreamScanner(bytes.NewReader(data))
+	if s.Scan() || !errors.Is(s.Err(), recordio.ErrUnsupportedVersion) {
+		t.Fatal("unexpected scan error:", s.Err())
+	}
+
+	if _, err := recordio.ReadRecord(bytes.NewReader(data), idx, 0); !errors.Is(err, recordio.ErrUnsupportedVersion) {
+		t.Fatal("unexpected ReadRecord error:", err)
+	}
+}
+
+func TestLoadIndexLenient(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(10), recordio.WithChecksum(recordio.SHA256))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	idx, truncated, err := recordio.LoadIndexLenient(bytes.NewReader(buf.Bytes()))
+	if err != nil || truncated || idx.NumRecords != 100 {
+		t.Fatal("unexpected index of a complete file:", truncated, err)
+	}
+
+	last := idx.ChunkOffsets[9]
+	for _, size := range []int64{last + 10, last + 30, last + 60} {
+		data := buf.Bytes()[:size]
+		idx, truncated, err := recordio.LoadIndexLenient(bytes.NewReader(data))
+		if err != nil || !truncated || idx.NumRecords != 90 {
+			t.Fatal("unexpected index of a truncated file:", size, truncated, err)
+		}
+
+		s := recordio.NewRangeScanner(bytes.NewReader(data), idx, -1, -1)
+		n := 0
+		for ; s.Scan(); n++ {
+		}
+		if s.Err() != nil || n != 90 {
+			t.Fatal("unexpected scan:", n, s.Err())
+		}
+	}
+}
+
+func TestRecordChecksums(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.NoCompression, recordio.WithRecordChecksums(true), recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 50; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	large := []byte("large record")
+	w.WriteFrom(bytes.NewReader(large), int64(len(large)))
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(data []byte, opts ...recordio.ReadOption) (int, error) {
+		s := recordio.NewRangeScanner(bytes.NewReader(data), idx, -1, -1, opts...)
+		n := 0
+		for ; s.Scan(); n++ {
+			if n < 50 && string(s.Record()) != fmt.Sprintf("record %d", n) {
+				return n, fmt.Errorf("unexpected record %q", s.Record())
+			}
+		}
+		return n, s.Err()
+	}
+
+	if n, err := scan(buf.Bytes()); err != nil || n != 51 {
+		t.Fatal("unexpected scan:", n, err)
+	}
+
+	if err := idx.LoadRecordOffsets(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 17, 50} {
+		if _, err := recordio.ReadRecord(bytes.NewReader(buf.Bytes()), idx, i); err != nil {
+			t.Fatal("unexpected ReadRecord:", i, err)
+		}
+	}
+
+	// Corrupt record 17, leaving the chunk checksums to be skipped.
+	data := append([]byte(nil), buf.Bytes()...)
+	data[bytes.Index(data, []byte("record 17"))+7] = '9'
+
+	skip := recordio.WithChecksumVerification(recordio.Skip)
+	if _, err := scan(data, skip); err == nil {
+		t.Fatal("expected a record checksum error")
+	}
+	if n, err := scan(data, skip, recordio.WithRecordChecksumVerification(recordio.Skip)); err == nil || n != 17 {
+		t.Fatal("expected the corrupted record without verification:", n, err)
+	}
+
+	if _, err := recordio.ReadRecord(bytes.NewReader(data), idx, 17); err == nil {
+		t.Fatal("expected a record checksum error from ReadRecord")
+	}
+	if rec, err := recordio.ReadRecord(bytes.NewReader(data), idx, 18); err != nil || string(rec) != "record 18" {
+		t.Fatal("unexpected ReadRecord:", string(rec), err)
+	}
+}
+
+func TestReaderAt(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Gzip, recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	ra := bytes.NewReader(buf.Bytes())
+	idx, err := recordio.LoadIndexAt(ra, int64(buf.Len()), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := recordio.NewReaderAt(ra, idx, 4)
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			s := recordio.NewRangeScannerAt(ra, idx, g*100, 100)
+			for i := g * 100; s.Scan(); i++ {
+				if string(s.Record()) != fmt.Sprintf("record %d", i) {
+					errs <- fmt.Errorf("unexpected record %d: %q", i, s.Record())
+					return
+				}
+			}
+			if s.Err() != nil {
+				errs <- s.Err()
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < 1000; i += 37 {
+				if rec, err := rd.Get(i); err != nil || string(rec) != fmt.Sprintf("record %d", i) {
+					errs <- fmt.Errorf("unexpected Get %d: %q %v", i, rec, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	s := recordio.NewReverseScannerAt(ra, idx, 990, -1)
+	if !s.Scan() || string(s.Record()) != "record 999" {
+		t.Fatal("unexpected reverse scan:", s.Err())
+	}
+
+	n := 0
+	for ss := recordio.NewSampleScannerAt(ra, idx, 1, 0); ss.Scan(); n++ {
+	}
+	if n != 1000 {
+		t.Fatal("unexpected sample scan:", n)
+	}
+}
+
+// countingRanges is a RangeReader of data counting its requests.
+type countingRanges struct {
+	data []byte
+	mu   sync.Mutex
+	n    int
+	fail bool
+}
+
+func (c *countingRanges) ReadRange(offset, length int64) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	if c.fail {
+		return nil, errors.New("unavailable")
+	}
+	return io.NopCloser(bytes.NewReader(c.data[offset : offset+length])), nil
+}
+
+func TestRangeReaderAt(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(10), recordio.WithFooterIndex(true))
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	rr := &countingRanges{data: buf.Bytes()}
+	ra := recordio.NewRangeReaderAt(rr, int64(buf.Len()), 1024, 4)
+
+	idx, err := recordio.LoadIndexAt(ra, ra.Size(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := recordio.NewRangeScannerAt(ra, idx, -1, -1)
+	n := 0
+	for ; s.Scan(); n++ {
+		if string(s.Record()) != fmt.Sprintf("record %d", n) {
+			t.Fatal("unexpected record:", n, string(s.Record()))
+		}
+	}
+	if s.Err() != nil || n != 1000 {
+		t.Fatal("unexpected scan:", n, s.Err())
+	}
+
+	// Each block is fetched about once per pass.
+	if blocks := (buf.Len() + 1023) / 1024; rr.n > 2*blocks+2 {
+		t.Fatal("too many requests:", rr.n, blocks)
+	}
+
+	// A read spanning uncached blocks takes one request.
+	ra = recordio.NewRangeReaderAt(rr, int64(buf.Len()), 100, 100)
+	rr.n = 0
+	p := make([]byte, 1000)
+	if n, err := ra.ReadAt(p, 50); err != nil || n != 1000 || !bytes.Equal(p, buf.Bytes()[50:1050]) || rr.n != 1 {
+		t.Fatal("unexpected ReadAt:", n, err, rr.n)
+	}
+
+	end := make([]byte, 10)
+	if n, err := ra.ReadAt(end, int64(buf.Len()-5)); err != io.EOF || n != 5 {
+		t.Fatal("unexpected ReadAt at the end:", n, err)
+	}
+
+	rr.fail = true
+	if _, err := ra.ReadAt(p, 2000); err == nil {
+		t.Fatal("expected an error")
+	}
+	rr.fail = false
+	if _, err := ra.ReadAt(p, 2000); err != nil {
+		t.Fatal("expected a retry to succeed:", err)
+	}
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(10), recordio.WithFooterIndex(true))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	var mu sync.Mutex
+	etag, failures := `"v1"`, 1
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		tag := etag
+		fail := failures > 0
+		failures--
+		mu.Unlock()
+
+		if fail {
+			http.Error(rw, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("ETag", tag)
+		http.ServeContent(rw, req, "data", time.Time{}, bytes.NewReader(buf.Bytes()))
+	}))
+	defer srv.Close()
+
+	h, err := recordio.NewHTTPReaderAt(srv.URL, srv.Client())
+	if err != nil || h.Size() != int64(buf.Len()) {
+		t.Fatal("unexpected HTTPReaderAt:", err)
+	}
+
+	r := recordio.NewRangeReaderAt(h, h.Size(), 256, -1)
+	idx, err := recordio.LoadIndexAt(r, r.Size(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := recordio.NewRangeScannerAt(h, idx, -1, -1)
+	n := 0
+	for ; s.Scan(); n++ {
+	}
+	if s.Err() != nil || n != 100 {
+		t.Fatal("unexpected scan:", n, s.Err())
+	}
+
+	mu.Lock()
+	etag = `"v2"`
+	mu.Unlock()
+	if _, err := h.ReadAt(make([]byte, 10), 0); err != recordio.ErrRemoteChanged {
+		t.Fatal("expected ErrRemoteChanged:", err)
+	}
+}
+
+// countingReader counts the reads of an io.ReadSeeker.
+type countingReader struct {
+	io.ReadSeeker
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.ReadSeeker.Read(p)
+}
+
+func TestChunkCache(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Gzip, recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := recordio.NewChunkCache(1 << 20)
+	scan := func(opts ...recordio.ReadOption) int {
+		r := &countingReader{ReadSeeker: bytes.NewReader(buf.Bytes())}
+		s := recordio.NewRangeScanner(r, idx, -1, -1, append(opts, recordio.WithChunkCache(cache, "a"))...)
+		n := 0
+		for ; s.Scan(); n++ {
+			if string(s.Record()) != fmt.Sprintf("record %d", n) {
+				t.Fatal("unexpected record:", n, string(s.Record()))
+			}
+		}
+		if s.Err() != nil || n != 100 {
+			t.Fatal("unexpected scan:", n, s.Err())
+		}
+		return r.reads
+	}
+
+	if scan() == 0 {
+		t.Fatal("expected reads")
+	}
+	if reads := scan(); reads != 0 {
+		t.Fatal("expected cached chunks:", reads)
+	}
+	if reads := scan(recordio.WithPrefetch(4, 0)); reads != 0 {
+		t.Fatal("expected cached chunks with prefetch:", reads)
+	}
+
+	r := &countingReader{ReadSeeker: bytes.NewReader(buf.Bytes())}
+	rd := recordio.NewReader(r, idx, 0, recordio.WithChunkCache(cache, "a"))
+	if rec, err := rd.Get(42); err != nil || string(rec) != "record 42" || r.reads != 0 {
+		t.Fatal("unexpected Get:", string(rec), err, r.reads)
+	}
+
+	// A small cache holds a few chunks only.
+	small := recordio.NewChunkCache(500)
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1, recordio.WithChunkCache(small, "a"))
+	for s.Scan() {
+	}
+	if small.Bytes() == 0 || small.Bytes() > 500 {
+		t.Fatal("unexpected cache size:", small.Bytes())
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.NoCompression, recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(start int, opts ...recordio.ReadOption) int {
+		r := &countingReader{ReadSeeker: bytes.NewReader(buf.Bytes())}
+		s := recordio.NewRangeScanner(r, idx, start, -1, opts...)
+		i := start
+		for ; s.Scan(); i++ {
+			if string(s.Record()) != fmt.Sprintf("record %d", i) {
+				t.Fatal("unexpected record:", i, string(s.Record()))
+			}
+		}
+		if s.Err() != nil || i != 1000 {
+			t.Fatal("unexpected scan:", i, s.Err())
+		}
+		return r.reads
+	}
+
+	plain := scan(0)
+	if ahead := scan(0, recordio.WithReadAhead(64<<10)); ahead*10 > plain {
+		t.Fatal("expected fewer reads:", ahead, plain)
+	}
+	scan(555, recordio.WithReadAhead(100))
+	scan(0, recordio.WithReadAhead(1000), recordio.WithPrefetch(4, 0))
+
+	s := recordio.NewStreamScanner(bytes.NewReader(buf.Bytes()), recordio.WithReadAhead(1000))
+	n := 0
+	for ; s.Scan(); n++ {
+	}
+	if s.Err() != nil || n != 1000 {
+		t.Fatal("unexpected stream scan:", n, s.Err())
+	}
+}
+
+func TestOpenFS(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	mapFS := fstest.MapFS{}
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithFooterIndex(i%2 == 0))
+		for j := 0; j < 10; j++ {
+			w.Write([]byte(fmt.Sprintf("file %d record %d", i, j)))
+		}
+		w.Close()
+
+		name := fmt.Sprintf("data/part-%d.recordio", i)
+		mapFS[name] = &fstest.MapFile{Data: buf.Bytes()}
+		f, _ := zw.Create(name)
+		f.Write(buf.Bytes())
+	}
+	mapFS["data/README"] = &fstest.MapFile{Data: []byte("not recordio")}
+	zw.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(zipped.Bytes()), int64(zipped.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fsys := range []fs.FS{mapFS, zr} {
+		files, err := recordio.OpenFS(fsys, "data/*.recordio")
+		if err != nil || len(files) != 3 {
+			t.Fatal("unexpected OpenFS:", len(files), err)
+		}
+
+		for i, f := range files {
+			s := f.NewRangeScanner(-1, -1)
+			j := 0
+			for ; s.Scan(); j++ {
+				if string(s.Record()) != fmt.Sprintf("file %d record %d", i, j) {
+					t.Fatal("unexpected record:", string(s.Record()))
+				}
+			}
+			if s.Err() != nil || j != 10 {
+				t.Fatal("unexpected scan:", f.Name, j, s.Err())
+			}
+
+			if rec, err := f.NewReader(-1).Get(3); err != nil || string(rec) != fmt.Sprintf("file %d record 3", i) {
+				t.Fatal("unexpected Get:", string(rec), err)
+			}
+			f.Close()
+		}
+	}
+
+	if _, err := recordio.OpenFS(mapFS, "data/README"); err == nil {
+		t.Fatal("expected an error opening a non-recordio file")
+	}
+	if _, err := recordio.OpenFS(mapFS, "none/*"); err == nil {
+		t.Fatal("expected an error without matches")
+	}
+}
+
+// memParts is a PartWriter into memory.
+type memParts struct {
+	parts     [][]byte
+	completed bool
+	aborted   bool
+	fail      bool
+}
+
+func (m *memParts) WritePart(number int, data []byte) error {
+	if m.fail {
+		return errors.New("unavailable")
+	}
+	if number != len(m.parts)+1 {
+		return fmt.Errorf("unexpected part number %d", number)
+	}
+	m.parts = append(m.parts, append([]byte(nil), data...))
+	return nil
+}
+
+func (m *memParts) Complete() error { m.completed = true; return nil }
+func (m *memParts) Abort() error    { m.aborted = true; return nil }
+
+func TestPartWriter(t *testing.T) {
+	pw := &memParts{}
+	w := recordio.NewPartWriter(pw, 1000, -1, recordio.Gzip, recordio.WithMaxChunkRecords(10), recordio.WithFooterIndex(true))
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	if err := w.Close(); err != nil || !pw.completed || pw.aborted {
+		t.Fatal("unexpected Close:", err, pw.completed, pw.aborted)
+	}
+
+	if len(pw.parts) < 3 {
+		t.Fatal("expected several parts:", len(pw.parts))
+	}
+	for _, part := range pw.parts[:len(pw.parts)-1] {
+		if len(part) < 1000 {
+			t.Fatal("part too small:", len(part))
+		}
+	}
+
+	data := bytes.Join(pw.parts, nil)
+	idx, err := recordio.LoadIndexFromFooter(bytes.NewReader(data))
+	if err != nil || idx.NumRecords != 1000 {
+		t.Fatal("unexpected index:", err)
+	}
+
+	pw = &memParts{}
+	w = recordio.NewPartWriter(pw, -1, -1, -1)
+	w.Write([]byte("Hello"))
+	if err := w.Abort(); err != nil || !pw.aborted || pw.completed {
+		t.Fatal("unexpected Abort:", err, pw.aborted, pw.completed)
+	}
+
+	pw = &memParts{fail: true}
+	w = recordio.NewPartWriter(pw, -1, -1, -1)
+	w.Write([]byte("Hello"))
+	if err := w.Close(); err == nil || !pw.aborted || pw.completed {
+		t.Fatal("expected a failed upload to abort:", err)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// flakyReaderAt fails every other read with err, after reading half
+// of it, until fails reaches 0.
+type flakyReaderAt struct {
+	r     io.ReaderAt
+	mu    sync.Mutex
+	calls int
+	fails int
+	err   error
+}
+
+func (f *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.fails > 0 && f.calls%2 == 1 {
+		f.fails--
+		n, _ := f.r.ReadAt(p[:len(p)/2], off)
+		return n, f.err
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func TestRetryingReaderAt(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	policy := recordio.RetryPolicy{Backoff: time.Millisecond}
+	flaky := &flakyReaderAt{r: bytes.NewReader(buf.Bytes()), fails: 20, err: timeoutError{}}
+	ra := recordio.NewRetryingReaderAt(flaky, policy)
+	idx, err := recordio.LoadIndex(io.NewSectionReader(ra, 0, int64(buf.Len())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := recordio.NewRangeScannerAt(ra, idx, -1, -1)
+	n := 0
+	for r.Scan() {
+		if string(r.Record()) != fmt.Sprintf("record %d", n) {
+			t.Fatal("unexpected record:", string(r.Record()))
+		}
+		n++
+	}
+	if r.Err() != nil || n != 100 || flaky.fails != 0 {
+		t.Fatal("unexpected scan:", r.Err(), n, flaky.fails)
+	}
+
+	// Beyond MaxAttempts, or for permanent errors, reads fail.
+	p := make([]byte, 16)
+	flaky.calls, flaky.fails = 0, 100
+	policy.MaxAttempts = 1
+	if _, err := recordio.NewRetryingReaderAt(flaky, policy).ReadAt(p, 0); err != (timeoutError{}) {
+		t.Fatal("expected the timeout:", err)
+	}
+
+	flaky.calls, flaky.fails, flaky.err = 0, 2, errors.New("permission denied")
+	policy.MaxAttempts = 5
+	if _, err := recordio.NewRetryingReaderAt(flaky, policy).ReadAt(p, 0); err == nil || flaky.fails != 1 {
+		t.Fatal("expected no retry of a permanent error:", err, flaky.fails)
+	}
+
+	// Errors of a RangeReaderAt keep their causes, so that they are
+	// retried.
+	calls := 0
+	rr := recordio.RangeReaderFunc(func(offset, length int64) (io.ReadCloser, error) {
+		if calls++; calls <= 2 {
+			return nil, &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}
+		}
+		return io.NopCloser(bytes.NewReader(buf.Bytes()[offset : offset+length])), nil
+	})
+	ra = recordio.NewRetryingReaderAt(recordio.NewRangeReaderAt(rr, int64(buf.Len()), -1, -1), policy)
+	if _, err := ra.ReadAt(p, 0); err != nil || calls != 3 || !bytes.Equal(p, buf.Bytes()[:16]) {
+		t.Fatal("expected the RangeReaderAt to be retried:", err, calls)
+	}
+}
+
+func TestIndexCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := recordio.NewIndexCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "data.recordio")
+	f, _ := os.Create(path)
+	w := recordio.NewWriter(f, -1, -1, recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+	f.Close()
+
+	loads := 0
+	load := func() (*recordio.Index, error) {
+		loads++
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return recordio.LoadIndex(f)
+	}
+
+	fi, _ := os.Stat(path)
+	for i := 0; i < 2; i++ {
+		idx, err := cache.Load(path, recordio.FileValidator(fi), load)
+		if err != nil || idx.NumRecords != 100 || idx.NumChunks() != 10 {
+			t.Fatal("unexpected index:", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatal("expected one load, got", loads)
+	}
+
+	// Another version of the file, or another file, misses.
+	if idx, err := cache.Get(path, recordio.Validator{Size: fi.Size(), Token: "other"}); idx != nil || err != nil {
+		t.Fatal("expected a miss:", err)
+	}
+	if idx, err := cache.Get(path+".other", recordio.FileValidator(fi)); idx != nil || err != nil {
+		t.Fatal("expected a miss:", err)
+	}
+
+	// A fresh cache of the directory reuses the entry.
+	cache, _ = recordio.NewIndexCache(filepath.Join(dir, "cache"))
+	if idx, err := cache.Get(path, recordio.FileValidator(fi)); idx == nil || err != nil || idx.NumRecords != 100 {
+		t.Fatal("expected a hit:", err)
+	}
+
+	if err := cache.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if idx, _ := cache.Get(path, recordio.FileValidator(fi)); idx != nil {
+		t.Fatal("expected a miss after Remove")
+	}
+}
+
+func TestCopyChunks(t *testing.T) {
+	var src bytes.Buffer
+	w := recordio.NewWriter(&src, -1, recordio.Gzip, recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+	idx, _ := recordio.LoadIndex(bytes.NewReader(src.Bytes()))
+
+	var dst bytes.Buffer
+	w = recordio.NewWriter(&dst, -1, recordio.Snappy, recordio.WithFooterIndex(true))
+	w.Write([]byte("first"))
+	if err := w.CopyChunks(bytes.NewReader(src.Bytes()), idx, 2, 5); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("last"))
+	w.Close()
+
+	out, err := recordio.LoadIndexFromFooter(bytes.NewReader(dst.Bytes()))
+	if err != nil || out.NumChunks() != 5 || out.NumRecords != 32 {
+		t.Fatal("unexpected index:", err, out)
+	}
+
+	expected := []string{"first"}
+	for i := 20; i < 50; i++ {
+		expected = append(expected, fmt.Sprintf("record %d", i))
+	}
+	expected = append(expected, "last")
+
+	s := recordio.NewRangeScanner(bytes.NewReader(dst.Bytes()), out, 0, -1)
+	n := 0
+	for s.Scan() {
+		if string(s.Record()) != expected[n] {
+			t.Fatal("unexpected record:", n, string(s.Record()))
+		}
+		n++
+	}
+	if s.Err() != nil || n != len(expected) {
+		t.Fatal("unexpected scan:", s.Err(), n)
+	}
+
+	// Chunks with a dictionary the Writer lacks are recompressed.
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"id": %d, "name": "sample %d"}`, i, i)))
+	}
+	dict, err := recordio.TrainDictionary(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Reset()
+	w = recordio.NewWriter(&src, -1, recordio.Zstd, recordio.WithDictionary(dict), recordio.WithMaxChunkRecords(100))
+	for _, sample := range samples {
+		w.Write(sample)
+	}
+	w.Close()
+	idx, _ = recordio.LoadIndex(bytes.NewReader(src.Bytes()))
+
+	dst.Reset()
+	w = recordio.NewWriter(&dst, -1, recordio.Zstd, recordio.WithCompressionWorkers(4))
+	if err := w.CopyChunks(bytes.NewReader(src.Bytes()), idx, 0, idx.NumChunks()); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	s = recordio.NewRangeScanner(bytes.NewReader(dst.Bytes()), w.Index(), 0, -1)
+	n = 0
+	for s.Scan() {
+		if !bytes.Equal(s.Record(), samples[n]) {
+			t.Fatal("unexpected record:", n, string(s.Record()))
+		}
+		n++
+	}
+	if s.Err() != nil || n != len(samples) {
+		t.Fatal("unexpected scan:", s.Err(), n)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.recordio")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := map[string]string{"dataset": "train", "producer": "v1.2"}
+	w := recordio.NewWriter(f, -1, recordio.Snappy, recordio.WithMetadata(md), recordio.WithFooterIndex(true))
+	for i := 0; i < 10; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	if err := w.SetMetadata("records", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetMetadata("producer", "v1.3"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	f.Close()
+
+	all := map[string]string{"dataset": "train", "producer": "v1.3", "records": "10"}
+	if !reflect.DeepEqual(w.Index().Metadata(), all) {
+		t.Fatal("unexpected metadata of the Writer:", w.Index().Metadata())
+	}
+
+	f, _ = os.OpenFile(path, os.O_RDWR, 0)
+	defer f.Close()
+	if got, err := recordio.ReadMetadata(f); err != nil || !reflect.DeepEqual(got, all) {
+		t.Fatal("unexpected metadata:", got, err)
+	}
+	if idx, err := recordio.LoadIndexFromFooter(f); err != nil || !reflect.DeepEqual(idx.Metadata(), all) {
+		t.Fatal("unexpected metadata of the footer:", err)
+	}
+	f.Seek(0, io.SeekStart)
+	idx, err := recordio.LoadIndex(f)
+	if err != nil || !reflect.DeepEqual(idx.Metadata(), md) || idx.NumRecords != 10 {
+		t.Fatal("unexpected metadata of the file header:", err)
+	}
+
+	for _, format := range []recordio.IndexFormat{recordio.IndexBinary, recordio.IndexJSON, recordio.IndexProto} {
+		var buf bytes.Buffer
+		if err := idx.SaveAs(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := recordio.LoadIndexFileAs(&buf, format)
+		if err != nil || !reflect.DeepEqual(loaded.Metadata(), md) || loaded.NumRecords != 10 {
+			t.Fatal("unexpected metadata of a saved index:", format, err)
+		}
+	}
+
+	// Appending keeps the metadata, adding that of WithMetadata to the
+	// footer.
+	aw, err := recordio.NewAppendWriter(f, -1, recordio.Snappy, recordio.WithMetadata(map[string]string{"appended": "yes"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw.Write([]byte("record 10"))
+	aw.Close()
+	all["appended"] = "yes"
+	if got, err := recordio.ReadMetadata(f); err != nil || !reflect.DeepEqual(got, all) {
+		t.Fatal("unexpected metadata after appending:", got, err)
+	}
+
+	// Without a footer, only the file header holds metadata.
+	var buf bytes.Buffer
+	w = recordio.NewWriter(&buf, -1, recordio.NoCompression, recordio.WithMetadata(md))
+	if err := w.SetMetadata("records", "0"); err == nil {
+		t.Fatal("expected an error of metadata without a footer")
+	}
+	w.Close()
+	if got, err := recordio.ReadMetadata(bytes.NewReader(buf.Bytes())); err != nil || !reflect.DeepEqual(got, md) {
+		t.Fatal("unexpected metadata without a footer:", got, err)
+	}
+
+	w = recordio.NewWriter(io.Discard, -1, recordio.NoCompression, recordio.WithMetadata(md), recordio.WithPaddleCompat(true))
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Fatal("expected an error of metadata in PaddlePaddle files")
+	}
+
+	buf.Reset()
+	w = recordio.NewWriter(&buf, -1, recordio.NoCompression)
+	w.Write([]byte("x"))
+	w.Close()
+	if got, err := recordio.ReadMetadata(bytes.NewReader(buf.Bytes())); err != nil || got != nil {
+		t.Fatal("unexpected metadata of a plain file:", got, err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema := &recordio.Schema{Kind: recordio.SchemaAvro, Data: []byte(`{"type": "record", "name": "User", "fields": []}`)}
+
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithSchema(schema), recordio.WithFooterIndex(true))
+	w.Write([]byte("record"))
+	w.Close()
+
+	if got, err := recordio.ReadSchema(bytes.NewReader(buf.Bytes())); err != nil || !reflect.DeepEqual(got, schema) {
+		t.Fatal("unexpected schema:", got, err)
+	}
+
+	var plain bytes.Buffer
+	w = recordio.NewWriter(&plain, -1, recordio.Snappy)
+	w.Write([]byte("record"))
+	w.Close()
+
+	fsys := fstest.MapFS{
+		"with.recordio":    {Data: buf.Bytes()},
+		"without.recordio": {Data: plain.Bytes()},
+	}
+	files, err := recordio.OpenFS(fsys, "*.recordio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files[0].Schema(), schema) || files[1].Schema() != nil {
+		t.Fatal("unexpected schemas of files:", files[0].Schema(), files[1].Schema())
+	}
+	for _, f := range files {
+		f.Close()
+	}
+
+	// Appending needs the same schema, if any.
+	path := filepath.Join(t.TempDir(), "data.recordio")
+	os.WriteFile(path, buf.Bytes(), 0644)
+	f, _ := os.OpenFile(path, os.O_RDWR, 0)
+	defer f.Close()
+	other := &recordio.Schema{Kind: recordio.SchemaJSON, Data: []byte(`{"type": "string"}`)}
+	if _, err := recordio.NewAppendWriter(f, -1, recordio.Snappy, recordio.WithSchema(other)); err == nil {
+		t.Fatal("expected an error of appending with another schema")
+	}
+	aw, err := recordio.NewAppendWriter(f, -1, recordio.Snappy, recordio.WithSchema(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw.Write([]byte("record"))
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := recordio.ReadSchema(f); err != nil || !reflect.DeepEqual(got, schema) {
+		t.Fatal("unexpected schema after appending:", got, err)
+	}
+}
+
+type typedExample struct {
+	ID    int
+	Label string
+	Tags  []string
+}
+
+func TestTyped(t *testing.T) {
+	for _, codec := range []recordio.Codec[typedExample]{recordio.JSONCodec[typedExample]{}, recordio.GobCodec[typedExample]{}} {
+		var buf bytes.Buffer
+		w := recordio.NewTypedWriter(recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(10)), codec)
+		for i := 0; i < 25; i++ {
+			if err := w.Write(typedExample{ID: i, Label: fmt.Sprint("label ", i%3), Tags: []string{"a"}[:i%2]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		s := recordio.NewTypedScanner(recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), w.Writer().Index(), 0, -1), codec)
+		n := 0
+		for s.Scan() {
+			if v := s.Value(); v.ID != n || v.Label != fmt.Sprint("label ", n%3) || len(v.Tags) != n%2 {
+				t.Fatal("unexpected value:", v)
+			}
+			n++
+		}
+		if s.Err() != nil || n != 25 {
+			t.Fatal("unexpected scan:", s.Err(), n)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.NoCompression)
+	w.Write([]byte(`{"ID": 1}`))
+	w.Write([]byte(`not json`))
+	w.Close()
+	s := recordio.NewTypedScanner(recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), recordio.JSONCodec[typedExample]{})
+	if !s.Scan() || s.Value().ID != 1 || s.Scan() || s.Err() == nil {
+		t.Fatal("expected an error of an invalid record:", s.Err())
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	base := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	w := recordio.NewWriter(&buf, -1, recordio.Gzip, recordio.WithRecordChecksums(true))
+	for i := 0; i < 10; i++ {
+		record := []byte(fmt.Sprintf("record %d", i))
+		if i < 3 {
+			w.Write(record)
+			continue
+		}
+		// Out of order, to exercise negative deltas.
+		if _, err := w.WriteWithTimestamp(record, base.Add(time.Duration((i*7)%10)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil || idx.NumRecords != 10 {
+		t.Fatal("unexpected index:", err)
+	}
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1)
+	for i := 0; s.Scan(); i++ {
+		want := time.Time{}
+		if i >= 3 {
+			want = base.Add(time.Duration((i*7)%10) * time.Second)
+		}
+		if string(s.Record()) != fmt.Sprintf("record %d", i) || !s.Timestamp().Equal(want) {
+			t.Fatal("unexpected record:", i, string(s.Record()), s.Timestamp())
+		}
+	}
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+
+	if err := idx.LoadRecordOffsets(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := recordio.ReadRecord(bytes.NewReader(buf.Bytes()), idx, 7); err != nil || string(r) != "record 7" {
+		t.Fatal("unexpected record:", string(r), err)
+	}
+
+	// [base+2s, base+6s) holds records 5 (5s), 6 (2s) and 9 (3s), but not 8 (6s).
+	ts := recordio.NewTimeRangeScanner(recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), base.Add(2*time.Second), base.Add(6*time.Second))
+	var got []string
+	for ts.Scan() {
+		got = append(got, string(ts.Record()))
+	}
+	if ts.Err() != nil || !reflect.DeepEqual(got, []string{"record 5", "record 6", "record 9"}) {
+		t.Fatal("unexpected records in time range:", got, ts.Err())
+	}
+
+	ts = recordio.NewTimeRangeScanner(recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), time.Time{}, time.Time{})
+	n := 0
+	for ts.Scan() {
+		n++
+	}
+	if n != 7 {
+		t.Fatal("unexpected number of timestamped records:", n)
+	}
+
+	if _, err := recordio.NewWriter(io.Discard, -1, recordio.Snappy, recordio.WithPaddleCompat(true)).WriteWithTimestamp(nil, base); err == nil {
+		t.Fatal("expected an error writing timestamps in PaddlePaddle mode")
+	}
+}
+
+func TestKeyedRecords(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 64, recordio.Snappy, recordio.WithFooterIndex(true))
+	for i := 0; i < 20; i++ {
+		if _, err := w.WriteKV([]byte(fmt.Sprintf("id-%d", i)), []byte(fmt.Sprintf("example %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.WriteKV(nil, []byte("no key"))
+	w.Write([]byte("plain"))
+	w.Close()
+
+	idx, err := recordio.LoadIndexFromFooter(bytes.NewReader(buf.Bytes()))
+	if err != nil || idx.NumRecords != 22 {
+		t.Fatal("unexpected index:", err)
+	}
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1)
+	for i := 0; i < 20; i++ {
+		if !s.Scan() || string(s.Key()) != fmt.Sprintf("id-%d", i) || string(s.Record()) != fmt.Sprintf("example %d", i) {
+			t.Fatal("unexpected record:", i, string(s.Key()), string(s.Record()), s.Err())
+		}
+	}
+	if !s.Scan() || s.Key() == nil || len(s.Key()) != 0 || string(s.Record()) != "no key" {
+		t.Fatal("unexpected record with an empty key:", s.Key(), string(s.Record()))
+	}
+	if !s.Scan() || s.Key() != nil || string(s.Record()) != "plain" {
+		t.Fatal("unexpected record without a key:", s.Key(), string(s.Record()))
+	}
+
+	if err := idx.LoadRecordOffsets(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 13, 19} {
+		if r, err := recordio.ReadRecord(bytes.NewReader(buf.Bytes()), idx, i); err != nil || string(r) != fmt.Sprintf("example %d", i) {
+			t.Fatal("unexpected record:", string(r), err)
+		}
+	}
+
+	var copied bytes.Buffer
+	cw := recordio.NewWriter(&copied, -1, recordio.Zstd)
+	if err := cw.CopyChunks(bytes.NewReader(buf.Bytes()), idx, 0, idx.NumChunks()); err != nil {
+		t.Fatal(err)
+	}
+	cw.Close()
+	ss := recordio.NewStreamScanner(bytes.NewReader(copied.Bytes()))
+	if !ss.Scan() || string(ss.Key()) != "id-0" {
+		t.Fatal("unexpected key of a copied record:", string(ss.Key()), ss.Err())
+	}
+}
+
+func TestKeyIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.recordio")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := recordio.NewWriter(f, 100, recordio.Snappy, recordio.WithFooterIndex(true), recordio.WithKeyIndex(true), recordio.WithMetadata(map[string]string{"a": "b"}))
+	for i := 0; i < 50; i++ {
+		w.WriteKV([]byte(fmt.Sprintf("id-%d", i)), []byte(fmt.Sprintf("example %d", i)))
+	}
+	w.Write([]byte("plain"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	f, _ = os.OpenFile(path, os.O_RDWR, 0)
+	defer f.Close()
+	idx, err := recordio.LoadIndexFromFooter(f)
+	if err != nil || idx.KeyIndex() == nil || idx.KeyIndex().Len() != 50 || idx.Metadata()["a"] != "b" {
+		t.Fatal("unexpected footer index:", err)
+	}
+
+	r := recordio.NewReader(f, idx, -1)
+	for _, i := range []int{0, 17, 49} {
+		if v, err := r.Lookup([]byte(fmt.Sprintf("id-%d", i))); err != nil || string(v) != fmt.Sprintf("example %d", i) {
+			t.Fatal("unexpected value:", i, string(v), err)
+		}
+	}
+	if _, err := r.Lookup([]byte("id-50")); err != recordio.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got", err)
+	}
+
+	// The KeyIndex of a slice numbers records from the slice.
+	sl := idx.Slice(2, idx.NumChunks())
+	if v, err := recordio.NewReader(f, sl, 0).Lookup([]byte("id-49")); err != nil || string(v) != "example 49" {
+		t.Fatal("unexpected value in slice:", string(v), err)
+	}
+
+	// Appending keeps indexing keys.
+	w, err = recordio.NewAppendWriter(f, 100, recordio.Snappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteKV([]byte("id-50"), []byte("example 50"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	idx, err = recordio.LoadIndexFromFooter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := recordio.NewReader(f, idx, -1).Lookup([]byte("id-50")); err != nil || string(v) != "example 50" {
+		t.Fatal("unexpected appended value:", string(v), err)
+	}
+
+	// A sidecar index of a file without one.
+	f.Seek(0, io.SeekStart)
+	scanned, err := recordio.LoadIndex(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recordio.NewReader(f, scanned, -1).Lookup([]byte("id-0")); err != recordio.ErrNoKeyIndex {
+		t.Fatal("expected ErrNoKeyIndex, got", err)
+	}
+	keys, err := recordio.BuildKeyIndex(f, scanned)
+	if err != nil || keys.Len() != 51 {
+		t.Fatal("unexpected built key index:", err)
+	}
+	scanned.SetKeyIndex(keys)
+	var buf bytes.Buffer
+	if err := scanned.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := recordio.LoadIndexFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := recordio.NewReader(f, loaded, -1).Lookup([]byte("id-3")); err != nil || string(v) != "example 3" {
+		t.Fatal("unexpected value with a sidecar index:", string(v), err)
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 64, recordio.Snappy, recordio.WithSortedKeys(true), recordio.WithFooterIndex(true))
+	for i := 0; i < 100; i += 2 {
+		if _, err := w.WriteKV([]byte(fmt.Sprintf("k%03d", i)), []byte(fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.WriteKV([]byte("k001"), nil); !errors.Is(err, recordio.ErrUnsortedKey) {
+		t.Fatal("expected ErrUnsortedKey, got", err)
+	}
+	if _, err := w.Write([]byte("no key")); err == nil {
+		t.Fatal("expected an error writing a record without a key")
+	}
+	w.WriteKV([]byte("k098"), []byte("v98 again"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := recordio.LoadIndexFromFooter(bytes.NewReader(buf.Bytes()))
+	if err != nil || !idx.SortedByKey() || idx.NumChunks() < 3 {
+		t.Fatal("unexpected index:", err)
+	}
+
+	r := recordio.NewReader(bytes.NewReader(buf.Bytes()), idx, 0)
+	for i := 0; i < 100; i++ {
+		v, err := r.Lookup([]byte(fmt.Sprintf("k%03d", i)))
+		if i%2 == 1 && err != recordio.ErrKeyNotFound {
+			t.Fatal("expected ErrKeyNotFound:", i, err)
+		}
+		if i%2 == 0 && (err != nil || string(v) != fmt.Sprintf("v%d", i)) {
+			t.Fatal("unexpected value:", i, string(v), err)
+		}
+	}
+
+	scan := func(lo, hi []byte) []string {
+		s, err := r.Range(lo, hi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for s.Scan() {
+			keys = append(keys, string(s.Key()))
+		}
+		if s.Err() != nil {
+			t.Fatal(s.Err())
+		}
+		return keys
+	}
+	if got := scan([]byte("k011"), []byte("k020")); !reflect.DeepEqual(got, []string{"k012", "k014", "k016", "k018"}) {
+		t.Fatal("unexpected range:", got)
+	}
+	if got := scan([]byte("k095"), nil); !reflect.DeepEqual(got, []string{"k096", "k098", "k098"}) {
+		t.Fatal("unexpected unbounded range:", got)
+	}
+	if got := scan(nil, []byte("k003")); !reflect.DeepEqual(got, []string{"k000", "k002"}) {
+		t.Fatal("unexpected range from the start:", got)
+	}
+	if got := scan([]byte("z"), nil); got != nil {
+		t.Fatal("unexpected range past the end:", got)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 256, recordio.Snappy, recordio.WithBloomFilter(10, 0), recordio.WithFooterIndex(true))
+	for i := 0; i < 1000; i++ {
+		w.WriteKV([]byte(fmt.Sprintf("id-%d", (i*7919)%1000)), []byte(fmt.Sprintf("example %d", (i*7919)%1000)))
+	}
+	w.Write([]byte("plain"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := recordio.LoadIndexFromFooter(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No false negatives, and few false positives.
+	positives := 0
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("id-%d", (i*7919)%1000))
+		if ci, _ := idx.Locate(i); !idx.ChunkMayContain(ci, key) {
+			t.Fatal("false negative of record", i)
+		}
+		for ci := 0; ci < idx.NumChunks(); ci++ {
+			if idx.ChunkMayContain(ci, []byte(fmt.Sprintf("absent-%d", i))) {
+				positives++
+			}
+		}
+	}
+	if rate := float64(positives) / float64(1000*idx.NumChunks()); rate > 0.05 {
+		t.Fatal("too many false positives:", rate)
+	}
+
+	r := recordio.NewReader(bytes.NewReader(buf.Bytes()), idx, 0)
+	for _, i := range []int{0, 500, 999} {
+		if v, err := r.Lookup([]byte(fmt.Sprintf("id-%d", i))); err != nil || string(v) != fmt.Sprintf("example %d", i) {
+			t.Fatal("unexpected value:", i, string(v), err)
+		}
+	}
+	if _, err := r.Lookup([]byte("absent")); err != recordio.ErrKeyNotFound {
+		t.Fatal("expected ErrKeyNotFound, got", err)
+	}
+	if sl := idx.Slice(1, 2); sl.ChunkMayContain(0, []byte("absent")) != idx.ChunkMayContain(1, []byte("absent")) {
+		t.Fatal("unexpected Bloom filter of a slice")
+	}
+}
+
+func TestTags(t *testing.T) {
+	const data, marker = 1, 300
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Zstd, recordio.WithRecordChecksums(true))
+	for i := 0; i < 10; i++ {
+		w.WriteTagged(data, []byte(fmt.Sprintf("example %d", i)))
+		if i%3 == 2 {
+			w.WriteTagged(marker, []byte(fmt.Sprintf("end of batch %d", i/3)))
+		}
+	}
+	w.Write([]byte("untagged"))
+	w.Close()
+
+	var got []string
+	s := recordio.NewTagScanner(recordio.NewStreamScanner(bytes.NewReader(buf.Bytes())), marker, 0)
+	for s.Scan() {
+		got = append(got, fmt.Sprintf("%d:%s", s.Tag(), s.Record()))
+	}
+	if s.Err() != nil || !reflect.DeepEqual(got, []string{"300:end of batch 0", "300:end of batch 1", "300:end of batch 2", "0:untagged"}) {
+		t.Fatal("unexpected records:", got, s.Err())
+	}
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil || idx.NumRecords != 14 {
+		t.Fatal("unexpected index:", err)
+	}
+	if err := idx.LoadRecordOffsets(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := recordio.ReadRecord(bytes.NewReader(buf.Bytes()), idx, 3); err != nil || string(r) != "end of batch 0" {
+		t.Fatal("unexpected record:", string(r), err)
+	}
+	n := 0
+	for ds := recordio.NewTagScanner(recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), idx, -1, -1), data); ds.Scan(); n++ {
+	}
+	if n != 10 {
+		t.Fatal("unexpected number of data records:", n)
+	}
+}
+
+func TestStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.recordio")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := recordio.NewWriter(f, 1000, recordio.Gzip, recordio.WithStats(true), recordio.WithFooterIndex(true))
+	for i := 0; i < 100; i++ {
+		w.Write(bytes.Repeat([]byte{'a'}, i))
+	}
+	if s := w.Stats(); s.NumRecords != 100 || s.MaxRecordSize != 99 {
+		t.Fatal("unexpected stats of the Writer:", s)
+	}
+	w.Close()
+	f.Close()
+
+	f, _ = os.OpenFile(path, os.O_RDWR, 0)
+	defer f.Close()
+	s, err := recordio.Stats(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.NumRecords != 100 || s.RecordBytes != 4950 || s.MinRecordSize != 0 || s.MaxRecordSize != 99 || s.MeanRecordSize() != 49.5 {
+		t.Fatal("unexpected stats:", s)
+	}
+	if !reflect.DeepEqual(s.SizeHistogram, []int64{1, 1, 2, 4, 8, 16, 32, 36}) {
+		t.Fatal("unexpected histogram:", s.SizeHistogram)
+	}
+	if p := s.Percentile(50); p != 63 {
+		t.Fatal("unexpected median:", p)
+	}
+	if c := s.Codecs[recordio.Gzip]; c == nil || c.NumChunks != s.NumChunks || c.RecordBytes != 4950 || c.Ratio() <= 1 {
+		t.Fatal("unexpected codec stats:", c)
+	}
+
+	// Stats of a file without them are computed, and appending
+	// keeps them up to date.
+	var plain bytes.Buffer
+	pw := recordio.NewWriter(&plain, 1000, recordio.Gzip)
+	for i := 0; i < 100; i++ {
+		pw.Write(bytes.Repeat([]byte{'a'}, i))
+	}
+	pw.Close()
+	if computed, err := recordio.Stats(bytes.NewReader(plain.Bytes())); err != nil || !reflect.DeepEqual(computed, s) {
+		t.Fatal("unexpected computed stats:", computed, err)
+	}
+
+	w, err = recordio.NewAppendWriter(f, 1000, recordio.Snappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(make([]byte, 1000))
+	w.Close()
+	if s, err = recordio.Stats(f); err != nil || s.NumRecords != 101 || s.MaxRecordSize != 1000 || s.Codecs[recordio.Snappy].NumChunks != 1 {
+		t.Fatal("unexpected stats after appending:", s, err)
+	}
+}
+
+func TestDataset(t *testing.T) {
+	dir := t.TempDir()
+	fsys := fstest.MapFS{}
+	n := 0
+	for shard, count := range []int{5, 0, 12, 3} {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, 40, recordio.Snappy, recordio.WithFooterIndex(shard%2 == 0))
+		for i := 0; i < count; i++ {
+			w.Write([]byte(fmt.Sprintf("record %d", n)))
+			n++
+		}
+		w.Close()
+		name := fmt.Sprintf("data-%05d.recordio", shard)
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fsys[name] = &fstest.MapFile{Data: buf.Bytes()}
+	}
+
+	d, err := recordio.NewDataset([]string{filepath.Join(dir, "data-*")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if r, err := d.Get(7); err != nil || string(r) != "record 7" {
+		t.Fatal("unexpected record:", string(r), err)
+	}
+	if shard, i, err := d.Locate(18); err != nil || shard != 3 || i != 1 {
+		t.Fatal("unexpected location:", shard, i, err)
+	}
+	if num, err := d.NumRecords(); err != nil || num != n || d.NumShards() != 4 {
+		t.Fatal("unexpected number of records:", num, err)
+	}
+	if _, err := d.Get(n); err == nil {
+		t.Fatal("expected an error getting a record out of range")
+	}
+
+	fd, err := recordio.NewDatasetFS(fsys, "*.recordio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	s := fd.NewScanner()
+	i := 0
+	for ; s.Scan(); i++ {
+		if string(s.Record()) != fmt.Sprintf("record %d", i) || s.RecordIndex() != i {
+			t.Fatal("unexpected record:", i, string(s.Record()), s.RecordIndex())
+		}
+	}
+	if s.Err() != nil || i != n {
+		t.Fatal("unexpected end of scan:", i, s.Err())
+	}
+
+	// Closing mid-shard stops the prefetching goroutines.
+	pd, err := recordio.NewDatasetFS(fsys, "*.recordio", recordio.WithPrefetch(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pd.Close()
+	before := runtime.NumGoroutine()
+	ps := pd.NewScanner()
+	for i := 0; i < 7 && ps.Scan(); i++ {
+	}
+	if err := ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatal("prefetching goroutines left after Close:", before, after)
+	}
+}
+
+func TestMultiScanner(t *testing.T) {
+	fsys := fstest.MapFS{"README": &fstest.MapFile{Data: []byte("not recordio")}}
+	n := 0
+	for _, name := range []string{"b/part-1", "b/part-0", "b/part-2"} {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, -1, recordio.Snappy)
+		for i := 0; i < 3; i++ {
+			w.Write([]byte(fmt.Sprintf("%s %d", name, i)))
+			n++
+		}
+		w.Close()
+		fsys[name] = &fstest.MapFile{Data: buf.Bytes()}
+	}
+
+	s, err := recordio.NewMultiScanner(fsys, "b/part-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for s.Scan() {
+		got = append(got, string(s.Record()))
+		if !strings.HasPrefix(string(s.Record()), s.Name()) {
+			t.Fatal("unexpected name of the file:", s.Name())
+		}
+	}
+	if s.Err() != nil || len(got) != n || got[0] != "b/part-0 0" || got[n-1] != "b/part-2 2" {
+		t.Fatal("unexpected records:", got, s.Err())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := recordio.NewMultiScanner(fsys, "c/*"); err == nil {
+		t.Fatal("expected an error without matches")
+	}
+	s, _ = recordio.NewMultiScanner(fsys, "*")
+	for s.Scan() {
+	}
+	if s.Err() == nil {
+		t.Fatal("expected an error scanning a file that is not recordio")
+	}
+
+	// Closing mid-file stops the prefetching goroutines.
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(1))
+	for i := 0; i < 50; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+	fsys["c/long"] = &fstest.MapFile{Data: buf.Bytes()}
+	before := runtime.NumGoroutine()
+	s, err = recordio.NewMultiScanner(fsys, "c/*", recordio.WithPrefetch(2, 0), recordio.WithDecodeParallelism(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3 && s.Scan(); i++ {
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatal("prefetching goroutines left after Close:", before, after)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.NoCompression, recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 95; i++ {
+		size := 10
+		if i >= 50 {
+			size = 1000
+		}
+		w.Write(make([]byte, size))
+	}
+	w.Close()
+	idx := w.Index()
+
+	check := func(idx *recordio.Index, splits []recordio.Split, n int) {
+		if len(splits) != n {
+			t.Fatal("unexpected number of splits:", splits)
+		}
+		next := 0
+		for _, s := range splits {
+			if s.Start != next || s.Len < 0 {
+				t.Fatal("splits with overlaps or gaps:", splits)
+			}
+			next += s.Len
+		}
+		if next != idx.NumRecords {
+			t.Fatal("splits not covering the records:", splits)
+		}
+	}
+
+	splits := recordio.SplitByRecords(idx, 3)
+	check(idx, splits, 3)
+	if !reflect.DeepEqual(splits, []recordio.Split{{0, 30}, {30, 30}, {60, 35}}) {
+		t.Fatal("unexpected splits by records:", splits)
+	}
+
+	// The first 5 chunks are about as large as one of the others.
+	splits = recordio.SplitByBytes(idx, 3)
+	check(idx, splits, 3)
+	if splits[0].Len <= 50 || splits[2].Len >= 30 {
+		t.Fatal("unexpected splits by bytes:", splits)
+	}
+
+	// More workers than chunks split chunks.
+	splits = recordio.SplitByRecords(idx, 19)
+	check(idx, splits, 19)
+	for _, s := range splits {
+		if s.Len != 5 {
+			t.Fatal("unexpected uneven splits:", splits)
+		}
+	}
+	check(idx, recordio.SplitByRecords(idx, 200), 200)
+	empty := recordio.NewWriter(io.Discard, -1, -1).Index()
+	check(empty, recordio.SplitByBytes(empty, 2), 2)
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for i := 0; i < 6; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("small-%d", i))
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := recordio.NewWriter(f, 50, recordio.NoCompression)
+		for j := 0; j < 10; j++ {
+			if _, err := w.Write([]byte(fmt.Sprintf("%050d", i*10+j))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		inputs = append(inputs, path)
+	}
+
+	compact := func(inputs []string, targetBytes int64, prefix string) ([]recordio.ShardInfo, [][]int) {
+		shards, err := recordio.Compact(inputs, targetBytes, func(i, n int) string {
+			return filepath.Join(dir, fmt.Sprintf("%s-%d-of-%d", prefix, i, n))
+		}, recordio.WithMaxChunkBytes(400), recordio.WithFooterIndex(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var paths []string
+		var chunks [][]int
+		total := 0
+		for i, shard := range shards {
+			if expected := filepath.Join(dir, fmt.Sprintf("%s-%d-of-%d", prefix, i, len(shards))); shard.Path != expected {
+				t.Fatal("unexpected shard path:", shard.Path)
+			}
+			f, err := os.Open(shard.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx, err := recordio.LoadIndexFromFooter(f)
+			f.Close()
+			if err != nil || idx.NumRecords != shard.NumRecords {
+				t.Fatal("unexpected index:", idx, err)
+			}
+			paths = append(paths, shard.Path)
+			chunks = append(chunks, idx.ChunkRecords)
+			total += shard.NumRecords
+		}
+		if total != 60 {
+			t.Fatal("unexpected number of records:", total)
+		}
+
+		s, err := recordio.NewScanner(paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for ; s.Scan(); n++ {
+			if string(s.Record()) != fmt.Sprintf("%050d", n) {
+				t.Fatal("unexpected record:", string(s.Record()))
+			}
+		}
+		if err := s.Err(); err != nil || n != 60 {
+			t.Fatal("unexpected records:", n, err)
+		}
+		return shards, chunks
+	}
+
+	// The chunks of single records are merged.
+	shards, chunks := compact(inputs, 1000, "compact")
+	if len(shards) < 2 {
+		t.Fatal("expected several shards, got", len(shards))
+	}
+	var all []int
+	for _, c := range chunks {
+		if c[0] != 8 {
+			t.Fatal("unexpected chunks:", chunks)
+		}
+		all = append(all, c...)
+	}
+
+	// Chunks of the usual size are copied as they are.
+	var paths []string
+	for _, shard := range shards {
+		paths = append(paths, shard.Path)
+	}
+	if _, chunks = compact(paths, 1<<20, "merged"); len(chunks) != 1 || !reflect.DeepEqual(chunks[0], all) {
+		t.Fatal("unexpected chunks:", chunks, all)
+	}
+
+	if _, err := recordio.Compact(inputs, 0, nil); err == nil {
+		t.Fatal("expected an error for a target of 0 bytes")
+	}
+}
+
+func TestInterleaveReader(t *testing.T) {
+	files := make([]*bytes.Reader, 3)
+	indexes := make([]*recordio.Index, 3)
+	for i, n := range []int{3, 1, 200} {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, 20, -1)
+		for j := 0; j < n; j++ {
+			w.Write([]byte(fmt.Sprintf("%c%d", 'a'+i, j)))
+		}
+		w.Close()
+		files[i] = bytes.NewReader(buf.Bytes())
+		idx, err := recordio.LoadIndex(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexes[i] = idx
+	}
+
+	scanners := func(n int) []recordio.RecordScanner {
+		var srcs []recordio.RecordScanner
+		for i := 0; i < n; i++ {
+			srcs = append(srcs, recordio.NewRangeScanner(files[i], indexes[i], -1, -1))
+		}
+		return srcs
+	}
+	read := func(s *recordio.InterleaveReader, sources string) []string {
+		var records []string
+		for s.Scan() {
+			if r := string(s.Record()); r[0] != sources[s.Source()] {
+				t.Fatal("unexpected source:", s.Source(), r)
+			}
+			records = append(records, string(s.Record()))
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+
+	got := read(recordio.NewInterleaveReader(scanners(2)...), "ab")
+	if expected := []string{"a0", "b0", "a1", "a2"}; !reflect.DeepEqual(got, expected) {
+		t.Fatal("unexpected records:", got)
+	}
+
+	weighted := func(seed int64) []string {
+		srcs := scanners(3)[1:]
+		srcs = append(srcs, scanners(1)...)
+		return read(recordio.NewWeightedInterleaveReader(srcs, []float64{1, 3, 0}, seed), "bca")
+	}
+	a := weighted(1)
+	if len(a) != 201 || !reflect.DeepEqual(a, weighted(1)) || reflect.DeepEqual(a, weighted(2)) {
+		t.Fatal("unexpected records:", a)
+	}
+	next := map[byte]int{}
+	for _, r := range a {
+		if r != fmt.Sprintf("%c%d", r[0], next[r[0]]) {
+			t.Fatal("unexpected record:", r)
+		}
+		next[r[0]]++
+	}
+}
+
+func TestShardNames(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "train")
+	name := recordio.ShardNames(prefix)(7, 64)
+	if name != prefix+"-00007-of-00064" {
+		t.Fatal("unexpected shard name:", name)
+	}
+	if p, shard, n, err := recordio.ParseShardName(name); err != nil || p != prefix || shard != 7 || n != 64 {
+		t.Fatal("unexpected parse:", p, shard, n, err)
+	}
+	for _, bad := range []string{"train", "train-7-of-64", "train-00064-of-00064", "train-0000a-of-00064"} {
+		if _, _, _, err := recordio.ParseShardName(bad); err == nil {
+			t.Fatal("expected an error for", bad)
+		}
+	}
+
+	fsys := fstest.MapFS{}
+	for _, i := range []int{0, 2, 3} {
+		if err := os.WriteFile(recordio.ShardName(prefix, i, 4), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		fsys[recordio.ShardName("train", i, 4)] = &fstest.MapFile{}
+	}
+	// Neither is a shard of prefix.
+	os.WriteFile(prefix+"-eval-00001-of-00004", nil, 0644)
+	os.WriteFile(prefix+"-00001.tmp", nil, 0644)
+
+	_, err := recordio.FindShards(prefix)
+	var missing *recordio.MissingShardsError
+	if !errors.Is(err, recordio.ErrMissingShards) || !errors.As(err, &missing) || !reflect.DeepEqual(missing.Missing, []int{1}) {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := recordio.FindShardsFS(fsys, "train"); !errors.Is(err, recordio.ErrMissingShards) {
+		t.Fatal("unexpected error:", err)
+	}
+
+	os.WriteFile(recordio.ShardName(prefix, 1, 4), nil, 0644)
+	fsys[recordio.ShardName("train", 1, 4)] = &fstest.MapFile{}
+	paths, err := recordio.FindShards(prefix)
+	if err != nil || len(paths) != 4 || paths[1] != recordio.ShardName(prefix, 1, 4) {
+		t.Fatal("unexpected shards:", paths, err)
+	}
+	if paths, err := recordio.FindShardsFS(fsys, "train"); err != nil || len(paths) != 4 {
+		t.Fatal("unexpected shards:", paths, err)
+	}
+
+	os.WriteFile(recordio.ShardName(prefix, 0, 5), nil, 0644)
+	if _, err := recordio.FindShards(prefix); err == nil || errors.Is(err, recordio.ErrMissingShards) {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := recordio.FindShards(prefix + "-test"); err == nil {
+		t.Fatal("expected an error without shards")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path := recordio.ShardName(filepath.Join(dir, "train"), i, 3)
+		w, err := recordio.CreateAtomic(path, recordio.WithFooterIndex(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j <= i; j++ {
+			w.Write([]byte(fmt.Sprintf("%d-%d", i, j)))
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	m, err := recordio.NewManifest(paths, map[string]string{"split": "train"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.NumRecords() != 6 || len(m.Shards[0].SHA256) != 64 {
+		t.Fatal("unexpected manifest:", m)
+	}
+	path := filepath.Join(dir, "train.manifest")
+	if err := recordio.WriteManifest(path, m); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := os.ReadFile(path); !strings.Contains(string(buf), `"path": "train-00000-of-00003"`) {
+		t.Fatal("expected relative paths:", string(buf))
+	}
+
+	opened, err := recordio.OpenManifest(path)
+	if err != nil || !reflect.DeepEqual(opened, m) {
+		t.Fatal("unexpected manifest:", opened, err)
+	}
+	if err := opened.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := opened.Dataset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if r, err := d.Get(5); err != nil || string(r) != "2-2" {
+		t.Fatal("unexpected record:", string(r), err)
+	}
+
+	// A corrupted shard of the same size.
+	buf, _ := os.ReadFile(paths[1])
+	buf[len(buf)/2] ^= 1
+	os.WriteFile(paths[1], buf, 0644)
+	if _, err := recordio.OpenManifest(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := opened.Verify(); err == nil {
+		t.Fatal("expected a verification error")
+	}
+	os.Remove(paths[2])
+	if _, err := recordio.OpenManifest(path); err == nil {
+		t.Fatal("expected an error for a missing shard")
+	}
+
+	// The manifest of a ShardedWriter.
+	prefix := filepath.Join(dir, "eval")
+	sw := recordio.NewShardedWriter(prefix, 100, 50, recordio.NoCompression)
+	for i := 0; i < 20; i++ {
+		sw.Write([]byte(fmt.Sprintf("record-%02d", i)))
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := recordio.OpenManifest(prefix + ".manifest"); err != nil || m.NumRecords() != 20 || m.Verify() != nil {
+		t.Fatal("unexpected manifest:", m, err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 3; i++ {
+		path := recordio.ShardName(filepath.Join(dir, "etl"), i, 3)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := recordio.NewWriter(f, 30, -1)
+		for j := 0; j < 10; j++ {
+			w.Write([]byte(fmt.Sprintf("%d-%d", i, j)))
+		}
+		w.Close()
+		f.Close()
+		paths = append(paths, path)
+	}
+
+	read := func(s *recordio.Scanner, n int) []string {
+		var records []string
+		for len(records) != n && s.Scan() {
+			records = append(records, string(s.Record()))
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+
+	s, err := recordio.NewScanner(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := read(s, -1)
+	s.Close()
+
+	for _, n := range []int{0, 7, 10, 25, 30} {
+		s, _ := recordio.NewScanner(paths...)
+		records := read(s, n)
+		checkpoint := s.Checkpoint()
+		s.Close()
+
+		resumed, _ := recordio.NewScanner(paths...)
+		if err := resumed.Resume(checkpoint); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, read(resumed, -1)...)
+		resumed.Close()
+		if !reflect.DeepEqual(records, all) {
+			t.Fatal("unexpected records after resuming at", n, records)
+		}
+		if err := resumed.Resume(checkpoint); err == nil {
+			t.Fatal("expected an error resuming a Scanner that has scanned")
+		}
+	}
+
+	f, err := os.Open(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	idx, err := recordio.LoadIndex(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := recordio.NewRangeScanner(f, idx, 2, 5)
+	rs.Scan()
+	rs.Scan()
+	resumed, err := recordio.ResumeScanner(f, idx, rs.Checkpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []string
+	for resumed.Scan() {
+		records = append(records, string(resumed.Record()))
+	}
+	if !reflect.DeepEqual(records, []string{"1-4", "1-5", "1-6"}) {
+		t.Fatal("unexpected records:", records)
+	}
+	if resumed, err := recordio.ResumeScanner(f, idx, resumed.Checkpoint()); err != nil || resumed.Scan() {
+		t.Fatal("expected no records after the end:", err)
+	}
+
+	s, _ = recordio.NewScanner(paths...)
+	read(s, 15)
+	if _, err := recordio.ResumeScanner(f, idx, s.Checkpoint()); err == nil {
+		t.Fatal("expected an error for a checkpoint in another file")
+	}
+	s.Close()
+	if _, err := recordio.ResumeScanner(f, idx, []byte("bad")); err == nil {
+		t.Fatal("expected an error for an invalid checkpoint")
+	}
+}
+
+func TestEpochIterator(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 4; i++ {
+		f, err := os.Create(recordio.ShardName(filepath.Join(dir, "train"), i, 4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := recordio.NewWriter(f, -1, -1, recordio.WithMaxChunkRecords(3))
+		for j := 0; j < 10; j++ {
+			w.Write([]byte(fmt.Sprintf("%d-%d", i, j)))
+		}
+		w.Close()
+		f.Close()
+	}
+	d, err := recordio.NewDataset([]string{filepath.Join(dir, "train-*")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	epochs := func(seed int64, n int) [][]string {
+		var epochs [][]string
+		it := recordio.NewEpochIterator(d, seed)
+		for it.NextEpoch() && it.Epoch() < n {
+			var records []string
+			for it.Scan() {
+				r, err := d.Get(it.RecordIndex())
+				if err != nil || !bytes.Equal(r, it.Record()) || string(r[0]) != fmt.Sprint(it.Shard()) {
+					t.Fatal("unexpected record:", string(it.Record()), it.RecordIndex(), it.Shard(), err)
+				}
+				records = append(records, string(it.Record()))
+			}
+			if err := it.Err(); err != nil {
+				t.Fatal(err)
+			}
+			epochs = append(epochs, records)
+		}
+		return epochs
+	}
+
+	a := epochs(1, 3)
+	if len(a) != 3 || reflect.DeepEqual(a[0], a[1]) || !reflect.DeepEqual(a, epochs(1, 3)) || reflect.DeepEqual(a, epochs(2, 3)) {
+		t.Fatal("unexpected epochs:", a)
+	}
+	for _, records := range a {
+		if len(records) != 40 {
+			t.Fatal("unexpected epoch:", records)
+		}
+		seen := map[string]bool{}
+		for i, r := range records {
+			seen[r] = true
+			// The records of a chunk keep their order.
+			var shard, j int
+			fmt.Sscanf(r, "%d-%d", &shard, &j)
+			if j%3 != 0 && records[i-1] != fmt.Sprintf("%d-%d", shard, j-1) {
+				t.Fatal("unexpected order:", records)
+			}
+		}
+		if len(seen) != 40 {
+			t.Fatal("unexpected epoch:", records)
+		}
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	file := func(prefix string, n int) func() (recordio.RecordScanner, error) {
+		var buf bytes.Buffer
+		w := recordio.NewWriter(&buf, 10, -1)
+		for i := 0; i < n; i++ {
+			w.Write([]byte(fmt.Sprintf("%s%d", prefix, i)))
+		}
+		w.Close()
+		return func() (recordio.RecordScanner, error) {
+			r := bytes.NewReader(buf.Bytes())
+			idx, err := recordio.LoadIndex(r)
+			if err != nil {
+				return nil, err
+			}
+			return recordio.NewRangeScanner(r, idx, -1, -1), nil
+		}
+	}
+	open := func(f func() (recordio.RecordScanner, error)) recordio.RecordScanner {
+		s, err := f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	read := func(s recordio.RecordScanner) string {
+		var records []string
+		for s.Scan() {
+			records = append(records, string(s.Record()))
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(records, " ")
+	}
+
+	a, b, c := file("a", 3), file("b", 2), file("c", 3)
+	if got := read(recordio.Concat(open(a), open(b))); got != "a0 a1 a2 b0 b1" {
+		t.Fatal("unexpected records:", got)
+	}
+	if got := read(recordio.Take(recordio.Concat(open(a), open(b)), 4)); got != "a0 a1 a2 b0" {
+		t.Fatal("unexpected records:", got)
+	}
+	if got := read(recordio.Repeat(b, 3)); got != "b0 b1 b0 b1 b0 b1" {
+		t.Fatal("unexpected records:", got)
+	}
+	if got := read(recordio.Take(recordio.Repeat(b, -1), 5)); got != "b0 b1 b0 b1 b0" {
+		t.Fatal("unexpected records:", got)
+	}
+	fail := errors.New("open failed")
+	if s := recordio.Repeat(func() (recordio.RecordScanner, error) { return nil, fail }, 2); s.Scan() || s.Err() != fail {
+		t.Fatal("unexpected error:", s.Err())
+	}
+
+	z := recordio.Zip(open(a), open(c))
+	var zipped []string
+	for z.Scan() {
+		zipped = append(zipped, string(bytes.Join(z.Records(), []byte("+"))))
+	}
+	if z.Err() != nil || strings.Join(zipped, " ") != "a0+c0 a1+c1 a2+c2" {
+		t.Fatal("unexpected records:", zipped, z.Err())
+	}
+	z = recordio.Zip(open(a), open(b))
+	for z.Scan() {
+	}
+	if z.Err() == nil {
+		t.Fatal("expected an error for scanners of different lengths")
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 40, recordio.Snappy, recordio.WithEncryption(key))
+	for i := 0; i < 10; i++ {
+		if _, err := w.WriteKV([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("secret-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("secret")) || bytes.Contains(buf.Bytes(), []byte("key-")) {
+		t.Fatal("expected encrypted records")
+	}
+
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil || idx.NumChunks() < 2 {
+		t.Fatal("unexpected index:", idx, err)
+	}
+	read := func(data []byte, opts ...recordio.ReadOption) ([]string, error) {
+		s := recordio.NewRangeScanner(bytes.NewReader(data), idx, -1, -1, opts...)
+		var records []string
+		for s.Scan() {
+			records = append(records, string(s.Key())+"="+string(s.Record()))
+		}
+		return records, s.Err()
+	}
+
+	records, err := read(buf.Bytes(), recordio.WithDecryptionKey(key))
+	if err != nil || len(records) != 10 || records[3] != "key-3=secret-3" {
+		t.Fatal("unexpected records:", records, err)
+	}
+	if _, err := read(buf.Bytes()); !errors.Is(err, recordio.ErrEncrypted) {
+		t.Fatal("expected ErrEncrypted, got", err)
+	}
+	if _, err := read(buf.Bytes(), recordio.WithDecryptionKey(bytes.Repeat([]byte{8}, 32))); err == nil {
+		t.Fatal("expected an error with the wrong key")
+	}
+	if _, err := read(buf.Bytes(), recordio.WithDecryptionKey(key[:16])); err == nil {
+		t.Fatal("expected an error with a key of 16 bytes")
+	}
+
+	// The header is authenticated with the data: corrupt the
+	// compressor and the checksum still matches.
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[idx.ChunkOffsets[0]+4] ^= 2
+	if _, err := read(corrupted, recordio.WithDecryptionKey(key)); err == nil || !strings.Contains(err.Error(), "decrypt") {
+		t.Fatal("expected a decryption error, got", err)
+	}
+
+	// Chunks are copied encrypted, by a Writer of the key.
+	if err := recordio.NewWriter(io.Discard, -1, -1).CopyChunks(bytes.NewReader(buf.Bytes()), idx, 0, 1); !errors.Is(err, recordio.ErrEncrypted) {
+		t.Fatal("expected ErrEncrypted, got", err)
+	}
+	var copied bytes.Buffer
+	cw := recordio.NewWriter(&copied, -1, -1, recordio.WithEncryption(key))
+	if err := cw.CopyChunks(bytes.NewReader(buf.Bytes()), idx, 0, idx.NumChunks()); err != nil {
+		t.Fatal(err)
+	}
+	cw.Close()
+	if records, err := read(copied.Bytes(), recordio.WithDecryptionKey(key)); err != nil || len(records) != 10 {
+		t.Fatal("unexpected records:", records, err)
+	}
+
+	if _, err := recordio.NewWriter(io.Discard, -1, -1, recordio.WithEncryption(key[:5])).Write([]byte("x")); err == nil {
+		t.Fatal("expected an error for an invalid key")
+	}
+	if _, err := recordio.NewWriter(io.Discard, -1, -1, recordio.WithEncryption(key)).WriteFrom(strings.NewReader("x"), 1); err == nil {
+		t.Fatal("expected an error streaming an encrypted record")
+	}
+}
+
+type mapKeyProvider map[string][]byte
+
+func (p mapKeyProvider) Key(id string) ([]byte, error) {
+	if key, ok := p[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", id)
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys := mapKeyProvider{
+		"":   bytes.Repeat([]byte{1}, 32),
+		"k1": bytes.Repeat([]byte{2}, 32),
+		"k2": bytes.Repeat([]byte{3}, 32),
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "rotated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	write := func(prefix string, opts ...recordio.Option) {
+		var w *recordio.Writer
+		if prefix == "none" {
+			w = recordio.NewWriter(f, 10, -1, append(opts, recordio.WithFooterIndex(true))...)
+		} else if w, err = recordio.NewAppendWriter(f, 10, -1, opts...); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			w.Write([]byte(fmt.Sprintf("%s-%d", prefix, i)))
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("none", recordio.WithEncryption(keys[""]))
+	write("k1", recordio.WithEncryption(keys["k1"]), recordio.WithKeyID("k1"))
+	write("k2", recordio.WithEncryption(keys["k2"]), recordio.WithKeyID("k2"))
+
+	idx, err := recordio.LoadIndexFromFooter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(opts ...recordio.ReadOption) ([]string, error) {
+		s := recordio.NewRangeScanner(f, idx, -1, -1, opts...)
+		var records []string
+		for s.Scan() {
+			records = append(records, string(s.Record()))
+		}
+		return records, s.Err()
+	}
+
+	records, err := read(recordio.WithKeyProvider(keys), recordio.WithDecodeParallelism(4))
+	if err != nil || strings.Join(records, " ") != "none-0 none-1 none-2 k1-0 k1-1 k1-2 k2-0 k2-1 k2-2" {
+		t.Fatal("unexpected records:", records, err)
+	}
+	if _, err := read(recordio.WithKeyProvider(mapKeyProvider{"": keys[""], "k1": keys["k1"]})); err == nil || !strings.Contains(err.Error(), "k2") {
+		t.Fatal("expected an error for the missing key k2, got", err)
+	}
+	if records, err := read(recordio.WithDecryptionKey(keys[""])); err == nil || len(records) != 3 {
+		t.Fatal("expected an error after the chunks of the key:", records, err)
+	}
+
+	if _, err := recordio.NewWriter(io.Discard, -1, -1, recordio.WithEncryption(keys[""]), recordio.WithKeyID(strings.Repeat("x", 256))).Write(nil); err == nil {
+		t.Fatal("expected an error for a key ID of 256 bytes")
+	}
+}
+
+// xorKMS wraps data keys by XOR with a master key, counting calls.
+type xorKMS struct {
+	master             []byte
+	encrypts, decrypts int
+}
+
+func (k *xorKMS) EncryptDataKey(dataKey []byte) ([]byte, error) {
+	k.encrypts++
+	return k.xor(dataKey), nil
+}
+
+func (k *xorKMS) DecryptDataKey(wrapped []byte) ([]byte, error) {
+	k.decrypts++
+	return k.xor(wrapped), nil
+}
+
+func (k *xorKMS) xor(key []byte) []byte {
+	out := make([]byte, len(key))
+	for i := range key {
+		out[i] = key[i] ^ k.master[i%len(k.master)]
+	}
+	return out
+}
+
+func TestKMSEnvelope(t *testing.T) {
+	kms := &xorKMS{master: []byte("master key")}
+	f, err := os.Create(filepath.Join(t.TempDir(), "enveloped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := recordio.NewWriter(f, 10, -1, recordio.WithKMS(kms), recordio.WithFooterIndex(true))
+	for i := 0; i < 3; i++ {
+		w.Write([]byte(fmt.Sprintf("secret-%d", i)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if kms.encrypts != 1 || kms.decrypts != 0 {
+		t.Fatal("unexpected KMS calls:", kms.encrypts, kms.decrypts)
+	}
+
+	read := func(opts ...recordio.ReadOption) ([]string, error) {
+		idx, err := recordio.LoadIndexFromFooter(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := recordio.NewRangeScanner(f, idx, -1, -1, opts...)
+		var records []string
+		for s.Scan() {
+			records = append(records, string(s.Record()))
+		}
+		return records, s.Err()
+	}
+	if _, err := read(); !errors.Is(err, recordio.ErrEncrypted) {
+		t.Fatal("expected ErrEncrypted without the KMS, got", err)
+	}
+
+	aw, err := recordio.NewAppendWriter(f, 10, -1, recordio.WithKMS(kms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw.Write([]byte("secret-3"))
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if kms.encrypts != 1 || kms.decrypts != 1 {
+		t.Fatal("unexpected KMS calls of NewAppendWriter:", kms.encrypts, kms.decrypts)
+	}
+
+	records, err := read(recordio.WithReadKMS(kms), recordio.WithDecodeParallelism(4))
+	if err != nil || strings.Join(records, " ") != "secret-0 secret-1 secret-2 secret-3" {
+		t.Fatal("unexpected records:", records, err)
+	}
+	if kms.decrypts != 2 {
+		t.Fatal("expected the reader to unwrap the data key once, got", kms.decrypts-1)
+	}
+
+	buf, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf, []byte("secret")) {
+		t.Fatal("records are stored in plaintext")
+	}
+}
+
+func TestSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.New(rand.NewSource(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, opts ...recordio.Option) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		w := recordio.NewWriter(f, 10, -1, opts...)
+		for i := 0; i < 5; i++ {
+			w.Write([]byte(fmt.Sprintf("record-%d", i)))
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for _, path := range []string{
+		write("footer", recordio.WithFooterIndex(true), recordio.WithMetadata(map[string]string{"a": "b"})),
+		write("sidecar"),
+	} {
+		if err := recordio.VerifyFile(path, pub); err != recordio.ErrNoSignature {
+			t.Fatal("expected ErrNoSignature before signing, got", err)
+		}
+		if err := recordio.SignFile(path, priv); err != nil {
+			t.Fatal(err)
+		}
+		if err := recordio.VerifyFile(path, pub); err != nil {
+			t.Fatal(path, err)
+		}
+		if err := recordio.VerifyFile(path, otherPub); err != recordio.ErrBadSignature {
+			t.Fatal("expected ErrBadSignature for another key, got", err)
+		}
+
+		// The records are still readable.
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx, err := recordio.LoadIndex(f)
+		if err != nil || idx.NumRecords != 5 {
+			t.Fatal("unexpected index after signing:", idx, err)
+		}
+
+		// A detached signature of the same file verifies too.
+		sig, err := recordio.Sign(f, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := recordio.VerifySignature(f, pub, sig); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		// Flip a byte of the last chunk.
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := bytes.LastIndex(buf, []byte("record-4"))
+		buf[i] ^= 1
+		if err := os.WriteFile(path, buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := recordio.VerifyFile(path, pub); err != recordio.ErrBadSignature {
+			t.Fatal("expected ErrBadSignature for a modified file, got", err)
+		}
+	}
+}
+
+func TestReuseBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, 100, recordio.Gzip)
+	var want []string
+	for i := 0; i < 200; i++ {
+		want = append(want, fmt.Sprintf("record-%03d-%s", i, strings.Repeat("x", i%17)))
+		w.Write([]byte(want[i]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	idx, err := recordio.LoadIndex(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.NumChunks() < 10 {
+		t.Fatal("expected many chunks, got", idx.NumChunks())
+	}
+
+	for _, opts := range [][]recordio.ReadOption{
+		nil,
+		{recordio.WithReuseBuffer()},
+		{recordio.WithReuseBuffer(), recordio.WithDecodeParallelism(4)},
+	} {
+		s := recordio.NewRangeScanner(r, idx, -1, -1, opts...)
+		var got [][]byte
+		for s.Scan() {
+			rec := s.Record()
+			if cap(rec) != len(rec) {
+				t.Fatal("record slice has spare capacity:", len(rec), cap(rec))
+			}
+			if string(rec) != want[len(got)] {
+				t.Fatal("unexpected record:", string(rec))
+			}
+			got = append(got, s.RecordCopy())
+		}
+		if s.Err() != nil || len(got) != len(want) {
+			t.Fatal("unexpected scan:", len(got), s.Err())
+		}
+		for i, rec := range got {
+			if string(rec) != want[i] {
+				t.Fatal("copied record overwritten:", i, string(rec))
+			}
+		}
+	}
+
+	// A ShuffleReader keeps copies of the records, and chunks dropped by
+	// the prefetcher on Seek are reused.
+	s := recordio.NewRangeScanner(r, idx, -1, -1, recordio.WithReuseBuffer(), recordio.WithDecodeParallelism(4))
+	for i := 0; i < 5 && s.Scan(); i++ {
+	}
+	if err := s.Seek(0); err != nil {
+		t.Fatal(err)
+	}
+	shuffled := recordio.NewShuffleReader(s, 50, 0, 1)
+	var got []string
+	for shuffled.Scan() {
+		got = append(got, string(shuffled.Record()))
+	}
+	sort.Strings(got)
+	if shuffled.Err() != nil || !reflect.DeepEqual(got, want) {
+		t.Fatal("unexpected shuffled records:", len(got), shuffled.Err())
+	}
+	s.Close()
+}
+
+func TestEncryptedRepairAndVerify(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Gzip, recordio.WithEncryption(key), recordio.WithMaxChunkRecords(10))
+	for i := 0; i < 100; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := recordio.LoadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Verified without the key.
+	rep, err := recordio.Verify(bytes.NewReader(buf.Bytes()))
+	if err != nil || !rep.OK() || len(rep.Chunks) != 10 {
+		t.Fatal("unexpected verification without the key:", rep, err)
+	}
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[idx.ChunkOffsets[4]-1] ^= 1 // the last byte of chunk 3.
+	if rep, err := recordio.Verify(bytes.NewReader(corrupted)); err != nil || rep.OK() || rep.Chunks[3].Err == nil {
+		t.Fatal("expected a checksum error of chunk 3:", rep, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "encrypted")
+	for _, opts := range [][]recordio.ReadOption{nil, {recordio.WithDecryptionKey(key)}} {
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rep, err := recordio.Repair(f, opts...); err != nil || rep.BytesDropped != 0 || rep.NumRecords != 100 {
+			t.Fatal("unexpected repair of an intact encrypted file:", rep, err)
+		}
+
+		if err := f.Truncate(idx.ChunkOffsets[9] + 30); err != nil {
+			t.Fatal(err)
+		}
+		rep, err := recordio.Repair(f, opts...)
+		if err != nil || rep.Size != idx.ChunkOffsets[9] || rep.NumRecords != 90 {
+			t.Fatal("unexpected repair of a cut encrypted file:", rep, err)
+		}
+		f.Close()
+	}
+
+	// A wrong key is an error, not corruption.
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := recordio.Repair(f, recordio.WithDecryptionKey(bytes.Repeat([]byte{8}, 32))); err == nil {
+		t.Fatal("expected an error for a wrong key")
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != int64(buf.Len()) {
+		t.Fatal("file changed by the repair with a wrong key:", err)
+	}
+}
+
+func TestAppendPaddleToFooter(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "footer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := recordio.NewWriter(f, -1, recordio.Gzip, recordio.WithFooterIndex(true))
+	for i := 0; i < 5; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	aw, err := recordio.NewAppendWriter(f, -1, recordio.Gzip, recordio.WithPaddleCompat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 5; i < 10; i++ {
+		aw.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := recordio.LoadIndexFromFooter(f); err != recordio.ErrNoFooter {
+		t.Fatal("expected the old footer to be dropped, got", err)
+	}
+	rep, err := recordio.Verify(f)
+	if err != nil || !rep.OK() || rep.NumRecords != 10 {
+		t.Fatal("unexpected file after appending:", rep, err)
+	}
+}
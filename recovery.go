@@ -0,0 +1,192 @@
+package recordio
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// SkippedRange is a byte range of a file skipped by a RecoveryScanner,
+// since no valid chunk starts in it.
+type SkippedRange struct {
+	Offset int64
+	Length int64
+	Err    error // why reading the chunk at Offset failed.
+}
+
+// RecoveryScanner scans the records of a possibly corrupted recordio
+// file sequentially, without an Index.  When a chunk fails to parse or
+// to pass its checksum, it looks for the next chunk magic number at
+// which a valid chunk starts and resumes from there, reporting the
+// bytes in between to a callback, so that one bad chunk costs only its
+// own records.  Since read errors look like corruption to it, it is
+// meant for salvaging files rather than for regular reads.
+type RecoveryScanner struct {
+	reader io.ReadSeeker
+	onSkip func(SkippedRange)
+	chunk  *Chunk
+	cur    int   // index of the current record in chunk.
+	offset int64 // of the next chunk.
+	end    int64 // of the chunks; -1 until known.
+	err    error
+	opts   *readOptions
+}
+
+// NewRecoveryScanner creates a scanner reading r from its start.
+// onSkip, if not nil, is called with every skipped byte range, in
+// order.
+func NewRecoveryScanner(r io.ReadSeeker, onSkip func(SkippedRange), opts ...ReadOption) *RecoveryScanner {
+	return &RecoveryScanner{reader: r, onSkip: onSkip, chunk: &Chunk{}, end: -1, opts: newReadOptions(opts)}
+}
+
+// Scan moves the cursor forward for one record, reading the next valid
+// chunk if the current one is exhausted.
+func (s *RecoveryScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	if s.end < 0 {
+		if s.err = s.start(); s.err != nil {
+			return false
+		}
+	}
+
+	s.cur++
+	for s.cur >= len(s.chunk.records) {
+		if s.offset >= s.end {
+			s.err = io.EOF
+			return false
+		}
+
+		ch, next, e := s.readChunk(s.offset)
+		if e != nil {
+			var resume int64
+			ch, next, resume = s.resync(s.offset + 1)
+			s.skip(s.offset, resume, e)
+		}
+
+		s.chunk, s.offset, s.cur = ch, next, 0
+		if ch == nil {
+			s.chunk = &Chunk{}
+		}
+	}
+
+	return true
+}
+
+// Record returns the record under the current cursor.
+func (s *RecoveryScanner) Record() []byte {
+	return s.chunk.records[s.cur]
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, as written by Writer.WriteWithTimestamp, or the zero Time if
+// it has none.
+func (s *RecoveryScanner) Timestamp() time.Time {
+	return s.chunk.timestamp(s.cur)
+}
+
+// Key returns the key of the record under the current cursor, as
+// written by Writer.WriteKV, or nil if it has none.
+func (s *RecoveryScanner) Key() []byte {
+	return s.chunk.key(s.cur)
+}
+
+// Tag returns the type tag of the record under the current cursor, as
+// written by Writer.WriteTagged, or 0 if it has none.
+func (s *RecoveryScanner) Tag() uint16 {
+	return s.chunk.tag(s.cur)
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// Scanner.  Corruption is reported to the callback instead.
+func (s *RecoveryScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	return s.err
+}
+
+// start finds where the chunks start and end, skipping the file header
+// and the footer, if any.
+func (s *RecoveryScanner) start() error {
+	size, e := s.reader.Seek(0, io.SeekEnd)
+	if e != nil {
+		return fmt.Errorf("Failed to seek file end: %v", e)
+	}
+
+	s.end = size
+	if _, footer, e := readFooter(s.reader); e == nil {
+		s.end = footer
+	}
+
+	if _, e = s.reader.Seek(0, io.SeekStart); e != nil {
+		return fmt.Errorf("Failed to seek file start: %v", e)
+	}
+
+	fh, e := readFileHeader(s.reader)
+	if e != nil {
+		// Chunks needing the dictionary fail, the others are
+		// recovered.
+		s.opts.header.put(nil)
+		return nil
+	}
+
+	s.opts.header.put(fh)
+	s.offset, e = s.reader.Seek(0, io.SeekCurrent)
+	return e
+}
+
+// readChunk reads the chunk at offset and returns it with the offset
+// of the next chunk.
+func (s *RecoveryScanner) readChunk(offset int64) (*Chunk, int64, error) {
+	hdr, data, e := readRawChunk(s.reader, offset, s.opts)
+	if e != nil {
+		return nil, 0, e
+	}
+
+	next := offset + hdr.size() + int64(hdr.compressedSize)
+	if next > s.end {
+		return nil, 0, fmt.Errorf("Chunk at %d exceeds the file", offset)
+	}
+
+	ch, e := decodeChunk(hdr, data, offset, s.opts)
+	return ch, next, e
+}
+
+// resync returns the first valid chunk starting at or after from, the
+// offset of the chunk after it, and its own offset.  It returns a nil
+// chunk at the end of the chunks if there is none.
+func (s *RecoveryScanner) resync(from int64) (*Chunk, int64, int64) {
+	buf := make([]byte, probeWindow+3)
+	for pos := from; pos < s.end; {
+		if _, e := s.reader.Seek(pos, io.SeekStart); e != nil {
+			break
+		}
+
+		n, _ := io.ReadFull(s.reader, buf)
+		i := indexMagic(buf[:n])
+		if i < 0 {
+			if n < len(buf) {
+				break
+			}
+			pos += probeWindow
+			continue
+		}
+
+		offset := pos + int64(i)
+		if ch, next, e := s.readChunk(offset); e == nil {
+			return ch, next, offset
+		}
+		pos = offset + 1
+	}
+	return nil, s.end, s.end
+}
+
+func (s *RecoveryScanner) skip(from, to int64, e error) {
+	if s.onSkip != nil {
+		s.onSkip(SkippedRange{Offset: from, Length: to - from, Err: e})
+	}
+}
@@ -0,0 +1,132 @@
+package recordio
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// RepairReport tells what Repair kept and dropped of a file.
+type RepairReport struct {
+	Size       int64 // of the file after repair.
+	NumChunks  int   // kept.
+	NumRecords int   // kept.
+
+	BytesDropped int64
+	// RecordsDropped counts the records of the dropped chunks whose
+	// headers were still readable, so more may have been lost.
+	RecordsDropped int
+}
+
+// Repair makes the recordio file f readable again after, e.g., a
+// writer crashed in the middle of a chunk: it reads the chunks from
+// the start, verifying their checksums, and truncates f after the last
+// valid one, dropping everything from the first broken chunk on.  A
+// valid footer index at the end of f is kept; an invalid one is
+// dropped, leaving a file without a footer.  Files with a broken file
+// header cannot be repaired.  Use a RecoveryScanner to salvage the
+// records after a broken chunk instead.
+//
+// Only corruption, like a bad magic number, a checksum mismatch or
+// truncated data, makes Repair drop chunks.  The chunks whose checksums
+// hold are decoded with opts, as by readers; errors decoding them,
+// like a wrong key of WithDecryptionKey, an unknown compressor or a
+// chunk over WithMaxDecompressedChunkSize, are returned, leaving f
+// untouched, as are chunks in a newer version of the format.  Chunks
+// encrypted by WithEncryption are decoded only if opts have a key.
+func Repair(f *os.File, opts ...ReadOption) (RepairReport, error) {
+	var rep RepairReport
+
+	size, e := f.Seek(0, io.SeekEnd)
+	if e != nil {
+		return rep, e
+	}
+
+	if _, e = f.Seek(0, io.SeekStart); e != nil {
+		return rep, e
+	}
+	fh, e := readFileHeader(f)
+	if e != nil {
+		return rep, fmt.Errorf("Failed to read file header: %v", e)
+	}
+	o := newReadOptions(opts)
+	o.header.put(fh)
+
+	offset, e := f.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return rep, e
+	}
+
+	for offset < size {
+		hdr, e := headerAt(f, offset)
+		if e == errFooter {
+			if _, footer, e := readFooter(f); e == nil && footer == offset {
+				offset = size
+			}
+			break
+		}
+		if e != nil {
+			if corrupted(e) {
+				break
+			}
+			return rep, fmt.Errorf("Failed to parse chunk header at %d: %v", offset, e)
+		}
+
+		next := offset + hdr.size() + int64(hdr.compressedSize)
+		if next > size {
+			break
+		}
+
+		if _, e = f.Seek(offset+hdr.size(), io.SeekStart); e != nil {
+			return rep, e
+		}
+		data, e := readChunkData(f, hdr)
+		if e != nil {
+			return rep, e
+		}
+		if e = hdr.verify(data.Bytes()); e == errChecksum {
+			break
+		} else if e != nil {
+			return rep, fmt.Errorf("Failed to verify chunk at %d: %v", offset, e)
+		}
+		if hdr.flags&flagEncrypted == 0 || o.hasKey() {
+			if _, e = decodeChunk(hdr, data, offset, o); e != nil {
+				return rep, fmt.Errorf("Failed to decode chunk at %d: %v", offset, e)
+			}
+		}
+
+		rep.NumChunks++
+		rep.NumRecords += int(hdr.numRecords)
+		offset = next
+	}
+
+	rep.Size = offset
+	rep.BytesDropped = size - offset
+	if rep.BytesDropped == 0 {
+		return rep, nil
+	}
+
+	// Count the records of the dropped chunks.
+	for next := offset; next < size; {
+		hdr, e := headerAt(f, next)
+		if e != nil {
+			break
+		}
+		rep.RecordsDropped += int(hdr.numRecords)
+		next += hdr.size() + int64(hdr.compressedSize)
+	}
+
+	if e = f.Truncate(offset); e != nil {
+		return rep, fmt.Errorf("Failed to truncate file: %v", e)
+	}
+	if e = f.Sync(); e != nil {
+		return rep, fmt.Errorf("Failed to sync: %v", e)
+	}
+	return rep, nil
+}
+
+// corrupted tells whether e, of parsing a chunk header, means that the
+// file is broken there, rather than, e.g., in a newer format.
+func corrupted(e error) bool {
+	return e == errMagic || e == errFileHeader || e == io.EOF || e == io.ErrUnexpectedEOF
+}
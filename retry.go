@@ -0,0 +1,84 @@
+package recordio
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy tells a RetryingReaderAt which errors to retry, and how
+// often.  The zero value retries transient network errors 5 times,
+// starting after 100ms and doubling the backoff up to 10s.
+type RetryPolicy struct {
+	// MaxAttempts bounds the attempts of a read, the first included;
+	// <= 0 means 5.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled before each
+	// further one up to MaxBackoff; <= 0 means 100ms and 10s.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable tells whether an error is transient.  nil means
+	// timeouts, and refused, reset or aborted connections.
+	Retryable func(error) bool
+}
+
+// RetryingReaderAt is an io.ReaderAt retrying the transient errors of
+// another, like those of a RangeReaderAt or an HTTPReaderAt over a
+// flaky network, with exponential backoff, so that a long scan does
+// not die on the first blip.  A read failing MaxAttempts times returns
+// its last error.  It is safe for concurrent use if the underlying
+// io.ReaderAt is.
+type RetryingReaderAt struct {
+	r      io.ReaderAt
+	policy RetryPolicy
+}
+
+// NewRetryingReaderAt creates a RetryingReaderAt of r.
+func NewRetryingReaderAt(r io.ReaderAt, policy RetryPolicy) *RetryingReaderAt {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 5
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = 100 * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 10 * time.Second
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = transient
+	}
+	return &RetryingReaderAt{r: r, policy: policy}
+}
+
+// ReadAt implements io.ReaderAt.  A retry reads only what the failed
+// attempt left.
+func (r *RetryingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	backoff := r.policy.Backoff
+	for attempt := 1; ; attempt++ {
+		m, e := r.r.ReadAt(p[n:], off+int64(n))
+		n += m
+		if e == nil || e == io.EOF || attempt >= r.policy.MaxAttempts || !r.policy.Retryable(e) {
+			return n, e
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > r.policy.MaxBackoff {
+			backoff = r.policy.MaxBackoff
+		}
+	}
+}
+
+// transient tells whether e is a timeout or a broken connection.
+func transient(e error) bool {
+	var ne net.Error
+	if errors.As(e, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(e, syscall.ECONNRESET) ||
+		errors.Is(e, syscall.ECONNREFUSED) ||
+		errors.Is(e, syscall.ECONNABORTED) ||
+		errors.Is(e, syscall.EPIPE)
+}
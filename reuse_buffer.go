@@ -0,0 +1,56 @@
+package recordio
+
+import (
+	"bytes"
+	"sync"
+)
+
+// WithReuseBuffer makes a RangeScanner, and the DatasetScanner of a
+// Dataset, reuse the buffers of a chunk for the following chunks once it
+// has moved past the chunk, instead of allocating new ones for every
+// chunk.  The records of Record are then overwritten by later chunks, so
+// that they must not be kept, or passed to what keeps them, like
+// Writer.Write, after the next Scan, unless copied by RecordCopy.  The
+// scanners of the same option, like those of the shards of a Dataset,
+// share its buffers.  It has no effect with WithChunkCache, whose chunks
+// outlive the scan.
+func WithReuseBuffer() ReadOption {
+	p := &bufferPool{}
+	return func(o *readOptions) {
+		o.bufs = p
+	}
+}
+
+// bufferPool holds the buffers of chunks released by the scanners of
+// WithReuseBuffer.  A nil *bufferPool allocates the buffers.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+// get returns an empty buffer.
+func (p *bufferPool) get() *bytes.Buffer {
+	if p != nil {
+		if b, ok := p.pool.Get().(*bytes.Buffer); ok {
+			return b
+		}
+	}
+	return new(bytes.Buffer)
+}
+
+// put returns b, which must no longer be used, to p.
+func (p *bufferPool) put(b *bytes.Buffer) {
+	if p != nil && b != nil {
+		b.Reset()
+		p.pool.Put(b)
+	}
+}
+
+// releaseChunk returns the buffer of the records of ch to the pool of
+// WithReuseBuffer, once ch is no longer scanned.
+func (o *readOptions) releaseChunk(ch *Chunk) {
+	if o.bufs == nil || o.cache != nil || ch == nil || ch.buf == nil {
+		return
+	}
+	o.bufs.put(ch.buf)
+	ch.buf = nil
+}
@@ -0,0 +1,101 @@
+package recordio
+
+import (
+	"io"
+	"time"
+)
+
+// ReverseScanner scans records in a specified range within [0,
+// numRecords) from the last to the first, loading chunks in reverse
+// order.  It suits log-structured files where the newest records are
+// at the end.
+type ReverseScanner struct {
+	reader          io.ReadSeeker
+	index           *Index
+	start, end, cur int
+	chunkIndex      int
+	chunkStart      int // index of the first record in chunk.
+	chunk           *Chunk
+	err             error
+	opts            *readOptions
+}
+
+// NewReverseScanner creates a scanner that reads the records in the
+// range [start, start+len) backwards, from start+len-1 down to start.
+// If start < 0, the range begins at the beginning of the file.  If len
+// < 0, it extends till the end of file.  For the last n records, use
+// NewReverseScanner(r, index, index.NumRecords-n, -1).
+func NewReverseScanner(r io.ReadSeeker, index *Index, start, len int, opts ...ReadOption) *ReverseScanner {
+	if start < 0 {
+		start = 0
+	}
+	if len < 0 || start+len >= index.NumRecords {
+		len = index.NumRecords - start
+	}
+
+	return &ReverseScanner{
+		reader:     r,
+		index:      index,
+		start:      start,
+		end:        start + len,
+		cur:        start + len, // The intial status required by Scan.
+		chunkIndex: -1,
+		chunk:      &Chunk{},
+		opts:       newReadOptions(opts),
+	}
+}
+
+// Scan moves the cursor backward for one record and loads the chunk
+// containing the record if not yet.
+func (s *ReverseScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	s.cur--
+
+	if s.cur < s.start {
+		s.err = io.EOF
+	} else if s.chunkIndex < 0 || s.cur < s.chunkStart {
+		ci, ri := s.index.Locate(s.cur)
+		s.chunkIndex = ci
+		s.chunkStart = s.cur - ri
+		s.chunk, s.err = parseChunk(s.reader, s.index.ChunkOffsets[ci], s.opts)
+	}
+
+	return s.err == nil
+}
+
+// Record returns the record under the current cursor.
+func (s *ReverseScanner) Record() []byte {
+	return s.chunk.records[s.cur-s.chunkStart]
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, as written by Writer.WriteWithTimestamp, or the zero Time if
+// it has none.
+func (s *ReverseScanner) Timestamp() time.Time {
+	return s.chunk.timestamp(s.cur - s.chunkStart)
+}
+
+// Key returns the key of the record under the current cursor, as
+// written by Writer.WriteKV, or nil if it has none.
+func (s *ReverseScanner) Key() []byte {
+	return s.chunk.key(s.cur - s.chunkStart)
+}
+
+// Tag returns the type tag of the record under the current cursor, as
+// written by Writer.WriteTagged, or 0 if it has none.
+func (s *ReverseScanner) Tag() uint16 {
+	return s.chunk.tag(s.cur - s.chunkStart)
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// Scanner.
+func (s *ReverseScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	return s.err
+}
@@ -0,0 +1,139 @@
+package recordio
+
+import (
+	"io"
+	"time"
+)
+
+// SampleScanner scans a pseudo-random subset of the records of a file
+// in file order.  Whether a record is in the subset depends only on
+// the seed and the record index, so the same seed always selects the
+// same records.  Chunks are decoded at most once, and chunks without
+// selected records not at all.
+type SampleScanner struct {
+	reader    io.ReadSeeker
+	index     *Index
+	threshold uint64 // records hashing below it are selected.
+	seed      uint64
+
+	chunkIndex int
+	chunkStart int // index of the first record in chunk.
+	chunk      *Chunk
+	selected   []int // indexes of the selected records in chunk.
+	cur        int   // index into selected.
+	err        error
+	opts       *readOptions
+}
+
+// NewSampleScanner creates a scanner that visits each record of the
+// file with probability fraction, as decided by seed.
+func NewSampleScanner(r io.ReadSeeker, index *Index, fraction float64, seed int64, opts ...ReadOption) *SampleScanner {
+	var threshold uint64
+	switch {
+	case fraction >= 1:
+		threshold = ^uint64(0)
+	case fraction > 0:
+		threshold = uint64(fraction * (1 << 63) * 2)
+	}
+
+	return &SampleScanner{
+		reader:     r,
+		index:      index,
+		threshold:  threshold,
+		seed:       uint64(seed),
+		chunkIndex: -1,
+		opts:       newReadOptions(opts),
+	}
+}
+
+// Scan moves the cursor to the next selected record, loading its
+// chunk if not yet.
+func (s *SampleScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	s.cur++
+	for s.cur >= len(s.selected) {
+		s.chunkIndex++
+		if s.chunkIndex >= s.index.NumChunks() {
+			s.err = io.EOF
+			return false
+		}
+
+		if s.chunkIndex > 0 {
+			s.chunkStart += s.index.ChunkRecords[s.chunkIndex-1]
+		}
+
+		s.selected = s.selected[:0]
+		for i := 0; i < s.index.ChunkRecords[s.chunkIndex]; i++ {
+			if s.selects(s.chunkStart + i) {
+				s.selected = append(s.selected, i)
+			}
+		}
+		s.cur = 0
+
+		if len(s.selected) > 0 {
+			s.chunk, s.err = parseChunk(s.reader, s.index.ChunkOffsets[s.chunkIndex], s.opts)
+			if s.err != nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// selects returns whether the record of the given index is in the
+// subset.
+func (s *SampleScanner) selects(recordIndex int) bool {
+	return s.threshold == ^uint64(0) || splitmix64(s.seed^uint64(recordIndex)) < s.threshold
+}
+
+// Record returns the record under the current cursor.
+func (s *SampleScanner) Record() []byte {
+	return s.chunk.records[s.selected[s.cur]]
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, as written by Writer.WriteWithTimestamp, or the zero Time if
+// it has none.
+func (s *SampleScanner) Timestamp() time.Time {
+	return s.chunk.timestamp(s.selected[s.cur])
+}
+
+// Key returns the key of the record under the current cursor, as
+// written by Writer.WriteKV, or nil if it has none.
+func (s *SampleScanner) Key() []byte {
+	return s.chunk.key(s.selected[s.cur])
+}
+
+// Tag returns the type tag of the record under the current cursor, as
+// written by Writer.WriteTagged, or 0 if it has none.
+func (s *SampleScanner) Tag() uint16 {
+	return s.chunk.tag(s.selected[s.cur])
+}
+
+// RecordIndex returns the index in the file of the record under the
+// current cursor.
+func (s *SampleScanner) RecordIndex() int {
+	return s.chunkStart + s.selected[s.cur]
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// Scanner.
+func (s *SampleScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	return s.err
+}
+
+// splitmix64 is a fast, well-mixing hash of x.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
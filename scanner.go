@@ -2,8 +2,32 @@ package recordio
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
+)
+
+// RecordScanner is the interface shared by the scanners in this
+// package, for code consuming records from any of them.
+type RecordScanner interface {
+	// Scan moves the cursor forward for one record and returns
+	// false at the end or on error.
+	Scan() bool
+	// Record returns the record under the current cursor, which may
+	// point into the buffers of the scanner, and must not be
+	// modified.
+	Record() []byte
+	// Err returns the first non-EOF error encountered by Scan.
+	Err() error
+}
+
+var (
+	_ RecordScanner = (*Scanner)(nil)
+	_ RecordScanner = (*RangeScanner)(nil)
+	_ RecordScanner = (*ReverseScanner)(nil)
+	_ RecordScanner = (*StreamScanner)(nil)
+	_ RecordScanner = (*SampleScanner)(nil)
 )
 
 // Scanner is a scanner for multiple recordio files.
@@ -47,7 +71,7 @@ func (s *Scanner) Scan() bool {
 	}
 
 	if s.curScanner == nil {
-		more, err := s.nextFile()
+		more, err := s.nextFile(0)
 		if err != nil {
 			s.err = err
 			return false
@@ -74,7 +98,7 @@ func (s *Scanner) Scan() bool {
 		}
 		s.curFile = nil
 
-		more, err := s.nextFile()
+		more, err := s.nextFile(0)
 		if err != nil {
 			s.err = err
 			return false
@@ -96,7 +120,8 @@ func (s *Scanner) Err() error {
 	return s.err
 }
 
-// Record returns the record under the current cursor.
+// Record returns the record under the current cursor, without
+// copying it, as RangeScanner.Record does.
 func (s *Scanner) Record() []byte {
 	if s.curScanner == nil {
 		return nil
@@ -105,6 +130,42 @@ func (s *Scanner) Record() []byte {
 	return s.curScanner.Record()
 }
 
+// RecordCopy returns a copy of the record under the current cursor,
+// which the caller owns.
+func (s *Scanner) RecordCopy() []byte {
+	return append([]byte{}, s.Record()...)
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, or the zero Time if it has none.
+func (s *Scanner) Timestamp() time.Time {
+	if s.curScanner == nil {
+		return time.Time{}
+	}
+
+	return s.curScanner.Timestamp()
+}
+
+// Key returns the key of the record under the current cursor, or nil
+// if it has none.
+func (s *Scanner) Key() []byte {
+	if s.curScanner == nil {
+		return nil
+	}
+
+	return s.curScanner.Key()
+}
+
+// Tag returns the type tag of the record under the current cursor, or
+// 0 if it has none.
+func (s *Scanner) Tag() uint16 {
+	if s.curScanner == nil {
+		return 0
+	}
+
+	return s.curScanner.Tag()
+}
+
 // Close release the resources.
 func (s *Scanner) Close() error {
 	s.curScanner = nil
@@ -116,7 +177,8 @@ func (s *Scanner) Close() error {
 	return nil
 }
 
-func (s *Scanner) nextFile() (bool, error) {
+// nextFile opens the next file, to scan from its start-th record.
+func (s *Scanner) nextFile(start int) (bool, error) {
 	if s.pathIdx >= len(s.paths) {
 		return false, nil
 	}
@@ -128,13 +190,24 @@ func (s *Scanner) nextFile() (bool, error) {
 		return false, err
 	}
 
-	idx, err := LoadIndex(f)
+	idx, err := LoadIndexFromFooter(f)
+	if err == ErrNoFooter {
+		_, err = f.Seek(0, io.SeekStart)
+		if err == nil {
+			idx, err = LoadIndex(f)
+		}
+	}
 	if err != nil {
 		f.Close()
 		return false, err
 	}
 
+	if start > idx.NumRecords {
+		f.Close()
+		return false, fmt.Errorf("Record index out of range: %d", start)
+	}
+
 	s.curFile = f
-	s.curScanner = NewRangeScanner(f, idx, 0, -1)
+	s.curScanner = NewRangeScanner(f, idx, start, -1)
 	return true, nil
 }
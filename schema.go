@@ -0,0 +1,81 @@
+package recordio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Kinds of schemas of Schema.Kind.
+const (
+	// SchemaProtobuf is a serialized google.protobuf.FileDescriptorSet,
+	// with the full name of the message of the records as the Name.
+	SchemaProtobuf = "protobuf"
+	// SchemaJSON is a JSON Schema document.
+	SchemaJSON = "jsonschema"
+	// SchemaAvro is an Avro schema in JSON.
+	SchemaAvro = "avro"
+)
+
+// File header entries of the Schema.
+const (
+	schemaKindKey = "schema.kind"
+	schemaNameKey = "schema.name"
+	schemaDataKey = "schema.data"
+)
+
+// Schema describes the records of a file, so that readers validate or
+// decode them without knowing their type in advance.
+type Schema struct {
+	Kind string // like SchemaProtobuf; other kinds are up to their users.
+	Name string // of the type of the records within Data; optional.
+	Data []byte
+}
+
+// WithSchema embeds s in the file header, from which ReadSchema and
+// FSFile.Schema return it.  It makes writes fail with WithPaddleCompat,
+// whose files have no file header.
+func WithSchema(s *Schema) Option {
+	return func(w *Writer) {
+		w.schema = s
+	}
+}
+
+// ReadSchema returns the Schema embedded in the recordio file r by
+// WithSchema, or nil if there is none.
+func ReadSchema(r io.ReadSeeker) (*Schema, error) {
+	if _, e := r.Seek(0, io.SeekStart); e != nil {
+		return nil, e
+	}
+	fh, e := readFileHeader(r)
+	if e != nil {
+		return nil, e
+	}
+	return fh.schema(), nil
+}
+
+// schema returns the Schema in the entries of h, or nil.
+func (h *fileHeader) schema() *Schema {
+	kind := h.get(schemaKindKey)
+	if kind == nil {
+		return nil
+	}
+	return &Schema{Kind: string(kind), Name: string(h.get(schemaNameKey)), Data: h.get(schemaDataKey)}
+}
+
+// setSchema stores s in the entries of h.
+func (h *fileHeader) setSchema(s *Schema) {
+	h.set(schemaKindKey, []byte(s.Kind))
+	if s.Name != "" {
+		h.set(schemaNameKey, []byte(s.Name))
+	}
+	h.set(schemaDataKey, s.Data)
+}
+
+// checkSchema checks that the file header h embeds s, for appending.
+func (h *fileHeader) checkSchema(s *Schema) error {
+	if fs := h.schema(); fs == nil || fs.Kind != s.Kind || fs.Name != s.Name || !bytes.Equal(fs.Data, s.Data) {
+		return fmt.Errorf("Cannot append with a schema other than that of the file")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package sequencefile
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// codecs maps the class names of Hadoop compression codecs to
+// decompressors of a whole compressed buffer.
+var codecs = map[string]func(data []byte) ([]byte, error){
+	"org.apache.hadoop.io.compress.DefaultCodec": func(data []byte) ([]byte, error) {
+		zr, e := zlib.NewReader(bytes.NewReader(data))
+		if e != nil {
+			return nil, e
+		}
+		return io.ReadAll(zr)
+	},
+	"org.apache.hadoop.io.compress.GzipCodec": func(data []byte) ([]byte, error) {
+		gr, e := gzip.NewReader(bytes.NewReader(data))
+		if e != nil {
+			return nil, e
+		}
+		return io.ReadAll(gr)
+	},
+	"org.apache.hadoop.io.compress.BZip2Codec": func(data []byte) ([]byte, error) {
+		return io.ReadAll(bzip2.NewReader(bytes.NewReader(data)))
+	},
+	"org.apache.hadoop.io.compress.ZStandardCodec": func(data []byte) ([]byte, error) {
+		zr, e := zstd.NewReader(bytes.NewReader(data))
+		if e != nil {
+			return nil, e
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	},
+	"org.apache.hadoop.io.compress.SnappyCodec": func(data []byte) ([]byte, error) {
+		return decodeBlocks(data, func(dst, src []byte) (int, error) {
+			n, e := snappy.DecodedLen(src)
+			if e != nil {
+				return 0, e
+			}
+			if n > len(dst) {
+				return 0, fmt.Errorf("Chunk decompresses past its block")
+			}
+			_, e = snappy.Decode(dst[:n], src)
+			return n, e
+		})
+	},
+	"org.apache.hadoop.io.compress.Lz4Codec": func(data []byte) ([]byte, error) {
+		return decodeBlocks(data, lz4.UncompressBlock)
+	},
+}
+
+// decodeBlocks decompresses data in the framing of Hadoop's
+// BlockCompressorStream, used by the Snappy and LZ4 codecs: blocks of
+//
+//	rawLength uint32 // big endian.
+//	chunks, until rawLength bytes are decompressed, of
+//		length uint32 // big endian.
+//		data   [length]byte
+//
+// where decode decompresses the data of a chunk into dst, returning the
+// number of bytes decompressed.
+func decodeBlocks(data []byte, decode func(dst, src []byte) (int, error)) ([]byte, error) {
+	var out []byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		raw := int(binary.BigEndian.Uint32(data))
+		data = data[4:]
+		if raw > maxLength {
+			return nil, fmt.Errorf("Block too large: %d bytes", raw)
+		}
+
+		start := len(out)
+		out = append(out, make([]byte, raw)...)
+		for done := 0; done < raw; {
+			if len(data) < 4 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			n := binary.BigEndian.Uint32(data)
+			data = data[4:]
+			if uint64(n) > uint64(len(data)) {
+				return nil, io.ErrUnexpectedEOF
+			}
+
+			m, e := decode(out[start+done:], data[:n])
+			if e != nil {
+				return nil, e
+			}
+			if m == 0 {
+				return nil, fmt.Errorf("Empty compressed chunk")
+			}
+			done += m
+			data = data[n:]
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,449 @@
+// Package sequencefile reads Hadoop SequenceFiles and converts them into
+// recordio files, so that code reading recordio files takes over
+// datasets stored on HDFS.
+//
+// Files of version 6, written by every Hadoop since 0.20, are read,
+// whether uncompressed, record-compressed, or block-compressed, by the
+// DefaultCodec (zlib), GzipCodec, BZip2Codec, SnappyCodec, Lz4Codec, or
+// ZStandardCodec.  A record is the value of a key/value pair; the
+// payload of a BytesWritable or a Text, or else the value as serialized
+// by its Writable.
+package sequencefile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+const (
+	version    = 6
+	syncSize   = 16
+	syncEscape = -1
+	maxLength  = 1 << 31
+)
+
+// Class names of Writables.
+const (
+	BytesWritable = "org.apache.hadoop.io.BytesWritable"
+	Text          = "org.apache.hadoop.io.Text"
+	NullWritable  = "org.apache.hadoop.io.NullWritable"
+)
+
+// ErrSync is returned when a sync marker differs from that of the file
+// header.
+var ErrSync = errors.New("sequencefile: sync marker mismatch")
+
+// Reader scans the key/value pairs of a SequenceFile.  It implements
+// recordio.RecordScanner.
+type Reader struct {
+	r *bufio.Reader
+
+	keyClass   string
+	valueClass string
+	codec      string
+	compressed bool
+	block      bool
+	decompress func(data []byte) ([]byte, error)
+	metadata   map[string]string
+	sync       [syncSize]byte
+
+	key, value, record []byte
+	keys, values       [][]byte // left in the current block.
+	err                error
+}
+
+// NewReader creates a Reader of r, reading the file header.
+func NewReader(r io.Reader) (*Reader, error) {
+	sr := &Reader{r: bufio.NewReader(r)}
+	if e := sr.readHeader(); e != nil {
+		return nil, fmt.Errorf("Failed to read SequenceFile header: %v", noEOF(e))
+	}
+	return sr, nil
+}
+
+func (r *Reader) readHeader() error {
+	var magic [4]byte
+	if _, e := io.ReadFull(r.r, magic[:]); e != nil {
+		return e
+	}
+	if string(magic[:3]) != "SEQ" {
+		return fmt.Errorf("Not a SequenceFile")
+	}
+	if magic[3] != version {
+		return fmt.Errorf("Unsupported version: %d", magic[3])
+	}
+
+	var e error
+	if r.keyClass, e = readText(r.r); e != nil {
+		return e
+	}
+	if r.valueClass, e = readText(r.r); e != nil {
+		return e
+	}
+	if r.compressed, e = readBool(r.r); e != nil {
+		return e
+	}
+	if r.block, e = readBool(r.r); e != nil {
+		return e
+	}
+	if r.compressed {
+		if r.codec, e = readText(r.r); e != nil {
+			return e
+		}
+		if r.decompress = codecs[r.codec]; r.decompress == nil {
+			return fmt.Errorf("Unsupported codec: %s", r.codec)
+		}
+	}
+
+	n, e := readInt(r.r)
+	if e != nil {
+		return e
+	}
+	if n < 0 {
+		return fmt.Errorf("Invalid number of metadata entries: %d", n)
+	}
+	r.metadata = make(map[string]string)
+	for i := 0; i < int(n); i++ {
+		k, e := readText(r.r)
+		if e != nil {
+			return e
+		}
+		if r.metadata[k], e = readText(r.r); e != nil {
+			return e
+		}
+	}
+
+	_, e = io.ReadFull(r.r, r.sync[:])
+	return e
+}
+
+// KeyClass returns the class name of the keys.
+func (r *Reader) KeyClass() string {
+	return r.keyClass
+}
+
+// ValueClass returns the class name of the values.
+func (r *Reader) ValueClass() string {
+	return r.valueClass
+}
+
+// Codec returns the class name of the compression codec, or "" if the
+// file is not compressed.
+func (r *Reader) Codec() string {
+	return r.codec
+}
+
+// BlockCompressed tells whether the file is block-compressed.
+func (r *Reader) BlockCompressed() bool {
+	return r.block
+}
+
+// Metadata returns the metadata of the file header.
+func (r *Reader) Metadata() map[string]string {
+	return r.metadata
+}
+
+// Scan reads the next key/value pair, returning false at the end of
+// the file or on error.
+func (r *Reader) Scan() bool {
+	if r.err != nil {
+		return false
+	}
+
+	if r.block {
+		for len(r.keys) == 0 {
+			if r.err = r.readBlock(); r.err != nil {
+				return false
+			}
+		}
+		r.key, r.value = r.keys[0], r.values[0]
+		r.keys, r.values = r.keys[1:], r.values[1:]
+	} else if r.err = r.readRecord(); r.err != nil {
+		return false
+	}
+
+	if r.record, r.err = Unwrap(r.valueClass, r.value); r.err != nil {
+		r.err = fmt.Errorf("Failed to read value: %v", r.err)
+		return false
+	}
+	return true
+}
+
+// readRecord reads a record of an uncompressed or record-compressed
+// file.
+func (r *Reader) readRecord() error {
+	length, e := readInt(r.r)
+	if e != nil {
+		return e
+	}
+	if length == syncEscape {
+		if e = r.readSync(); e != nil {
+			return e
+		}
+		if length, e = readInt(r.r); e != nil {
+			return e
+		}
+	}
+
+	keyLength, e := readInt(r.r)
+	if e != nil {
+		return fmt.Errorf("Failed to read record: %v", noEOF(e))
+	}
+	if keyLength < 0 || length < keyLength {
+		return fmt.Errorf("Invalid record length %d with key length %d", length, keyLength)
+	}
+
+	data := make([]byte, length)
+	if _, e = io.ReadFull(r.r, data); e != nil {
+		return fmt.Errorf("Failed to read record: %v", noEOF(e))
+	}
+	r.key, r.value = data[:keyLength], data[keyLength:]
+
+	if r.compressed {
+		if r.value, e = r.decompress(r.value); e != nil {
+			return fmt.Errorf("Failed to decompress value: %v", e)
+		}
+	}
+	return nil
+}
+
+// readBlock reads the next block of a block-compressed file: a sync
+// marker, the number of records, and the compressed buffers of the
+// lengths of keys, the keys, the lengths of values, and the values.
+func (r *Reader) readBlock() error {
+	escape, e := readInt(r.r)
+	if e != nil {
+		return e
+	}
+	if escape != syncEscape {
+		return fmt.Errorf("Failed to read block: missing sync marker")
+	}
+	if e = r.readSync(); e != nil {
+		return e
+	}
+
+	n, e := readVLong(r.r)
+	if e != nil {
+		return fmt.Errorf("Failed to read block: %v", noEOF(e))
+	}
+	if n < 0 || n > maxLength {
+		return fmt.Errorf("Invalid number of records in block: %d", n)
+	}
+
+	if r.keys, e = r.readBuffers(int(n)); e != nil {
+		return fmt.Errorf("Failed to read keys of block: %v", e)
+	}
+	if r.values, e = r.readBuffers(int(n)); e != nil {
+		return fmt.Errorf("Failed to read values of block: %v", e)
+	}
+	return nil
+}
+
+// readBuffers reads the buffer of the lengths of n keys or values and
+// the buffer of their data, splitting it.
+func (r *Reader) readBuffers(n int) ([][]byte, error) {
+	lengths, e := r.readBuffer()
+	if e != nil {
+		return nil, e
+	}
+	data, e := r.readBuffer()
+	if e != nil {
+		return nil, e
+	}
+
+	lr := bytes.NewReader(lengths)
+	parts := make([][]byte, n)
+	for i := range parts {
+		length, e := readVLong(lr)
+		if e != nil {
+			return nil, noEOF(e)
+		}
+		if length < 0 || length > int64(len(data)) {
+			return nil, fmt.Errorf("Invalid length: %d", length)
+		}
+		parts[i], data = data[:length], data[length:]
+	}
+	if len(data) > 0 || lr.Len() > 0 {
+		return nil, fmt.Errorf("Buffers longer than %d records", n)
+	}
+	return parts, nil
+}
+
+func (r *Reader) readBuffer() ([]byte, error) {
+	length, e := readVLong(r.r)
+	if e != nil {
+		return nil, noEOF(e)
+	}
+	if length < 0 || length > maxLength {
+		return nil, fmt.Errorf("Invalid buffer length: %d", length)
+	}
+
+	data := make([]byte, length)
+	if _, e = io.ReadFull(r.r, data); e != nil {
+		return nil, noEOF(e)
+	}
+	if data, e = r.decompress(data); e != nil {
+		return nil, fmt.Errorf("Failed to decompress: %v", e)
+	}
+	return data, nil
+}
+
+func (r *Reader) readSync() error {
+	var sync [syncSize]byte
+	if _, e := io.ReadFull(r.r, sync[:]); e != nil {
+		return fmt.Errorf("Failed to read sync marker: %v", noEOF(e))
+	}
+	if sync != r.sync {
+		return ErrSync
+	}
+	return nil
+}
+
+// Key returns the key read by the last Scan, as serialized by its
+// Writable.
+func (r *Reader) Key() []byte {
+	return r.key
+}
+
+// Value returns the value read by the last Scan, as serialized by its
+// Writable.
+func (r *Reader) Value() []byte {
+	return r.value
+}
+
+// Record returns the value read by the last Scan, unwrapped by Unwrap.
+func (r *Reader) Record() []byte {
+	return r.record
+}
+
+// Err returns the first error of Scan other than the end of the file.
+func (r *Reader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// Unwrap returns the bytes held by data, a Writable of the given class
+// as serialized in a SequenceFile: the payload of a BytesWritable or a
+// Text, nothing of a NullWritable, and data itself of other classes.
+func Unwrap(class string, data []byte) ([]byte, error) {
+	var n int64
+	switch class {
+	case BytesWritable:
+		if len(data) < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n, data = int64(int32(binary.BigEndian.Uint32(data))), data[4:]
+	case Text:
+		br := bytes.NewReader(data)
+		var e error
+		if n, e = readVLong(br); e != nil {
+			return nil, noEOF(e)
+		}
+		data = data[len(data)-br.Len():]
+	case NullWritable:
+		return nil, nil
+	default:
+		return data, nil
+	}
+
+	if n != int64(len(data)) {
+		return nil, fmt.Errorf("Length %d of a %d-byte %s", n, len(data), class)
+	}
+	return data, nil
+}
+
+// ToRecordIO writes the records of the SequenceFile r into w, returning
+// their number.  w is not closed.
+func ToRecordIO(w *recordio.Writer, r io.Reader) (int, error) {
+	sr, e := NewReader(r)
+	if e != nil {
+		return 0, e
+	}
+
+	n := 0
+	for sr.Scan() {
+		if _, e = w.Write(sr.Record()); e != nil {
+			return n, e
+		}
+		n++
+	}
+	return n, sr.Err()
+}
+
+func readInt(r io.Reader) (int32, error) {
+	var b [4]byte
+	if _, e := io.ReadFull(r, b[:]); e != nil {
+		return 0, e
+	}
+	return int32(binary.BigEndian.Uint32(b[:])), nil
+}
+
+func readBool(r io.ByteReader) (bool, error) {
+	b, e := r.ReadByte()
+	return b != 0, e
+}
+
+// readText reads a string serialized as a Text.
+func readText(r *bufio.Reader) (string, error) {
+	n, e := readVLong(r)
+	if e != nil {
+		return "", e
+	}
+	if n < 0 || n > maxLength {
+		return "", fmt.Errorf("Invalid string length: %d", n)
+	}
+
+	b := make([]byte, n)
+	if _, e = io.ReadFull(r, b); e != nil {
+		return "", e
+	}
+	return string(b), nil
+}
+
+// readVLong reads a variable-length integer of Hadoop's WritableUtils:
+// a value in [-112, 127] is a byte of itself; other values are a byte
+// of their sign and length, followed by their big-endian bytes, those
+// of negative values complemented.
+func readVLong(r io.ByteReader) (int64, error) {
+	b, e := r.ReadByte()
+	if e != nil {
+		return 0, e
+	}
+	first := int8(b)
+	if first >= -112 {
+		return int64(first), nil
+	}
+
+	negative := first < -120
+	n := -112 - int(first)
+	if negative {
+		n = -120 - int(first)
+	}
+
+	var v int64
+	for i := 0; i < n; i++ {
+		if b, e = r.ReadByte(); e != nil {
+			return 0, noEOF(e)
+		}
+		v = v<<8 | int64(b)
+	}
+	if negative {
+		v = ^v
+	}
+	return v, nil
+}
+
+func noEOF(e error) error {
+	if e == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return e
+}
@@ -0,0 +1,240 @@
+package sequencefile_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/sequencefile"
+)
+
+const (
+	defaultCodec = "org.apache.hadoop.io.compress.DefaultCodec"
+	snappyCodec  = "org.apache.hadoop.io.compress.SnappyCodec"
+	longWritable = "org.apache.hadoop.io.LongWritable"
+)
+
+var sync = []byte("0123456789abcdef")
+
+// seqFile writes SequenceFiles as Hadoop's SequenceFile.Writer does.
+type seqFile struct {
+	bytes.Buffer
+}
+
+func (f *seqFile) int32(v int32) {
+	binary.Write(f, binary.BigEndian, v)
+}
+
+// vlong writes v as Hadoop's WritableUtils.writeVLong.
+func (f *seqFile) vlong(v int64) {
+	if v >= -112 && v <= 127 {
+		f.WriteByte(byte(v))
+		return
+	}
+	n := -112
+	if v < 0 {
+		v, n = ^v, -120
+	}
+	var b []byte
+	for tmp := v; tmp != 0; tmp >>= 8 {
+		b = append([]byte{byte(tmp)}, b...)
+		n--
+	}
+	f.WriteByte(byte(int8(n)))
+	f.Write(b)
+}
+
+func (f *seqFile) text(s string) {
+	f.vlong(int64(len(s)))
+	f.WriteString(s)
+}
+
+func (f *seqFile) header(valueClass, codec string, block bool) {
+	f.WriteString("SEQ\x06")
+	f.text(longWritable)
+	f.text(valueClass)
+	f.WriteByte(map[bool]byte{false: 0, true: 1}[codec != ""])
+	f.WriteByte(map[bool]byte{false: 0, true: 1}[block])
+	if codec != "" {
+		f.text(codec)
+	}
+	f.int32(1)
+	f.text("source")
+	f.text("test")
+	f.Write(sync)
+}
+
+func compress(codec string, data []byte) []byte {
+	var buf bytes.Buffer
+	switch codec {
+	case defaultCodec:
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+	case snappyCodec:
+		// One block of two chunks.
+		binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+		for _, part := range [][]byte{data[:len(data)/2], data[len(data)/2:]} {
+			c := snappy.Encode(nil, part)
+			binary.Write(&buf, binary.BigEndian, uint32(len(c)))
+			buf.Write(c)
+		}
+	}
+	return buf.Bytes()
+}
+
+func key(i int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(i))
+}
+
+// bytesWritable serializes the i-th value as a BytesWritable.
+func bytesWritable(i int) []byte {
+	v := []byte(fmt.Sprintf("value %d %s", i, strings.Repeat("x", i%200)))
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(v))), v...)
+}
+
+func records(f *seqFile, codec string, n int) {
+	for i := 0; i < n; i++ {
+		if i%100 == 0 {
+			f.int32(-1)
+			f.Write(sync)
+		}
+		k, v := key(i), bytesWritable(i)
+		if codec != "" {
+			v = compress(codec, v)
+		}
+		f.int32(int32(len(k) + len(v)))
+		f.int32(int32(len(k)))
+		f.Write(k)
+		f.Write(v)
+	}
+}
+
+func blocks(f *seqFile, codec string, n, perBlock int) {
+	for first := 0; first < n; first += perBlock {
+		var keyLens, keys, valueLens, values seqFile
+		last := min(first+perBlock, n)
+		for i := first; i < last; i++ {
+			keyLens.vlong(int64(len(key(i))))
+			keys.Write(key(i))
+			valueLens.vlong(int64(len(bytesWritable(i))))
+			values.Write(bytesWritable(i))
+		}
+
+		f.int32(-1)
+		f.Write(sync)
+		f.vlong(int64(last - first))
+		for _, b := range []*seqFile{&keyLens, &keys, &valueLens, &values} {
+			c := compress(codec, b.Bytes())
+			f.vlong(int64(len(c)))
+			f.Write(c)
+		}
+	}
+}
+
+func check(t *testing.T, data []byte, n int) {
+	r, err := sequencefile.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.KeyClass() != longWritable || r.ValueClass() != sequencefile.BytesWritable || r.Metadata()["source"] != "test" {
+		t.Fatal("unexpected header:", r.KeyClass(), r.ValueClass(), r.Metadata())
+	}
+
+	i := 0
+	for r.Scan() {
+		if !bytes.Equal(r.Key(), key(i)) || !bytes.Equal(r.Value(), bytesWritable(i)) || !bytes.Equal(r.Record(), bytesWritable(i)[4:]) {
+			t.Fatal("unexpected record:", i)
+		}
+		i++
+	}
+	if r.Err() != nil || i != n {
+		t.Fatal("unexpected scan:", r.Err(), i)
+	}
+}
+
+func TestReader(t *testing.T) {
+	var f seqFile
+	f.header(sequencefile.BytesWritable, "", false)
+	records(&f, "", 250)
+	check(t, f.Bytes(), 250)
+
+	f.Reset()
+	f.header(sequencefile.BytesWritable, defaultCodec, false)
+	records(&f, defaultCodec, 250)
+	check(t, f.Bytes(), 250)
+
+	for _, codec := range []string{defaultCodec, snappyCodec} {
+		f.Reset()
+		f.header(sequencefile.BytesWritable, codec, true)
+		blocks(&f, codec, 250, 100)
+		check(t, f.Bytes(), 250)
+	}
+
+	// A broken sync marker.
+	data := append([]byte(nil), f.Bytes()...)
+	data[bytes.LastIndex(data, sync)] ^= 0xff
+	r, _ := sequencefile.NewReader(bytes.NewReader(data))
+	for r.Scan() {
+	}
+	if !errors.Is(r.Err(), sequencefile.ErrSync) {
+		t.Fatal("expected a sync error:", r.Err())
+	}
+
+	// A truncated file.
+	r, _ = sequencefile.NewReader(bytes.NewReader(f.Bytes()[:f.Len()-3]))
+	for r.Scan() {
+	}
+	if r.Err() == nil {
+		t.Fatal("expected an error of a truncated file")
+	}
+
+	if _, err := sequencefile.NewReader(strings.NewReader("SEQ\x05")); err == nil {
+		t.Fatal("expected an error of an old version")
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	var text seqFile
+	text.text(strings.Repeat("t", 300))
+	if b, err := sequencefile.Unwrap(sequencefile.Text, text.Bytes()); err != nil || string(b) != strings.Repeat("t", 300) {
+		t.Fatal("unexpected Text:", err)
+	}
+	if _, err := sequencefile.Unwrap(sequencefile.BytesWritable, []byte{0, 0, 0, 5, 'a'}); err == nil {
+		t.Fatal("expected an error of a short BytesWritable")
+	}
+	if b, err := sequencefile.Unwrap(longWritable, key(7)); err != nil || !bytes.Equal(b, key(7)) {
+		t.Fatal("unexpected LongWritable:", err)
+	}
+}
+
+func TestToRecordIO(t *testing.T) {
+	var f seqFile
+	f.header(sequencefile.BytesWritable, defaultCodec, true)
+	blocks(&f, defaultCodec, 1000, 300)
+
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(100))
+	if n, err := sequencefile.ToRecordIO(w, bytes.NewReader(f.Bytes())); err != nil || n != 1000 {
+		t.Fatal("unexpected conversion:", n, err)
+	}
+	w.Close()
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), w.Index(), 0, -1)
+	i := 0
+	for ; s.Scan(); i++ {
+		if !bytes.Equal(s.Record(), bytesWritable(i)[4:]) {
+			t.Fatal("unexpected record:", i)
+		}
+	}
+	if s.Err() != nil || i != 1000 {
+		t.Fatal("unexpected records:", s.Err(), i)
+	}
+}
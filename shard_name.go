@@ -0,0 +1,131 @@
+package recordio
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A ShardNamer returns the path of the shard-th of numShards shard
+// files, like those written by Compact.
+type ShardNamer func(shard, numShards int) string
+
+// ShardName returns the name of the shard-th of numShards shards of
+// prefix, as prefix-00007-of-00064, the names of the shards of a
+// ShardedWriter.
+func ShardName(prefix string, shard, numShards int) string {
+	return fmt.Sprintf("%s-%05d-of-%05d", prefix, shard, numShards)
+}
+
+// ShardNames returns the ShardNamer of the names of ShardName.
+func ShardNames(prefix string) ShardNamer {
+	return func(shard, numShards int) string {
+		return ShardName(prefix, shard, numShards)
+	}
+}
+
+// ParseShardName parses a name of ShardName into its prefix, shard, and
+// number of shards.
+func ParseShardName(name string) (string, int, int, error) {
+	i := strings.LastIndex(name, "-of-")
+	if i < 0 {
+		return "", 0, 0, fmt.Errorf("Not a shard name: %s", name)
+	}
+	j := strings.LastIndex(name[:i], "-")
+	if j < 0 {
+		return "", 0, 0, fmt.Errorf("Not a shard name: %s", name)
+	}
+
+	shard, ok1 := parseShardNumber(name[j+1 : i])
+	numShards, ok2 := parseShardNumber(name[i+len("-of-"):])
+	if !ok1 || !ok2 || shard >= numShards {
+		return "", 0, 0, fmt.Errorf("Not a shard name: %s", name)
+	}
+	return name[:j], shard, numShards, nil
+}
+
+// parseShardNumber parses a number of at least 5 decimal digits.
+func parseShardNumber(s string) (int, bool) {
+	if len(s) < 5 || strings.Trim(s, "0123456789") != "" {
+		return 0, false
+	}
+	n, e := strconv.Atoi(s)
+	return n, e == nil
+}
+
+// ErrMissingShards is matched, via errors.Is, by the
+// *MissingShardsError of an incomplete set of shards.
+var ErrMissingShards = errors.New("recordio: missing shards")
+
+// MissingShardsError reports the shards of a prefix missing from the
+// set found by FindShards, so that a job fails before reading any.
+type MissingShardsError struct {
+	Prefix    string
+	NumShards int
+	Missing   []int // the missing shards, in order.
+}
+
+func (e *MissingShardsError) Error() string {
+	return fmt.Sprintf("recordio: %d of %d shards of %s are missing, like %s",
+		len(e.Missing), e.NumShards, e.Prefix, ShardName(e.Prefix, e.Missing[0], e.NumShards))
+}
+
+// Unwrap returns ErrMissingShards.
+func (e *MissingShardsError) Unwrap() error {
+	return ErrMissingShards
+}
+
+// FindShards returns the paths of the shards of prefix, as named by
+// ShardName, in order.  It fails if there are none, if they disagree
+// on the number of shards, and with a *MissingShardsError if some of
+// them don't exist.
+func FindShards(prefix string) ([]string, error) {
+	return findShards(prefix, filepath.Glob)
+}
+
+// FindShardsFS is FindShards for the shards of fsys.
+func FindShardsFS(fsys fs.FS, prefix string) ([]string, error) {
+	return findShards(prefix, func(pattern string) ([]string, error) {
+		return fs.Glob(fsys, pattern)
+	})
+}
+
+func findShards(prefix string, glob func(pattern string) ([]string, error)) ([]string, error) {
+	match, e := glob(prefix + "-*-of-*")
+	if e != nil {
+		return nil, e
+	}
+
+	var paths []string
+	for _, name := range match {
+		p, shard, numShards, e := ParseShardName(name)
+		if e != nil || p != prefix {
+			continue
+		}
+
+		if paths == nil {
+			paths = make([]string, numShards)
+		} else if numShards != len(paths) {
+			return nil, fmt.Errorf("Shards of %s have different totals: %d and %d", prefix, len(paths), numShards)
+		}
+		paths[shard] = name
+	}
+
+	if paths == nil {
+		return nil, fmt.Errorf("No shards match %s", prefix)
+	}
+
+	var missing []int
+	for i, path := range paths {
+		if path == "" {
+			missing = append(missing, i)
+		}
+	}
+	if missing != nil {
+		return nil, &MissingShardsError{Prefix: prefix, NumShards: len(paths), Missing: missing}
+	}
+	return paths, nil
+}
@@ -0,0 +1,148 @@
+package recordio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ShardInfo describes a shard file written by a ShardedWriter, or
+// listed by a Manifest.
+type ShardInfo struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	NumRecords int    `json:"num_records"`
+	SHA256     string `json:"sha256,omitempty"` // in hex, of the whole file.
+}
+
+// ShardedWriter writes records into a set of shard files named
+// prefix-00000-of-00012, prefix-00001-of-00012, …, starting a new shard
+// once the current one reaches maxShardBytes.  Shards are rotated at
+// chunk boundaries, so a shard may exceed maxShardBytes by up to a
+// chunk.
+//
+// Since the total number of shards is only known at the end, shards
+// are written as prefix-00000.tmp, … and renamed by Close, which also
+// writes the list of shards as JSON into prefix.manifest.
+type ShardedWriter struct {
+	prefix        string
+	maxShardBytes int64
+	maxChunkSize  int
+	compressor    int
+	opts          []Option
+
+	f          *os.File
+	w          *Writer
+	numRecords int // in the current shard.
+	shards     []ShardInfo
+	closed     bool
+}
+
+// NewShardedWriter creates a ShardedWriter.  maxChunkSize, compressor
+// and opts are passed to NewWriter for every shard.
+func NewShardedWriter(prefix string, maxShardBytes int64, maxChunkSize, compressor int, opts ...Option) *ShardedWriter {
+	return &ShardedWriter{
+		prefix:        prefix,
+		maxShardBytes: maxShardBytes,
+		maxChunkSize:  maxChunkSize,
+		compressor:    compressor,
+		opts:          opts,
+	}
+}
+
+// Write writes a record into the current shard, creating it if
+// needed.
+func (s *ShardedWriter) Write(record []byte) (int, error) {
+	if s.closed {
+		return 0, fmt.Errorf("Cannot write since writer had been closed")
+	}
+
+	if s.w == nil {
+		f, e := os.Create(s.tempName(len(s.shards)))
+		if e != nil {
+			return 0, fmt.Errorf("Failed to create shard: %v", e)
+		}
+
+		s.f = f
+		s.w = NewWriter(f, s.maxChunkSize, s.compressor, s.opts...)
+		s.numRecords = 0
+	}
+
+	n, e := s.w.Write(record)
+	if e != nil {
+		return n, e
+	}
+	s.numRecords++
+
+	if s.w.offset >= s.maxShardBytes {
+		return n, s.closeShard()
+	}
+	return n, nil
+}
+
+// Shards returns the shards completed so far.  Paths are final only
+// after Close.
+func (s *ShardedWriter) Shards() []ShardInfo {
+	return append([]ShardInfo(nil), s.shards...)
+}
+
+// Close closes the current shard, renames all shards to their final
+// names and writes the manifest.
+func (s *ShardedWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	if s.w != nil {
+		if e := s.closeShard(); e != nil {
+			return e
+		}
+	}
+
+	for i := range s.shards {
+		path := ShardName(s.prefix, i, len(s.shards))
+		if e := os.Rename(s.shards[i].Path, path); e != nil {
+			return fmt.Errorf("Failed to rename shard: %v", e)
+		}
+		s.shards[i].Path = path
+	}
+
+	buf, e := json.MarshalIndent(s.shards, "", "  ")
+	if e != nil {
+		return e
+	}
+
+	if e := os.WriteFile(s.prefix+".manifest", append(buf, '\n'), 0644); e != nil {
+		return fmt.Errorf("Failed to write manifest: %v", e)
+	}
+	return nil
+}
+
+// closeShard closes the current shard and records it in s.shards.
+func (s *ShardedWriter) closeShard() error {
+	e := s.w.Close()
+	var size int64
+	if e == nil {
+		size, e = s.f.Seek(0, io.SeekCurrent)
+	}
+	if ce := s.f.Close(); e == nil {
+		e = ce
+	}
+	s.w, s.f = nil, nil
+	if e != nil {
+		return fmt.Errorf("Failed to close shard: %v", e)
+	}
+
+	s.shards = append(s.shards, ShardInfo{
+		Path:       s.tempName(len(s.shards)),
+		Size:       size,
+		NumRecords: s.numRecords,
+	})
+	return nil
+}
+
+func (s *ShardedWriter) tempName(i int) string {
+	return fmt.Sprintf("%s-%05d.tmp", s.prefix, i)
+}
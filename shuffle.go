@@ -0,0 +1,86 @@
+package recordio
+
+import "math/rand"
+
+const defaultShuffleRecords = 1024
+
+// ShuffleReader yields the records of a RecordScanner in a shuffled
+// order, like the shuffle buffers of TFRecord and PyTorch loaders.  It
+// keeps a bounded buffer of records and outputs a random buffered
+// record each time it reads a new one, so records move at most about
+// the size of the buffer from their position in the source.
+type ShuffleReader struct {
+	src         RecordScanner
+	rand        *rand.Rand
+	maxRecords  int
+	maxBytes    int
+	buf         [][]byte
+	bytes       int // sum of record lengths in buf.
+	record      []byte
+	srcFinished bool
+}
+
+// NewShuffleReader creates a ShuffleReader over src, buffering at most
+// maxRecords records and maxBytes bytes of records; a limit <= 0 means
+// no such limit, and if both limits are <= 0, a buffer of 1024 records
+// is used.  The same seed and source give the same order.
+func NewShuffleReader(src RecordScanner, maxRecords, maxBytes int, seed int64) *ShuffleReader {
+	if maxRecords <= 0 && maxBytes <= 0 {
+		maxRecords = defaultShuffleRecords
+	}
+
+	return &ShuffleReader{
+		src:        src,
+		rand:       rand.New(rand.NewSource(seed)),
+		maxRecords: maxRecords,
+		maxBytes:   maxBytes,
+	}
+}
+
+// Scan moves the cursor to the next record in the shuffled order.
+func (s *ShuffleReader) Scan() bool {
+	for !s.srcFinished && !s.full() {
+		if !s.src.Scan() {
+			s.srcFinished = true
+			break
+		}
+
+		// Copy the record, lest it keep the whole chunk of a
+		// zero-copy Record in memory, beyond maxBytes.
+		r := append([]byte(nil), s.src.Record()...)
+		s.buf = append(s.buf, r)
+		s.bytes += len(r)
+	}
+
+	if len(s.buf) == 0 || s.src.Err() != nil {
+		s.record = nil
+		return false
+	}
+
+	i := s.rand.Intn(len(s.buf))
+	last := len(s.buf) - 1
+	s.record = s.buf[i]
+	s.buf[i] = s.buf[last]
+	s.buf[last] = nil
+	s.buf = s.buf[:last]
+	s.bytes -= len(s.record)
+	return true
+}
+
+// full returns whether the buffer has reached a limit.  A single
+// record over maxBytes is still buffered.
+func (s *ShuffleReader) full() bool {
+	return (s.maxRecords > 0 && len(s.buf) >= s.maxRecords) ||
+		(s.maxBytes > 0 && len(s.buf) > 0 && s.bytes >= s.maxBytes)
+}
+
+// Record returns the record under the current cursor.
+func (s *ShuffleReader) Record() []byte {
+	return s.record
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// source scanner.
+func (s *ShuffleReader) Err() error {
+	return s.src.Err()
+}
@@ -0,0 +1,185 @@
+package recordio
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// signatureKey is the metadata key of the signature of SignFile in the
+// footer index.
+const signatureKey = "signature.ed25519"
+
+// signatureDomain prefixes the messages signed by Sign, so that their
+// signatures are not valid for other uses of the key.
+const signatureDomain = "recordio signature v1\x00"
+
+// SignatureSuffix is appended to the path of a recordio file without a
+// footer index to name the sidecar file of its signature by SignFile.
+const SignatureSuffix = ".sig"
+
+// ErrNoSignature is returned by VerifySignature and VerifyFile for
+// files without a signature.
+var ErrNoSignature = errors.New("recordio: no signature")
+
+// ErrBadSignature is returned by VerifySignature and VerifyFile for
+// signatures not of the public key or not of the chunks of the file,
+// like those of files modified or appended to after being signed.
+var ErrBadSignature = errors.New("recordio: invalid signature")
+
+// Sign returns the Ed25519 signature by priv of the recordio file r,
+// for consumers of published datasets to authenticate their origin.  It
+// signs the SHA-256 checksums of the file header and of every chunk, as
+// stored, which cover the records and their fields, so that it reads
+// the whole file once.  The footer index is not signed, and can hold
+// the signature, as stored by SignFile.  Otherwise, the signature is
+// detached, for the caller to publish along with the file.
+func Sign(r io.ReadSeeker, priv ed25519.PrivateKey) ([]byte, error) {
+	msg, e := signedMessage(r)
+	if e != nil {
+		return nil, e
+	}
+	return ed25519.Sign(priv, msg), nil
+}
+
+// VerifySignature checks that sig is the signature of Sign by the key
+// of pub of the recordio file r, or, if sig is nil, the signature
+// stored in the footer index of r by SignFile.  It returns
+// ErrBadSignature if not.
+func VerifySignature(r io.ReadSeeker, pub ed25519.PublicKey, sig []byte) error {
+	if sig == nil {
+		idx, e := LoadIndexFromFooter(r)
+		if e == ErrNoFooter {
+			return ErrNoSignature
+		}
+		if e != nil {
+			return e
+		}
+		if sig, e = decodeSignature(idx.Metadata()[signatureKey]); e != nil {
+			return e
+		}
+	}
+
+	msg, e := signedMessage(r)
+	if e != nil {
+		return e
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// SignFile signs the recordio file path by Sign, and stores the
+// signature in its footer index, if any, or in the sidecar file of
+// path and SignatureSuffix otherwise.  Signing the file again replaces
+// the signature.
+func SignFile(path string, priv ed25519.PrivateKey) error {
+	f, e := os.OpenFile(path, os.O_RDWR, 0)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	sig, e := Sign(f, priv)
+	if e != nil {
+		return e
+	}
+
+	if _, e = LoadIndexFromFooter(f); e == ErrNoFooter {
+		encoded := base64.StdEncoding.EncodeToString(sig) + "\n"
+		if e = os.WriteFile(path+SignatureSuffix, []byte(encoded), 0644); e != nil {
+			return fmt.Errorf("Failed to write signature: %v", e)
+		}
+		return nil
+	}
+	if e != nil {
+		return e
+	}
+
+	// Append no records, rewriting the footer with the signature.
+	w, e := NewAppendWriter(f, -1, -1)
+	if e != nil {
+		return e
+	}
+	if e = w.SetMetadata(signatureKey, base64.StdEncoding.EncodeToString(sig)); e != nil {
+		w.Close()
+		return e
+	}
+	return w.Close()
+}
+
+// VerifyFile checks the signature of the recordio file path stored by
+// SignFile, in its footer index or in its sidecar file, as
+// VerifySignature does.
+func VerifyFile(path string, pub ed25519.PublicKey) error {
+	f, e := os.Open(path)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+
+	if e = VerifySignature(f, pub, nil); e != ErrNoSignature {
+		return e
+	}
+
+	encoded, e := os.ReadFile(path + SignatureSuffix)
+	if os.IsNotExist(e) {
+		return ErrNoSignature
+	}
+	if e != nil {
+		return fmt.Errorf("Failed to read signature: %v", e)
+	}
+	sig, e := decodeSignature(string(encoded))
+	if e != nil {
+		return e
+	}
+	return VerifySignature(f, pub, sig)
+}
+
+// decodeSignature decodes a signature of SignFile, or returns
+// ErrNoSignature if there is none.
+func decodeSignature(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, ErrNoSignature
+	}
+	sig, e := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if e != nil {
+		return nil, fmt.Errorf("Failed to decode signature: %v", e)
+	}
+	return sig, nil
+}
+
+// signedMessage returns the message of the signature of r: the SHA-256
+// checksums of the file header, if any, and of the chunks, as stored,
+// after signatureDomain.
+func signedMessage(r io.ReadSeeker) ([]byte, error) {
+	idx, end, e := loadIndexAndEnd(r)
+	if e != nil {
+		return nil, fmt.Errorf("Failed to load index: %v", e)
+	}
+
+	bounds := append([]int64{0}, idx.ChunkOffsets...)
+	bounds = append(bounds, end)
+	msg := []byte(signatureDomain)
+	for i := 0; i+1 < len(bounds); i++ {
+		from, to := bounds[i], bounds[i+1]
+		if i == 0 && from == to {
+			continue // no file header.
+		}
+		if _, e = r.Seek(from, io.SeekStart); e != nil {
+			return nil, e
+		}
+		h := sha256.New()
+		if _, e = io.CopyN(h, r, to-from); e != nil {
+			return nil, fmt.Errorf("Failed to read chunk at %d: %v", from, e)
+		}
+		msg = h.Sum(msg)
+	}
+	return msg, nil
+}
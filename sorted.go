@@ -0,0 +1,265 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// WithSortedKeys makes the Writer require the records to be written by
+// WriteKV in the order of their keys, as compared by bytes.Compare,
+// and record the first and last keys of every chunk in the Index, so
+// that Reader.Lookup and Reader.Range binary search the chunks, like
+// in an SSTable.  Equal keys are allowed.  The keys are stored in the
+// footer with WithFooterIndex.
+func WithSortedKeys(enabled bool) Option {
+	return func(w *Writer) {
+		w.sortedKeys = enabled
+	}
+}
+
+// ErrUnsortedKey is matched, via errors.Is, by the *UnsortedKeyError
+// of a record written out of the order of WithSortedKeys.
+var ErrUnsortedKey = errors.New("recordio: key out of order")
+
+// UnsortedKeyError reports a record whose key is less than that of
+// the previous record, rejected by a Writer of WithSortedKeys.
+type UnsortedKeyError struct {
+	Record   int // the index of the rejected record in the file.
+	Key      []byte
+	Previous []byte // the key of the previous record.
+}
+
+func (e *UnsortedKeyError) Error() string {
+	return fmt.Sprintf("recordio: key %q of record %d is less than the previous key %q", e.Key, e.Record, e.Previous)
+}
+
+// Unwrap returns ErrUnsortedKey.
+func (e *UnsortedKeyError) Unwrap() error {
+	return ErrUnsortedKey
+}
+
+// keyRange holds the first and the last keys of a sorted chunk.
+type keyRange struct {
+	first, last []byte
+}
+
+// keyRange returns the keyRange of a chunk of sorted keyed records,
+// with copies of the keys, which outlive the chunk.
+func (ch *Chunk) keyRange() keyRange {
+	return keyRange{
+		first: append([]byte{}, ch.keys[0]...),
+		last:  append([]byte{}, ch.keys[len(ch.keys)-1]...),
+	}
+}
+
+// lastKey returns the key of the last record written, if any.
+func (w *Writer) lastKey() ([]byte, bool) {
+	if n := len(w.chunk.keys); n > 0 {
+		return w.chunk.keys[n-1], true
+	}
+	if n := len(w.ranges); n > 0 {
+		return w.ranges[n-1].last, true
+	}
+	return nil, false
+}
+
+// checkKeyOrder checks that a record of layout with key can follow the
+// records written so far by a Writer of WithSortedKeys.
+func (w *Writer) checkKeyOrder(layout uint8, key []byte) error {
+	if layout&flagKeys == 0 {
+		return fmt.Errorf("Records written with WithSortedKeys must have keys")
+	}
+	if prev, ok := w.lastKey(); ok && bytes.Compare(key, prev) < 0 {
+		return &UnsortedKeyError{Record: w.numRecords(), Key: key, Previous: prev}
+	}
+	return nil
+}
+
+// checkChunkKeys checks that the records of ch, copied by CopyChunks,
+// can follow the records written so far, as by checkKeyOrder.
+func (w *Writer) checkChunkKeys(ch *Chunk) error {
+	if ch.keys == nil {
+		return fmt.Errorf("Records written with WithSortedKeys must have keys")
+	}
+
+	prev, ok := w.lastKey()
+	for i, key := range ch.keys {
+		if ok && bytes.Compare(key, prev) < 0 {
+			return &UnsortedKeyError{Record: w.numRecords() + i, Key: key, Previous: prev}
+		}
+		prev, ok = key, true
+	}
+	return nil
+}
+
+// SortedByKey returns whether the records were written with
+// WithSortedKeys, so that Reader.Lookup and Reader.Range binary search
+// them.
+func (r *Index) SortedByKey() bool {
+	return r.keyRanges != nil
+}
+
+// lookupSorted is Lookup by binary search of sorted records.
+func (r *Reader) lookupSorted(key []byte) ([]byte, error) {
+	ranges := r.index.keyRanges
+	ci := sort.Search(len(ranges), func(i int) bool { return bytes.Compare(ranges[i].last, key) >= 0 })
+	if ci == len(ranges) || bytes.Compare(ranges[ci].first, key) > 0 || !r.index.ChunkMayContain(ci, key) {
+		return nil, ErrKeyNotFound
+	}
+
+	ch, e := r.chunk(ci)
+	if e != nil {
+		return nil, e
+	}
+	ri := sort.Search(len(ch.keys), func(i int) bool { return bytes.Compare(ch.keys[i], key) >= 0 })
+	if ri == len(ch.keys) || !bytes.Equal(ch.keys[ri], key) {
+		return nil, ErrKeyNotFound
+	}
+	return ch.records[ri], nil
+}
+
+// seekKey returns the index of the first record whose key is not less
+// than key, or NumRecords if none, decoding at most one chunk.
+func (r *Reader) seekKey(key []byte) (int, error) {
+	ranges := r.index.keyRanges
+	ci := sort.Search(len(ranges), func(i int) bool { return bytes.Compare(ranges[i].last, key) >= 0 })
+	start := r.index.chunkStart(ci)
+	if ci == len(ranges) || bytes.Compare(ranges[ci].first, key) >= 0 {
+		return start, nil
+	}
+
+	ch, e := r.chunk(ci)
+	if e != nil {
+		return 0, e
+	}
+	return start + sort.Search(len(ch.keys), func(i int) bool { return bytes.Compare(ch.keys[i], key) >= 0 }), nil
+}
+
+// Range returns a scanner of the records with keys in [lo, hi), of an
+// Index sorted by key.  A nil hi leaves the range unbounded.  Like
+// that of Lookup, the records of the scanner must not be modified.
+func (r *Reader) Range(lo, hi []byte) (*KeyRangeScanner, error) {
+	if !r.index.SortedByKey() {
+		return nil, fmt.Errorf("Records are not sorted by key")
+	}
+
+	start, e := r.seekKey(lo)
+	if e != nil {
+		return nil, e
+	}
+
+	end := r.index.NumRecords
+	if hi != nil {
+		if end, e = r.seekKey(hi); e != nil {
+			return nil, e
+		}
+	}
+	if end < start {
+		end = start
+	}
+	return &KeyRangeScanner{r: r, cur: start - 1, end: end, chunkIndex: -1}, nil
+}
+
+var _ TimestampedScanner = (*KeyRangeScanner)(nil)
+
+// KeyRangeScanner scans the records of a Reader in a range of keys,
+// as returned by Reader.Range, through the chunk cache of the Reader.
+type KeyRangeScanner struct {
+	r          *Reader
+	cur, end   int
+	chunkIndex int
+	chunk      *Chunk
+	ri         int // the index of the current record in chunk.
+	err        error
+}
+
+// Scan moves the cursor forward for one record and loads the chunk
+// containing the record if not yet.
+func (s *KeyRangeScanner) Scan() bool {
+	if s.err != nil || s.cur+1 >= s.end {
+		return false
+	}
+
+	s.cur++
+	ci, ri := s.r.index.Locate(s.cur)
+	if ci != s.chunkIndex {
+		if s.chunk, s.err = s.r.chunk(ci); s.err != nil {
+			return false
+		}
+		s.chunkIndex = ci
+	}
+	s.ri = ri
+	return true
+}
+
+// Record returns the record under the current cursor.
+func (s *KeyRangeScanner) Record() []byte {
+	return s.chunk.records[s.ri]
+}
+
+// Key returns the key of the record under the current cursor.
+func (s *KeyRangeScanner) Key() []byte {
+	return s.chunk.key(s.ri)
+}
+
+// Tag returns the type tag of the record under the current cursor, as
+// written by Writer.WriteTagged, or 0 if it has none.
+func (s *KeyRangeScanner) Tag() uint16 {
+	return s.chunk.tag(s.ri)
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, which records of WriteKV have none of.
+func (s *KeyRangeScanner) Timestamp() time.Time {
+	return s.chunk.timestamp(s.ri)
+}
+
+// Err returns the first error that was encountered by the Scanner.
+func (s *KeyRangeScanner) Err() error {
+	return s.err
+}
+
+// appendKeyRanges appends the key ranges of the chunks to buf as
+//
+//	numChunks * {
+//		firstLen uvarint
+//		first    [firstLen]byte
+//		lastLen  uvarint
+//		last     [lastLen]byte
+//	}
+func appendKeyRanges(buf []byte, ranges []keyRange) []byte {
+	for _, kr := range ranges {
+		for _, key := range [][]byte{kr.first, kr.last} {
+			buf = appendUvarint(buf, uint64(len(key)))
+			buf = append(buf, key...)
+		}
+	}
+	return buf
+}
+
+// parseKeyRanges parses the key ranges of numChunks chunks by
+// appendKeyRanges, which must fill buf.
+func parseKeyRanges(buf []byte, numChunks int) ([]keyRange, error) {
+	ranges := make([]keyRange, numChunks)
+	for i := range ranges {
+		var keys [2][]byte
+		for j := range keys {
+			n, l := binary.Uvarint(buf)
+			if l <= 0 || n > uint64(len(buf)-l) {
+				return nil, fmt.Errorf("Failed to parse key range of chunk %d", i)
+			}
+			keys[j] = append([]byte{}, buf[l:l+int(n)]...)
+			buf = buf[l+int(n):]
+		}
+		ranges[i] = keyRange{keys[0], keys[1]}
+	}
+
+	if len(buf) > 0 {
+		return nil, fmt.Errorf("Key ranges have %d bytes after the chunks", len(buf))
+	}
+	return ranges, nil
+}
@@ -0,0 +1,93 @@
+package recordio
+
+import (
+	"math"
+	"sort"
+)
+
+// A Split is the range [Start, Start+Len) of records assigned to a
+// worker, as taken by NewRangeScanner.
+type Split struct {
+	Start, Len int
+}
+
+// SplitByRecords divides the records of index into n contiguous
+// Splits of about the same number of records, in order, without
+// overlaps or gaps.  If the index has at least n chunks, the Splits
+// start and end at chunk boundaries, the nearest ones to the even
+// split, so that no chunk is decoded by two workers; otherwise they
+// split chunks.  The Splits depend only on the index and n, so that
+// every worker computes the same.  Splits are empty if there are fewer
+// records than workers.
+func SplitByRecords(index *Index, n int) []Split {
+	return splitIndex(index, n, func(i int) float64 {
+		return float64(index.ChunkRecords[i])
+	})
+}
+
+// SplitByBytes is SplitByRecords dividing the file into Splits of
+// about the same number of compressed bytes, for records of uneven
+// sizes.  The size of a chunk is taken from the offset of the next
+// chunk, and that of the last chunk, which the Index doesn't record,
+// as the mean of the others.
+func SplitByBytes(index *Index, n int) []Split {
+	m := index.NumChunks()
+	mean := 1.0
+	if m > 1 {
+		mean = float64(index.ChunkOffsets[m-1]-index.ChunkOffsets[0]) / float64(m-1)
+	}
+	return splitIndex(index, n, func(i int) float64 {
+		if i == m-1 {
+			return mean
+		}
+		return float64(index.ChunkOffsets[i+1] - index.ChunkOffsets[i])
+	})
+}
+
+// splitIndex divides the records of index into n Splits of about the
+// same weight, given the weight of each chunk.
+func splitIndex(index *Index, n int, weight func(chunk int) float64) []Split {
+	if n <= 0 {
+		return nil
+	}
+
+	m := index.NumChunks()
+	cumWeights := make([]float64, m+1)
+	for i := 0; i < m; i++ {
+		cumWeights[i+1] = cumWeights[i] + weight(i)
+	}
+	total := cumWeights[m]
+
+	splits := make([]Split, n)
+	prev, prevChunk := 0, 0
+	for k := 1; k <= n; k++ {
+		cut := index.NumRecords
+		target := total * float64(k) / float64(n)
+		if k < n && m >= n {
+			// The boundary nearest to target, leaving a chunk
+			// for each Split before and after.
+			j := sort.SearchFloat64s(cumWeights, target)
+			if j > 0 && target-cumWeights[j-1] <= cumWeights[j]-target {
+				j--
+			}
+			j = min(max(j, prevChunk+1), m-(n-k))
+			cut, prevChunk = index.chunkStart(j), j
+		} else if k < n && total > 0 {
+			// Cut the chunk holding target in proportion.
+			c := min(sort.SearchFloat64s(cumWeights, target), m) - 1
+			c = max(c, 0)
+			frac := 0.0
+			if w := cumWeights[c+1] - cumWeights[c]; w > 0 {
+				frac = (target - cumWeights[c]) / w
+			}
+			cut = index.chunkStart(c) + int(math.Round(frac*float64(index.ChunkRecords[c])))
+			cut = min(max(cut, prev), index.NumRecords)
+		} else if k < n {
+			cut = 0
+		}
+
+		splits[k-1] = Split{Start: prev, Len: cut - prev}
+		prev = cut
+	}
+	return splits
+}
@@ -0,0 +1,110 @@
+// Package sqliteio dumps the records of recordio files into SQLite
+// tables and builds recordio files from queries, for ad-hoc SQL access
+// to datasets while debugging or labeling:
+//
+//	db, err := sql.Open("sqlite", "debug.db")
+//	...
+//	n, err := sqliteio.Export(db, "train", s)
+//	...
+//	n, err = sqliteio.Import(w, db, `SELECT record FROM train WHERE id % 10 = 0`)
+//
+// It works through database/sql, with any SQLite driver registered by
+// the program, like modernc.org/sqlite or github.com/mattn/go-sqlite3.
+package sqliteio
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+// Column names of the tables written by Export.
+const (
+	IDColumn     = "id"
+	RecordColumn = "record"
+)
+
+// Export creates the table of the given name in db and inserts the
+// records of s into it, each as a row of the blob column "record" with
+// its index in the scan as the "id", which is the rowid.  It returns
+// the number of records.  The rows are inserted in one transaction,
+// so that they all are, or none is.
+func Export(db *sql.DB, table string, s recordio.RecordScanner) (int, error) {
+	tx, e := db.Begin()
+	if e != nil {
+		return 0, fmt.Errorf("Failed to begin transaction: %v", e)
+	}
+	defer tx.Rollback()
+
+	name := quote(table)
+	if _, e = tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s INTEGER PRIMARY KEY, %s BLOB NOT NULL)", name, IDColumn, RecordColumn)); e != nil {
+		return 0, fmt.Errorf("Failed to create table %s: %v", table, e)
+	}
+	insert, e := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (?, ?)", name, IDColumn, RecordColumn))
+	if e != nil {
+		return 0, fmt.Errorf("Failed to prepare insert: %v", e)
+	}
+	defer insert.Close()
+
+	n := 0
+	for s.Scan() {
+		record := s.Record()
+		if record == nil {
+			record = []byte{}
+		}
+		if _, e = insert.Exec(n, record); e != nil {
+			return n, fmt.Errorf("Failed to insert record %d: %v", n, e)
+		}
+		n++
+	}
+	if e = s.Err(); e != nil {
+		return n, e
+	}
+
+	if e = tx.Commit(); e != nil {
+		return n, fmt.Errorf("Failed to commit: %v", e)
+	}
+	return n, nil
+}
+
+// Import writes the rows of the query, which must select one column
+// of blobs or text, into w as records, returning their number.  A NULL
+// is an empty record.  w is not closed.
+func Import(w *recordio.Writer, db *sql.DB, query string, args ...interface{}) (int, error) {
+	rows, e := db.Query(query, args...)
+	if e != nil {
+		return 0, fmt.Errorf("Failed to query: %v", e)
+	}
+	defer rows.Close()
+
+	columns, e := rows.Columns()
+	if e != nil {
+		return 0, fmt.Errorf("Failed to query: %v", e)
+	}
+	if len(columns) != 1 {
+		return 0, fmt.Errorf("Query selects %d columns, not 1", len(columns))
+	}
+
+	n := 0
+	for rows.Next() {
+		var record []byte
+		if e = rows.Scan(&record); e != nil {
+			return n, fmt.Errorf("Failed to read row %d: %v", n, e)
+		}
+		if _, e = w.Write(record); e != nil {
+			return n, e
+		}
+		n++
+	}
+	if e = rows.Err(); e != nil {
+		return n, fmt.Errorf("Failed to read rows: %v", e)
+	}
+	return n, nil
+}
+
+// quote quotes an SQL identifier.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
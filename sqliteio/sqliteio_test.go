@@ -0,0 +1,67 @@
+package sqliteio_test
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/sqliteio"
+)
+
+func TestExportImport(t *testing.T) {
+	var buf bytes.Buffer
+	w := recordio.NewWriter(&buf, -1, recordio.Snappy, recordio.WithMaxChunkRecords(100))
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+	w.Close()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), w.Index(), 0, -1)
+	if n, err := sqliteio.Export(db, `my "records"`, s); err != nil || n != 1000 {
+		t.Fatal("unexpected export:", n, err)
+	}
+
+	var record []byte
+	if err := db.QueryRow(`SELECT record FROM "my ""records""" WHERE rowid = 123`).Scan(&record); err != nil || string(record) != "record 123" {
+		t.Fatal("unexpected row:", string(record), err)
+	}
+
+	// The table exists.
+	s = recordio.NewRangeScanner(bytes.NewReader(buf.Bytes()), w.Index(), 0, -1)
+	if _, err := sqliteio.Export(db, `my "records"`, s); err == nil {
+		t.Fatal("expected an error of an existing table")
+	}
+
+	var out bytes.Buffer
+	ow := recordio.NewWriter(&out, -1, recordio.NoCompression)
+	n, err := sqliteio.Import(ow, db, `SELECT record FROM "my ""records""" WHERE id % ? = 0 ORDER BY id DESC`, 100)
+	if err != nil || n != 10 {
+		t.Fatal("unexpected import:", n, err)
+	}
+	ow.Close()
+
+	s = recordio.NewRangeScanner(bytes.NewReader(out.Bytes()), ow.Index(), 0, -1)
+	for i := 900; s.Scan(); i -= 100 {
+		if string(s.Record()) != fmt.Sprintf("record %d", i) {
+			t.Fatal("unexpected record:", string(s.Record()))
+		}
+	}
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+
+	if _, err := sqliteio.Import(ow, db, `SELECT id, record FROM "my ""records"""`); err == nil {
+		t.Fatal("expected an error of two columns")
+	}
+}
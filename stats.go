@@ -0,0 +1,257 @@
+package recordio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// WithStats makes the Writer accumulate the FileStats of the file,
+// returned by Writer.Stats, and store them in the footer with
+// WithFooterIndex, for Stats to read without decoding the chunks.
+func WithStats(enabled bool) Option {
+	return func(w *Writer) {
+		w.collectStats = enabled
+	}
+}
+
+// FileStats summarizes the records and the chunks of a file, for
+// capacity planning and dataset descriptions.
+type FileStats struct {
+	NumRecords    int64
+	NumChunks     int64
+	RecordBytes   int64 // the total size of the records.
+	MinRecordSize int64 // 0 without records.
+	MaxRecordSize int64
+
+	// SizeHistogram[i] counts the records of bits.Len64(size) == i,
+	// that is the empty ones for i == 0 and those of [2^(i-1), 2^i)
+	// bytes otherwise.
+	SizeHistogram []int64
+
+	// Codecs holds the stats of the chunks by the compressor they
+	// were written with, like Snappy, which differs from that of the
+	// Writer for chunks stored uncompressed by
+	// WithAdaptiveCompression.
+	Codecs map[int]*CodecStats
+}
+
+// CodecStats summarizes the chunks written with a compressor.
+type CodecStats struct {
+	NumChunks       int64
+	RecordBytes     int64 // the total size of the records of the chunks.
+	CompressedBytes int64 // the total size of the chunk data.
+}
+
+// Ratio returns the compression ratio of the chunks, RecordBytes over
+// CompressedBytes.
+func (c *CodecStats) Ratio() float64 {
+	if c.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(c.RecordBytes) / float64(c.CompressedBytes)
+}
+
+// MeanRecordSize returns the mean size of the records.
+func (s *FileStats) MeanRecordSize() float64 {
+	if s.NumRecords == 0 {
+		return 0
+	}
+	return float64(s.RecordBytes) / float64(s.NumRecords)
+}
+
+// Percentile returns an upper bound of the p-th percentile, in [0,
+// 100], of the record sizes: the largest size of the SizeHistogram
+// bucket holding it, at most MaxRecordSize.
+func (s *FileStats) Percentile(p float64) int64 {
+	rank := int64(math.Ceil(p / 100 * float64(s.NumRecords)))
+	var n int64
+	for i, count := range s.SizeHistogram {
+		n += count
+		if count > 0 && n >= rank {
+			return min(int64(1)<<i-1, s.MaxRecordSize)
+		}
+	}
+	return s.MaxRecordSize
+}
+
+func (s *FileStats) addRecord(size int64) {
+	if s.NumRecords == 0 || size < s.MinRecordSize {
+		s.MinRecordSize = size
+	}
+	s.MaxRecordSize = max(s.MaxRecordSize, size)
+	s.NumRecords++
+	s.RecordBytes += size
+
+	b := bits.Len64(uint64(size))
+	for len(s.SizeHistogram) <= b {
+		s.SizeHistogram = append(s.SizeHistogram, 0)
+	}
+	s.SizeHistogram[b]++
+}
+
+func (s *FileStats) addChunk(compressor uint32, recordBytes, compressedBytes int64) {
+	if compressor == zstdDict {
+		compressor = Zstd
+	}
+	if s.Codecs == nil {
+		s.Codecs = make(map[int]*CodecStats)
+	}
+
+	c := s.Codecs[int(compressor)]
+	if c == nil {
+		c = &CodecStats{}
+		s.Codecs[int(compressor)] = c
+	}
+	c.NumChunks++
+	c.RecordBytes += recordBytes
+	c.CompressedBytes += compressedBytes
+	s.NumChunks++
+}
+
+// clone returns a deep copy of s.
+func (s *FileStats) clone() *FileStats {
+	c := *s
+	c.SizeHistogram = append([]int64(nil), s.SizeHistogram...)
+	c.Codecs = nil
+	for k, v := range s.Codecs {
+		if c.Codecs == nil {
+			c.Codecs = make(map[int]*CodecStats)
+		}
+		cs := *v
+		c.Codecs[k] = &cs
+	}
+	return &c
+}
+
+// Stats returns the FileStats of the records written so far, including
+// those not yet in a chunk, which have no CodecStats yet.  It returns
+// nil without WithStats.
+func (w *Writer) Stats() *FileStats {
+	if w.stats == nil {
+		return nil
+	}
+	return w.stats.clone()
+}
+
+// Stats returns the FileStats of the recordio file r, as stored in the
+// footer by a Writer of WithStats, or otherwise by reading every
+// chunk.
+func Stats(r io.ReadSeeker) (*FileStats, error) {
+	idx, e := LoadIndexFromFooter(r)
+	if e == nil && idx.stats != nil {
+		return idx.stats, nil
+	}
+	if e != nil && e != ErrNoFooter {
+		return nil, e
+	}
+
+	if _, e = r.Seek(0, io.SeekStart); e != nil {
+		return nil, e
+	}
+	if idx, e = LoadIndex(r); e != nil {
+		return nil, e
+	}
+	return computeStats(r, idx)
+}
+
+// computeStats reads the FileStats of the chunks of index from r.
+func computeStats(r io.ReadSeeker, index *Index) (*FileStats, error) {
+	s := &FileStats{}
+	o := newReadOptions(nil)
+	for _, offset := range index.ChunkOffsets {
+		hdr, data, e := readRawChunk(r, offset, o)
+		if e != nil {
+			return nil, e
+		}
+
+		ch, e := decodeChunk(hdr, data, offset, o)
+		if e != nil {
+			return nil, e
+		}
+
+		for _, record := range ch.records {
+			s.addRecord(int64(len(record)))
+		}
+		s.addChunk(hdr.compressor, int64(ch.numBytes), int64(hdr.compressedSize))
+	}
+	return s, nil
+}
+
+// appendStats appends s to buf as uvarints:
+//
+//	numRecords, numChunks, recordBytes, minRecordSize, maxRecordSize
+//	numBuckets, numBuckets * count
+//	numCodecs, numCodecs * {compressor, numChunks, recordBytes, compressedBytes}
+func appendStats(buf []byte, s *FileStats) []byte {
+	for _, v := range []int64{s.NumRecords, s.NumChunks, s.RecordBytes, s.MinRecordSize, s.MaxRecordSize} {
+		buf = appendUvarint(buf, uint64(v))
+	}
+
+	buf = appendUvarint(buf, uint64(len(s.SizeHistogram)))
+	for _, v := range s.SizeHistogram {
+		buf = appendUvarint(buf, uint64(v))
+	}
+
+	codecs := make([]int, 0, len(s.Codecs))
+	for k := range s.Codecs {
+		codecs = append(codecs, k)
+	}
+	sort.Ints(codecs)
+
+	buf = appendUvarint(buf, uint64(len(codecs)))
+	for _, k := range codecs {
+		c := s.Codecs[k]
+		for _, v := range []int64{int64(k), c.NumChunks, c.RecordBytes, c.CompressedBytes} {
+			buf = appendUvarint(buf, uint64(v))
+		}
+	}
+	return buf
+}
+
+// parseStats parses the FileStats of appendStats, which must fill buf.
+func parseStats(buf []byte) (*FileStats, error) {
+	var e error
+	next := func() int64 {
+		v, l := binary.Uvarint(buf)
+		if l <= 0 || v > math.MaxInt64 {
+			e = fmt.Errorf("Failed to parse stats")
+			return 0
+		}
+		buf = buf[l:]
+		return int64(v)
+	}
+
+	s := &FileStats{}
+	for _, v := range []*int64{&s.NumRecords, &s.NumChunks, &s.RecordBytes, &s.MinRecordSize, &s.MaxRecordSize} {
+		*v = next()
+	}
+
+	if n := next(); e == nil && n <= 64 {
+		s.SizeHistogram = make([]int64, n)
+		for i := range s.SizeHistogram {
+			s.SizeHistogram[i] = next()
+		}
+	} else if e == nil {
+		e = fmt.Errorf("Stats have %d histogram buckets", n)
+	}
+
+	for n := next(); e == nil && n > 0; n-- {
+		k, c := next(), &CodecStats{NumChunks: next(), RecordBytes: next(), CompressedBytes: next()}
+		if s.Codecs == nil {
+			s.Codecs = make(map[int]*CodecStats)
+		}
+		s.Codecs[int(k)] = c
+	}
+
+	if e == nil && len(buf) > 0 {
+		e = fmt.Errorf("Stats have %d bytes after the codecs", len(buf))
+	}
+	if e != nil {
+		return nil, e
+	}
+	return s, nil
+}
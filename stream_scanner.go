@@ -0,0 +1,121 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// StreamScanner scans the records of a recordio stream sequentially,
+// without an Index or seeking, so it can read from pipes and network
+// connections.  Records are returned as soon as their chunk arrives.
+type StreamScanner struct {
+	reader io.Reader
+	chunk  *Chunk
+	cur    int   // index of the current record in chunk.
+	offset int64 // of the next chunk, from the start of the scan.
+	err    error
+	opts   *readOptions
+}
+
+// NewStreamScanner creates a scanner reading the stream r from the
+// current position.  A footer index ends the scan.
+func NewStreamScanner(r io.Reader, opts ...ReadOption) *StreamScanner {
+	o := newReadOptions(opts)
+	return &StreamScanner{reader: readAheadStream(r, o.readAhead), chunk: &Chunk{}, opts: o}
+}
+
+// Scan moves the cursor forward for one record, reading the next
+// chunk from the stream if the current one is exhausted.
+func (s *StreamScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	s.cur++
+	for s.cur >= len(s.chunk.records) {
+		if s.offset == 0 {
+			if s.err = s.readFileHeader(); s.err != nil {
+				return false
+			}
+		}
+
+		hdr, e := parseHeader(s.reader)
+		if e == errFooter {
+			e = io.EOF
+		}
+		if e != nil {
+			s.err = e
+			return false
+		}
+
+		if s.chunk, s.err = readChunk(s.reader, hdr, s.offset, s.opts); s.err != nil {
+			return false
+		}
+		s.offset += hdr.size() + int64(hdr.compressedSize)
+		s.cur = 0
+	}
+
+	return true
+}
+
+// Record returns the record under the current cursor.
+func (s *StreamScanner) Record() []byte {
+	return s.chunk.records[s.cur]
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor, as written by Writer.WriteWithTimestamp, or the zero Time if
+// it has none.
+func (s *StreamScanner) Timestamp() time.Time {
+	return s.chunk.timestamp(s.cur)
+}
+
+// Key returns the key of the record under the current cursor, as
+// written by Writer.WriteKV, or nil if it has none.
+func (s *StreamScanner) Key() []byte {
+	return s.chunk.key(s.cur)
+}
+
+// Tag returns the type tag of the record under the current cursor, as
+// written by Writer.WriteTagged, or 0 if it has none.
+func (s *StreamScanner) Tag() uint16 {
+	return s.chunk.tag(s.cur)
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// Scanner.
+func (s *StreamScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	return s.err
+}
+
+// Diagnostics returns the anomalies met so far with CollectAnomalies.
+func (s *StreamScanner) Diagnostics() []Diagnostic {
+	return s.opts.diagnostics()
+}
+
+// readFileHeader reads the file header at the start of the stream, if
+// any, into s.opts.
+func (s *StreamScanner) readFileHeader() error {
+	var magic [4]byte
+	n, e := io.ReadFull(s.reader, magic[:])
+	s.reader = io.MultiReader(bytes.NewReader(magic[:n]), s.reader)
+	if e != nil || binary.LittleEndian.Uint32(magic[:]) != fileHeaderMagic {
+		// Leave errors, including an empty stream, to parseHeader.
+		return nil
+	}
+
+	fh, e := parseFileHeader(s.reader)
+	if e != nil {
+		return e
+	}
+
+	s.opts.header.put(fh)
+	s.offset = fileHeaderHeaderSize + int64(len(fh.encodedPayload()))
+	return nil
+}
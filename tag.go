@@ -0,0 +1,65 @@
+package recordio
+
+// TaggedScanner is a RecordScanner returning the type tags written by
+// Writer.WriteTagged.
+type TaggedScanner interface {
+	RecordScanner
+	// Tag returns the type tag of the record under the current
+	// cursor, or 0 if it has none.
+	Tag() uint16
+}
+
+var (
+	_ TaggedScanner = (*Scanner)(nil)
+	_ TaggedScanner = (*RangeScanner)(nil)
+	_ TaggedScanner = (*ReverseScanner)(nil)
+	_ TaggedScanner = (*StreamScanner)(nil)
+	_ TaggedScanner = (*SampleScanner)(nil)
+	_ TaggedScanner = (*RecoveryScanner)(nil)
+	_ TaggedScanner = (*KeyRangeScanner)(nil)
+	_ TaggedScanner = (*TagScanner)(nil)
+)
+
+// TagScanner scans the records of another scanner with some type tags,
+// skipping the others.
+type TagScanner struct {
+	s    TaggedScanner
+	tags map[uint16]bool
+}
+
+// NewTagScanner creates a scanner of the records of s with any of the
+// given type tags.  Records without tags have tag 0.
+func NewTagScanner(s TaggedScanner, tags ...uint16) *TagScanner {
+	t := &TagScanner{s: s, tags: make(map[uint16]bool)}
+	for _, tag := range tags {
+		t.tags[tag] = true
+	}
+	return t
+}
+
+// Scan moves the cursor forward to the next record with one of the
+// tags.
+func (s *TagScanner) Scan() bool {
+	for s.s.Scan() {
+		if s.tags[s.s.Tag()] {
+			return true
+		}
+	}
+	return false
+}
+
+// Record returns the record under the current cursor.
+func (s *TagScanner) Record() []byte {
+	return s.s.Record()
+}
+
+// Tag returns the type tag of the record under the current cursor.
+func (s *TagScanner) Tag() uint16 {
+	return s.s.Tag()
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// underlying scanner.
+func (s *TagScanner) Err() error {
+	return s.s.Err()
+}
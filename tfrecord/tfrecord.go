@@ -0,0 +1,171 @@
+// Package tfrecord reads and writes TFRecord files, the record format of
+// TensorFlow, and converts them from and to recordio files, so that
+// datasets flow between TensorFlow and this package.
+//
+// A TFRecord file is a sequence of records, each framed as
+//
+//	length    uint64 // little endian.
+//	lengthCRC uint32 // masked CRC32C of length.
+//	data      [length]byte
+//	dataCRC   uint32 // masked CRC32C of data.
+//
+// TFRecord files compressed by gzip or zlib must be decompressed, e.g.
+// by compress/gzip, before reading.
+package tfrecord
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/PaddlePaddle/recordio"
+)
+
+// ErrChecksum is returned when a TFRecord fails its CRC.
+var ErrChecksum = errors.New("tfrecord: checksum checking failed")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// maskedCRC is the masked CRC32C of data, as framed by TFRecord.
+func maskedCRC(data []byte) uint32 {
+	crc := crc32.Checksum(data, castagnoli)
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+// Reader scans the records of a TFRecord stream.  It implements
+// recordio.RecordScanner.
+type Reader struct {
+	r      *bufio.Reader
+	record []byte
+	offset int64 // of the next record.
+	err    error
+}
+
+// NewReader creates a Reader of r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Scan reads the next record, returning false at the end of the stream
+// or on error.
+func (r *Reader) Scan() bool {
+	if r.err != nil {
+		return false
+	}
+
+	var hdr [12]byte
+	if _, e := io.ReadFull(r.r, hdr[:]); e != nil {
+		if e == io.ErrUnexpectedEOF {
+			e = fmt.Errorf("Failed to read record header at %d: %v", r.offset, e)
+		}
+		r.err = e
+		return false
+	}
+	if binary.LittleEndian.Uint32(hdr[8:]) != maskedCRC(hdr[:8]) {
+		r.err = fmt.Errorf("Failed to read record length at %d: %w", r.offset, ErrChecksum)
+		return false
+	}
+
+	n := binary.LittleEndian.Uint64(hdr[:8])
+	if n > 1<<31 {
+		r.err = fmt.Errorf("Record at %d too large: %d bytes", r.offset, n)
+		return false
+	}
+
+	r.record = make([]byte, n+4)
+	if _, e := io.ReadFull(r.r, r.record); e != nil {
+		r.err = fmt.Errorf("Failed to read record at %d: %v", r.offset, noEOF(e))
+		return false
+	}
+	sum := binary.LittleEndian.Uint32(r.record[n:])
+	if r.record = r.record[:n]; sum != maskedCRC(r.record) {
+		r.err = fmt.Errorf("Failed to read record at %d: %w", r.offset, ErrChecksum)
+		return false
+	}
+
+	r.offset += int64(n) + 16
+	return true
+}
+
+// Record returns the record read by the last Scan.
+func (r *Reader) Record() []byte {
+	return r.record
+}
+
+// Err returns the first error of Scan other than the end of the
+// stream.
+func (r *Reader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+func noEOF(e error) error {
+	if e == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return e
+}
+
+// Writer writes records in the TFRecord format.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter creates a Writer into w.  Records are written through
+// unbuffered; wrap w in a bufio.Writer for small records.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes a record.
+func (w *Writer) Write(record []byte) (int, error) {
+	var hdr [12]byte
+	binary.LittleEndian.PutUint64(hdr[:8], uint64(len(record)))
+	binary.LittleEndian.PutUint32(hdr[8:], maskedCRC(hdr[:8]))
+
+	var footer [4]byte
+	binary.LittleEndian.PutUint32(footer[:], maskedCRC(record))
+
+	for _, b := range [][]byte{hdr[:], record, footer[:]} {
+		if _, e := w.w.Write(b); e != nil {
+			return 0, fmt.Errorf("Failed to write record: %v", e)
+		}
+	}
+	return len(record), nil
+}
+
+// ToRecordIO writes the records of the TFRecord stream r into w,
+// returning their number.  w is not closed.
+func ToRecordIO(w *recordio.Writer, r io.Reader) (int, error) {
+	return copyRecords(w, NewReader(r))
+}
+
+// FromRecordIO writes the records of s, like a recordio.RangeScanner,
+// into w as a TFRecord stream, returning their number.
+func FromRecordIO(w io.Writer, s recordio.RecordScanner) (int, error) {
+	bw := bufio.NewWriter(w)
+	n, e := copyRecords(NewWriter(bw), s)
+	if e != nil {
+		return n, e
+	}
+	if e = bw.Flush(); e != nil {
+		return n, fmt.Errorf("Failed to write record: %v", e)
+	}
+	return n, nil
+}
+
+func copyRecords(w io.Writer, s recordio.RecordScanner) (int, error) {
+	n := 0
+	for s.Scan() {
+		if _, e := w.Write(s.Record()); e != nil {
+			return n, e
+		}
+		n++
+	}
+	return n, s.Err()
+}
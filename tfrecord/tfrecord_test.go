@@ -0,0 +1,70 @@
+package tfrecord_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/PaddlePaddle/recordio"
+	"github.com/PaddlePaddle/recordio/tfrecord"
+)
+
+// hello holds the TFRecords "hello" and "", as written by TensorFlow.
+const hello = "\x05\x00\x00\x00\x00\x00\x00\x00\xea\xb2\x04\x3e\x68\x65\x6c\x6c\x6f\xbb\x1f\x1c\x19" +
+	"\x00\x00\x00\x00\x00\x00\x00\x00\x29\x03\x98\x07\xd8\xea\x82\xa2"
+
+func TestFormat(t *testing.T) {
+	var buf bytes.Buffer
+	w := tfrecord.NewWriter(&buf)
+	w.Write([]byte("hello"))
+	w.Write(nil)
+	if buf.String() != hello {
+		t.Fatalf("unexpected encoding: %q", buf.String())
+	}
+
+	r := tfrecord.NewReader(bytes.NewReader([]byte(hello)))
+	var records []string
+	for r.Scan() {
+		records = append(records, string(r.Record()))
+	}
+	if r.Err() != nil || len(records) != 2 || records[0] != "hello" || records[1] != "" {
+		t.Fatal("unexpected records:", r.Err(), records)
+	}
+
+	corrupted := []byte(hello)
+	corrupted[14] ^= 0xff
+	r = tfrecord.NewReader(bytes.NewReader(corrupted))
+	if r.Scan() || !errors.Is(r.Err(), tfrecord.ErrChecksum) {
+		t.Fatal("expected a checksum error:", r.Err())
+	}
+
+	r = tfrecord.NewReader(bytes.NewReader([]byte(hello[:10])))
+	if r.Scan() || r.Err() == nil {
+		t.Fatal("expected an error of a truncated record")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	var tf bytes.Buffer
+	w := tfrecord.NewWriter(&tf)
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(fmt.Sprintf("record %d", i)))
+	}
+
+	var rio bytes.Buffer
+	rw := recordio.NewWriter(&rio, -1, recordio.Gzip, recordio.WithMaxChunkRecords(100))
+	if n, err := tfrecord.ToRecordIO(rw, bytes.NewReader(tf.Bytes())); err != nil || n != 1000 {
+		t.Fatal("unexpected conversion:", n, err)
+	}
+	rw.Close()
+
+	var out bytes.Buffer
+	s := recordio.NewRangeScanner(bytes.NewReader(rio.Bytes()), rw.Index(), 0, -1)
+	if n, err := tfrecord.FromRecordIO(&out, s); err != nil || n != 1000 {
+		t.Fatal("unexpected conversion:", n, err)
+	}
+	if !bytes.Equal(out.Bytes(), tf.Bytes()) {
+		t.Fatal("expected the TFRecords back")
+	}
+}
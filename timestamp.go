@@ -0,0 +1,67 @@
+package recordio
+
+import "time"
+
+// TimestampedScanner is a RecordScanner returning the timestamps
+// written by Writer.WriteWithTimestamp.
+type TimestampedScanner interface {
+	RecordScanner
+	// Timestamp returns the timestamp of the record under the
+	// current cursor, or the zero Time if it has none.
+	Timestamp() time.Time
+}
+
+var (
+	_ TimestampedScanner = (*Scanner)(nil)
+	_ TimestampedScanner = (*RangeScanner)(nil)
+	_ TimestampedScanner = (*ReverseScanner)(nil)
+	_ TimestampedScanner = (*StreamScanner)(nil)
+	_ TimestampedScanner = (*SampleScanner)(nil)
+	_ TimestampedScanner = (*RecoveryScanner)(nil)
+	_ TimestampedScanner = (*TimeRangeScanner)(nil)
+)
+
+// TimeRangeScanner scans the records of another scanner with
+// timestamps in a time range, skipping the others.
+type TimeRangeScanner struct {
+	s        TimestampedScanner
+	from, to time.Time
+}
+
+// NewTimeRangeScanner creates a scanner of the records of s with
+// timestamps in [from, to).  A zero from or to leaves the range
+// unbounded on that side.  Records without timestamps are skipped.
+// As the records of a file need not be in time order, all records of
+// s are read.
+func NewTimeRangeScanner(s TimestampedScanner, from, to time.Time) *TimeRangeScanner {
+	return &TimeRangeScanner{s: s, from: from, to: to}
+}
+
+// Scan moves the cursor forward to the next record in the range.
+func (s *TimeRangeScanner) Scan() bool {
+	for s.s.Scan() {
+		t := s.s.Timestamp()
+		if t.IsZero() || (!s.from.IsZero() && t.Before(s.from)) || (!s.to.IsZero() && !t.Before(s.to)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Record returns the record under the current cursor.
+func (s *TimeRangeScanner) Record() []byte {
+	return s.s.Record()
+}
+
+// Timestamp returns the timestamp of the record under the current
+// cursor.
+func (s *TimeRangeScanner) Timestamp() time.Time {
+	return s.s.Timestamp()
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// underlying scanner.
+func (s *TimeRangeScanner) Err() error {
+	return s.s.Err()
+}
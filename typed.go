@@ -0,0 +1,142 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// A Codec encodes values of type T as records, for a TypedWriter and a
+// TypedScanner.  JSONCodec and GobCodec are provided here, and codecs
+// of protobuf and MessagePack in the package recordio/codecs.
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	// Unmarshal decodes data into *v, which holds the zero value.
+	Unmarshal(data []byte, v *T) error
+}
+
+// JSONCodec encodes values as JSON by encoding/json.
+type JSONCodec[T any] struct{}
+
+// Marshal implements Codec.
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements Codec.
+func (JSONCodec[T]) Unmarshal(data []byte, v *T) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes values by encoding/gob.  As records are decoded
+// independently, each one is a Gob stream of its own, repeating the
+// description of T, which is far larger than the value for small
+// types.
+type GobCodec[T any] struct{}
+
+// Marshal implements Codec.
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if e := gob.NewEncoder(&buf).Encode(v); e != nil {
+		return nil, e
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal implements Codec.
+func (GobCodec[T]) Unmarshal(data []byte, v *T) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// TypedWriter writes values of type T as records encoded by a Codec:
+//
+//	w := recordio.NewTypedWriter(recordio.NewWriter(f, -1, -1), recordio.JSONCodec[Example]{})
+//	for _, ex := range examples {
+//		if e := w.Write(ex); e != nil {
+//			...
+//		}
+//	}
+//	e := w.Close()
+type TypedWriter[T any] struct {
+	w     *Writer
+	codec Codec[T]
+}
+
+// NewTypedWriter creates a TypedWriter writing into w.
+func NewTypedWriter[T any](w *Writer, codec Codec[T]) *TypedWriter[T] {
+	return &TypedWriter[T]{w: w, codec: codec}
+}
+
+// Write encodes v and writes it as a record.
+func (w *TypedWriter[T]) Write(v T) error {
+	record, e := w.codec.Marshal(v)
+	if e != nil {
+		return fmt.Errorf("Failed to encode record: %v", e)
+	}
+	_, e = w.w.Write(record)
+	return e
+}
+
+// Writer returns the underlying Writer, e.g. to Flush it.
+func (w *TypedWriter[T]) Writer() *Writer {
+	return w.w
+}
+
+// Close closes the underlying Writer.
+func (w *TypedWriter[T]) Close() error {
+	return w.w.Close()
+}
+
+// TypedScanner decodes the records of a RecordScanner into values of
+// type T by a Codec:
+//
+//	s := recordio.NewTypedScanner(recordio.NewRangeScanner(f, idx, 0, -1), recordio.JSONCodec[Example]{})
+//	for s.Scan() {
+//		train(s.Value())
+//	}
+//	if e := s.Err(); e != nil {
+//		...
+//	}
+type TypedScanner[T any] struct {
+	s     RecordScanner
+	codec Codec[T]
+	n     int // records scanned.
+	v     T
+	err   error
+}
+
+// NewTypedScanner creates a TypedScanner of the records of s.
+func NewTypedScanner[T any](s RecordScanner, codec Codec[T]) *TypedScanner[T] {
+	return &TypedScanner[T]{s: s, codec: codec}
+}
+
+// Scan decodes the next record, returning false at the end or on
+// error, including a record failing to decode.
+func (s *TypedScanner[T]) Scan() bool {
+	if s.err != nil || !s.s.Scan() {
+		return false
+	}
+
+	var v T
+	if e := s.codec.Unmarshal(s.s.Record(), &v); e != nil {
+		s.err = fmt.Errorf("Failed to decode record %d: %v", s.n, e)
+		return false
+	}
+	s.v = v
+	s.n++
+	return true
+}
+
+// Value returns the value decoded by the last Scan.
+func (s *TypedScanner[T]) Value() T {
+	return s.v
+}
+
+// Err returns the first error of Scan or of the underlying scanner.
+func (s *TypedScanner[T]) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.s.Err()
+}
@@ -0,0 +1,172 @@
+package recordio
+
+import (
+	"fmt"
+	"io"
+)
+
+// ChunkStatus is the result of verifying a chunk.
+type ChunkStatus struct {
+	Offset         int64
+	NumRecords     int // as given by the header.
+	Compressor     int // as given by the header.
+	CompressedSize int64
+	RawSize        int64 // of the decompressed data; 0 if it cannot be decompressed.
+	Err            error // nil if the chunk is valid.
+}
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	// Chunks holds the status of every chunk, in file order.  A
+	// chunk whose header is broken ends the walk, as the chunks after
+	// it cannot be found; its status is the last one.
+	Chunks     []ChunkStatus
+	NumRecords int // in the valid chunks.
+
+	HeaderErr error // of the file header, if broken.
+	Footer    bool  // whether the file ends with a footer index.
+	FooterErr error // of the footer index, if broken or disagreeing with the chunks.
+}
+
+// OK tells whether the file is free of errors.
+func (r *VerifyReport) OK() bool {
+	if r.HeaderErr != nil || r.FooterErr != nil {
+		return false
+	}
+	for _, c := range r.Chunks {
+		if c.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify checks the integrity of the whole recordio file r, for
+// fsck-style tools: the file header, the headers, checksums and
+// compressed data of all chunks, the lengths of their records, and the
+// footer index.  Corruption is reported in the VerifyReport, whose OK
+// tells if there is any; the error is for failing to read r.
+func Verify(r io.ReadSeeker, opts ...ReadOption) (*VerifyReport, error) {
+	rep := &VerifyReport{}
+
+	size, e := r.Seek(0, io.SeekEnd)
+	if e != nil {
+		return nil, e
+	}
+
+	end := size
+	idx, footer, e := readFooter(r)
+	if e == nil {
+		rep.Footer, end = true, footer
+	} else if e != ErrNoFooter {
+		rep.Footer, rep.FooterErr = true, e
+	}
+
+	if _, e = r.Seek(0, io.SeekStart); e != nil {
+		return nil, e
+	}
+
+	o := newReadOptions(opts)
+	fh, e := readFileHeader(r)
+	if e != nil {
+		rep.HeaderErr = e
+		return rep, nil
+	}
+	o.header.put(fh)
+
+	offset, e := r.Seek(0, io.SeekCurrent)
+	if e != nil {
+		return nil, e
+	}
+
+	for offset < end {
+		hdr, e := parseChunkHeader(r, offset)
+		if e == errFooter && !rep.Footer {
+			rep.Footer, rep.FooterErr = true, fmt.Errorf("Footer at %d lacks its trailer", offset)
+		}
+		if e == errFooter && rep.FooterErr != nil {
+			break
+		}
+		if e != nil {
+			rep.Chunks = append(rep.Chunks, ChunkStatus{Offset: offset, Err: fmt.Errorf("Failed to parse chunk header: %v", e)})
+			break
+		}
+
+		status := ChunkStatus{
+			Offset:         offset,
+			NumRecords:     int(hdr.numRecords),
+			Compressor:     int(hdr.compressor),
+			CompressedSize: int64(hdr.compressedSize),
+		}
+		if status.Compressor == zstdDict {
+			status.Compressor = Zstd
+		}
+		next := offset + hdr.size() + int64(hdr.compressedSize)
+		if next > end {
+			status.Err = fmt.Errorf("Chunk data ends at %d, after the chunks at %d", next, end)
+			rep.Chunks = append(rep.Chunks, status)
+			break
+		}
+
+		if status.RawSize, status.Err = verifyChunk(r, hdr, offset, o); status.Err == nil {
+			rep.NumRecords += status.NumRecords
+		}
+		rep.Chunks = append(rep.Chunks, status)
+		offset = next
+	}
+
+	if idx != nil {
+		rep.FooterErr = checkFooterIndex(idx, rep.Chunks)
+	}
+	return rep, nil
+}
+
+// parseChunkHeader parses the chunk header at offset of r.
+func parseChunkHeader(r io.ReadSeeker, offset int64) (*Header, error) {
+	if _, e := r.Seek(offset, io.SeekStart); e != nil {
+		return nil, e
+	}
+	return parseHeader(r)
+}
+
+// verifyChunk decodes the chunk following hdr in r, and checks that its
+// records take all of its data, returning the size of the data.
+func verifyChunk(r io.Reader, hdr *Header, offset int64, o *readOptions) (int64, error) {
+	if hdr.flags&flagEncrypted != 0 && !o.hasKey() {
+		return 0, verifySealed(r, hdr)
+	}
+
+	data, e := readChunkData(r, hdr)
+	if e != nil {
+		return 0, e
+	}
+
+	deflated, e := inflateChunk(hdr, data, offset, o)
+	if e != nil {
+		return 0, e
+	}
+
+	size := int64(deflated.Len())
+	if _, e = parseRecords(hdr, deflated, offset, o); e != nil {
+		return size, e
+	}
+
+	if deflated.Len() > 0 {
+		return size, fmt.Errorf("%d bytes after the last record", deflated.Len())
+	}
+	return size, nil
+}
+
+// checkFooterIndex checks that the footer index idx lists the chunks.
+func checkFooterIndex(idx *Index, chunks []ChunkStatus) error {
+	if idx.NumChunks() != len(chunks) {
+		return fmt.Errorf("Footer index has %d chunks, the file %d", idx.NumChunks(), len(chunks))
+	}
+
+	for i, c := range chunks {
+		if idx.ChunkOffsets[i] != c.Offset || idx.ChunkRecords[i] != c.NumRecords {
+			return fmt.Errorf("Footer index disagrees with chunk %d at %d", i, c.Offset)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package recordio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// WriteFrom writes a record of size bytes read from r, for records
+// too large to hold in memory, like videos or model checkpoints.  The
+// record is streamed through the compressor into a chunk of its own,
+// after flushing the current chunk.
+//
+// If the underlying io.Writer is an io.WriteSeeker, like *os.File,
+// neither the record nor its compressed data is buffered: the chunk
+// header is written once the data is, by seeking back.  Otherwise the
+// compressed data is buffered, since the header precedes it.  As the
+// header records sizes as uint32, the compressed chunk must be smaller
+// than 4GB.
+//
+// A failed WriteFrom may leave a partial chunk behind, so all later
+// writes return the same error.
+func (w *Writer) WriteFrom(r io.Reader, size int64) (int64, error) {
+	if w.Writer == nil {
+		return 0, fmt.Errorf("Cannot write since writer had been closed")
+	}
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if size < 0 || size > math.MaxUint32-4 {
+		return 0, fmt.Errorf("Invalid record size: %d", size)
+	}
+
+	if w.sortedKeys {
+		return 0, fmt.Errorf("Records written with WithSortedKeys must have keys")
+	}
+
+	if w.aead != nil {
+		return 0, fmt.Errorf("Records written with WithEncryption cannot be streamed")
+	}
+
+	if e := w.checkRecordSize(size); e != nil {
+		return 0, e
+	}
+
+	if e := w.flushChunk(); e != nil {
+		return 0, e
+	}
+	if e := w.writePending(true); e != nil {
+		return 0, e
+	}
+
+	w.addBloomFilter(nil)
+	n, e := w.streamChunk(r, size)
+	if e != nil {
+		w.err = e
+	} else if w.stats != nil {
+		w.stats.addRecord(size)
+	}
+	return n, e
+}
+
+// streamChunk writes the record read from r as a chunk.
+func (w *Writer) streamChunk(r io.Reader, size int64) (int64, error) {
+	if e := w.writeFileHeader(); e != nil {
+		return 0, e
+	}
+
+	enc := w.encoding()
+	sum, rawSum, e := enc.newHashes()
+	if e != nil {
+		return 0, e
+	}
+	placeholder := enc.header(enc.chunkCompressor(), 0, 1, 0, sum, rawSum).size()
+
+	ws, seekable := w.Writer.(io.WriteSeeker)
+
+	var start int64
+	var buf bytes.Buffer
+	var dst io.Writer = &buf
+	if seekable {
+		if start, e = ws.Seek(0, io.SeekCurrent); e != nil {
+			return 0, fmt.Errorf("Failed to seek chunk: %v", e)
+		}
+
+		// A placeholder until the header is known.
+		if _, e = ws.Write(make([]byte, placeholder)); e != nil {
+			return 0, fmt.Errorf("Failed to write chunk header: %v", e)
+		}
+		dst = ws
+	}
+
+	cw := &countingWriter{Writer: dst}
+	compressor, e := newCompressor(io.MultiWriter(cw, sum), enc)
+	if e != nil {
+		return 0, e
+	}
+
+	var in io.Writer = compressor
+	if rawSum != nil {
+		in = io.MultiWriter(compressor, rawSum)
+	}
+
+	var rs [4]byte
+	binary.LittleEndian.PutUint32(rs[:], uint32(size))
+	if _, e = in.Write(rs[:]); e != nil {
+		return 0, fmt.Errorf("Failed to write record length: %v", e)
+	}
+
+	src, recordSum := in, crc32.New(castagnoli)
+	if enc.recordChecksums {
+		src = io.MultiWriter(in, recordSum)
+	}
+
+	n, e := io.CopyN(src, r, size)
+	if e != nil {
+		return n, fmt.Errorf("Failed to write record: %v", e)
+	}
+
+	if enc.recordChecksums {
+		binary.LittleEndian.PutUint32(rs[:], recordSum.Sum32())
+		if _, e = in.Write(rs[:]); e != nil {
+			return n, fmt.Errorf("Failed to write record checksum: %v", e)
+		}
+	}
+
+	if e = compressor.Close(); e != nil {
+		return n, fmt.Errorf("Failed to compress chunk data: %v", e)
+	}
+
+	if cw.n > math.MaxUint32 {
+		return n, fmt.Errorf("Compressed chunk too large: %d bytes", cw.n)
+	}
+
+	hdr := enc.header(enc.chunkCompressor(), cw.n, 1, 0, sum, rawSum)
+
+	if !seekable {
+		return n, w.writeChunk(hdr, buf.Bytes(), size)
+	}
+
+	if _, e = ws.Seek(start, io.SeekStart); e == nil {
+		if _, e = hdr.write(ws); e == nil {
+			_, e = ws.Seek(start+hdr.size()+cw.n, io.SeekStart)
+		}
+	}
+	if e != nil {
+		return n, fmt.Errorf("Failed to write chunk header: %v", e)
+	}
+
+	return n, w.chunkWritten(hdr, size)
+}
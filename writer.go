@@ -1,8 +1,10 @@
 package recordio
 
 import (
+	"crypto/cipher"
 	"fmt"
 	"io"
+	"time"
 )
 
 const (
@@ -11,16 +13,258 @@ const (
 
 // Writer creates a RecordIO file.
 type Writer struct {
-	io.Writer    // Set to nil to mark a closed writer.
-	chunk        *Chunk
-	maxChunkSize int // total records size, excluding metadata, before compression.
-	compressor   int
+	io.Writer       // Set to nil to mark a closed writer.
+	chunk           *Chunk
+	maxChunkSize    int // total records size, excluding metadata, before compression.
+	maxRecords      int // records per chunk; 0 means no limit.
+	maxRecord       int // bytes per record; 0 means no limit.
+	compressor      int
+	level           int               // 0 means the default of the compressor.
+	minSaving       float64           // see WithAdaptiveCompression.
+	dict            []byte            // see WithDictionary.
+	checksum        int               // see WithChecksum.
+	rawChecksum     bool              // see WithUncompressedChecksum.
+	recordSums      bool              // see WithRecordChecksums.
+	paddle          bool              // see WithPaddleCompat.
+	metadata        map[string]string // see WithMetadata.
+	schema          *Schema           // see WithSchema.
+	keyIndex        bool              // see WithKeyIndex.
+	keys            []keyEntry        // of the records written so far, with keyIndex.
+	sortedKeys      bool              // see WithSortedKeys.
+	ranges          []keyRange        // of the chunks flushed so far, with sortedKeys.
+	bloomBitsPerKey int               // see WithBloomFilter; 0 disables it.
+	bloomHashes     int
+	blooms          []bloomFilter // of the chunks flushed so far.
+	collectStats    bool          // see WithStats.
+	stats           *FileStats    // of the records written so far, with collectStats.
+	encryptionKey   []byte        // see WithEncryption.
+	aead            cipher.AEAD   // of encryptionKey.
+	keyID           []byte        // see WithKeyID.
+	kms             KMS           // see WithKMS.
+	wrappedKey      []byte        // of the data key of kms.
+
+	offset      int64  // bytes written so far.
+	index       *Index // chunks written so far.
+	header      *fileHeader
+	fileHeader  bool // see WithFileHeader.
+	headerDone  bool // whether header, if any, has been written.
+	footerIndex bool
+	sync        bool
+	onFlush     func(ChunkStats)
+	onClose     func(error) error // called with the error of Close or Abort.
+
+	workers int            // compression goroutines; <= 1 compresses in Write.
+	jobs    chan *chunkJob // to the compression goroutines.
+	pending []*chunkJob    // chunks being compressed, in file order.
+	err     error          // the first error of a compressed chunk.
+}
+
+// chunkJob is a chunk compressed by a compression goroutine.
+type chunkJob struct {
+	chunk *Chunk
+	enc   chunkEncoding
+	done  chan struct{} // closed after compression.
+	hdr   *Header
+	data  []byte
+	err   error
+}
+
+// ChunkStats describes a chunk written by a Writer, as passed to the
+// callback of OnChunkFlush.
+type ChunkStats struct {
+	Chunk          int   // the index of the chunk in the file.
+	Offset         int64 // the offset of the chunk in the file.
+	NumRecords     int
+	RecordBytes    int64 // the total size of the records.
+	CompressedSize int64 // the size of the chunk data, excluding the header.
+}
+
+// An Option configures a Writer.
+type Option func(*Writer)
+
+// WithFooterIndex makes Close append the Index of the written chunks
+// to the end of the file, so that readers can load it by
+// LoadIndexFromFooter without scanning every chunk header.
+func WithFooterIndex(enabled bool) Option {
+	return func(w *Writer) {
+		w.footerIndex = enabled
+	}
+}
+
+// WithKeyIndex makes the Writer index the keys of the records written
+// by WriteKV into the KeyIndex of its Index, for Reader.Lookup, which
+// is stored in the footer with WithFooterIndex.
+func WithKeyIndex(enabled bool) Option {
+	return func(w *Writer) {
+		w.keyIndex = enabled
+	}
+}
+
+// WithCompressor overrides the compressor argument of NewWriter, for
+// constructors like CreateAtomic that take only options.
+func WithCompressor(compressor int) Option {
+	return func(w *Writer) {
+		if compressor < 0 {
+			compressor = defaultCompressor
+		}
+		w.compressor = compressor
+	}
+}
+
+// WithCompressionLevel sets the level of the compressor, trading speed
+// for compression ratio: from 1, the fastest, to 9, the smallest, for
+// Gzip and LZ4, and from 1 to 22 as for the zstd command line for Zstd.
+// 0 means the default of the compressor.  Snappy has no levels, and
+// neither do registered compressors unless they implement
+// LevelCompressor.
+func WithCompressionLevel(n int) Option {
+	return func(w *Writer) {
+		w.level = n
+	}
+}
+
+// WithAdaptiveCompression makes the Writer store a chunk uncompressed
+// if compressing it saves less than the fraction minSaving of its
+// size, e.g. 0.1 for 10%, so that reading already compressed records,
+// like JPEG images, costs no decompression.  The choice is recorded in
+// the chunk header, so readers need no configuration.  It does not
+// apply to WriteFrom, which streams the compressed data.
+func WithAdaptiveCompression(minSaving float64) Option {
+	return func(w *Writer) {
+		w.minSaving = minSaving
+	}
+}
+
+// WithDictionary makes the Writer compress Zstd chunks with the
+// dictionary dict, as built by TrainDictionary, which is stored in a
+// file header before the first chunk for readers to find.  Readers
+// older than the file header cannot read such files.  It has no effect
+// with other compressors.
+func WithDictionary(dict []byte) Option {
+	return func(w *Writer) {
+		w.dict = dict
+	}
+}
+
+// WithFileHeader makes the Writer start the file with a file header
+// holding its magic number and format version, even if no feature
+// needs one, so that the file identifies itself and future readers can
+// tell its version.  Readers older than the file header cannot read
+// such files.
+func WithFileHeader(enabled bool) Option {
+	return func(w *Writer) {
+		w.fileHeader = enabled
+	}
+}
+
+// WithChecksum makes the Writer checksum chunks with the given
+// algorithm, like CRC32C, XXHash64, SHA256 or one registered by
+// RegisterChecksum, instead of CRC32.  Chunks checked by other
+// algorithms than CRC32 have version 2 headers, which older readers
+// cannot parse.
+func WithChecksum(checksumType int) Option {
+	return func(w *Writer) {
+		w.checksum = checksumType
+	}
+}
+
+// WithUncompressedChecksum makes the Writer also checksum the data of
+// chunks before compression, so that readers catch corruption
+// introduced by the compressor as well as by the storage.  It implies
+// version 2 chunk headers.
+func WithUncompressedChecksum(enabled bool) Option {
+	return func(w *Writer) {
+		w.rawChecksum = enabled
+	}
+}
+
+// WithRecordChecksums makes the Writer store a CRC32C after every
+// record, which readers verify as they parse the record, so that a
+// single record read by ReadRecord via RecordOffsets is checked too.
+// It costs 4 bytes per record and implies version 2 chunk headers.
+func WithRecordChecksums(enabled bool) Option {
+	return func(w *Writer) {
+		w.recordSums = enabled
+	}
+}
+
+// WithPaddleCompat makes the Writer write files readable by the
+// original PaddlePaddle recordio: version 1 chunk headers, checksummed
+// by CRC32, without a file header or a footer index, whatever other
+// options say.  Writes fail unless the compressor is NoCompression,
+// Snappy or Gzip, the only ones it knows, and with the options storing
+// what it cannot read, like WithMetadata, WithKeyIndex, WithSortedKeys,
+// WithBloomFilter or WithStats.
+func WithPaddleCompat(enabled bool) Option {
+	return func(w *Writer) {
+		w.paddle = enabled
+	}
+}
+
+// WithMaxChunkBytes overrides the maxChunkSize argument of NewWriter:
+// a chunk is flushed before the total size of its records would
+// exceed n bytes.  Small chunks suit random access, large ones the
+// compression ratio.  n < 0 means the default of 32MB.
+func WithMaxChunkBytes(n int) Option {
+	return func(w *Writer) {
+		if n < 0 {
+			n = defaultMaxChunkSize
+		}
+		w.maxChunkSize = n
+	}
+}
+
+// WithMaxChunkRecords flushes a chunk once it holds n records, in
+// addition to the limit of chunk bytes.  n <= 0 means no limit.
+func WithMaxChunkRecords(n int) Option {
+	return func(w *Writer) {
+		w.maxRecords = n
+	}
+}
+
+// WithMaxRecordSize makes writing a record longer than n bytes fail
+// with a *RecordTooLargeError.  n <= 0 means no limit.
+func WithMaxRecordSize(n int) Option {
+	return func(w *Writer) {
+		w.maxRecord = n
+	}
+}
+
+// WithSync makes the Writer call the Sync method of the underlying
+// io.Writer, as *os.File has, after writing each chunk, so that a
+// crash loses at most the records written since the last chunk or
+// Flush.  It has no effect if the io.Writer has no Sync method.
+func WithSync(enabled bool) Option {
+	return func(w *Writer) {
+		w.sync = enabled
+	}
+}
+
+// OnChunkFlush makes the Writer call fn after writing each chunk, for
+// progress reporting and metrics.  fn is called by the goroutine
+// calling the Writer, and must not call the Writer.
+func OnChunkFlush(fn func(ChunkStats)) Option {
+	return func(w *Writer) {
+		w.onFlush = fn
+	}
+}
+
+// WithCompressionWorkers makes the Writer compress full chunks in n
+// goroutines while the caller keeps writing records, which scales
+// slow compressors like Gzip with the number of cores.  Chunks are
+// still written in order, by the goroutine calling the Writer.  Up to
+// n chunks are buffered, and as with a single goroutine, written
+// records must not be modified until their chunk has been written.
+func WithCompressionWorkers(n int) Option {
+	return func(w *Writer) {
+		w.workers = n
+	}
 }
 
 // NewWriter creates a RecordIO file writer.  Each chunk is compressed
 // using the deflate algorithm given compression level.  Note that
 // level 0 means no compression and -1 means default compression.
-func NewWriter(w io.Writer, maxChunkSize, compressor int) *Writer {
+func NewWriter(w io.Writer, maxChunkSize, compressor int, opts ...Option) *Writer {
 	if maxChunkSize < 0 {
 		maxChunkSize = defaultMaxChunkSize
 	}
@@ -29,32 +273,449 @@ func NewWriter(w io.Writer, maxChunkSize, compressor int) *Writer {
 		compressor = defaultCompressor
 	}
 
-	return &Writer{
+	wr := &Writer{
 		Writer:       w,
 		chunk:        &Chunk{},
 		maxChunkSize: maxChunkSize,
-		compressor:   compressor}
+		compressor:   compressor,
+		index:        newIndex()}
+
+	for _, opt := range opts {
+		opt(wr)
+	}
+
+	if wr.paddle {
+		wr.dict, wr.fileHeader, wr.footerIndex = nil, false, false
+		wr.checksum, wr.rawChecksum, wr.recordSums = CRC32, false, false
+		if wr.compressor > Gzip {
+			wr.err = fmt.Errorf("Compressor %d cannot be read by PaddlePaddle recordio", wr.compressor)
+		}
+		if wr.err == nil && (len(wr.metadata) > 0 || wr.schema != nil) {
+			wr.err = fmt.Errorf("Metadata and schemas cannot be stored in files of PaddlePaddle recordio")
+		}
+		if wr.err == nil && (wr.keyIndex || wr.sortedKeys || wr.bloomBitsPerKey > 0 || wr.collectStats) {
+			wr.err = fmt.Errorf("Key indexes, sorted keys, bloom filters and stats cannot be stored in files of PaddlePaddle recordio")
+		}
+		wr.keyIndex, wr.sortedKeys, wr.bloomBitsPerKey, wr.collectStats = false, false, 0, false
+	}
+
+	if wr.collectStats {
+		wr.stats = &FileStats{}
+	}
+
+	if wr.kms != nil {
+		var e error
+		if wr.wrappedKey, e = wr.setupKMS(); e != nil {
+			wr.err = e
+		}
+	}
+	if wr.encryptionKey != nil {
+		var e error
+		if wr.aead, e = newAEAD(wr.encryptionKey); e != nil {
+			wr.err = e
+		}
+		if len(wr.keyID) > 255 {
+			wr.err = fmt.Errorf("Key ID of %d bytes exceeds 255", len(wr.keyID))
+		}
+		if wr.paddle {
+			wr.err = fmt.Errorf("Encrypted chunks cannot be read by PaddlePaddle recordio")
+		}
+	}
+
+	if wr.dict != nil && wr.compressor != Zstd {
+		wr.dict = nil
+	}
+	if wr.dict != nil || wr.fileHeader || wr.wrappedKey != nil || ((len(wr.metadata) > 0 || wr.schema != nil) && !wr.paddle) {
+		wr.header = newFileHeader()
+	}
+	if wr.dict != nil {
+		wr.header.set(dictionaryKey, wr.dict)
+	}
+	if wr.wrappedKey != nil {
+		wr.header.set(wrappedKeyKey, wr.wrappedKey)
+	}
+	if wr.schema != nil && wr.header != nil {
+		wr.header.setSchema(wr.schema)
+	}
+	if wr.header != nil {
+		for k, v := range wr.metadata {
+			wr.header.set(metadataPrefix+k, []byte(v))
+			wr.index.setMetadata(k, v)
+		}
+	}
+	return wr
 }
 
 // Writes a record.  It returns an error if Close has been called.
 func (w *Writer) Write(record []byte) (int, error) {
+	return w.write(record, 0, recordFields{})
+}
+
+// WriteWithTimestamp writes a record with a timestamp, like the time
+// of the event it records, which scanners return by Timestamp and
+// NewTimeRangeScanner filters by.  Records written by Write and by
+// WriteWithTimestamp go into different chunks, so alternating between
+// them makes small chunks.
+func (w *Writer) WriteWithTimestamp(record []byte, t time.Time) (int, error) {
+	if w.paddle {
+		return 0, fmt.Errorf("Timestamps cannot be stored in files of PaddlePaddle recordio")
+	}
+	return w.write(record, flagTimestamps, recordFields{timestamp: t.UnixNano()})
+}
+
+// WriteKV writes a record with a key, like the id of the example in
+// value, which scanners return by Key.  Keys are stored in the chunks
+// before their values, and are not covered by WithRecordChecksums.
+// Like values, keys must not be modified until the Writer is flushed.
+// Records written by WriteKV go into chunks of their own, like those
+// of WriteWithTimestamp.  It returns the length of value.
+func (w *Writer) WriteKV(key, value []byte) (int, error) {
+	if w.paddle {
+		return 0, fmt.Errorf("Keys cannot be stored in files of PaddlePaddle recordio")
+	}
+	return w.write(value, flagKeys, recordFields{key: key})
+}
+
+// WriteTagged writes a record with a type tag, like the type of the
+// message in record, which scanners return by Tag and NewTagScanner
+// filters by, so that a file interleaves records of several types.
+// Records written by WriteTagged go into chunks of their own, like
+// those of WriteWithTimestamp.
+func (w *Writer) WriteTagged(tag uint16, record []byte) (int, error) {
+	if w.paddle {
+		return 0, fmt.Errorf("Tags cannot be stored in files of PaddlePaddle recordio")
+	}
+	return w.write(record, flagTags, recordFields{tag: tag})
+}
+
+// write writes a record with the per-record fields f of layout.
+func (w *Writer) write(record []byte, layout uint8, f recordFields) (int, error) {
 	if w.Writer == nil {
 		return 0, fmt.Errorf("Cannot write since writer had been closed")
 	}
 
-	if w.chunk.numBytes+len(record) > w.maxChunkSize {
-		if e := w.chunk.dump(w.Writer, w.compressor); e != nil {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if e := w.checkRecordSize(int64(len(record))); e != nil {
+		return 0, e
+	}
+
+	if w.sortedKeys {
+		if e := w.checkKeyOrder(layout, f.key); e != nil {
+			return 0, e
+		}
+	}
+
+	if w.chunk.numBytes+len(record) > w.maxChunkSize ||
+		(w.maxRecords > 0 && len(w.chunk.records) >= w.maxRecords) ||
+		(len(w.chunk.records) > 0 && w.chunk.layout() != layout) {
+		if e := w.flushChunk(); e != nil {
 			return 0, e
 		}
 	}
 
-	w.chunk.add(record)
+	if w.keyIndex && layout&flagKeys != 0 {
+		w.keys = append(w.keys, keyEntry{hashKey(f.key), w.numRecords()})
+	}
+	w.chunk.addRecord(record, layout, f)
+	if w.stats != nil {
+		w.stats.addRecord(int64(len(record)))
+	}
 	return len(record), nil
 }
 
+// Flush writes the records written so far as a chunk, even if it is
+// not full.  It returns an error if Close has been called.
+func (w *Writer) Flush() error {
+	if w.Writer == nil {
+		return fmt.Errorf("Cannot flush since writer had been closed")
+	}
+
+	if e := w.flushChunk(); e != nil {
+		return e
+	}
+	return w.writePending(true)
+}
+
 // Close flushes the current chunk and makes the writer invalid.
 func (w *Writer) Close() error {
-	e := w.chunk.dump(w.Writer, w.compressor)
+	if w.Writer == nil {
+		return nil
+	}
+
+	e := w.err
+	if e == nil {
+		e = w.flushChunk()
+	}
+	if e == nil {
+		e = w.writePending(true)
+	}
+	if w.jobs != nil {
+		close(w.jobs)
+	}
+
+	if e == nil {
+		e = w.writeFileHeader()
+	}
+	if w.keyIndex {
+		w.index.keys = newKeyIndex(w.keys)
+	}
+	if w.sortedKeys {
+		w.index.keyRanges = append([]keyRange{}, w.ranges...)
+	}
+	if w.bloomBitsPerKey > 0 {
+		w.index.blooms = append([]bloomFilter{}, w.blooms...)
+	}
+	if w.stats != nil {
+		w.index.stats = w.stats.clone()
+	}
+	if e == nil && w.footerIndex {
+		if _, e = writeFooter(w.Writer, w.offset, w.index); e == nil {
+			e = w.syncWriter()
+		}
+	}
 	w.Writer = nil
+
+	if w.onClose != nil {
+		e = w.onClose(e)
+	}
 	return e
 }
+
+// Abort makes the writer invalid without writing the current chunk or
+// the footer.  Chunks already written stay in the underlying
+// io.Writer, except for a Writer of CreateAtomic, which removes its
+// file.
+func (w *Writer) Abort() error {
+	if w.Writer == nil {
+		return nil
+	}
+
+	// Wait for the compression goroutines, which share w.pending.
+	for _, job := range w.pending {
+		<-job.done
+	}
+	w.pending = nil
+	if w.jobs != nil {
+		close(w.jobs)
+	}
+	w.Writer = nil
+
+	if w.onClose != nil {
+		return w.onClose(errAborted)
+	}
+	return nil
+}
+
+// Index returns the Index of the chunks written so far, which after
+// Close describes the whole file, so that it can be handed to readers
+// or saved with Index.Save without scanning the file.  Records still
+// buffered in the current chunk are not included until Flush or Close.
+func (w *Writer) Index() *Index {
+	idx := w.index.Slice(0, w.index.NumChunks())
+	if w.keyIndex {
+		idx.keys = newKeyIndex(w.keys).slice(0, idx.NumRecords)
+	}
+	if w.sortedKeys {
+		idx.keyRanges = append([]keyRange{}, w.ranges[:idx.NumChunks()]...)
+	}
+	if w.bloomBitsPerKey > 0 {
+		idx.blooms = append([]bloomFilter{}, w.blooms[:idx.NumChunks()]...)
+	}
+	return idx
+}
+
+// checkRecordSize returns a *RecordTooLargeError if a record of size
+// bytes exceeds the limit of WithMaxRecordSize.
+func (w *Writer) checkRecordSize(size int64) error {
+	if w.maxRecord <= 0 || size <= int64(w.maxRecord) {
+		return nil
+	}
+
+	return &RecordTooLargeError{Record: w.numRecords(), Offset: -1, Size: size, Max: w.maxRecord}
+}
+
+// addBloomFilter adds the Bloom filter of the keys of the next chunk,
+// if WithBloomFilter.
+func (w *Writer) addBloomFilter(keys [][]byte) {
+	if w.bloomBitsPerKey > 0 {
+		w.blooms = append(w.blooms, newBloomFilter(keys, w.bloomBitsPerKey, w.bloomHashes))
+	}
+}
+
+// numRecords returns the number of records written so far, including
+// those not yet in the Index.
+func (w *Writer) numRecords() int {
+	n := w.index.NumRecords + len(w.chunk.records)
+	for _, job := range w.pending {
+		n += len(job.chunk.records)
+	}
+	return n
+}
+
+func (w *Writer) encoding() chunkEncoding {
+	return chunkEncoding{
+		compressor:      w.compressor,
+		level:           w.level,
+		minSaving:       w.minSaving,
+		dict:            w.dict,
+		checksum:        w.checksum,
+		rawChecksum:     w.rawChecksum,
+		recordChecksums: w.recordSums,
+		aead:            w.aead,
+		keyID:           w.keyID,
+	}
+}
+
+// writeFileHeader writes the file header, if any, unless written.
+func (w *Writer) writeFileHeader() error {
+	if w.header == nil || w.headerDone {
+		return nil
+	}
+
+	n, e := w.header.write(w.Writer)
+	if e != nil {
+		return e
+	}
+
+	w.headerDone = true
+	w.offset += int64(n)
+	return nil
+}
+
+// flushChunk dumps the current chunk, or hands it to the compression
+// goroutines, and clears it for the next Write.
+func (w *Writer) flushChunk() error {
+	// NOTE: don't check w.chunk.numBytes instead, because empty
+	// records are allowed.
+	if len(w.chunk.records) == 0 {
+		return nil
+	}
+
+	if w.sortedKeys {
+		w.ranges = append(w.ranges, w.chunk.keyRange())
+	}
+	w.addBloomFilter(w.chunk.keys)
+
+	if w.workers <= 1 {
+		hdr, data, e := w.chunk.encode(w.encoding())
+		if e != nil {
+			return e
+		}
+
+		numBytes := w.chunk.numBytes
+		w.chunk = &Chunk{}
+		return w.writeChunk(hdr, data, int64(numBytes))
+	}
+
+	if w.jobs == nil {
+		w.jobs = make(chan *chunkJob, w.workers)
+		for i := 0; i < w.workers; i++ {
+			go compressChunks(w.jobs)
+		}
+	}
+
+	job := &chunkJob{chunk: w.chunk, enc: w.encoding(), done: make(chan struct{})}
+	w.chunk = &Chunk{}
+	w.jobs <- job
+	w.pending = append(w.pending, job)
+	return w.writePending(false)
+}
+
+// writePending writes the compressed chunks at the head of
+// w.pending.  It waits for all of them if all is true, and otherwise
+// only while more than w.workers chunks are pending.
+func (w *Writer) writePending(all bool) error {
+	for len(w.pending) > 0 {
+		job := w.pending[0]
+		if all || len(w.pending) > w.workers {
+			<-job.done
+		} else {
+			select {
+			case <-job.done:
+			default:
+				return nil
+			}
+		}
+
+		w.pending = w.pending[1:]
+		if job.err != nil {
+			w.err = job.err
+			return job.err
+		}
+		if e := w.writeChunk(job.hdr, job.data, int64(job.chunk.numBytes)); e != nil {
+			w.err = e
+			return e
+		}
+	}
+	return nil
+}
+
+func compressChunks(jobs <-chan *chunkJob) {
+	for job := range jobs {
+		job.hdr, job.data, job.err = job.chunk.encode(job.enc)
+		close(job.done)
+	}
+}
+
+// writeChunk writes an encoded chunk of records of numBytes bytes.
+func (w *Writer) writeChunk(hdr *Header, data []byte, numBytes int64) error {
+	if e := w.writeFileHeader(); e != nil {
+		return e
+	}
+
+	if e := writeChunk(w.Writer, hdr, data); e != nil {
+		return e
+	}
+	return w.chunkWritten(hdr, numBytes)
+}
+
+// chunkWritten records the chunk just written at w.offset in w.index,
+// and syncs it.
+func (w *Writer) chunkWritten(hdr *Header, numBytes int64) error {
+	stats := ChunkStats{
+		Chunk:          w.index.NumChunks(),
+		Offset:         w.offset,
+		NumRecords:     int(hdr.numRecords),
+		RecordBytes:    numBytes,
+		CompressedSize: int64(hdr.compressedSize),
+	}
+
+	w.index.addChunk(w.offset, int(hdr.numRecords), hdr.checkSum)
+	if w.stats != nil {
+		w.stats.addChunk(hdr.compressor, numBytes, int64(hdr.compressedSize))
+	}
+	w.offset += hdr.size() + int64(hdr.compressedSize)
+	if e := w.syncWriter(); e != nil {
+		return e
+	}
+
+	if w.onFlush != nil {
+		w.onFlush(stats)
+	}
+	return nil
+}
+
+// syncWriter syncs the underlying io.Writer if WithSync.
+func (w *Writer) syncWriter() error {
+	if s, ok := w.Writer.(interface{ Sync() error }); ok && w.sync {
+		if e := s.Sync(); e != nil {
+			return fmt.Errorf("Failed to sync: %v", e)
+		}
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, e := c.Writer.Write(p)
+	c.n += int64(n)
+	return n, e
+}